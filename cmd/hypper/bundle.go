@@ -0,0 +1,125 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+)
+
+const bundleDesc = `
+Create bundles of charts and install from them, for sites without network
+access.
+
+A bundle is an archive containing the requested charts, all the charts of their
+shared-dependency closure, and an index.yaml of them.
+`
+
+const bundleCreateDesc = `
+Create a bundle with the given charts and their shared dependencies.
+
+The shared-dependency closure of each chart is resolved with the solver against
+the configured repositories, without taking the releases in the cluster into
+account. Then, all the charts are downloaded into the bundle archive.
+
+Optional shared dependencies are only added to the bundle when passing
+'--include-optional-deps'. In that case, they will be installed too when
+installing from the bundle.
+`
+
+const bundleInstallDesc = `
+Install the charts of a bundle, together with their shared dependencies.
+
+The bundle is registered as a temporary 'file://' repository, which is the only
+repository used. No network access is needed.
+
+Charts of the bundle that are already installed are skipped.
+`
+
+func newBundleCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle create|install",
+		Short: "create bundles of charts and install from them without network access",
+		Long:  bundleDesc,
+		Args:  require.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newBundleCreateCmd(cfg, logger),
+		newBundleInstallCmd(cfg, logger),
+	)
+
+	return cmd
+}
+
+func newBundleCreateCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
+	client := action.NewBundle(cfg)
+	var dest string
+
+	cmd := &cobra.Command{
+		Use:   "create [CHART...]",
+		Short: "create a bundle with charts and their shared dependencies",
+		Long:  bundleCreateDesc,
+		Args:  require.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if _, err := client.Create(args, dest, settings, logger); err != nil {
+				return errors.New(eyecandy.ESPrintf(settings.NoEmojis, ":x: %s", err))
+			}
+			logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":clapping_hands:Bundle saved to %s", dest))
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.StringVarP(&dest, "destination", "d", "bundle.tgz", "path of the bundle archive to create")
+	f.BoolVar(&client.IncludeOptionalDeps, "include-optional-deps", false, "add the optional shared dependencies to the bundle")
+	addChartPathOptionsFlags(f, &client.InstallClient.ChartPathOptions)
+
+	return cmd
+}
+
+func newBundleInstallCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
+	client := action.NewBundle(cfg)
+
+	cmd := &cobra.Command{
+		Use:   "install BUNDLE",
+		Short: "install the charts of a bundle",
+		Long:  bundleInstallDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// map hypper's NoCreateNamespace to Helm's CreateNamespace
+			client.InstallClient.CreateNamespace = !client.InstallClient.NoCreateNamespace
+
+			if _, err := client.Install(args[0], settings, logger); err != nil {
+				return errors.New(eyecandy.ESPrintf(settings.NoEmojis, ":x: %s", err))
+			}
+			logger.Info(eyecandy.ESPrint(settings.NoEmojis, ":clapping_hands:Done!"))
+			return nil
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&client.InstallClient.NoCreateNamespace, "no-create-namespace", false, "don't create the release namespace if not present")
+	f.BoolVar(&client.InstallClient.DryRun, "dry-run", false, "simulate an install")
+
+	return cmd
+}
@@ -0,0 +1,45 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestBundleCmd(t *testing.T) {
+	tests := []cmdTestCase{
+		{
+			name:      "bundle create, no chart specified",
+			cmd:       "bundle create",
+			golden:    "output/bundle-create-no-chart.txt",
+			wantError: true,
+		},
+		{
+			name:      "bundle install, no bundle specified",
+			cmd:       "bundle install",
+			golden:    "output/bundle-install-no-bundle.txt",
+			wantError: true,
+		},
+		{
+			name:      "bundle install, bundle doesn't exist",
+			cmd:       "bundle install testdata/non-existent-bundle.tgz",
+			golden:    "output/bundle-install-not-found.txt",
+			wantError: true,
+		},
+	}
+	runTestCmd(t, tests)
+}
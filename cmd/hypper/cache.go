@@ -0,0 +1,77 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+)
+
+const cacheDesc = `
+This command consists of multiple subcommands to interact with the local cache
+of downloaded charts.
+
+Charts from the configured repositories are downloaded once, verified against
+the digest of the repository index, and reused from the cache by install,
+upgrade, pull and shared-deps list.
+
+The cache is stored in the directory set by '--chart-cache' or
+$HYPPER_CHART_CACHE. Its maximum size in MiB is set by
+$HYPPER_CHART_CACHE_MAX_SIZE (0 means no limit); when surpassed, the least
+recently used charts are removed.
+`
+
+func newCacheCmd(logger log.Logger) *cobra.Command {
+	wInfo := logio.NewWriter(logger, log.InfoLevel)
+	cmd := &cobra.Command{
+		Use:   "cache clean",
+		Short: "manage the local cache of downloaded charts",
+		Long:  cacheDesc,
+		Args:  require.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newCacheCleanCmd(wInfo),
+	)
+
+	return cmd
+}
+
+func newCacheCleanCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clean",
+		Short: "remove all charts from the local cache",
+		Args:  require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			num, size, err := action.NewChartCache(settings).Clean()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Removed %d charts from the chart cache, %.1f MiB freed\n",
+				num, float64(size)/(1024*1024))
+			return nil
+		},
+	}
+	return cmd
+}
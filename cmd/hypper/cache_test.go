@@ -0,0 +1,55 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+func TestCacheCleanCmd(t *testing.T) {
+	cacheDir := filepath.Join(ensure.TempDir(t), "charts")
+
+	src := "testdata/testcharts/compressedchart-0.1.0.tgz"
+	digest, err := provenance.DigestFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chartcache.New(cacheDir, 0).Put(src, "http://example.com/charts",
+		"compressedchart", "0.1.0", digest); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []cmdTestCase{
+		{
+			name:   "clean a cache with charts",
+			cmd:    fmt.Sprintf("cache clean --chart-cache %s", cacheDir),
+			golden: "output/cache-clean.txt",
+		},
+		{
+			name:   "clean an empty cache",
+			cmd:    fmt.Sprintf("cache clean --chart-cache %s", cacheDir),
+			golden: "output/cache-clean-empty.txt",
+		},
+	}
+	runTestCmd(t, tests)
+}
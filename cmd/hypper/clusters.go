@@ -0,0 +1,302 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/log-go"
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/gosuri/uitable"
+	"github.com/mitchellh/copystructure"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	helmAction "helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/cli/output"
+	"helm.sh/helm/v3/pkg/release"
+
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cluster"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
+)
+
+const clustersHelp = `
+With '--kube-contexts ctx1,ctx2', or '--cluster-inventory FILE', the command
+runs on each of the clusters of those kubeconfig contexts instead, at most
+'--max-parallel' of them at once. An inventory file lists the clusters as:
+
+    clusters:
+      - name: eu-1
+        kubeContext: prod-eu-1
+      - name: us-1
+        kubeContext: prod-us-1
+        kubeconfig: /home/me/.kube/us.yaml
+
+The messages of each cluster are prefixed with its name, and the results of
+all of them are printed at the end. The command fails if it fails on any of
+the clusters. Each cluster takes the defaults of its kube context in the
+configuration file, and writes '--dump-solver-problem' to its own file, named
+after the kube context, e.g: problem-prod-eu-1.yaml.
+`
+
+// clusterOptions are the flags for running a command on several clusters.
+type clusterOptions struct {
+	kubeContexts []string
+	inventory    string
+	maxParallel  int
+}
+
+func addClusterFlags(f *pflag.FlagSet, o *clusterOptions) {
+	f.StringSliceVar(&o.kubeContexts, "kube-contexts", nil, "run on the clusters of these kubeconfig contexts, instead of the one of --kube-context")
+	f.StringVar(&o.inventory, "cluster-inventory", "", "run on the clusters listed in this inventory file, instead of the one of --kube-context")
+	f.IntVar(&o.maxParallel, "max-parallel", 4, "maximum number of clusters to run on at once, with --kube-contexts or --cluster-inventory")
+}
+
+// clusters returns the clusters to run on, or nil to run on the cluster of
+// the kube context in use.
+func (o *clusterOptions) clusters() ([]*cluster.Cluster, error) {
+	if len(o.kubeContexts) > 0 && o.inventory != "" {
+		return nil, errors.New("--kube-contexts and --cluster-inventory can't be used together")
+	}
+	if o.maxParallel < 1 {
+		return nil, errors.Errorf("--max-parallel must be at least 1, not %d", o.maxParallel)
+	}
+	if o.inventory != "" {
+		inv, err := cluster.LoadInventory(o.inventory)
+		if err != nil {
+			return nil, err
+		}
+		if len(inv.Clusters) == 0 {
+			return nil, errors.Errorf("cluster inventory (%s) has no clusters", o.inventory)
+		}
+		return inv.Clusters, nil
+	}
+	if len(o.kubeContexts) > 0 {
+		return cluster.FromKubeContexts(o.kubeContexts)
+	}
+	return nil, nil
+}
+
+// clusterConfig returns the action configuration for the cluster of
+// settings, storing releases in namespace, or in all namespaces if empty.
+var clusterConfig = func(settings *cli.EnvSettings, namespace string, logger log.Logger) (*action.Configuration, error) {
+	cfg := &action.Configuration{
+		Configuration: new(helmAction.Configuration),
+	}
+	helmDriver := os.Getenv("HELM_DRIVER")
+	if err := cfg.Init(settings.RESTClientGetter(), namespace, helmDriver, logger.Debugf); err != nil {
+		return nil, err
+	}
+	if helmDriver == "memory" {
+		loadReleasesInMemory(cfg)
+	}
+	return cfg, nil
+}
+
+// runOnClusters calls fn for each of the clusters, at most maxParallel at
+// once, with the settings, action configuration and logger of the cluster.
+// Releases are stored in all namespaces if allNamespaces is set. It returns
+// the errors in the order of the clusters, nil for those that succeeded.
+func runOnClusters(clusters []*cluster.Cluster, maxParallel int, allNamespaces bool, logger log.Logger,
+	fn func(idx int, settings *cli.EnvSettings, cfg *action.Configuration, logger log.Logger) error) []error {
+
+	return cluster.Run(clusters, maxParallel, func(idx int, c *cluster.Cluster) error {
+		clusterSettings := settings.ForKubeContext(c.KubeContext, c.KubeConfig)
+		clusterLog := clusterLogger(logger, c.Name)
+
+		namespace := clusterSettings.Namespace()
+		if allNamespaces {
+			namespace = ""
+		}
+		cfg, err := clusterConfig(clusterSettings, namespace, clusterLog)
+		if err != nil {
+			return err
+		}
+		return fn(idx, clusterSettings, cfg, clusterLog)
+	})
+}
+
+// clusterPath returns path for the cluster of kubeContext: with the kube
+// context appended to the name of the file, before its extension, so that
+// each cluster writes its own file. An empty path is left empty.
+func clusterPath(path, kubeContext string) string {
+	if path == "" {
+		return ""
+	}
+	ext := filepath.Ext(path)
+	suffix := strings.NewReplacer("/", "_", string(filepath.Separator), "_").Replace(kubeContext)
+	return strings.TrimSuffix(path, ext) + "-" + suffix + ext
+}
+
+// clusterValues returns a deep copy of the values vals for a cluster, as Helm
+// changes the values it is given when reusing the ones of the release.
+func clusterValues(vals map[string]interface{}) (map[string]interface{}, error) {
+	v, err := copystructure.Copy(vals)
+	if err != nil {
+		return nil, err
+	}
+	return v.(map[string]interface{}), nil
+}
+
+// clustersError returns an error naming the clusters that failed, if any,
+// given the errors of runOnClusters.
+func clustersError(clusters []*cluster.Cluster, errs []error) error {
+	failed := []string{}
+	for idx, err := range errs {
+		if err != nil {
+			failed = append(failed, clusters[idx].Name)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.Errorf("failed on %d of %d clusters: %s", len(failed), len(clusters), strings.Join(failed, ", "))
+}
+
+// logClusterErrors logs the errors of runOnClusters, each with the name of
+// its cluster.
+func logClusterErrors(clusters []*cluster.Cluster, errs []error, logger log.Logger) {
+	for idx, err := range errs {
+		if err != nil {
+			logger.Errorf("%s: %s", clusters[idx].Name, err)
+		}
+	}
+}
+
+// clusterLogger returns a logger for the operations on the cluster name:
+// logger with its messages prefixed by the name for text, or with a cluster
+// field for JSON.
+func clusterLogger(logger log.Logger, name string) log.Logger {
+	switch l := logger.(type) {
+	case *logjson.Logger:
+		c := *l
+		c.Fields = log.Fields{"cluster": name}
+		return &c
+	case *logcli.Logger:
+		c := *l
+		prefix := fmt.Sprintf("[%s] ", name)
+		c.TraceOut = &prefixWriter{out: l.TraceOut, prefix: prefix}
+		c.DebugOut = &prefixWriter{out: l.DebugOut, prefix: prefix}
+		c.InfoOut = &prefixWriter{out: l.InfoOut, prefix: prefix}
+		c.WarnOut = &prefixWriter{out: l.WarnOut, prefix: prefix}
+		c.ErrorOut = &prefixWriter{out: l.ErrorOut, prefix: prefix}
+		c.PanicOut = &prefixWriter{out: l.PanicOut, prefix: prefix}
+		c.FatalOut = &prefixWriter{out: l.FatalOut, prefix: prefix}
+		return &c
+	}
+	return logger
+}
+
+// prefixMu serializes the writes of all prefixWriters, so the lines of
+// clusters running in parallel don't mix.
+var prefixMu sync.Mutex
+
+// prefixWriter writes to out with prefix at the start of every line.
+type prefixWriter struct {
+	out    io.Writer
+	prefix string
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	lines := bytes.SplitAfter(p, []byte("\n"))
+	buf := new(bytes.Buffer)
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		buf.WriteString(w.prefix)
+		buf.Write(line)
+	}
+
+	prefixMu.Lock()
+	defer prefixMu.Unlock()
+	if _, err := w.out.Write(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// clusterResult is the outcome of installing or upgrading on a cluster.
+type clusterResult struct {
+	Cluster     string `json:"cluster"`
+	KubeContext string `json:"kubeContext"`
+	// Status is "succeeded" or "failed".
+	Status   string             `json:"status"`
+	Error    string             `json:"error,omitempty"`
+	Releases []installedRelease `json:"releases"`
+}
+
+// clusterResultsWriter prints the results of installing or upgrading on
+// several clusters, one per cluster.
+type clusterResultsWriter struct {
+	results []*clusterResult
+}
+
+// newClusterResultsWriter returns a clusterResultsWriter for the releases
+// installed or upgraded on each of the clusters, and the errors of each.
+func newClusterResultsWriter(clusters []*cluster.Cluster, rels [][]*release.Release, errs []error) *clusterResultsWriter {
+	w := &clusterResultsWriter{}
+	for idx, c := range clusters {
+		r := &clusterResult{
+			Cluster:     c.Name,
+			KubeContext: c.KubeContext,
+			Status:      "succeeded",
+			Releases:    []installedRelease{},
+		}
+		if err := errs[idx]; err != nil {
+			r.Status = "failed"
+			r.Error = err.Error()
+		}
+		for _, rel := range rels[idx] {
+			if rel != nil {
+				r.Releases = append(r.Releases, newInstalledRelease(rel))
+			}
+		}
+		w.results = append(w.results, r)
+	}
+	return w
+}
+
+func (w *clusterResultsWriter) WriteTable(out io.Writer) error {
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("CLUSTER", "KUBE CONTEXT", "STATUS", "RELEASES", "ERROR")
+	for _, r := range w.results {
+		names := make([]string, 0, len(r.Releases))
+		for _, rel := range r.Releases {
+			names = append(names, fmt.Sprintf("%s/%s", rel.Namespace, rel.Name))
+		}
+		table.AddRow(r.Cluster, r.KubeContext, r.Status, strings.Join(names, ", "), r.Error)
+	}
+	return output.EncodeTable(out, table)
+}
+
+func (w *clusterResultsWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, w.results)
+}
+
+func (w *clusterResultsWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, w.results)
+}
@@ -0,0 +1,399 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+	helmAction "helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+	kubefake "helm.sh/helm/v3/pkg/kube/fake"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage"
+	"helm.sh/helm/v3/pkg/storage/driver"
+
+	"github.com/rancher-sandbox/hypper/internal/test"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+)
+
+// clustersTestCase is a cmdTestCase running on several clusters, with the
+// releases of each cluster by kube context. Other kube contexts don't exist.
+type clustersTestCase struct {
+	name      string
+	cmd       string
+	golden    string
+	wantError bool
+	rels      map[string][]*release.Release
+}
+
+func runClustersTestCmd(t *testing.T, tests []clustersTestCase) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetEnv()()
+
+			stores := map[string]*storage.Storage{}
+			for kubeContext, rels := range tt.rels {
+				stores[kubeContext] = storageFixture()
+				for _, rel := range rels {
+					if err := stores[kubeContext].Create(rel); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			defer useClusterStores(stores)()
+
+			_, out, err := executeActionCommandC(storageFixture(), tt.cmd)
+			if (err != nil) != tt.wantError {
+				t.Errorf("expected error, got '%v'", err)
+			}
+			if tt.golden != "" {
+				test.AssertGoldenString(t, out, tt.golden)
+			}
+		})
+	}
+}
+
+// useClusterStores makes commands store the releases of each cluster in the
+// store of its kube context. It returns a function restoring clusterConfig.
+func useClusterStores(stores map[string]*storage.Storage) func() {
+	origClusterConfig := clusterConfig
+	clusterConfig = func(settings *cli.EnvSettings, namespace string, logger log.Logger) (*action.Configuration, error) {
+		store, ok := stores[settings.KubeContext]
+		if !ok {
+			return nil, errors.Errorf("context %q does not exist", settings.KubeContext)
+		}
+		if mem, ok := store.Driver.(*driver.Memory); ok {
+			mem.SetNamespace(namespace)
+		}
+		return &action.Configuration{
+			Configuration: &helmAction.Configuration{
+				Releases:     store,
+				KubeClient:   &kubefake.PrintingKubeClient{Out: ioutil.Discard},
+				Capabilities: chartutil.DefaultCapabilities,
+				Log:          func(format string, v ...interface{}) {},
+			},
+		}, nil
+	}
+	return func() {
+		clusterConfig = origClusterConfig
+	}
+}
+
+func TestListOnClusters(t *testing.T) {
+	chickadee := chart.Mock(&chart.MockChartOptions{Name: "chickadee", Version: "1.0.0"})
+	rels := map[string][]*release.Release{
+		"eu": {
+			release.Mock(&release.MockReleaseOptions{Name: "starlord", Namespace: "default", Chart: chickadee}),
+			release.Mock(&release.MockReleaseOptions{Name: "groot", Namespace: "default", Chart: chickadee}),
+		},
+		"us": {
+			release.Mock(&release.MockReleaseOptions{Name: "gamora", Namespace: "default", Chart: chickadee}),
+		},
+	}
+
+	tests := []clustersTestCase{
+		{
+			name:   "list on several kube contexts",
+			cmd:    "list --kube-contexts eu,us",
+			golden: "output/list-clusters.txt",
+			rels:   rels,
+		},
+		{
+			name:   "list on the clusters of an inventory",
+			cmd:    "list --cluster-inventory testdata/clusters/inventory.yaml --max-parallel 1",
+			golden: "output/list-clusters-inventory.txt",
+			rels:   rels,
+		},
+		{
+			name:   "list on several kube contexts in json",
+			cmd:    "list --kube-contexts eu,us -o json",
+			golden: "output/list-clusters-json.txt",
+			rels:   rels,
+		},
+		{
+			name:   "list short on several kube contexts",
+			cmd:    "list --kube-contexts eu,us --short",
+			golden: "output/list-clusters-short.txt",
+			rels:   rels,
+		},
+		{
+			name:      "list on a kube context that doesn't exist",
+			cmd:       "list --kube-contexts eu,ap,us",
+			golden:    "output/list-clusters-missing-context.txt",
+			wantError: true,
+			rels:      rels,
+		},
+		{
+			name:      "list on kube contexts and an inventory",
+			cmd:       "list --kube-contexts eu --cluster-inventory testdata/clusters/inventory.yaml",
+			golden:    "output/list-clusters-both-flags.txt",
+			wantError: true,
+		},
+		{
+			name:      "list on a kube context twice",
+			cmd:       "list --kube-contexts eu,eu",
+			golden:    "output/list-clusters-duplicated.txt",
+			wantError: true,
+		},
+		{
+			name:      "list with no parallelism",
+			cmd:       "list --kube-contexts eu --max-parallel 0",
+			golden:    "output/list-clusters-max-parallel.txt",
+			wantError: true,
+		},
+	}
+	runClustersTestCmd(t, tests)
+}
+
+func TestInstallOnClusters(t *testing.T) {
+	repoFlags := "--repository-config testdata/testcharts/repositories.yaml --repository-cache testdata/testcharts"
+
+	tests := []clustersTestCase{
+		{
+			name:   "install on several kube contexts",
+			cmd:    fmt.Sprintf("install testdata/testcharts/shared-deps --kube-contexts eu,us --max-parallel 1 %s", repoFlags),
+			golden: "output/install-clusters.txt",
+			rels:   map[string][]*release.Release{"eu": {}, "us": {}},
+		},
+		{
+			name:   "install on several kube contexts in parallel",
+			cmd:    fmt.Sprintf("install testdata/testcharts/shared-deps --kube-contexts eu,us,ap,af -o json %s", repoFlags),
+			golden: "output/install-clusters-json.txt",
+			rels:   map[string][]*release.Release{"eu": {}, "us": {}, "ap": {}, "af": {}},
+		},
+		{
+			name:      "install on a kube context that doesn't exist",
+			cmd:       fmt.Sprintf("install testdata/testcharts/shared-deps --kube-contexts eu,ap --max-parallel 1 %s", repoFlags),
+			golden:    "output/install-clusters-missing-context.txt",
+			wantError: true,
+			rels:      map[string][]*release.Release{"eu": {}},
+		},
+		{
+			name:      "install alternatives on several kube contexts",
+			cmd:       fmt.Sprintf("install testdata/testcharts/shared-deps --kube-contexts eu,us --show-alternatives 2 %s", repoFlags),
+			golden:    "output/install-clusters-alternatives.txt",
+			wantError: true,
+		},
+	}
+	runClustersTestCmd(t, tests)
+}
+
+func TestInstallOnClustersLogFormatJSON(t *testing.T) {
+	defer resetEnv()()
+	stores := map[string]*storage.Storage{"eu": storageFixture(), "us": storageFixture()}
+	defer useClusterStores(stores)()
+
+	_, out, err := executeActionCommandC(storageFixture(),
+		"install testdata/testcharts/shared-deps --kube-contexts eu,us --log-format json --repository-config testdata/testcharts/repositories.yaml --repository-cache testdata/testcharts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	installed := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %q is not JSON: %s", line, err)
+		}
+		if entry["event"] != "install-finished" {
+			continue
+		}
+		cluster, _ := entry["cluster"].(string)
+		release, _ := entry["release"].(string)
+		installed[cluster] = append(installed[cluster], release)
+	}
+
+	expected := map[string][]string{
+		"eu": {"my-shared-dep", "my-hypper-name"},
+		"us": {"my-shared-dep", "my-hypper-name"},
+	}
+	if !reflect.DeepEqual(expected, installed) {
+		t.Errorf("expected releases installed by cluster %v, got %v", expected, installed)
+	}
+}
+
+func TestInstallOnClustersConfig(t *testing.T) {
+	defer resetEnv()()
+	defer func() { optionaldepsmode = OptionalDepsAsk }()
+	os.Setenv("HYPPER_CONFIG", "testdata/config-clusters.yaml")
+	defer os.Unsetenv("HYPPER_CONFIG")
+	settings.ConfigFile = "testdata/config-clusters.yaml"
+
+	stores := map[string]*storage.Storage{"eu": storageFixture(), "us": storageFixture()}
+	defer useClusterStores(stores)()
+
+	dir := t.TempDir()
+	_, _, err := executeActionCommandC(storageFixture(), fmt.Sprintf(
+		"install testdata/testcharts/shared-and-optional-deps --kube-contexts eu,us --dump-solver-problem %s --repository-config testdata/testcharts/repositories.yaml --repository-cache testdata/testcharts",
+		filepath.Join(dir, "problem.yaml")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the optional deps of each cluster are the ones of its profile:
+	expected := map[string][]string{
+		"eu": {"my-hypper-name", "my-shared-dep"},
+		"us": {"empty", "my-hypper-name", "my-shared-dep"},
+	}
+	for kubeContext, store := range stores {
+		store.Driver.(*driver.Memory).SetNamespace("")
+		rels, err := store.ListReleases()
+		if err != nil {
+			t.Fatal(err)
+		}
+		names := []string{}
+		for _, rel := range rels {
+			names = append(names, rel.Name)
+		}
+		sort.Strings(names)
+		if !reflect.DeepEqual(expected[kubeContext], names) {
+			t.Errorf("expected releases %v on %s, got %v", expected[kubeContext], kubeContext, names)
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, "problem-"+kubeContext+".yaml")); err != nil {
+			t.Errorf("expected the solver problem of %s: %s", kubeContext, err)
+		}
+	}
+}
+
+func TestUpgradeOnClusters(t *testing.T) {
+	repoFlags := "--repository-config testdata/testcharts/repositories.yaml --repository-cache testdata/testcharts"
+	empty := chart.Mock(&chart.MockChartOptions{Name: "empty", Version: "0.0.1"})
+
+	tests := []clustersTestCase{
+		{
+			name:   "upgrade or install on several kube contexts",
+			cmd:    fmt.Sprintf("upgrade -i testdata/testcharts/shared-deps -n hypper --no-shared-deps --kube-contexts eu,us --max-parallel 1 %s", repoFlags),
+			golden: "output/upgrade-clusters.txt",
+			rels: map[string][]*release.Release{
+				"eu": {release.Mock(&release.MockReleaseOptions{Name: "my-hypper-name", Namespace: "hypper", Chart: empty})},
+				"us": {},
+			},
+		},
+	}
+	runClustersTestCmd(t, tests)
+}
+
+func TestDiffOnClusters(t *testing.T) {
+	repoFlags := "--repository-config testdata/sync/repositories.yaml --repository-cache testdata/sync/repository"
+
+	app := chart.Mock(&chart.MockChartOptions{Name: "app", Version: "2.0.0"})
+	app.Metadata.Annotations = map[string]string{
+		"hypper.cattle.io/namespace":           "app-ns",
+		"hypper.cattle.io/shared-dependencies": "- name: lib\n  version: \"^1.0.0\"\n",
+	}
+	lib := chart.Mock(&chart.MockChartOptions{Name: "lib", Version: "1.0.0"})
+	lib.Metadata.Annotations = map[string]string{"hypper.cattle.io/namespace": "lib-ns"}
+	rels := map[string][]*release.Release{
+		"eu": {
+			release.Mock(&release.MockReleaseOptions{Name: "app", Namespace: "app-ns", Chart: app}),
+			release.Mock(&release.MockReleaseOptions{Name: "lib", Namespace: "lib-ns", Chart: lib}),
+		},
+		"us": {
+			release.Mock(&release.MockReleaseOptions{Name: "app", Namespace: "app-ns", Chart: app}),
+		},
+	}
+
+	tests := []clustersTestCase{
+		{
+			name:      "diff on several kube contexts",
+			cmd:       fmt.Sprintf("diff --kube-contexts eu,us %s", repoFlags),
+			golden:    "output/diff-clusters.txt",
+			wantError: true,
+			rels:      rels,
+		},
+		{
+			name:      "diff on several kube contexts in json",
+			cmd:       fmt.Sprintf("diff --kube-contexts eu,us -o json %s", repoFlags),
+			golden:    "output/diff-clusters-json.txt",
+			wantError: true,
+			rels:      rels,
+		},
+		{
+			name:   "diff on several kube contexts without drift",
+			cmd:    fmt.Sprintf("diff --kube-contexts eu %s", repoFlags),
+			golden: "output/diff-clusters-no-drift.txt",
+			rels:   rels,
+		},
+	}
+	runClustersTestCmd(t, tests)
+}
+
+func TestClusterPath(t *testing.T) {
+	for _, tt := range []struct {
+		path, kubeContext, expected string
+	}{
+		{"", "eu", ""},
+		{"problem.yaml", "eu", "problem-eu.yaml"},
+		{"/tmp/problem.opb", "eu", "/tmp/problem-eu.opb"},
+		{"problem", "eu", "problem-eu"},
+		{"problem.yaml", "arn:aws:eks:eu/prod", "problem-arn:aws:eks:eu_prod.yaml"},
+	} {
+		if got := clusterPath(tt.path, tt.kubeContext); got != tt.expected {
+			t.Errorf("clusterPath(%q, %q): expected %q, got %q", tt.path, tt.kubeContext, tt.expected, got)
+		}
+	}
+}
+
+func TestInstallOnClustersValuesFromStdin(t *testing.T) {
+	defer resetEnv()()
+	stores := map[string]*storage.Storage{"eu": storageFixture(), "us": storageFixture()}
+	defer useClusterStores(stores)()
+
+	in, err := ioutil.TempFile(t.TempDir(), "values")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if _, err := in.WriteString("replicas: 3\n"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := in.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = executeActionCommandStdinC(storageFixture(), in,
+		"install testdata/testcharts/shared-deps --kube-contexts eu,us --no-shared-deps -f - --repository-config testdata/testcharts/repositories.yaml --repository-cache testdata/testcharts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// stdin is read once, with the same values for every cluster:
+	for kubeContext, store := range stores {
+		store.Driver.(*driver.Memory).SetNamespace("")
+		rel, err := store.Last("my-hypper-name")
+		if err != nil {
+			t.Fatalf("%s: %s", kubeContext, err)
+		}
+		if rel.Config["replicas"] != float64(3) {
+			t.Errorf("expected replicas 3 on %s, got %v", kubeContext, rel.Config["replicas"])
+		}
+	}
+}
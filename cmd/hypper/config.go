@@ -0,0 +1,266 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+)
+
+const configDesc = `
+This command consists of multiple subcommands to interact with the hypper
+configuration file.
+
+The configuration file is 'config.yaml' in the hypper configuration directory,
+or the file set by $HYPPER_CONFIG. It holds defaults for flags, for all kube
+contexts, and profiles overriding them for specific kube contexts. Flags and
+env vars take precedence over the configuration file.
+
+The settings are:
+
+	optionalDeps                default of '--optional-deps' [ask|all|none|best-effort]
+	noColors                    default of '--no-colors'
+	noEmojis                    default of '--no-emojis'
+	timeout                     default of '--timeout' for install and upgrade, e.g: 5m
+	solverTimeout               default of '--solver-timeout', e.g: 30s
+	allowCRDMajorUpgrade        default of '--allow-crd-major-upgrade' for upgrade
+	repositoryPriorities.<repo> priority of a repository, by name. When a chart
+	                            is in several repositories, the one with the
+	                            highest priority is used. The default is 0.
+
+Settings are set for all kube contexts, or for one with '--context':
+
+	$ hypper config set optionalDeps best-effort
+	$ hypper config set optionalDeps none --context production
+`
+
+func newConfigCmd(logger log.Logger) *cobra.Command {
+	wInfo := logio.NewWriter(logger, log.InfoLevel)
+	cmd := &cobra.Command{
+		Use:   "config get|set|list",
+		Short: "manage the hypper configuration file",
+		Long:  configDesc,
+		Args:  require.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newConfigGetCmd(wInfo),
+		newConfigSetCmd(wInfo),
+		newConfigListCmd(wInfo),
+	)
+
+	return cmd
+}
+
+func newConfigGetCmd(out io.Writer) *cobra.Command {
+	var kubeContext string
+	cmd := &cobra.Command{
+		Use:   "get KEY",
+		Short: "print the value of a setting",
+		Long: `Print the value of a setting. With '--context', print the value for the
+kube context: the one of its profile, or the default one otherwise.`,
+		Args: require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := cli.LoadConfig(settings.ConfigFile)
+			if err != nil {
+				return err
+			}
+			p := c.Profile
+			if kubeContext != "" {
+				p = c.ProfileFor(kubeContext)
+			}
+			value, err := p.Get(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Fprintln(out, value)
+			return nil
+		},
+	}
+	addConfigContextFlag(cmd.Flags(), &kubeContext)
+	return cmd
+}
+
+func newConfigSetCmd(out io.Writer) *cobra.Command {
+	var kubeContext string
+	cmd := &cobra.Command{
+		Use:   "set KEY VALUE",
+		Short: "set the value of a setting",
+		Long: `Set the value of a setting, for all kube contexts, or for the kube context
+passed with '--context'. An empty value unsets it.`,
+		Args: require.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := cli.LoadConfig(settings.ConfigFile)
+			if err != nil {
+				return err
+			}
+			if err := c.ContextProfile(kubeContext).Set(args[0], args[1]); err != nil {
+				return err
+			}
+			if err := c.WriteFile(settings.ConfigFile); err != nil {
+				return errors.Wrap(err, "cannot write the configuration file")
+			}
+			if args[1] == "" {
+				fmt.Fprintf(out, "%q has been unset\n", args[0])
+				return nil
+			}
+			fmt.Fprintf(out, "%q has been set\n", args[0])
+			return nil
+		},
+	}
+	addConfigContextFlag(cmd.Flags(), &kubeContext)
+	return cmd
+}
+
+func newConfigListCmd(out io.Writer) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "list",
+		Aliases: []string{"ls"},
+		Short:   "list the settings of all the kube contexts",
+		Args:    require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			c, err := cli.LoadConfig(settings.ConfigFile)
+			if err != nil {
+				return err
+			}
+			table := uitable.New()
+			table.AddRow("CONTEXT", "KEY", "VALUE")
+			addProfileRows(table, "*", &c.Profile)
+			for _, kubeContext := range sortedContexts(c) {
+				addProfileRows(table, kubeContext, c.Contexts[kubeContext])
+			}
+			fmt.Fprintln(out, table)
+			return nil
+		},
+	}
+	return cmd
+}
+
+func addConfigContextFlag(f *pflag.FlagSet, kubeContext *string) {
+	f.StringVar(kubeContext, "context", "", "kube context of the profile. If not set, the defaults for all kube contexts")
+}
+
+func addProfileRows(table *uitable.Table, kubeContext string, p *cli.Profile) {
+	if p == nil {
+		return
+	}
+	for _, key := range p.Keys() {
+		value, _ := p.Get(key)
+		table.AddRow(kubeContext, key, value)
+	}
+}
+
+func sortedContexts(c *cli.Config) []string {
+	contexts := []string{}
+	for kubeContext := range c.Contexts {
+		contexts = append(contexts, kubeContext)
+	}
+	sort.Strings(contexts)
+	return contexts
+}
+
+// configFlags are the flags with defaults in the configuration file, with
+// the key of their setting.
+var configFlags = []struct {
+	flag, key string
+}{
+	{"optional-deps", "optionalDeps"},
+	{"timeout", "timeout"},
+	{"allow-crd-major-upgrade", "allowCRDMajorUpgrade"},
+}
+
+// setFlagsFromConfig sets the flags of f that weren't passed to their value in
+// the configuration file for the current kube context, if any.
+func setFlagsFromConfig(f *pflag.FlagSet) error {
+	p := settings.Profile
+	for _, d := range configFlags {
+		flag := f.Lookup(d.flag)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		value, _ := p.Get(d.key)
+		if value == "" {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return errors.Wrapf(err, "invalid %q in the configuration file", d.key)
+		}
+	}
+	return nil
+}
+
+// unsetConfigFlags returns the default values of the flags of f with a
+// setting in the configuration file that weren't passed, by flag name. It is
+// taken before running on several clusters, for setClusterFlags.
+func unsetConfigFlags(f *pflag.FlagSet) map[string]string {
+	unset := map[string]string{}
+	for _, d := range configFlags {
+		flag := f.Lookup(d.flag)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		unset[d.flag] = flag.DefValue
+	}
+	return unset
+}
+
+// setClusterFlags sets the options of the flags in unset, as returned by
+// unsetConfigFlags, to their value in the profile p of a cluster, or to their
+// default if unset there. The options are the ones of a copy of the client
+// for the cluster, as the flags are bound to the client of the current kube
+// context. Options that the command doesn't have are nil.
+func setClusterFlags(unset map[string]string, p *cli.Profile, optionalDeps *action.OptionalDepsStrategy,
+	timeout *time.Duration, allowCRDMajorUpgrade *bool) error {
+
+	for _, d := range configFlags {
+		defValue, ok := unset[d.flag]
+		if !ok {
+			continue
+		}
+		value, _ := p.Get(d.key)
+		if value == "" {
+			value = defValue
+		}
+		var err error
+		switch {
+		case d.flag == "optional-deps" && optionalDeps != nil:
+			*optionalDeps, err = parseOptionalDepsStrategy(value)
+		case d.flag == "timeout" && timeout != nil:
+			*timeout, err = time.ParseDuration(value)
+		case d.flag == "allow-crd-major-upgrade" && allowCRDMajorUpgrade != nil:
+			*allowCRDMajorUpgrade, err = strconv.ParseBool(value)
+		}
+		if err != nil {
+			return errors.Wrapf(err, "invalid %q in the configuration file", d.key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	"github.com/spf13/pflag"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+)
+
+func TestConfigCmd(t *testing.T) {
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.yaml")
+
+	tests := []cmdTestCase{{
+		name:   "set a default",
+		cmd:    "config set optionalDeps best-effort",
+		golden: "output/config-set.txt",
+	}, {
+		name:   "set a setting of a kube context",
+		cmd:    "config set optionalDeps none --context production",
+		golden: "output/config-set-context.txt",
+	}, {
+		name:   "set a repository priority",
+		cmd:    "config set repositoryPriorities.stable 10",
+		golden: "output/config-set-repository-priority.txt",
+	}, {
+		name:      "set an invalid value",
+		cmd:       "config set timeout soon",
+		golden:    "output/config-set-invalid.txt",
+		wantError: true,
+	}, {
+		name:      "set an unknown key",
+		cmd:       "config set colors true",
+		golden:    "output/config-set-unknown.txt",
+		wantError: true,
+	}, {
+		name:   "get a default",
+		cmd:    "config get optionalDeps",
+		golden: "output/config-get.txt",
+	}, {
+		name:   "get a setting of a kube context",
+		cmd:    "config get optionalDeps --context production",
+		golden: "output/config-get-context.txt",
+	}, {
+		name:   "get a default for a kube context",
+		cmd:    "config get repositoryPriorities.stable --context production",
+		golden: "output/config-get-context-default.txt",
+	}, {
+		name:   "list the settings",
+		cmd:    "config list",
+		golden: "output/config-list.txt",
+	}, {
+		name:   "unset a setting",
+		cmd:    "config set optionalDeps ''",
+		golden: "output/config-unset.txt",
+	}}
+	for _, test := range tests {
+		os.Setenv("HYPPER_CONFIG", configFile)
+		settings.ConfigFile = configFile
+		runTestCmd(t, []cmdTestCase{test})
+	}
+	os.Unsetenv("HYPPER_CONFIG")
+}
+
+func TestRootCmdConfig(t *testing.T) {
+	defer resetEnv()()
+	dir := ensure.TempDir(t)
+	defer os.RemoveAll(dir)
+	configFile := filepath.Join(dir, "config.yaml")
+
+	for _, tt := range []struct {
+		name      string
+		config    string
+		args      []string
+		noEmojis  bool
+		wantError string
+	}{
+		{
+			name:     "emojis of the profile",
+			config:   "noEmojis: true\n",
+			noEmojis: true,
+		},
+		{
+			name:     "emojis of the profile, disabled for json logs",
+			config:   "noEmojis: false\n",
+			args:     []string{"--log-format", "json"},
+			noEmojis: true,
+		},
+		{
+			name:      "malformed configuration file",
+			config:    "noEmojis: maybe\n",
+			wantError: "config file (" + configFile + ") is malformed",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func(current log.Logger) { log.Current = current }(log.Current)
+			if err := ioutil.WriteFile(configFile, []byte(tt.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			settings = cli.New()
+			settings.ConfigFile = configFile
+
+			_, err := newRootCmd(new(action.Configuration), log.Current, tt.args)
+			if tt.wantError != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantError) {
+					t.Fatalf("expected error %q, got %v", tt.wantError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if settings.NoEmojis != tt.noEmojis {
+				t.Errorf("expected noEmojis %t, got %t", tt.noEmojis, settings.NoEmojis)
+			}
+		})
+	}
+}
+
+func TestInstallCmdConfig(t *testing.T) {
+	defer func() { optionaldepsmode = OptionalDepsAsk }()
+
+	repoCache := "testdata/testcharts"
+	repoConfig := repoCache + "/repositories.yaml"
+
+	tests := []cmdTestCase{{
+		name:   "install, optional deps from the configuration file",
+		cmd:    fmt.Sprintf("install testdata/testcharts/shared-and-optional-deps --repository-config %s --repository-cache %s", repoConfig, repoCache),
+		golden: "output/install-skip-all-optional-deps.txt",
+	}, {
+		name:   "install, flag over the configuration file",
+		cmd:    fmt.Sprintf("install testdata/testcharts/shared-and-optional-deps --optional-deps all --repository-config %s --repository-cache %s", repoConfig, repoCache),
+		golden: "output/install-with-all-optional-deps.txt",
+	}}
+	for _, test := range tests {
+		os.Setenv("HYPPER_CONFIG", "testdata/config.yaml")
+		settings.ConfigFile = "testdata/config.yaml"
+		runTestCmd(t, []cmdTestCase{test})
+	}
+	os.Unsetenv("HYPPER_CONFIG")
+}
+
+func TestSetClusterFlags(t *testing.T) {
+	defer func() { optionaldepsmode = OptionalDepsAsk }()
+
+	allow := true
+	profile := &cli.Profile{OptionalDeps: "all", Timeout: "10m", AllowCRDMajorUpgrade: &allow}
+
+	for _, tt := range []struct {
+		name                 string
+		args                 []string
+		profile              *cli.Profile
+		optionalDeps         action.OptionalDepsStrategy
+		timeout              time.Duration
+		allowCRDMajorUpgrade bool
+	}{
+		{
+			name:                 "profile of the cluster",
+			profile:              profile,
+			optionalDeps:         action.OptionalDepsAll,
+			timeout:              10 * time.Minute,
+			allowCRDMajorUpgrade: true,
+		},
+		{
+			name:         "defaults of the flags, for an empty profile",
+			profile:      &cli.Profile{},
+			optionalDeps: action.OptionalDepsAsk,
+			timeout:      5 * time.Minute,
+		},
+		{
+			name:                 "flags over the profile",
+			args:                 []string{"--optional-deps=none", "--timeout=1m"},
+			profile:              profile,
+			optionalDeps:         action.OptionalDepsNone,
+			timeout:              time.Minute,
+			allowCRDMajorUpgrade: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var timeout time.Duration
+			var allowCRDMajorUpgrade bool
+			f := pflag.NewFlagSet("testing", pflag.ContinueOnError)
+			addOptionalDepsFlag(f, "")
+			f.DurationVar(&timeout, "timeout", 5*time.Minute, "")
+			f.BoolVar(&allowCRDMajorUpgrade, "allow-crd-major-upgrade", false, "")
+			if err := f.Parse(tt.args); err != nil {
+				t.Fatal(err)
+			}
+			optionalDeps := optionalDepsStrategy()
+
+			if err := setClusterFlags(unsetConfigFlags(f), tt.profile, &optionalDeps, &timeout, &allowCRDMajorUpgrade); err != nil {
+				t.Fatal(err)
+			}
+			if optionalDeps != tt.optionalDeps {
+				t.Errorf("expected optional deps %v, got %v", tt.optionalDeps, optionalDeps)
+			}
+			if timeout != tt.timeout {
+				t.Errorf("expected timeout %s, got %s", tt.timeout, timeout)
+			}
+			if allowCRDMajorUpgrade != tt.allowCRDMajorUpgrade {
+				t.Errorf("expected allowCRDMajorUpgrade %t, got %t", tt.allowCRDMajorUpgrade, allowCRDMajorUpgrade)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"helm.sh/helm/v3/pkg/cli/output"
+)
+
+const debugDesc = `
+This command consists of multiple subcommands to debug hypper.
+`
+
+const debugSolveDesc = `
+Solve again a solver problem dumped by install or upgrade with
+'--dump-solver-problem', and print the outcome.
+
+The problem contains the packages known when it was dumped, from the releases,
+the repositories and the wanted chart, so it is solved offline, with the same
+strategy and options, without access to the cluster nor the repositories.
+
+Only problems dumped as YAML can be solved again; the OPB format is meant for
+other pseudo-boolean solvers.
+`
+
+func newDebugCmd(logger log.Logger) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "debug solve",
+		Short: "debug hypper",
+		Long:  debugDesc,
+		Args:  require.NoArgs,
+	}
+
+	cmd.AddCommand(
+		newDebugSolveCmd(logger),
+	)
+
+	return cmd
+}
+
+func newDebugSolveCmd(logger log.Logger) *cobra.Command {
+	client := action.NewDebugSolve()
+	var outfmt output.Format
+
+	cmd := &cobra.Command{
+		Use:   "solve [FILE]",
+		Short: "solve a dumped solver problem again",
+		Long:  debugSolveDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			s, err := client.Run(args[0], logger)
+			if err != nil {
+				return err
+			}
+			wInfo := logio.NewWriter(logger, log.InfoLevel)
+			return outfmt.Write(wInfo, &debugSolveWriter{s})
+		},
+	}
+
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
+
+type debugSolveWriter struct {
+	s *solver.Solver
+}
+
+func (d *debugSolveWriter) WriteTable(out io.Writer) error {
+	_, err := io.WriteString(out, d.s.FormatOutput(solver.Table))
+	return err
+}
+
+func (d *debugSolveWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, d.s.PkgResultSet)
+}
+
+func (d *debugSolveWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, d.s.PkgResultSet)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDebugSolveCmd(t *testing.T) {
+	repoCache := "testdata/testcharts"
+	repoConfig := repoCache + "/repositories.yaml"
+
+	dir, err := ioutil.TempDir("", "hypper-debug-solve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	problem := filepath.Join(dir, "problem.yaml")
+
+	// dump the problem of a dry-run install, to solve it again:
+	_, out, err := executeActionCommandC(storageFixture(),
+		fmt.Sprintf("install testdata/testcharts/shared-and-optional-deps --optional-deps best-effort --dry-run --dump-solver-problem %s --repository-config %s --repository-cache %s",
+			problem, repoConfig, repoCache))
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+
+	// dump it also as OPB, for other solvers:
+	problemOPB := filepath.Join(dir, "problem.opb")
+	_, out, err = executeActionCommandC(storageFixture(),
+		fmt.Sprintf("install testdata/testcharts/shared-and-optional-deps --optional-deps best-effort --dry-run --dump-solver-problem %s --repository-config %s --repository-cache %s",
+			problemOPB, repoConfig, repoCache))
+	if err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	b, err := ioutil.ReadFile(problemOPB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(b), "* #variable= ") {
+		t.Errorf("expected an OPB problem, got:\n%s", b)
+	}
+
+	tests := []cmdTestCase{
+		{
+			name:   "solve dumped problem",
+			cmd:    fmt.Sprintf("debug solve %s", problem),
+			golden: "output/debug-solve.txt",
+		},
+		{
+			name:      "solve OPB problem",
+			cmd:       "debug solve problem.opb",
+			golden:    "output/debug-solve-opb.txt",
+			wantError: true,
+		},
+		{
+			name:      "solve without problem",
+			cmd:       "debug solve",
+			golden:    "output/debug-solve-no-args.txt",
+			wantError: true,
+		},
+	}
+	runTestCmd(t, tests)
+}
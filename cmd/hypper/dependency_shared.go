@@ -74,6 +74,10 @@ const sharedDependencyListDesc = `
 List all of the shared dependencies declared in a chart, showing their statuses,
 and type (shared, shared-optional)
 
+Optional shared dependencies that were declined when installing are shown as
+'declined'. With '--optional-deps none', optional shared dependencies are not
+listed.
+
 This can take chart archives and chart directories as input. It will not alter
 the contents of a chart.
 
@@ -105,9 +109,14 @@ func newSharedDependencyListCmd(cfg *action.Configuration, logger log.Logger) *c
 		Long:    sharedDependencyListDesc,
 		Args:    require.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setFlagsFromConfig(cmd.Flags()); err != nil {
+				return err
+			}
+			client.OptionalDeps = optionalDepsStrategy()
 			return runList(args, client, logger)
 		},
 	}
+	addOptionalDepsFlag(cmd.Flags(), "list optional shared dependencies unless 'none' [ask|all|none|best-effort]")
 	return cmd
 }
 
@@ -0,0 +1,190 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cluster"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"helm.sh/helm/v3/pkg/cli/output"
+)
+
+const diffDesc = `
+Compare the deployed releases with the shared dependencies declared by their
+charts, and list the drift:
+
+- missing-dependency: a shared dependency is not installed.
+- out-of-range: a shared dependency is installed, but its version is outside
+  of the semver range of a dependent release.
+- wrong-namespace: a release is installed in another namespace than the one in
+  its 'hypper.cattle.io/namespace' chart annotation.
+- optional-not-installed: an optional dependency is not installed. This is
+  informational, and doesn't count as drift.
+
+The release name and namespace of a dependency are taken from the annotations
+of its chart in the cached repository indexes, or in its releases.
+
+With '--namespace', only the releases in that namespace are compared.
+
+The command fails if any drift is found.
+`
+
+func newDiffCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
+	client := action.NewDiff(cfg)
+	var outfmt output.Format
+	clusterOpts := &clusterOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "list the drift between the releases and their declared shared dependencies",
+		Long:  diffDesc + clustersHelp,
+		Args:  require.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			clusters, err := clusterOpts.clusters()
+			if err != nil {
+				return err
+			}
+
+			var writer *diffWriter
+			var clustersErr error
+			if clusters != nil {
+				writer, clustersErr = diffOnClusters(clusters, clusterOpts.maxParallel, logger)
+			} else {
+				drifts, err := client.Run(settings, logger)
+				if err != nil {
+					return err
+				}
+				writer = &diffWriter{drifts: drifts}
+			}
+
+			wInfo := logio.NewWriter(logger, log.InfoLevel)
+			if err := outfmt.Write(wInfo, writer); err != nil {
+				return err
+			}
+			if clustersErr != nil {
+				return clustersErr
+			}
+
+			n := 0
+			for _, d := range writer.drifts {
+				if d.Kind != action.DriftOptionalNotInstalled {
+					n++
+				}
+			}
+			if n != 0 {
+				return errors.Errorf("%d drifts found", n)
+			}
+			return nil
+		},
+	}
+
+	addClusterFlags(cmd.Flags(), clusterOpts)
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
+
+// diffOnClusters lists the drift of each of the clusters, at most
+// maxParallel at once. The errors of each cluster are logged, and the drift
+// of the others listed.
+func diffOnClusters(clusters []*cluster.Cluster, maxParallel int, logger log.Logger) (*diffWriter, error) {
+	drifts := make([][]*action.Drift, len(clusters))
+	errs := runOnClusters(clusters, maxParallel, false, logger,
+		func(idx int, settings *cli.EnvSettings, cfg *action.Configuration, logger log.Logger) error {
+			var err error
+			drifts[idx], err = action.NewDiff(cfg).Run(settings, logger)
+			return err
+		})
+	logClusterErrors(clusters, errs, logger)
+
+	writer := &diffWriter{drifts: []*action.Drift{}, clusters: []string{}}
+	for idx := range drifts {
+		for _, drift := range drifts[idx] {
+			writer.drifts = append(writer.drifts, drift)
+			writer.clusters = append(writer.clusters, clusters[idx].Name)
+		}
+	}
+	return writer, clustersError(clusters, errs)
+}
+
+type diffWriter struct {
+	drifts []*action.Drift
+	// clusters are the clusters of each of the drifts, when diffing several
+	// clusters.
+	clusters []string
+}
+
+// clusterDrift is a drift of one of several clusters.
+type clusterDrift struct {
+	Cluster string `json:"cluster"`
+	*action.Drift
+}
+
+func (d *diffWriter) WriteTable(out io.Writer) error {
+	if len(d.drifts) == 0 {
+		_, err := fmt.Fprintln(out, eyecandy.ESPrint(settings.NoEmojis,
+			":check_mark_button: Releases match their declared shared dependencies"))
+		return err
+	}
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	if d.clusters != nil {
+		table.AddRow("CLUSTER", "KIND", "RELEASE", "NAMESPACE", "DETAILS")
+		for idx, drift := range d.drifts {
+			table.AddRow(d.clusters[idx], drift.Kind, drift.Release, drift.Namespace, drift.Message)
+		}
+		return output.EncodeTable(out, table)
+	}
+	table.AddRow("KIND", "RELEASE", "NAMESPACE", "DETAILS")
+	for _, drift := range d.drifts {
+		table.AddRow(drift.Kind, drift.Release, drift.Namespace, drift.Message)
+	}
+	return output.EncodeTable(out, table)
+}
+
+func (d *diffWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, d.document())
+}
+
+func (d *diffWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, d.document())
+}
+
+// document returns the drifts to print as JSON or YAML, each with its cluster
+// when diffing several clusters.
+func (d *diffWriter) document() interface{} {
+	if d.clusters == nil {
+		return d.drifts
+	}
+	drifts := make([]clusterDrift, 0, len(d.drifts))
+	for idx, drift := range d.drifts {
+		drifts = append(drifts, clusterDrift{Cluster: d.clusters[idx], Drift: drift})
+	}
+	return drifts
+}
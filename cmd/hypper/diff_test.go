@@ -0,0 +1,66 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestDiffCmd(t *testing.T) {
+	repoFlags := "--repository-config testdata/sync/repositories.yaml --repository-cache testdata/sync/repository"
+
+	app := chart.Mock(&chart.MockChartOptions{Name: "app", Version: "2.0.0"})
+	app.Metadata.Annotations = map[string]string{
+		"hypper.cattle.io/namespace":           "app-ns",
+		"hypper.cattle.io/shared-dependencies": "- name: lib\n  version: \"^1.0.0\"\n",
+	}
+	lib := chart.Mock(&chart.MockChartOptions{Name: "lib", Version: "2.0.0"})
+	lib.Metadata.Annotations = map[string]string{"hypper.cattle.io/namespace": "lib-ns"}
+
+	tests := []cmdTestCase{
+		{
+			name:   "diff without drift",
+			cmd:    fmt.Sprintf("diff %s", repoFlags),
+			golden: "output/diff-no-drift.txt",
+		},
+		{
+			name:      "diff with drift",
+			cmd:       fmt.Sprintf("diff %s", repoFlags),
+			golden:    "output/diff.txt",
+			wantError: true,
+			rels: []*release.Release{
+				release.Mock(&release.MockReleaseOptions{Name: "app", Namespace: "app-ns", Chart: app}),
+				release.Mock(&release.MockReleaseOptions{Name: "lib", Namespace: "lib-ns", Chart: lib}),
+			},
+		},
+		{
+			name:      "diff with drift in json",
+			cmd:       fmt.Sprintf("diff %s -o json", repoFlags),
+			golden:    "output/diff-json.txt",
+			wantError: true,
+			rels: []*release.Release{
+				release.Mock(&release.MockReleaseOptions{Name: "app", Namespace: "app-ns", Chart: app}),
+				release.Mock(&release.MockReleaseOptions{Name: "lib", Namespace: "lib-ns", Chart: lib}),
+			},
+		},
+	}
+	runTestCmd(t, tests)
+}
@@ -0,0 +1,80 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/spf13/cobra"
+	"sigs.k8s.io/yaml"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+)
+
+const exportDesc = `
+Export the releases of the cluster into a Hypperfile.
+
+All the releases of all namespaces are exported, each with its exact chart
+version and chart digest, release name, namespace, and user-supplied values.
+Releases installed as shared dependencies of other releases are marked with
+'auto: true'. The repositories of the charts are exported too.
+
+Running 'hypper sync' with the exported Hypperfile on another cluster, with the
+same repositories added, recreates the same releases. This is useful for
+cloning environments and for disaster recovery.
+
+The Hypperfile is printed, or saved to FILE if passed. Note that values may
+contain secrets.
+`
+
+func newExportCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
+	client := action.NewExport(cfg)
+
+	cmd := &cobra.Command{
+		Use:   "export [FILE]",
+		Short: "export the releases of the cluster into a Hypperfile",
+		Long:  exportDesc,
+		Args:  require.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			hf, err := client.Run(settings, logger)
+			if err != nil {
+				return err
+			}
+			b, err := yaml.Marshal(hf)
+			if err != nil {
+				return err
+			}
+
+			if len(args) == 0 {
+				wInfo := logio.NewWriter(logger, log.InfoLevel)
+				_, err := wInfo.Write(b)
+				return err
+			}
+			if err := ioutil.WriteFile(args[0], b, 0600); err != nil {
+				return err
+			}
+			logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":clapping_hands:Exported %d releases to %s", len(hf.Releases), args[0]))
+			return nil
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,51 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestExportCmd(t *testing.T) {
+	repoFlags := "--repository-config testdata/sync/repositories.yaml --repository-cache testdata/sync/repository"
+
+	tests := []cmdTestCase{
+		{
+			name:   "export releases",
+			cmd:    fmt.Sprintf("export %s", repoFlags),
+			golden: "output/export.txt",
+			rels: []*release.Release{
+				release.Mock(&release.MockReleaseOptions{
+					Name:      "lib",
+					Namespace: "lib-ns",
+					Chart:     chart.Mock(&chart.MockChartOptions{Name: "lib", Version: "1.0.0"}),
+				}),
+			},
+		},
+		{
+			name:      "export with too many arguments",
+			cmd:       "export a b",
+			golden:    "output/export-too-many-args.txt",
+			wantError: true,
+		},
+	}
+	runTestCmd(t, tests)
+}
@@ -56,7 +56,7 @@ func main() {
 	}
 
 	if err != nil {
-		logger.Error(err)
+		log.Current.Error(err)
 		os.Exit(1)
 	}
 
@@ -71,7 +71,10 @@ func main() {
 	})
 
 	if err := cmd.Execute(); err != nil {
-		logger.Error(err)
+		log.Current.Error(err)
+		if perr, ok := err.(pluginError); ok {
+			os.Exit(perr.code)
+		}
 		os.Exit(1)
 	}
 }
@@ -17,8 +17,11 @@ limitations under the License.
 package main
 
 import (
+	"os"
 	"strings"
+	"time"
 
+	"github.com/jinzhu/copier"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
@@ -34,8 +37,11 @@ import (
 	logio "github.com/Masterminds/log-go/io"
 	"github.com/rancher-sandbox/hypper/internal/solver"
 	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cluster"
 	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
 	"github.com/thediveo/enumflag"
+	"golang.org/x/term"
 )
 
 type OptionalDepsMode enumflag.Flag
@@ -45,13 +51,15 @@ const (
 	OptionalDepsAsk OptionalDepsMode = iota
 	OptionalDepsAll
 	OptionalDepsNone
+	OptionalDepsBestEffort
 )
 
 // map enum values of --optional-deps flag to string representation
 var OptionalDepsModeIds = map[OptionalDepsMode][]string{
-	OptionalDepsAsk:  {"ask"},
-	OptionalDepsAll:  {"all"},
-	OptionalDepsNone: {"none"},
+	OptionalDepsAsk:        {"ask"},
+	OptionalDepsAll:        {"all"},
+	OptionalDepsNone:       {"none"},
+	OptionalDepsBestEffort: {"best-effort"},
 }
 
 var optionaldepsmode = OptionalDepsAsk
@@ -69,52 +77,181 @@ where the chart will be installed. By priority order:
 2. By using hypper.cattle.io annotations in the Chart.yaml
 3. By using catalog.cattle.io annotations in the Chart.yaml
 4. By using the chart name from the Chart.yaml if nothing else is specified
+
+Optional shared dependencies, of the chart and of its shared dependencies, are
+installed following '--optional-deps': 'ask' for each of them (default), 'all'
+or 'none'. With 'best-effort', the solver installs as many of them as possible
+without making the installation impossible. Optional dependencies declined when
+asked are remembered, and not asked for again.
+
+Before installing, when reading from a terminal, a summary of the solution is
+printed: the releases to install, upgrade and remove, with their versions,
+namespaces and repositories, and the optional shared dependencies to install.
+Answering with the number of an optional dependency toggles it and solves again,
+instead of asking for each of them. Pass '--yes' to install without the
+summary.
+
+If the --verify flag is specified, the provenance of the chart and of all the
+shared dependencies to be installed is verified before installing anything.
+Shared dependencies from repositories must have a valid provenance file. Local
+'file://' shared dependencies are verified when they are packaged charts with
+a provenance file next to them.
+
+With '--show-alternatives N', nothing is installed. Instead, up to N different
+solutions are printed, from best to worst, with their cost: the charts to
+install, and the releases reused as shared dependencies. The lower the cost, the
+better the solution.
+
+Once installed, the status of every release created is printed, shared
+dependencies first, with the notes of its chart. With '--output json' or
+'--output yaml', the result is printed as a document instead: the status of the
+solver and its inconsistencies if any, the tree of charts to install, and the
+name, namespace, revision, status and notes of each release installed. The
+progress messages are only printed with '--debug'. With '--dry-run', the same
+document is printed for the simulated install.
+
+With '--dump-solver-problem FILE', the problem given to the solver is written to
+FILE: as OPB if FILE has the '.opb' extension, for comparing against other
+pseudo-boolean solvers, or as YAML otherwise. YAML problems can be solved again
+offline with 'hypper debug solve FILE', which helps reproducing wrong
+resolutions without access to the cluster nor the repositories.
 `
 
 func newInstallCmd(actionConfig *action.Configuration, logger log.Logger) *cobra.Command {
 	client := action.NewInstall(actionConfig)
 	valueOpts := &values.Options{}
 	var outfmt output.Format
+	var yes bool
+	clusterOpts := &clusterOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "install [NAME] [CHART]",
 		Short: "install a chart",
-		Long:  installDesc,
+		Long:  installDesc + clustersHelp,
 		Args:  require.MinimumNArgs(1),
-		RunE: func(_ *cobra.Command, args []string) error {
-			// TODO decide how to use returned rel:
-			_, err := runInstall(solver.InstallOne, args, client, valueOpts, logger)
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := setFlagsFromConfig(cmd.Flags()); err != nil {
+				return err
+			}
+			client.OptionalDeps = optionalDepsStrategy()
+			clusters, err := clusterOpts.clusters()
 			if err != nil {
-				// Capturing a specific error message, when a chart in a repo
-				// was called for but the repo was never added. Adding more
-				// context for the user.
-				if strings.HasPrefix(err.Error(), "unable to load dependency") {
-					logger.Info("Please add any missing repositories, if necessary")
+				return err
+			}
+			if clusters != nil {
+				if client.ShowAlternatives > 0 {
+					return errors.New("--show-alternatives can't be used on several clusters")
 				}
-				err = errors.New(eyecandy.ESPrintf(settings.NoEmojis, ":x: %s", err))
+				return installOnClusters(args, client, valueOpts, outfmt, cmd.Flags(), clusters, clusterOpts.maxParallel, logger)
+			}
+			client.Review = reviewBeforeInstall(yes, outfmt)
+			vals, err := valueOpts.MergeValues(getter.All(settings.EnvSettings))
+			if err != nil {
 				return err
 			}
-			logger.Info(eyecandy.ESPrint(settings.NoEmojis, ":clapping_hands:Done!"))
-			return nil
+			if client.ShowAlternatives > 0 {
+				_, err := runInstall(solver.InstallOne, args, client, vals, settings, logger)
+				return installError(err, logger)
+			}
+
+			wInfo := logio.NewWriter(logger, log.InfoLevel)
+			rels, err := runInstall(solver.InstallOne, args, client, vals, settings, outputLogger(logger, outfmt))
+			if err != nil {
+				if outfmt != output.Table {
+					writeSolvedReleases(wInfo, outfmt, client.DryRun, client.PkgResultSet, rels)
+					return err
+				}
+				return installError(err, logger)
+			}
+			if outfmt == output.Table {
+				logger.Info(eyecandy.ESPrint(settings.NoEmojis, ":clapping_hands:Done!"))
+			}
+			return outfmt.Write(wInfo, newReleasesPrinter(client.DryRun, client.PkgResultSet, rels))
 		},
 	}
 	f := cmd.Flags()
 	addInstallFlags(cmd, f, client, valueOpts)
+	f.BoolVarP(&yes, "yes", "y", false, "install without reviewing the summary of the solution first")
+	f.IntVar(&client.ShowAlternatives, "show-alternatives", 0, "print up to N alternative solutions with their cost, without installing")
+	f.StringVar(&client.DumpSolverProblem, "dump-solver-problem", "", "write the solver problem to a file, as OPB if it has the .opb extension, or as YAML")
 	addValueOptionsFlags(f, valueOpts)
 	addChartPathOptionsFlags(f, &client.ChartPathOptions)
+	addClusterFlags(f, clusterOpts)
 	bindOutputFlag(cmd, &outfmt)
 	return cmd
 }
 
+// installError returns err of an install ready for printing, if any.
+func installError(err error, logger log.Logger) error {
+	if err == nil {
+		return nil
+	}
+	// Capturing a specific error message, when a chart in a repo
+	// was called for but the repo was never added. Adding more
+	// context for the user.
+	if strings.HasPrefix(err.Error(), "unable to load dependency") {
+		logger.Info("Please add any missing repositories, if necessary")
+	}
+	return errors.New(eyecandy.ESPrintf(settings.NoEmojis, ":x: %s", err))
+}
+
+// reviewBeforeInstall returns true if the solution is to be reviewed before
+// installing: when printing tables and reading from a terminal, unless yes is
+// set.
+func reviewBeforeInstall(yes bool, outfmt output.Format) bool {
+	return !yes && outfmt == output.Table && term.IsTerminal(int(os.Stdin.Fd()))
+}
+
 func addInstallFlags(cmd *cobra.Command, f *pflag.FlagSet, client *action.Install, valueOpts *values.Options) {
 	f.BoolVar(&client.NoCreateNamespace, "no-create-namespace", false, "don't create the release namespace if not present")
 	f.BoolVar(&client.NoSharedDeps, "no-shared-deps", false, "skip installation of shared dependencies")
-	f.Var(enumflag.New(&optionaldepsmode, "option", OptionalDepsModeIds, enumflag.EnumCaseInsensitive),
-		"optional-deps", "install optional shared dependencies [ask|all|none]")
+	addOptionalDepsFlag(f, "install optional shared dependencies, also of the shared dependencies [ask|all|none|best-effort]")
 	f.BoolVar(&client.DryRun, "dry-run", false, "simulate an install")
+	f.BoolVar(&client.Devel, "devel", false, "use development versions, also for shared dependencies. Equivalent to version '>0.0.0-0'. If --version is set, this is ignored")
+	f.DurationVar(&client.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
+}
+
+func addOptionalDepsFlag(f *pflag.FlagSet, usage string) {
+	f.Var(enumflag.New(&optionaldepsmode, "option", OptionalDepsModeIds, enumflag.EnumCaseInsensitive),
+		"optional-deps", usage)
+}
+
+// optionalDepsStrategy maps the --optional-deps flag to an action.OptionalDeps
+// strategy
+func optionalDepsStrategy() action.OptionalDepsStrategy {
+	return optionalDepsStrategyOf(optionaldepsmode)
 }
 
-func runInstall(strategy solver.SolverStrategy, args []string, client *action.Install, valueOpts *values.Options, logger log.Logger) ([]*release.Release, error) {
+// parseOptionalDepsStrategy maps a value of the --optional-deps flag to an
+// action.OptionalDeps strategy.
+func parseOptionalDepsStrategy(value string) (action.OptionalDepsStrategy, error) {
+	for mode, ids := range OptionalDepsModeIds {
+		for _, id := range ids {
+			if strings.EqualFold(id, value) {
+				return optionalDepsStrategyOf(mode), nil
+			}
+		}
+	}
+	return action.OptionalDepsAsk, errors.Errorf("invalid value %q for --optional-deps", value)
+}
+
+func optionalDepsStrategyOf(mode OptionalDepsMode) action.OptionalDepsStrategy {
+	switch mode {
+	case OptionalDepsAll:
+		return action.OptionalDepsAll
+	case OptionalDepsNone:
+		return action.OptionalDepsNone
+	case OptionalDepsBestEffort:
+		return action.OptionalDepsBestEffort
+	default:
+		return action.OptionalDepsAsk
+	}
+}
+
+// runInstall installs the chart in args with client and the values vals, on
+// the cluster of settings.
+func runInstall(strategy solver.SolverStrategy, args []string, client *action.Install, vals map[string]interface{},
+	settings *cli.EnvSettings, logger log.Logger) ([]*release.Release, error) {
 
 	// Get an io.Writer compliant logger instance at the info level.
 	wInfo := logio.NewWriter(logger, log.InfoLevel)
@@ -125,16 +262,6 @@ func runInstall(strategy solver.SolverStrategy, args []string, client *action.In
 		client.Version = ">0.0.0-0"
 	}
 
-	// map flag to action.OptionalDeps strategy
-	switch optionaldepsmode {
-	case OptionalDepsAsk:
-		client.OptionalDeps = action.OptionalDepsAsk
-	case OptionalDepsAll:
-		client.OptionalDeps = action.OptionalDepsAll
-	case OptionalDepsNone:
-		client.OptionalDeps = action.OptionalDepsNone
-	}
-
 	// map hypper's NoCreateNamespace to Helm's CreateNamespace
 	client.CreateNamespace = !client.NoCreateNamespace
 
@@ -143,18 +270,16 @@ func runInstall(strategy solver.SolverStrategy, args []string, client *action.In
 		return nil, err
 	}
 
-	chartPath, err := client.ChartPathOptions.LocateChart(chartName, settings.EnvSettings)
+	chartPath, err := action.LocateChart(&client.ChartPathOptions, chartName, settings, logger)
 	if err != nil {
 		return nil, err
 	}
+	// the policy checks the wanted chart by the URL of its repository:
+	client.ChartPathOptions.RepoURL = action.ChartRepoURL(&client.ChartPathOptions, chartName, settings)
 
 	logger.Debugf("CHART PATH: %s\n", chartPath)
 
 	p := getter.All(settings.EnvSettings)
-	vals, err := valueOpts.MergeValues(p)
-	if err != nil {
-		return nil, err
-	}
 
 	// Check chart dependencies to make sure all are present in /charts
 	chartRequested, err := loader.Load(chartPath)
@@ -212,3 +337,53 @@ func runInstall(strategy solver.SolverStrategy, args []string, client *action.In
 
 	return client.Run(solver.InstallOne, chartRequested, chartPath, vals, settings, logger)
 }
+
+// installOnClusters installs the chart in args on each of the clusters, at
+// most maxParallel at once, with a copy of client for each. Nothing is asked:
+// the solution isn't reviewed, and optional shared dependencies are installed
+// unless declined before. It prints the result of every cluster.
+//
+// The values are merged once for all the clusters, as they may be read from
+// stdin, and each cluster gets its own copy of them.
+func installOnClusters(args []string, client *action.Install, valueOpts *values.Options, outfmt output.Format,
+	f *pflag.FlagSet, clusters []*cluster.Cluster, maxParallel int, logger log.Logger) error {
+
+	vals, err := valueOpts.MergeValues(getter.All(settings.EnvSettings))
+	if err != nil {
+		return err
+	}
+	unset := unsetConfigFlags(f)
+
+	rels := make([][]*release.Release, len(clusters))
+	errs := runOnClusters(clusters, maxParallel, false, logger,
+		func(idx int, settings *cli.EnvSettings, cfg *action.Configuration, logger log.Logger) error {
+			// copy Helm's client on its own, copying it embedded changes
+			// its configuration:
+			helmClient := action.NewInstall(cfg).Install
+			if err := copier.Copy(helmClient, client.Install); err != nil {
+				return err
+			}
+			clusterClient := *client
+			clusterClient.Install = helmClient
+			clusterClient.Config = cfg
+			clusterClient.Review = false
+			clusterClient.Unattended = true
+			clusterClient.DumpSolverProblem = clusterPath(client.DumpSolverProblem, settings.KubeContext)
+			if err := setClusterFlags(unset, &settings.Profile, &clusterClient.OptionalDeps, &clusterClient.Timeout, nil); err != nil {
+				return err
+			}
+			clusterVals, err := clusterValues(vals)
+			if err != nil {
+				return err
+			}
+
+			rels[idx], err = runInstall(solver.InstallOne, args, &clusterClient, clusterVals, settings, outputLogger(logger, outfmt))
+			return err
+		})
+
+	wInfo := logio.NewWriter(logger, log.InfoLevel)
+	if err := outfmt.Write(wInfo, newClusterResultsWriter(clusters, rels, errs)); err != nil {
+		return err
+	}
+	return clustersError(clusters, errs)
+}
@@ -17,8 +17,14 @@ limitations under the License.
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"helm.sh/helm/v3/pkg/repo/repotest"
 )
 
 func TestInstallCmd(t *testing.T) {
@@ -98,6 +104,20 @@ func TestInstallCmd(t *testing.T) {
 			golden: "output/install-skip-all-optional-deps.txt",
 		},
 
+		// Install, best-effort optional shared deps
+		{
+			name:   "install, best-effort optional shared deps",
+			cmd:    fmt.Sprintf("install testdata/testcharts/shared-and-optional-deps --optional-deps best-effort --repository-config %s --repository-cache %s", repoConfig, repoCache),
+			golden: "output/install-best-effort-optional-deps.txt",
+		},
+
+		// Install, show alternatives
+		{
+			name:   "install, show alternatives",
+			cmd:    fmt.Sprintf("install testdata/testcharts/shared-and-optional-deps --optional-deps best-effort --show-alternatives 3 --repository-config %s --repository-cache %s", repoConfig, repoCache),
+			golden: "output/install-show-alternatives.txt",
+		},
+
 		// Install, ask for optional shared deps (default), tested in pkg/action/install_test.go
 
 		// Install, incorrect flag value for optional shared deps
@@ -114,6 +134,201 @@ func TestInstallCmd(t *testing.T) {
 			cmd:    fmt.Sprintf("install testdata/testcharts/shared-and-optional-deps --optional-deps all --dry-run --repository-config %s --repository-cache %s", repoConfig, repoCache),
 			golden: "output/install-dry-run-with-all-optional-deps.txt",
 		},
+
+		// Install, output as json
+		{
+			name:   "install, output as json",
+			cmd:    fmt.Sprintf("install testdata/testcharts/shared-and-optional-deps --optional-deps all -o json --repository-config %s --repository-cache %s", repoConfig, repoCache),
+			golden: "output/install-output-json.txt",
+		},
+		// Install, output as yaml
+		{
+			name:   "install, output as yaml",
+			cmd:    fmt.Sprintf("install testdata/testcharts/shared-deps -o yaml --repository-config %s --repository-cache %s", repoConfig, repoCache),
+			golden: "output/install-output-yaml.txt",
+		},
+		// dry-run, output as yaml
+		{
+			name:   "install dry-run, output as yaml",
+			cmd:    fmt.Sprintf("install testdata/testcharts/shared-deps --dry-run -o yaml --repository-config %s --repository-cache %s", repoConfig, repoCache),
+			golden: "output/install-dry-run-output-yaml.txt",
+		},
+		// Install, output as json, unsatisfiable
+		{
+			name:      "install, output as json, with shared deps out-of-range",
+			cmd:       fmt.Sprintf("install testdata/testcharts/shared-deps-out-of-range -o json --repository-config %s --repository-cache %s", repoConfig, repoCache),
+			golden:    "output/install-output-json-unsat.txt",
+			wantError: true,
+		},
 	}
 	runTestActionCmd(t, tests)
 }
+
+func TestInstallCmdPluginHooks(t *testing.T) {
+
+	repoCache := "testdata/testcharts"
+
+	repoConfig := repoCache + "/repositories.yaml"
+
+	tests := []cmdTestCase{
+		{
+			name:   "install, with hooks",
+			cmd:    fmt.Sprintf("install testdata/testcharts/hypper-annot --no-shared-deps --repository-config %s --repository-cache %s", repoConfig, repoCache),
+			golden: "output/install-plugin-hooks.txt",
+		},
+		{
+			name:      "install, with a failing hook",
+			cmd:       fmt.Sprintf("install testdata/testcharts/shared-deps --repository-config %s --repository-cache %s", repoConfig, repoCache),
+			golden:    "output/install-plugin-hooks-failing.txt",
+			wantError: true,
+		},
+	}
+	for _, test := range tests {
+		settings.PluginsDirectory = "testdata/hookplugins"
+		runTestCmd(t, []cmdTestCase{test})
+	}
+}
+
+func TestInstallCmdFailingHookAborts(t *testing.T) {
+	defer resetEnv()()
+	settings.PluginsDirectory = "testdata/hookplugins"
+
+	store := storageFixture()
+	_, _, err := executeActionCommandC(store, "install testdata/testcharts/shared-deps")
+	expected := `plugin "deny" pre-install-package hook exited with error: exit status 1`
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected error containing %q, got %v", expected, err)
+	}
+
+	rels, err := store.ListReleases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rels) != 0 {
+		t.Errorf("expected nothing installed, got %d releases", len(rels))
+	}
+}
+
+func TestInstallCmdLogFormatJSON(t *testing.T) {
+	defer resetEnv()()
+
+	repoCache := "testdata/testcharts"
+
+	repoConfig := repoCache + "/repositories.yaml"
+
+	_, out, err := executeActionCommandC(storageFixture(),
+		fmt.Sprintf("install testdata/testcharts/shared-deps --log-format json --repository-config %s --repository-cache %s", repoConfig, repoCache))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type event struct {
+		Event     string `json:"event"`
+		Release   string `json:"release"`
+		Namespace string `json:"namespace"`
+		Result    string `json:"result"`
+		Status    string `json:"status"`
+		Revision  int    `json:"revision"`
+	}
+	var events []event
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %q is not JSON: %s", line, err)
+		}
+		if entry["event"] == nil {
+			continue
+		}
+		var e event
+		if err := json.Unmarshal([]byte(line), &e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+
+	expected := []event{
+		{Event: "solve-started", Release: "my-hypper-name", Namespace: "hypper"},
+		{Event: "solve-finished", Result: "sat"},
+		{Event: "install-started", Release: "my-shared-dep", Namespace: "my-shared-dep-ns"},
+		{Event: "install-finished", Release: "my-shared-dep", Namespace: "my-shared-dep-ns", Status: "deployed", Revision: 1},
+		{Event: "install-started", Release: "my-hypper-name", Namespace: "hypper"},
+		{Event: "install-finished", Release: "my-hypper-name", Namespace: "hypper", Status: "deployed", Revision: 1},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected events %+v, got %+v", expected, events)
+	}
+	for i := range expected {
+		if events[i] != expected[i] {
+			t.Errorf("expected event %d to be %+v, got %+v", i, expected[i], events[i])
+		}
+	}
+}
+
+func TestInstallCmdInvalidLogFormat(t *testing.T) {
+	defer resetEnv()()
+
+	_, _, err := executeActionCommandC(storageFixture(), "install testdata/testcharts/vanilla-helm --log-format yaml")
+	if err == nil || err.Error() != `invalid log format "yaml", must be one of text, json` {
+		t.Errorf("expected an invalid log format error, got %v", err)
+	}
+}
+
+func TestInstallCmdPolicyDeniesRepoAlias(t *testing.T) {
+	defer resetEnv()()
+
+	repoSetup, repoURL := policyRepoFixture(t)
+	_, _, err := executeActionCommandC(storageFixture(), "install untrusted/compressedchart "+repoSetup)
+	expected := fmt.Sprintf("repository %q is not allowed", repoURL)
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error containing %q, got %v", expected, err)
+	}
+}
+
+func TestInstallCmdPolicyDeniesAbsoluteURL(t *testing.T) {
+	defer resetEnv()()
+
+	repoSetup, repoURL := policyRepoFixture(t)
+	cmd := fmt.Sprintf("install %s/compressedchart-0.1.0.tgz %s", repoURL, repoSetup)
+	_, _, err := executeActionCommandC(storageFixture(), cmd)
+	expected := fmt.Sprintf("repository %q is not allowed", repoURL)
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error containing %q, got %v", expected, err)
+	}
+}
+
+// policyRepoFixture serves the test charts from a repository configured as
+// "untrusted", with a policy that doesn't allow it. It returns the flags
+// that configure the repository, and its URL.
+func policyRepoFixture(t *testing.T) (string, string) {
+	t.Helper()
+
+	srv, err := repotest.NewTempServerWithCleanup(t, "testdata/testcharts/*.tgz*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(srv.Stop)
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	repoConfig := filepath.Join(dir, "repositories.yaml")
+	repoFile := fmt.Sprintf("apiVersion: v1\nrepositories:\n  - name: untrusted\n    url: %s\n", srv.URL())
+	if err := ioutil.WriteFile(repoConfig, []byte(repoFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	index, err := ioutil.ReadFile(filepath.Join(srv.Root(), "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "untrusted-index.yaml"), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+	policyFile := filepath.Join(dir, "policy.yaml")
+	if err := ioutil.WriteFile(policyFile, []byte("allowedRepositories:\n  - http://example.com/ours\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings.PolicyFile = policyFile
+
+	return fmt.Sprintf("--repository-config %s --repository-cache %s", repoConfig, dir), srv.URL()
+}
@@ -23,9 +23,12 @@ import (
 	"strconv"
 
 	"github.com/gosuri/uitable"
+	"github.com/jinzhu/copier"
 	"github.com/spf13/cobra"
 
 	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cluster"
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/cli/output"
 	"helm.sh/helm/v3/pkg/release"
@@ -41,34 +44,51 @@ List all of the releases for a specified namespace, by wrapping Helm for now.
 func newListCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
 	client := action.NewList(cfg)
 	var outfmt output.Format
+	clusterOpts := &clusterOptions{}
 
 	cmd := &cobra.Command{
 		Use:     "list",
 		Short:   "list releases",
-		Long:    listHelp,
+		Long:    listHelp + clustersHelp,
 		Aliases: []string{"ls"},
 		Args:    require.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			if client.AllNamespaces {
-				if err := cfg.Init(settings.RESTClientGetter(), "", os.Getenv("HELM_DRIVER"), logger.Debugf); err != nil {
-					return err
-				}
-			}
-			client.SetStateMask()
-
-			results, err := client.Run()
+			clusters, err := clusterOpts.clusters()
 			if err != nil {
 				return err
 			}
 
+			var writer *releaseListWriter
+			var clustersErr error
+			if clusters != nil {
+				writer, clustersErr = listOnClusters(client, clusters, clusterOpts.maxParallel, logger)
+			} else {
+				if client.AllNamespaces {
+					if err := cfg.Init(settings.RESTClientGetter(), "", os.Getenv("HELM_DRIVER"), logger.Debugf); err != nil {
+						return err
+					}
+				}
+				client.SetStateMask()
+
+				results, err := client.Run()
+				if err != nil {
+					return err
+				}
+				writer = newReleaseListWriter(results, client.TimeFormat)
+			}
+
 			// Get an io.Writer compliant logger instance at the info level.
 			wInfo := logio.NewWriter(logger, log.InfoLevel)
 
 			if client.Short {
 
 				names := make([]string, 0)
-				for _, res := range results {
-					names = append(names, res.Name)
+				for _, res := range writer.releases {
+					if res.Cluster != "" {
+						names = append(names, res.Cluster+"/"+res.Name)
+					} else {
+						names = append(names, res.Name)
+					}
 				}
 
 				outputFlag := cmd.Flag("output")
@@ -79,24 +99,30 @@ func newListCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
 					if err != nil {
 						logger.Error(err)
 					}
-					return nil
+					return clustersErr
 				case "yaml":
 					err = output.EncodeYAML(wInfo, names)
 					if err != nil {
 						logger.Error(err)
 					}
-					return nil
+					return clustersErr
 				case "table":
-					for _, res := range results {
-						logger.Info(res.Name)
+					for _, name := range names {
+						logger.Info(name)
 					}
-					return nil
+					return clustersErr
 				default:
-					return outfmt.Write(wInfo, newReleaseListWriter(results, client.TimeFormat))
+					if err := outfmt.Write(wInfo, writer); err != nil {
+						return err
+					}
+					return clustersErr
 				}
 			}
 
-			return outfmt.Write(wInfo, newReleaseListWriter(results, client.TimeFormat))
+			if err := outfmt.Write(wInfo, writer); err != nil {
+				return err
+			}
+			return clustersErr
 		},
 	}
 
@@ -117,12 +143,52 @@ func newListCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
 	f.IntVar(&client.Offset, "offset", 0, "next release name in the list, used to offset from start value")
 	f.StringVarP(&client.Filter, "filter", "f", "", "a regular expression (Perl compatible). Any releases that match the expression will be included in the results")
 	f.StringVarP(&client.Selector, "selector", "l", "", "Selector (label query) to filter on, supports '=', '==', and '!='.(e.g. -l key1=value1,key2=value2). Works only for secret(default) and configmap storage backends.")
+	addClusterFlags(f, clusterOpts)
 	bindOutputFlag(cmd, &outfmt)
 
 	return cmd
 }
 
+// listOnClusters lists the releases of each of the clusters, at most
+// maxParallel at once, with a copy of client for each. The errors of each
+// cluster are logged, and the releases of the others listed.
+func listOnClusters(client *action.List, clusters []*cluster.Cluster, maxParallel int,
+	logger log.Logger) (*releaseListWriter, error) {
+
+	writers := make([]*releaseListWriter, len(clusters))
+	errs := runOnClusters(clusters, maxParallel, client.AllNamespaces, logger,
+		func(idx int, settings *cli.EnvSettings, cfg *action.Configuration, logger log.Logger) error {
+			clusterClient := action.NewList(cfg)
+			if err := copier.Copy(clusterClient.List, client.List); err != nil {
+				return err
+			}
+			clusterClient.SetStateMask()
+
+			results, err := clusterClient.Run()
+			if err != nil {
+				return err
+			}
+			writers[idx] = newReleaseListWriter(results, client.TimeFormat)
+			return nil
+		})
+	logClusterErrors(clusters, errs, logger)
+
+	writer := &releaseListWriter{releases: []releaseElement{}, clusters: true}
+	for idx, w := range writers {
+		if w == nil {
+			continue
+		}
+		for _, element := range w.releases {
+			element.Cluster = clusters[idx].Name
+			writer.releases = append(writer.releases, element)
+		}
+	}
+	return writer, clustersError(clusters, errs)
+}
+
 type releaseElement struct {
+	// Cluster is set when listing several clusters.
+	Cluster    string `json:"cluster,omitempty"`
 	Name       string `json:"name"`
 	Namespace  string `json:"namespace"`
 	Revision   string `json:"revision"`
@@ -134,6 +200,8 @@ type releaseElement struct {
 
 type releaseListWriter struct {
 	releases []releaseElement
+	// clusters adds the cluster of each release to tables.
+	clusters bool
 }
 
 func newReleaseListWriter(releases []*release.Release, timeFormat string) *releaseListWriter {
@@ -161,11 +229,18 @@ func newReleaseListWriter(releases []*release.Release, timeFormat string) *relea
 
 		elements = append(elements, element)
 	}
-	return &releaseListWriter{elements}
+	return &releaseListWriter{releases: elements}
 }
 
 func (r *releaseListWriter) WriteTable(out io.Writer) error {
 	table := uitable.New()
+	if r.clusters {
+		table.AddRow("CLUSTER", "NAME", "NAMESPACE", "REVISION", "UPDATED", "STATUS", "CHART", "APP VERSION")
+		for _, r := range r.releases {
+			table.AddRow(r.Cluster, r.Name, r.Namespace, r.Revision, r.Updated, r.Status, r.Chart, r.AppVersion)
+		}
+		return output.EncodeTable(out, table)
+	}
 	table.AddRow("NAME", "NAMESPACE", "REVISION", "UPDATED", "STATUS", "CHART", "APP VERSION")
 	for _, r := range r.releases {
 		table.AddRow(r.Name, r.Namespace, r.Revision, r.Updated, r.Status, r.Chart, r.AppVersion)
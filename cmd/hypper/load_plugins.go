@@ -0,0 +1,191 @@
+/*
+Copyright The Helm Authors, SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/pkg/plugin"
+	helmPlugin "helm.sh/helm/v3/pkg/plugin"
+)
+
+type pluginError struct {
+	error
+	code int
+}
+
+// loadPlugins loads plugins into the command list.
+//
+// This follows a different pattern than the other commands because it has
+// to inspect its environment and then add commands to the base command
+// as it finds them.
+func loadPlugins(baseCmd *cobra.Command, out io.Writer, logger log.Logger) {
+
+	// If HYPPER_NO_PLUGINS is set to 1, do not load plugins.
+	if os.Getenv("HYPPER_NO_PLUGINS") == "1" {
+		return
+	}
+
+	found, err := helmPlugin.FindPlugins(settings.PluginsDirectory)
+	if err != nil {
+		logger.Warnf("failed to load plugins: %s", err)
+		return
+	}
+
+	// Now we create commands for all of these.
+	for _, plug := range found {
+		plug := plug
+		md := plug.Metadata
+		if md.Usage == "" {
+			md.Usage = fmt.Sprintf("the %q plugin", md.Name)
+		}
+
+		// A plugin cannot shadow a hypper command, nor another plugin.
+		if c, _, err := baseCmd.Find([]string{md.Name}); err == nil && c != baseCmd {
+			logger.Warnf("plugin %q in %s ignored: a command with the same name already exists", md.Name, plug.Dir)
+			continue
+		}
+
+		c := &cobra.Command{
+			Use:   md.Name,
+			Short: md.Usage,
+			Long:  md.Description,
+			RunE: func(cmd *cobra.Command, args []string) error {
+				u, err := processParent(cmd, args)
+				if err != nil {
+					return err
+				}
+
+				// Call setupPluginEnv before PrepareCommand because
+				// PrepareCommand uses os.ExpandEnv and expects the
+				// plugin env vars.
+				setupPluginEnv(md.Name, plug.Dir)
+				main, argv, prepCmdErr := plug.PrepareCommand(u)
+				if prepCmdErr != nil {
+					logger.Error(prepCmdErr)
+					return errors.Errorf("plugin %q exited with error", md.Name)
+				}
+
+				return callPluginExecutable(md.Name, main, argv, out)
+			},
+			// This passes all the flags to the subcommand.
+			DisableFlagParsing: true,
+		}
+
+		baseCmd.AddCommand(c)
+	}
+}
+
+func processParent(cmd *cobra.Command, args []string) ([]string, error) {
+	k, u := manuallyProcessArgs(args)
+	if err := cmd.Parent().ParseFlags(k); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// setupPluginEnv sets the environment of the plugin called name, installed in
+// dir, in the environment of the current process, for the plugin and its
+// hooks to inherit.
+func setupPluginEnv(name, dir string) {
+	for k, v := range plugin.Env(settings, name, dir) {
+		os.Setenv(k, v)
+	}
+}
+
+// This function is used to setup the environment for the plugin and then
+// call the executable specified by the parameter 'main'
+func callPluginExecutable(pluginName string, main string, argv []string, out io.Writer) error {
+	env := os.Environ()
+	for k, v := range settings.EnvVars() {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	prog := exec.Command(main, argv...)
+	prog.Env = env
+	prog.Stdin = os.Stdin
+	prog.Stdout = out
+	prog.Stderr = os.Stderr
+	if err := prog.Run(); err != nil {
+		if eerr, ok := err.(*exec.ExitError); ok {
+			os.Stderr.Write(eerr.Stderr)
+			status := eerr.Sys().(syscall.WaitStatus)
+			return pluginError{
+				error: errors.Errorf("plugin %q exited with error", pluginName),
+				code:  status.ExitStatus(),
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// manuallyProcessArgs processes an arg array, removing the global hypper
+// flags.
+//
+// Returns two sets of args: known and unknown (in that order)
+func manuallyProcessArgs(args []string) ([]string, []string) {
+	known := []string{}
+	unknown := []string{}
+	boolargs := []string{"--debug", "--no-colors", "--no-emojis"}
+	kvargs := []string{"--kube-context", "--namespace", "-n", "--kubeconfig", "--kube-apiserver", "--kube-token",
+		"--kube-as-user", "--kube-as-group", "--kube-ca-file", "--registry-config", "--repository-cache",
+		"--repository-config", "--chart-cache", "--solver-timeout", "--log-format"}
+	knownArg := func(a string) bool {
+		for _, pre := range append(kvargs, boolargs...) {
+			if strings.HasPrefix(a, pre+"=") {
+				return true
+			}
+		}
+		return false
+	}
+
+	isKnown := func(v string, list []string) bool {
+		for _, i := range list {
+			if i == v {
+				return true
+			}
+		}
+		return false
+	}
+
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case isKnown(a, boolargs), knownArg(a):
+			known = append(known, a)
+		case isKnown(a, kvargs):
+			known = append(known, a)
+			i++
+			if i < len(args) {
+				known = append(known, args[i])
+			}
+		default:
+			unknown = append(unknown, a)
+		}
+	}
+	return known, unknown
+}
@@ -0,0 +1,90 @@
+/*
+Copyright The Helm Authors, SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/pkg/plugin"
+)
+
+const pluginHelp = `
+Manage client-side hypper plugins.
+
+Plugins use the same plugin.yaml format as Helm plugins, and are installed in
+the directory set by $HYPPER_PLUGINS. Each plugin is available as a hypper
+command of the same name, and gets the hypper and helm environment variables
+($HYPPER_PLUGIN_DIR, $HELM_PLUGIN_DIR, $HYPPER_NAMESPACE…) when run.
+
+Set $HYPPER_NO_PLUGINS to 1 to disable loading plugins.
+`
+
+func newPluginCmd(logger log.Logger) *cobra.Command {
+	wInfo := logio.NewWriter(logger, log.InfoLevel)
+	cmd := &cobra.Command{
+		Use:   "plugin",
+		Short: "install, list, or uninstall hypper plugins",
+		Long:  pluginHelp,
+	}
+	cmd.AddCommand(
+		newPluginInstallCmd(wInfo, logger),
+		newPluginListCmd(wInfo, logger),
+		newPluginUninstallCmd(wInfo, logger),
+		newPluginUpdateCmd(wInfo, logger),
+	)
+	return cmd
+}
+
+// runHook will execute a plugin hook.
+func runHook(p *plugin.Plugin, event string, logger log.Logger) error {
+	hook := p.Metadata.Hooks[event]
+	if hook == "" {
+		return nil
+	}
+
+	prog := exec.Command("sh", "-c", hook)
+	// TODO make this work on windows
+
+	logger.Debugf("running %s hook: %s", event, prog)
+
+	setupPluginEnv(p.Metadata.Name, p.Dir)
+	prog.Stdout, prog.Stderr = os.Stdout, os.Stderr
+	if err := prog.Run(); err != nil {
+		if eerr, ok := err.(*exec.ExitError); ok {
+			os.Stderr.Write(eerr.Stderr)
+			return errors.Errorf("plugin %s hook for %q exited with error", event, p.Metadata.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// findPlugin returns the plugin called name in plugins, or nil.
+func findPlugin(plugins []*plugin.Plugin, name string) *plugin.Plugin {
+	for _, p := range plugins {
+		if p.Metadata.Name == name {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+/*
+Copyright The Helm Authors, SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Masterminds/log-go"
+	"github.com/Masterminds/semver/v3"
+	"github.com/Masterminds/vcs"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/plugin"
+	"helm.sh/helm/v3/pkg/plugin/installer"
+)
+
+type pluginInstallOptions struct {
+	source  string
+	version string
+}
+
+const pluginInstallDesc = `
+This command allows you to install a plugin from a url to a VCS repo, a url to
+a tarball, or a local path.
+
+Plugins written for Helm can be installed too.
+`
+
+func newPluginInstallCmd(out io.Writer, logger log.Logger) *cobra.Command {
+	o := &pluginInstallOptions{}
+	cmd := &cobra.Command{
+		Use:     "install [options] <path|url>",
+		Short:   "install a hypper plugin",
+		Long:    pluginInstallDesc,
+		Aliases: []string{"add"},
+		Args:    require.ExactArgs(1),
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return o.complete(args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(out, logger)
+		},
+	}
+	cmd.Flags().StringVar(&o.version, "version", "", "specify a version constraint. If this is not specified, the latest version is installed")
+	return cmd
+}
+
+func (o *pluginInstallOptions) complete(args []string) error {
+	o.source = args[0]
+	return nil
+}
+
+func (o *pluginInstallOptions) run(out io.Writer, logger log.Logger) error {
+	installer.Debug = settings.Debug
+
+	dir, err := installPlugin(o.source, o.version, logger)
+	if err != nil {
+		return err
+	}
+
+	logger.Debugf("loading plugin from %s", dir)
+	p, err := plugin.LoadDir(dir)
+	if err != nil {
+		return errors.Wrap(err, "plugin is installed but unusable")
+	}
+
+	if err := runHook(p, plugin.Install, logger); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "Installed plugin: %s\n", p.Metadata.Name)
+	return nil
+}
+
+// installPlugin installs the plugin in source into the plugins directory, and
+// returns the directory of the installed plugin.
+//
+// Helm installers always install into $HELM_DATA_HOME/plugins, and pointing it
+// to the plugins directory would change the environment of the whole process,
+// which other goroutines may read, e.g: when running on several clusters. So
+// Helm installers only tell the kind of source apart, and the plugin is
+// fetched into a temporary directory inside the plugins directory, and moved
+// into place from there.
+func installPlugin(source, version string, logger log.Logger) (string, error) {
+	i, err := installer.NewForSource(source, version)
+	if err != nil {
+		return "", err
+	}
+	var name string
+	var fetch func(dest string) error
+	switch i := i.(type) {
+	case *installer.LocalInstaller:
+		// symlinked, as Helm does, so it is always up to date:
+		name = filepath.Base(i.Source)
+		fetch = func(dest string) error { return os.Symlink(i.Source, dest) }
+	case *installer.HTTPInstaller:
+		name = i.PluginName
+		fetch = func(dest string) error { return fetchPluginArchive(i.Source, dest) }
+	case *installer.VCSInstaller:
+		name = filepath.Base(i.Source)
+		fetch = func(dest string) error { return fetchPluginRepo(i.Source, version, dest) }
+	default:
+		return "", errors.Errorf("unsupported plugin source %q", source)
+	}
+
+	dir := filepath.Join(settings.PluginsDirectory, name)
+	if _, err := os.Lstat(dir); !os.IsNotExist(err) {
+		return "", errors.New("plugin already exists")
+	}
+	if err := os.MkdirAll(settings.PluginsDirectory, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(settings.PluginsDirectory, ".install-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	fetched := filepath.Join(tmp, name)
+	logger.Debugf("fetching plugin from %s into %s", source, fetched)
+	if err := fetch(fetched); err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(fetched, plugin.PluginFileName)); err != nil {
+		return "", installer.ErrMissingMetadata
+	}
+
+	logger.Debugf("moving plugin from %s to %s", fetched, dir)
+	if err := os.Rename(fetched, dir); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// fetchPluginArchive downloads the plugin tarball at url, and extracts it into
+// dest.
+func fetchPluginArchive(url, dest string) error {
+	extractor, err := installer.NewExtractor(url)
+	if err != nil {
+		return err
+	}
+	g, err := getter.All(settings.EnvSettings).ByScheme("http")
+	if err != nil {
+		return err
+	}
+	data, err := g.Get(url)
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(extractor.Extract(data, dest), "extracting files from archive")
+}
+
+// fetchPluginRepo clones the VCS repo of the plugin at url into dest, and
+// checks out version: a reference, or the newest tag satisfying it as a semver
+// constraint. The latest version is kept if version is empty.
+func fetchPluginRepo(url, version, dest string) error {
+	repo, err := vcs.NewRepo(url, dest)
+	if err != nil {
+		return err
+	}
+	if err := repo.Get(); err != nil {
+		return err
+	}
+	if version == "" {
+		return nil
+	}
+	if repo.IsReference(version) {
+		return repo.UpdateVersion(version)
+	}
+
+	constraint, err := semver.NewConstraint(version)
+	if err != nil {
+		return err
+	}
+	tags, err := repo.Tags()
+	if err != nil {
+		return err
+	}
+	versions := []*semver.Version{}
+	for _, tag := range tags {
+		if v, err := semver.NewVersion(tag); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+	for _, v := range versions {
+		if constraint.Check(v) {
+			return repo.UpdateVersion(v.Original())
+		}
+	}
+	return errors.Errorf("requested version %q does not exist for plugin %q", version, url)
+}
@@ -0,0 +1,332 @@
+/*
+Copyright The Helm Authors, SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+)
+
+const testPluginsDir = "testdata/hypperhome/hypper/plugins"
+
+func TestManuallyProcessArgs(t *testing.T) {
+	input := []string{
+		"--debug",
+		"--no-colors",
+		"--foo", "bar",
+		"--kubeconfig=/home/foo",
+		"--kubeconfig", "/home/foo",
+		"--kube-context=test1",
+		"--kube-context", "test1",
+		"--kube-as-user", "pikachu",
+		"--kube-as-group", "teatime",
+		"--kube-as-group", "admins",
+		"-n=test2",
+		"-n", "test2",
+		"--namespace=test2",
+		"--namespace", "test2",
+		"--solver-timeout", "1m",
+		"--home=/tmp",
+		"",
+		"command",
+	}
+
+	expectKnown := []string{
+		"--debug",
+		"--no-colors",
+		"--kubeconfig=/home/foo",
+		"--kubeconfig", "/home/foo",
+		"--kube-context=test1",
+		"--kube-context", "test1",
+		"--kube-as-user", "pikachu",
+		"--kube-as-group", "teatime",
+		"--kube-as-group", "admins",
+		"-n=test2",
+		"-n", "test2",
+		"--namespace=test2",
+		"--namespace", "test2",
+		"--solver-timeout", "1m",
+	}
+
+	expectUnknown := []string{
+		"--foo", "bar", "--home=/tmp", "", "command",
+	}
+
+	known, unknown := manuallyProcessArgs(input)
+
+	if len(known) != len(expectKnown) {
+		t.Fatalf("expected known flags %q, got %q", expectKnown, known)
+	}
+	for i, k := range known {
+		if k != expectKnown[i] {
+			t.Errorf("expected known flag %d to be %q, got %q", i, expectKnown[i], k)
+		}
+	}
+	if len(unknown) != len(expectUnknown) {
+		t.Fatalf("expected unknown flags %q, got %q", expectUnknown, unknown)
+	}
+	for i, k := range unknown {
+		if k != expectUnknown[i] {
+			t.Errorf("expected unknown flag %d to be %q, got %q", i, expectUnknown[i], k)
+		}
+	}
+}
+
+func TestLoadPlugins(t *testing.T) {
+	defer resetEnv()()
+
+	settings.PluginsDirectory = testPluginsDir
+	settings.RepositoryConfig = "testdata/hypperhome/hypper/repositories.yaml"
+	settings.RepositoryCache = "testdata/hypperhome/hypper/repository"
+
+	var (
+		out bytes.Buffer
+		cmd cobra.Command
+	)
+	loadPlugins(&cmd, &out, logcli.NewStandard())
+
+	envs := strings.Join([]string{
+		"fullenv",
+		"testdata/hypperhome/hypper/plugins/fullenv",
+		"fullenv",
+		"testdata/hypperhome/hypper/plugins/fullenv",
+		"testdata/hypperhome/hypper/plugins",
+		"testdata/hypperhome/hypper/repositories.yaml",
+		"testdata/hypperhome/hypper/repository",
+		os.Args[0],
+	}, "\n")
+
+	// Test that the YAML file was correctly converted to a command.
+	tests := []struct {
+		use    string
+		short  string
+		long   string
+		expect string
+		args   []string
+		code   int
+	}{
+		{"args", "echo args", "This echos args", "-a -b -c\n", []string{"-a", "-b", "-c"}, 0},
+		{"echo", "echo stuff", "This echos stuff", "hello\n", []string{}, 0},
+		{"env", "env stuff", "show the env", "env\n", []string{}, 0},
+		{"exitwith", "exitwith code", "This exits with the specified exit code", "", []string{"2"}, 2},
+		{"fullenv", "show env vars", "show all env vars", envs + "\n", []string{}, 0},
+	}
+
+	plugins := cmd.Commands()
+
+	if len(plugins) != len(tests) {
+		t.Fatalf("Expected %d plugins, got %d", len(tests), len(plugins))
+	}
+
+	for i := 0; i < len(plugins); i++ {
+		out.Reset()
+		tt := tests[i]
+		pp := plugins[i]
+		if pp.Use != tt.use {
+			t.Errorf("%d: Expected Use=%q, got %q", i, tt.use, pp.Use)
+		}
+		if pp.Short != tt.short {
+			t.Errorf("%d: Expected Short=%q, got %q", i, tt.short, pp.Short)
+		}
+		if pp.Long != tt.long {
+			t.Errorf("%d: Expected Long=%q, got %q", i, tt.long, pp.Long)
+		}
+
+		// Currently, plugins assume a Linux subsystem. Skip the execution
+		// tests until this is fixed
+		if runtime.GOOS != "windows" {
+			if err := pp.RunE(pp, tt.args); err != nil {
+				if tt.code > 0 {
+					perr, ok := err.(pluginError)
+					if !ok {
+						t.Errorf("Expected %s to return pluginError: got %v(%T)", tt.use, err, err)
+					}
+					if perr.code != tt.code {
+						t.Errorf("Expected %s to return %d: got %d", tt.use, tt.code, perr.code)
+					}
+				} else {
+					t.Errorf("Error running %s: %+v", tt.use, err)
+				}
+			}
+			if out.String() != tt.expect {
+				t.Errorf("Expected %s to output:\n%s\ngot\n%s", tt.use, tt.expect, out.String())
+			}
+		}
+	}
+}
+
+func TestLoadPluginsHypperNoPlugins(t *testing.T) {
+	defer resetEnv()()
+
+	settings.PluginsDirectory = testPluginsDir
+	os.Setenv("HYPPER_NO_PLUGINS", "1")
+
+	out := bytes.NewBuffer(nil)
+	cmd := &cobra.Command{}
+	loadPlugins(cmd, out, logcli.NewStandard())
+	plugins := cmd.Commands()
+
+	if len(plugins) != 0 {
+		t.Fatalf("Expected 0 plugins, got %d", len(plugins))
+	}
+}
+
+func TestLoadPluginsShadowingCommands(t *testing.T) {
+	defer resetEnv()()
+
+	pluginsDir := ensure.TempDir(t)
+	defer os.RemoveAll(pluginsDir)
+	if err := os.Mkdir(filepath.Join(pluginsDir, "list"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	md := "name: list\nusage: \"list stuff\"\ncommand: \"echo list\"\n"
+	if err := ioutil.WriteFile(filepath.Join(pluginsDir, "list", "plugin.yaml"), []byte(md), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings.PluginsDirectory = pluginsDir
+
+	var errOut bytes.Buffer
+	logger := logcli.NewStandard()
+	logger.WarnOut = &errOut
+	cmd := &cobra.Command{}
+	cmd.AddCommand(&cobra.Command{Use: "list", Short: "list releases"})
+	loadPlugins(cmd, ioutil.Discard, logger)
+
+	if len(cmd.Commands()) != 1 || cmd.Commands()[0].Short != "list releases" {
+		t.Fatalf("Expected the plugin not to shadow the list command, got %v", cmd.Commands())
+	}
+	if !strings.Contains(errOut.String(), `plugin "list"`) {
+		t.Errorf("Expected a warning about the ignored plugin, got %q", errOut.String())
+	}
+}
+
+func TestPluginCmds(t *testing.T) {
+	home := ensure.TempDir(t)
+	defer os.RemoveAll(home)
+	pluginsDir := filepath.Join(home, "plugins")
+
+	tests := []cmdTestCase{{
+		name:   "install a plugin from a local path",
+		cmd:    "plugin install " + filepath.Join(testPluginsDir, "echo"),
+		golden: "output/plugin-install.txt",
+	}, {
+		name:      "install an already installed plugin",
+		cmd:       "plugin install " + filepath.Join(testPluginsDir, "echo"),
+		golden:    "output/plugin-install-exists.txt",
+		wantError: true,
+	}, {
+		name:   "list plugins",
+		cmd:    "plugin list",
+		golden: "output/plugin-list.txt",
+	}, {
+		name:   "run an installed plugin",
+		cmd:    "echo",
+		golden: "output/plugin-run.txt",
+	}, {
+		name:      "update a local plugin",
+		cmd:       "plugin update echo",
+		golden:    "output/plugin-update-local.txt",
+		wantError: true,
+	}, {
+		name:   "uninstall a plugin",
+		cmd:    "plugin uninstall echo",
+		golden: "output/plugin-uninstall.txt",
+	}, {
+		name:      "uninstall a missing plugin",
+		cmd:       "plugin uninstall echo",
+		golden:    "output/plugin-uninstall-missing.txt",
+		wantError: true,
+	}}
+	for _, test := range tests {
+		os.Setenv("HYPPER_PLUGINS", pluginsDir)
+		settings.PluginsDirectory = pluginsDir
+		runTestCmd(t, []cmdTestCase{test})
+	}
+	os.Unsetenv("HYPPER_PLUGINS")
+
+	// the temporary install directory is removed
+	entries, err := ioutil.ReadDir(pluginsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Expected an empty plugins directory, got %v", entries)
+	}
+}
+
+func TestPluginInstallCmdArchive(t *testing.T) {
+	home := ensure.TempDir(t)
+	defer os.RemoveAll(home)
+	pluginsDir := filepath.Join(home, "plugins")
+
+	// tarball of the echo plugin, with its files at the root:
+	md, err := ioutil.ReadFile(filepath.Join(testPluginsDir, "echo", "plugin.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var archive bytes.Buffer
+	zw := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(zw)
+	if err := tw.WriteHeader(&tar.Header{Name: "plugin.yaml", Mode: 0644, Size: int64(len(md))}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(md); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive.Bytes())
+	}))
+	defer srv.Close()
+
+	os.Setenv("HYPPER_PLUGINS", pluginsDir)
+	settings.PluginsDirectory = pluginsDir
+	runTestCmd(t, []cmdTestCase{{
+		name:   "install a plugin from a tarball",
+		cmd:    "plugin install " + srv.URL + "/echo-1.0.0.tgz",
+		golden: "output/plugin-install.txt",
+	}})
+	os.Unsetenv("HYPPER_PLUGINS")
+
+	// only the plugin is left in the plugins directory:
+	entries, err := ioutil.ReadDir(pluginsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "echo" || !entries[0].IsDir() {
+		t.Errorf("Expected the echo plugin only in the plugins directory, got %v", entries)
+	}
+}
@@ -0,0 +1,118 @@
+/*
+Copyright The Helm Authors, SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"helm.sh/helm/v3/pkg/plugin"
+	"helm.sh/helm/v3/pkg/plugin/installer"
+)
+
+type pluginUpdateOptions struct {
+	names []string
+}
+
+func newPluginUpdateCmd(out io.Writer, logger log.Logger) *cobra.Command {
+	o := &pluginUpdateOptions{}
+
+	cmd := &cobra.Command{
+		Use:     "update <plugin>...",
+		Aliases: []string{"up"},
+		Short:   "update one or more hypper plugins",
+		PreRunE: func(cmd *cobra.Command, args []string) error {
+			return o.complete(args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return o.run(out, logger)
+		},
+	}
+	return cmd
+}
+
+func (o *pluginUpdateOptions) complete(args []string) error {
+	if len(args) == 0 {
+		return errors.New("please provide plugin name to update")
+	}
+	o.names = args
+	return nil
+}
+
+func (o *pluginUpdateOptions) run(out io.Writer, logger log.Logger) error {
+	installer.Debug = settings.Debug
+	logger.Debugf("loading installed plugins from %s", settings.PluginsDirectory)
+	plugins, err := plugin.FindPlugins(settings.PluginsDirectory)
+	if err != nil {
+		return err
+	}
+	var errorPlugins []string
+
+	for _, name := range o.names {
+		if found := findPlugin(plugins, name); found != nil {
+			if err := updatePlugin(found, logger); err != nil {
+				errorPlugins = append(errorPlugins, fmt.Sprintf("Failed to update plugin %s, got error (%v)", name, err))
+			} else {
+				fmt.Fprintf(out, "Updated plugin: %s\n", name)
+			}
+		} else {
+			errorPlugins = append(errorPlugins, fmt.Sprintf("Plugin: %s not found", name))
+		}
+	}
+	if len(errorPlugins) > 0 {
+		return errors.New(strings.Join(errorPlugins, "\n"))
+	}
+	return nil
+}
+
+// updatePlugin updates the plugin p in place. Only plugins installed from a
+// VCS repo can be updated; plugins installed from a local path are symlinks,
+// and always up to date.
+func updatePlugin(p *plugin.Plugin, logger log.Logger) error {
+	exactLocation, err := filepath.EvalSymlinks(p.Dir)
+	if err != nil {
+		return err
+	}
+	absExactLocation, err := filepath.Abs(exactLocation)
+	if err != nil {
+		return err
+	}
+
+	i, err := installer.FindSource(absExactLocation)
+	if err != nil {
+		return err
+	}
+	// The installer of the VCS repo expects the plugin in $HELM_DATA_HOME,
+	// so it is updated in place instead of through installer.Update.
+	if err := i.Update(); err != nil {
+		return err
+	}
+
+	logger.Debugf("loading plugin from %s", p.Dir)
+	updatedPlugin, err := plugin.LoadDir(p.Dir)
+	if err != nil {
+		return err
+	}
+
+	return runHook(updatedPlugin, plugin.Update, logger)
+}
@@ -60,7 +60,7 @@ func newPullCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
 			}
 
 			for i := 0; i < len(args); i++ {
-				output, err := client.Run(args[i])
+				output, err := client.Run(args[i], settings, logger)
 				if err != nil {
 					return err
 				}
@@ -28,24 +28,25 @@ import (
 
 var repoHypper = `
 This command consists of multiple subcommands to interact with chart repositories.
-It can be used to add, remove, list, and index chart repositories.
+It can be used to add, remove, list, index, and check chart repositories.
 `
 
 func newRepoCmd(logger log.Logger) *cobra.Command {
 	wInfo := logio.NewWriter(logger, log.InfoLevel)
 	cmd := &cobra.Command{
-		Use:   "repo add|remove|list|index|update [ARGS]",
-		Short: "add, list, remove, update, and index chart repositories",
+		Use:   "repo add|remove|list|index|update|check [ARGS]",
+		Short: "add, list, remove, update, index, and check chart repositories",
 		Long:  repoHypper,
 		Args:  require.NoArgs,
 	}
 
 	cmd.AddCommand(
-		newRepoAddCmd(wInfo),
+		newRepoAddCmd(wInfo, logger),
 		newRepoListCmd(wInfo),
 		newRepoIndexCmd(wInfo),
-		newRepoUpdateCmd(wInfo),
-		newRepoRemoveCmd(wInfo),
+		newRepoUpdateCmd(wInfo, logger),
+		newRepoRemoveCmd(wInfo, logger),
+		newRepoCheckCmd(wInfo, logger),
 	)
 
 	return cmd
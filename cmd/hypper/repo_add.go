@@ -26,12 +26,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Masterminds/log-go"
 	"github.com/gofrs/flock"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"golang.org/x/term"
 	"sigs.k8s.io/yaml"
 
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/getter"
@@ -62,10 +64,12 @@ type repoAddOptions struct {
 
 	// Deprecated, but cannot be removed until Helm 4
 	deprecatedNoUpdate bool
+
+	logger log.Logger
 }
 
-func newRepoAddCmd(out io.Writer) *cobra.Command {
-	o := &repoAddOptions{}
+func newRepoAddCmd(out io.Writer, logger log.Logger) *cobra.Command {
+	o := &repoAddOptions{logger: logger}
 
 	cmd := &cobra.Command{
 		Use:   "add [NAME] [URL]",
@@ -192,5 +196,6 @@ func (o *repoAddOptions) run(out io.Writer) error {
 		return err
 	}
 	fmt.Fprintf(out, "%q has been added to your repositories\n", o.name)
+	logjson.Event(o.logger, logjson.RepoAdded, log.Fields{"name": o.name, "url": o.url})
 	return nil
 }
@@ -0,0 +1,132 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
+	"helm.sh/helm/v3/pkg/cli/output"
+)
+
+const repoCheckDesc = `
+Check that all the chart versions of a repository are installable.
+
+For every chart version in the index of the repository, a world of packages is
+built out of the configured repositories only, without taking the releases in
+the cluster into account. Then, the solver tries to install that chart version.
+Every chart version whose shared dependencies can never be satisfied is listed
+as uninstallable. With '--solver-timeout', the chart versions for which the
+solver times out are listed as undetermined, as they may be installable.
+
+The cached repository indexes are used, run 'hypper repo update' beforehand to
+check against the latest indexes. As no cluster is read, the result is the
+same for all of them, and the command doesn't take '--kube-contexts' nor
+'--cluster-inventory'.
+
+The command fails if any chart version is not installable or undetermined,
+which makes it suitable for running in CI before publishing a chart repository.
+`
+
+func newRepoCheckCmd(out io.Writer, logger log.Logger) *cobra.Command {
+	var outfmt output.Format
+
+	cmd := &cobra.Command{
+		Use:   "check [NAME]",
+		Short: "check that all chart versions of a repository are installable",
+		Long:  repoCheckDesc,
+		Args:  require.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			client := action.NewRepoCheck()
+			results, err := client.Run(args[0], settings, logger)
+			if err != nil {
+				return err
+			}
+			uninstallable, undetermined := 0, 0
+			for _, res := range results {
+				if res.Result == action.RepoCheckUndetermined {
+					undetermined++
+				} else {
+					uninstallable++
+				}
+			}
+			logjson.Event(logger, logjson.RepoChecked, log.Fields{
+				"name":          args[0],
+				"uninstallable": uninstallable,
+				"undetermined":  undetermined,
+			})
+
+			if err := outfmt.Write(out, &repoCheckWriter{args[0], results}); err != nil {
+				return err
+			}
+
+			switch {
+			case undetermined != 0 && uninstallable != 0:
+				return errors.Errorf("%d chart versions of repo %q are not installable, and %d are undetermined as the solver timed out",
+					uninstallable, args[0], undetermined)
+			case undetermined != 0:
+				return errors.Errorf("%d chart versions of repo %q are undetermined as the solver timed out", undetermined, args[0])
+			case uninstallable != 0:
+				return errors.Errorf("%d chart versions of repo %q are not installable", uninstallable, args[0])
+			}
+			return nil
+		},
+	}
+
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
+
+type repoCheckWriter struct {
+	repoName string
+	results  []*action.RepoCheckResult
+}
+
+func (r *repoCheckWriter) WriteTable(out io.Writer) error {
+	if len(r.results) == 0 {
+		_, err := fmt.Fprintln(out, eyecandy.ESPrintf(settings.NoEmojis,
+			":check_mark_button: All chart versions of repo %q are installable", r.repoName))
+		return err
+	}
+	table := uitable.New()
+	table.MaxColWidth = 80
+	table.Wrap = true
+	table.AddRow("CHART", "VERSION", "RESULT", "INCONSISTENCIES")
+	for _, res := range r.results {
+		table.AddRow(res.Chart, res.Version, res.Result, strings.Join(res.Inconsistencies, "\n"))
+	}
+	return output.EncodeTable(out, table)
+}
+
+func (r *repoCheckWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, r.results)
+}
+
+func (r *repoCheckWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, r.results)
+}
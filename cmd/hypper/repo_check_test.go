@@ -0,0 +1,59 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRepoCheckCmd(t *testing.T) {
+	repoFlags := "--repository-config testdata/repocheck/repositories.yaml --repository-cache testdata/repocheck/repository"
+
+	tests := []cmdTestCase{
+		{
+			name:      "check a repo with uninstallable chart versions",
+			cmd:       fmt.Sprintf("repo check ours %s", repoFlags),
+			golden:    "output/repo-check-uninstallable.txt",
+			wantError: true,
+		},
+		{
+			name:      "check a repo with uninstallable chart versions, json output",
+			cmd:       fmt.Sprintf("repo check ours -o json %s", repoFlags),
+			golden:    "output/repo-check-uninstallable-json.txt",
+			wantError: true,
+		},
+		{
+			name:   "check a repo with all chart versions installable",
+			cmd:    fmt.Sprintf("repo check theirs --no-emojis %s", repoFlags),
+			golden: "output/repo-check-installable.txt",
+		},
+		{
+			name:      "check a repo with the solver timing out",
+			cmd:       fmt.Sprintf("repo check theirs --solver-timeout 1ns %s", repoFlags),
+			golden:    "output/repo-check-undetermined.txt",
+			wantError: true,
+		},
+		{
+			name:      "check a repo that doesn't exist",
+			cmd:       fmt.Sprintf("repo check foo %s", repoFlags),
+			golden:    "output/repo-check-not-found.txt",
+			wantError: true,
+		},
+	}
+	runTestCmd(t, tests)
+}
@@ -22,22 +22,25 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/Masterminds/log-go"
 	"github.com/pkg/errors"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
 	"github.com/spf13/cobra"
 
 	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
 	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
 )
 
 type repoRemoveOptions struct {
 	names     []string
 	repoFile  string
 	repoCache string
+	logger    log.Logger
 }
 
-func newRepoRemoveCmd(out io.Writer) *cobra.Command {
-	o := &repoRemoveOptions{}
+func newRepoRemoveCmd(out io.Writer, logger log.Logger) *cobra.Command {
+	o := &repoRemoveOptions{logger: logger}
 
 	cmd := &cobra.Command{
 		Use:     "remove [REPO1 [REPO2 ...]]",
@@ -72,6 +75,7 @@ func (o *repoRemoveOptions) run(out io.Writer) error {
 			return err
 		}
 		fmt.Fprintf(out, "%q has been removed from your repositories\n", name)
+		logjson.Event(o.logger, logjson.RepoRemoved, log.Fields{"name": name})
 	}
 
 	return nil
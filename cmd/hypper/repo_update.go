@@ -21,11 +21,13 @@ import (
 	"io"
 	"sync"
 
+	"github.com/Masterminds/log-go"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 
 	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
 	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
 	"helm.sh/helm/v3/pkg/getter"
 )
@@ -38,13 +40,14 @@ Information is cached locally, where it is used by commands like 'hypper search'
 var errNoRepositories = errors.New("no repositories found. You must add one before updating")
 
 type repoUpdateOptions struct {
-	update    func([]*repo.ChartRepository, io.Writer)
+	update    func([]*repo.ChartRepository, io.Writer, log.Logger)
 	repoFile  string
 	repoCache string
+	logger    log.Logger
 }
 
-func newRepoUpdateCmd(out io.Writer) *cobra.Command {
-	o := &repoUpdateOptions{update: updateCharts}
+func newRepoUpdateCmd(out io.Writer, logger log.Logger) *cobra.Command {
+	o := &repoUpdateOptions{update: updateCharts, logger: logger}
 
 	cmd := &cobra.Command{
 		Use:     "update",
@@ -84,11 +87,11 @@ func (o *repoUpdateOptions) run(out io.Writer) error {
 		repos = append(repos, r)
 	}
 
-	o.update(repos, out)
+	o.update(repos, out, o.logger)
 	return nil
 }
 
-func updateCharts(repos []*repo.ChartRepository, out io.Writer) {
+func updateCharts(repos []*repo.ChartRepository, out io.Writer, logger log.Logger) {
 	fmt.Fprintln(out, "Hang tight while we grab the latest from your chart repositories...")
 	var wg sync.WaitGroup
 	for _, re := range repos {
@@ -97,8 +100,10 @@ func updateCharts(repos []*repo.ChartRepository, out io.Writer) {
 			defer wg.Done()
 			if _, err := re.DownloadIndexFile(); err != nil {
 				fmt.Fprintf(out, "...Unable to get an update from the %q chart repository (%s):\n\t%s\n", re.Config.Name, re.Config.URL, err)
+				logjson.Event(logger, logjson.RepoUpdateFailed, log.Fields{"name": re.Config.Name, "url": re.Config.URL, "error": err.Error()})
 			} else {
 				fmt.Fprintf(out, "...Successfully got an update from the %q chart repository\n", re.Config.Name)
+				logjson.Event(logger, logjson.RepoUpdated, log.Fields{"name": re.Config.Name, "url": re.Config.URL})
 			}
 		}(re)
 	}
@@ -25,7 +25,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/Masterminds/log-go"
 	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
 	"helm.sh/helm/v3/pkg/getter"
 	helmRepo "helm.sh/helm/v3/pkg/repo"
@@ -36,7 +38,7 @@ func TestUpdateCmd(t *testing.T) {
 	var out bytes.Buffer
 	// Instead of using the HTTP updater, we provide our own for this test.
 	// The TestUpdateCharts test verifies the HTTP behavior independently.
-	updater := func(repos []*repo.ChartRepository, out io.Writer) {
+	updater := func(repos []*repo.ChartRepository, out io.Writer, _ log.Logger) {
 		for _, re := range repos {
 			fmt.Fprintln(out, re.Config.Name)
 		}
@@ -102,7 +104,7 @@ func TestUpdateCharts(t *testing.T) {
 	}
 
 	b := bytes.NewBuffer(nil)
-	updateCharts([]*repo.ChartRepository{r}, b)
+	updateCharts([]*repo.ChartRepository{r}, b, nil)
 
 	got := b.String()
 	if strings.Contains(got, "Unable to get an update") {
@@ -112,3 +114,37 @@ func TestUpdateCharts(t *testing.T) {
 		t.Error("Update was not successful")
 	}
 }
+
+func TestUpdateChartsEvents(t *testing.T) {
+	defer resetEnv()()
+	defer ensure.HelmHome(t)()
+
+	ts, err := repotest.NewTempServerWithCleanup(t, "testdata/testserver/*.*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ts.Stop()
+
+	var repos []*repo.ChartRepository
+	for name, url := range map[string]string{"charts": ts.URL(), "missing": ts.URL() + "/missing"} {
+		r, err := repo.NewChartRepository(&helmRepo.Entry{
+			Name: name,
+			URL:  url,
+		}, getter.All(settings.EnvSettings))
+		if err != nil {
+			t.Fatal(err)
+		}
+		repos = append(repos, r)
+	}
+
+	events := bytes.NewBuffer(nil)
+	updateCharts(repos, ioutil.Discard, logjson.New(events))
+
+	got := events.String()
+	if !strings.Contains(got, `"event":"repo-updated"`) || !strings.Contains(got, `"name":"charts"`) {
+		t.Errorf("Expected a repo-updated event for charts, got %q", got)
+	}
+	if !strings.Contains(got, `"event":"repo-update-failed"`) || !strings.Contains(got, `"name":"missing"`) {
+		t.Errorf("Expected a repo-update-failed event for missing, got %q", got)
+	}
+}
@@ -17,12 +17,15 @@ limitations under the License.
 package main
 
 import (
-	"errors"
 	"os"
 
 	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
 	"github.com/fatih/color"
+	"github.com/pkg/errors"
 	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
@@ -44,6 +47,30 @@ func newRootCmd(actionConfig *action.Configuration, logger log.Logger, args []st
 	flags := cmd.PersistentFlags()
 	settings.AddFlags(flags)
 
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	err := flags.Parse(args)
+
+	// Flags are parsed, lets fill the helm cli.Settings with our current settings
+	settings.FillHelmSettings()
+
+	if err != nil && !errors.Is(err, pflag.ErrHelp) {
+		log.Errorf("failed while parsing flags for %s: %s", args, err)
+
+		os.Exit(1)
+	}
+
+	// the profile of the configuration file sets defaults that the logger
+	// depends on, e.g: noEmojis:
+	if err := settings.LoadConfig(flags); err != nil {
+		return nil, err
+	}
+
+	// commands log in the format of --log-format:
+	logger, err = newLogger(logger)
+	if err != nil {
+		return nil, err
+	}
+
 	cmd.AddCommand(
 		newInstallCmd(actionConfig, logger),
 		newUninstallCmd(actionConfig, logger),
@@ -57,20 +84,16 @@ func newRootCmd(actionConfig *action.Configuration, logger log.Logger, args []st
 		newLintCmd(logger),
 		newSearchCmd(logger),
 		newDocsCmd(logger),
+		newBundleCmd(actionConfig, logger),
+		newCacheCmd(logger),
+		newSyncCmd(actionConfig, logger),
+		newExportCmd(actionConfig, logger),
+		newDiffCmd(actionConfig, logger),
+		newDebugCmd(logger),
+		newPluginCmd(logger),
+		newConfigCmd(logger),
 	)
 
-	flags.ParseErrorsWhitelist.UnknownFlags = true
-	err := flags.Parse(args)
-
-	// Flags are parsed, lets fill the helm cli.Settings with our current settings
-	settings.FillHelmSettings()
-
-	if err != nil && !errors.Is(err, pflag.ErrHelp) {
-		log.Errorf("failed while parsing flags for %s: %s", args, err)
-
-		os.Exit(1)
-	}
-
 	flags.Visit(func(f *pflag.Flag) {
 		if f.Name == "namespace" || f.Name == "n" {
 			settings.NamespaceFromFlag = true
@@ -81,5 +104,32 @@ func newRootCmd(actionConfig *action.Configuration, logger log.Logger, args []st
 		color.NoColor = true // disable colorized output
 	}
 
+	// Find and add plugins
+	loadPlugins(cmd, logio.NewWriter(logger, log.InfoLevel), logger)
+
 	return cmd, nil
 }
+
+// newLogger returns the logger for the format of '--log-format': logger for
+// text, or a JSON logger writing to the info level of logger for json, which
+// becomes the current logger. Emojis and colors are disabled for json.
+func newLogger(logger log.Logger) (log.Logger, error) {
+	switch settings.LogFormat {
+	case cli.LogFormatText:
+		return logger, nil
+	case cli.LogFormatJSON:
+		l := logjson.New(logio.NewWriter(logger, log.InfoLevel))
+		if settings.Debug {
+			l.Level = log.DebugLevel
+		}
+		if settings.Verbose {
+			l.Level = log.TraceLevel
+		}
+		settings.NoEmojis = true
+		settings.NoColors = true
+		log.Current = l
+		return l, nil
+	}
+	return nil, errors.Errorf("invalid log format %q, must be one of %s, %s",
+		settings.LogFormat, cli.LogFormatText, cli.LogFormatJSON)
+}
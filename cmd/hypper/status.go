@@ -24,7 +24,9 @@ import (
 
 	"github.com/Masterminds/log-go"
 	logio "github.com/Masterminds/log-go/io"
+	"github.com/rancher-sandbox/hypper/internal/solver"
 	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
 	"github.com/spf13/cobra"
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/chartutil"
@@ -177,3 +179,156 @@ func executionsByHookEvent(rel *release.Release) map[release.HookEvent][]*releas
 	}
 	return result
 }
+
+// releasesPrinter prints the releases created by installing a chart together
+// with its shared dependencies, in the order they were installed. Tables have
+// the status of each release, with its notes. JSON and YAML have a document
+// with the status of the solver, the tree of charts to install, and a summary
+// of each release.
+type releasesPrinter struct {
+	result   *installResult
+	releases []*release.Release
+	debug    bool
+}
+
+// installResult is the document printed by releasesPrinter in JSON and YAML.
+type installResult struct {
+	// Status is the status of the solver: SAT, UNSAT or UNKNOWN.
+	Status          string   `json:"status"`
+	Inconsistencies []string `json:"inconsistencies,omitempty"`
+	DryRun          bool     `json:"dryRun"`
+	// Tree is the tree of charts to install, with the shared dependencies of
+	// each chart.
+	Tree     *installTree       `json:"tree,omitempty"`
+	Releases []installedRelease `json:"releases"`
+}
+
+type installTree struct {
+	Release      string         `json:"release"`
+	Namespace    string         `json:"namespace"`
+	Chart        string         `json:"chart"`
+	Version      string         `json:"version"`
+	Dependencies []*installTree `json:"dependencies,omitempty"`
+}
+
+type installedRelease struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+	Revision  int    `json:"revision"`
+	Status    string `json:"status"`
+	Chart     string `json:"chart,omitempty"`
+	Version   string `json:"version,omitempty"`
+	Notes     string `json:"notes,omitempty"`
+}
+
+// newReleasesPrinter returns a releasesPrinter for rels, installed from the
+// solution rs, which is nil if the solver wasn't run.
+func newReleasesPrinter(dryRun bool, rs *solver.PkgResultSet, rels []*release.Release) *releasesPrinter {
+	result := &installResult{
+		DryRun:   dryRun,
+		Releases: []installedRelease{},
+	}
+	if rs != nil {
+		result.Status = rs.Status
+		result.Inconsistencies = rs.Inconsistencies
+		result.Tree = newInstallTree(rs.ToInstall)
+	}
+	p := &releasesPrinter{result: result, debug: settings.Debug}
+	for _, rel := range rels {
+		if rel == nil {
+			continue
+		}
+		p.releases = append(p.releases, rel)
+		result.Releases = append(result.Releases, newInstalledRelease(rel))
+	}
+	return p
+}
+
+func newInstalledRelease(rel *release.Release) installedRelease {
+	r := installedRelease{
+		Name:      rel.Name,
+		Namespace: rel.Namespace,
+		Revision:  rel.Version,
+	}
+	if rel.Info != nil {
+		r.Status = rel.Info.Status.String()
+		r.Notes = strings.TrimSpace(rel.Info.Notes)
+	}
+	if rel.Chart != nil && rel.Chart.Metadata != nil {
+		r.Chart = rel.Chart.Metadata.Name
+		r.Version = rel.Chart.Metadata.Version
+	}
+	return r
+}
+
+func newInstallTree(tr *solver.PkgTree) *installTree {
+	if tr == nil || tr.Node == nil {
+		return nil
+	}
+	t := &installTree{
+		Release:   tr.Node.ReleaseName,
+		Namespace: tr.Node.Namespace,
+		Chart:     tr.Node.ChartName,
+		Version:   tr.Node.Version,
+	}
+	for _, dep := range tr.Relations {
+		if d := newInstallTree(dep); d != nil {
+			t.Dependencies = append(t.Dependencies, d)
+		}
+	}
+	return t
+}
+
+func (p *releasesPrinter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, p.result)
+}
+
+func (p *releasesPrinter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, p.result)
+}
+
+func (p *releasesPrinter) WriteTable(out io.Writer) error {
+	for i, rel := range p.releases {
+		if i > 0 {
+			fmt.Fprintln(out)
+		}
+		if err := (statusPrinter{rel, p.debug, false}).WriteTable(out); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSolvedReleases prints the releases installed from the solution rs
+// before failing, in JSON and YAML, if it got to solve. Tables are skipped, as
+// the progress has been printed already.
+func writeSolvedReleases(out io.Writer, outfmt output.Format, dryRun bool, rs *solver.PkgResultSet, rels []*release.Release) {
+	if outfmt == output.Table || rs == nil {
+		return
+	}
+	_ = outfmt.Write(out, newReleasesPrinter(dryRun, rs, rels))
+}
+
+// outputLogger returns the logger for commands printing in outfmt: logger for
+// tables, or a quietLogger for JSON and YAML.
+func outputLogger(logger log.Logger, outfmt output.Format) log.Logger {
+	if outfmt == output.Table {
+		return logger
+	}
+	return quietLogger{logger}
+}
+
+// quietLogger logs the info messages of Logger at the debug level, for
+// commands printing a document that info messages would corrupt.
+type quietLogger struct {
+	log.Logger
+}
+
+func (l quietLogger) Info(msg ...interface{}) { l.Debug(msg...) }
+
+func (l quietLogger) Infof(template string, args ...interface{}) { l.Debugf(template, args...) }
+
+func (l quietLogger) Infow(msg string, fields log.Fields) { l.Debugw(msg, fields) }
+
+// Event keeps the structured events of Logger.
+func (l quietLogger) Event(name string, fields log.Fields) { logjson.Event(l.Logger, name, fields) }
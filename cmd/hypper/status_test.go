@@ -17,12 +17,16 @@ limitations under the License.
 package main
 
 import (
+	"bytes"
 	"testing"
 	"time"
 
 	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/cli/output"
 	"helm.sh/helm/v3/pkg/release"
 	helmtime "helm.sh/helm/v3/pkg/time"
+
+	"github.com/rancher-sandbox/hypper/internal/test"
 )
 
 func TestStatusCmd(t *testing.T) {
@@ -112,6 +116,41 @@ func TestStatusCmd(t *testing.T) {
 	runTestCmd(t, tests)
 }
 
+func TestReleasesPrinter(t *testing.T) {
+	rels := []*release.Release{}
+	for _, name := range []string{"shared-dep", "app"} {
+		rels = append(rels, &release.Release{
+			Name:      name,
+			Namespace: "default",
+			Version:   1,
+			Info: &release.Info{
+				LastDeployed: helmtime.Unix(1452902400, 0).UTC(),
+				Status:       release.StatusDeployed,
+				Notes:        name + " notes",
+			},
+			Chart: &chart.Chart{Metadata: &chart.Metadata{Name: name, Version: "0.1.0"}},
+		})
+	}
+
+	for _, tt := range []struct {
+		format output.Format
+		golden string
+	}{
+		{output.Table, "output/releases-with-notes.txt"},
+		{output.JSON, "output/releases-with-notes.json"},
+		{output.YAML, "output/releases-with-notes.yaml"},
+	} {
+		t.Run(tt.format.String(), func(t *testing.T) {
+			var out bytes.Buffer
+			p := newReleasesPrinter(false, nil, rels)
+			if err := tt.format.Write(&out, p); err != nil {
+				t.Fatal(err)
+			}
+			test.AssertGoldenString(t, out.String(), tt.golden)
+		})
+	}
+}
+
 func mustParseTime(t string) helmtime.Time {
 	res, _ := helmtime.Parse(time.RFC3339, t)
 	return res
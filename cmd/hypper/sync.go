@@ -0,0 +1,170 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+
+	"github.com/rancher-sandbox/hypper/cmd/hypper/require"
+	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"helm.sh/helm/v3/pkg/cli/output"
+)
+
+const syncDesc = `
+Bring the releases of the cluster to the state described in a Hypperfile.
+
+The Hypperfile defaults to 'Hypperfile.yaml' in the current directory. It lists
+the desired releases:
+
+    releases:
+      - chart: ours/frontend     # "repo/chart", or a chart name
+        version: "^1.0.0"        # version or semver range, optional
+        name: my-frontend        # release name, optional
+        namespace: web           # release namespace, optional
+        values:                  # values, optional
+          replicas: 2
+
+Release names and namespaces default to the ones in the chart annotations, as
+when installing. A release can also lock the chart 'digest' of an exact
+version. The 'repositories' listed in the Hypperfile, as written by
+'hypper export', need to be added with 'hypper repo add' under any name.
+
+All the listed releases are solved together with their shared dependencies, in
+one run. Missing releases get installed, and releases whose version is out of
+range get upgraded. Releases in range whose values differ from the listed ones
+get upgraded to the same version, with the listed values. Shared dependencies
+not listed get installed if missing, and keep their values when upgraded.
+
+With '--prune', releases that are neither listed nor shared dependencies of the
+listed ones get removed.
+Releases in the way of the listed ones, such as releases depending on an older
+version of a listed chart, get changed to another version too, or removed if
+there's no other way. Releases of charts that only contain CRDs are never
+removed, and upgrading them across a major version needs
+'--allow-crd-major-upgrade'.
+
+With '--dry-run', the changes are only printed.
+`
+
+func newSyncCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command {
+	client := action.NewSync(cfg)
+	var outfmt output.Format
+
+	cmd := &cobra.Command{
+		Use:   "sync [HYPPERFILE]",
+		Short: "bring the releases of the cluster to the state described in a Hypperfile",
+		Long:  syncDesc,
+		Args:  require.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			path := action.HypperfileName
+			if len(args) == 1 {
+				path = args[0]
+			}
+			hf, err := action.LoadHypperfile(path)
+			if err != nil {
+				return err
+			}
+
+			// map hypper's NoCreateNamespace to Helm's CreateNamespace
+			client.InstallClient.CreateNamespace = !client.InstallClient.NoCreateNamespace
+
+			changes, err := client.Run(hf, settings, logger)
+			if err != nil {
+				return errors.New(eyecandy.ESPrintf(settings.NoEmojis, ":x: %s", err))
+			}
+
+			wInfo := logio.NewWriter(logger, log.InfoLevel)
+			return outfmt.Write(wInfo, &syncWriter{changes, client.DryRun})
+		},
+	}
+
+	f := cmd.Flags()
+	f.BoolVar(&client.Prune, "prune", false, "remove releases that are neither listed nor shared dependencies of the listed ones")
+	f.BoolVar(&client.DryRun, "dry-run", false, "print the changes without applying them")
+	f.BoolVar(&client.AllowCRDMajorUpgrade, "allow-crd-major-upgrade", false, "allow upgrading charts that only contain CRDs across a major version")
+	f.BoolVar(&client.InstallClient.NoCreateNamespace, "no-create-namespace", false, "don't create the release namespace if not present")
+	f.BoolVar(&client.InstallClient.DisableHooks, "no-hooks", false, "disable pre/post install and upgrade hooks")
+	f.DurationVar(&client.InstallClient.Timeout, "timeout", 300*time.Second, "time to wait for any individual Kubernetes operation (like Jobs for hooks)")
+	f.BoolVar(&client.InstallClient.Wait, "wait", false, "if set, will wait until all Pods, PVCs, Services, and minimum number of Pods of a Deployment, StatefulSet, or ReplicaSet are in a ready state before marking each release as successful. It will wait for as long as --timeout")
+	bindOutputFlag(cmd, &outfmt)
+
+	return cmd
+}
+
+type syncWriter struct {
+	changes []*action.SyncChange
+	dryRun  bool
+}
+
+// syncMarkers are the diff-like markers of each action in the table output.
+var syncMarkers = map[action.SyncAction]string{
+	action.SyncInstall:   "+",
+	action.SyncUpgrade:   "~",
+	action.SyncRemove:    "-",
+	action.SyncUnchanged: "=",
+}
+
+func (s *syncWriter) WriteTable(out io.Writer) error {
+	changed := 0
+	table := uitable.New()
+	table.AddRow("", "RELEASE", "NAMESPACE", "CHART", "VERSION")
+	for _, c := range s.changes {
+		version := c.Version
+		if c.Action == action.SyncUpgrade && c.FromVersion == c.Version {
+			version = fmt.Sprintf("%s, values", c.Version)
+		} else if c.Action == action.SyncUpgrade {
+			version = fmt.Sprintf("%s -> %s", c.FromVersion, c.Version)
+		}
+		if c.Action != action.SyncUnchanged {
+			changed++
+		}
+		table.AddRow(syncMarkers[c.Action], c.ReleaseName, c.Namespace, c.Chart, version)
+	}
+
+	if changed == 0 {
+		_, err := fmt.Fprintln(out, eyecandy.ESPrint(settings.NoEmojis,
+			":check_mark_button: Releases are in sync with the Hypperfile"))
+		return err
+	}
+	if err := output.EncodeTable(out, table); err != nil {
+		return err
+	}
+	if s.dryRun {
+		_, err := fmt.Fprintf(out, "%d releases would be changed, run without --dry-run to apply\n", changed)
+		return err
+	}
+	_, err := fmt.Fprintln(out, eyecandy.ESPrintf(settings.NoEmojis,
+		":clapping_hands:%d releases changed", changed))
+	return err
+}
+
+func (s *syncWriter) WriteJSON(out io.Writer) error {
+	return output.EncodeJSON(out, s.changes)
+}
+
+func (s *syncWriter) WriteYAML(out io.Writer) error {
+	return output.EncodeYAML(out, s.changes)
+}
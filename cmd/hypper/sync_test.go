@@ -0,0 +1,64 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestSyncCmd(t *testing.T) {
+	repoFlags := "--repository-config testdata/sync/repositories.yaml --repository-cache testdata/sync/repository"
+
+	rels := []*release.Release{
+		release.Mock(&release.MockReleaseOptions{
+			Name:      "app",
+			Namespace: "app-ns",
+			Chart:     chart.Mock(&chart.MockChartOptions{Name: "app", Version: "1.0.0"}),
+		}),
+		release.Mock(&release.MockReleaseOptions{
+			Name:      "extra",
+			Namespace: "extra-ns",
+			Chart:     chart.Mock(&chart.MockChartOptions{Name: "extra", Version: "1.0.0"}),
+		}),
+	}
+
+	tests := []cmdTestCase{
+		{
+			name:   "sync dry-run",
+			cmd:    fmt.Sprintf("sync testdata/sync/Hypperfile.yaml --dry-run --prune %s", repoFlags),
+			golden: "output/sync-dry-run.txt",
+			rels:   rels,
+		},
+		{
+			name:   "sync dry-run, json output",
+			cmd:    fmt.Sprintf("sync testdata/sync/Hypperfile.yaml --dry-run --prune -o json %s", repoFlags),
+			golden: "output/sync-dry-run-json.txt",
+			rels:   rels,
+		},
+		{
+			name:      "sync with a Hypperfile that doesn't exist",
+			cmd:       fmt.Sprintf("sync testdata/sync/non-existent.yaml %s", repoFlags),
+			golden:    "output/sync-not-found.txt",
+			wantError: true,
+		},
+	}
+	runTestCmd(t, tests)
+}
@@ -0,0 +1,9 @@
+#!/bin/sh
+echo $HELM_PLUGIN_NAME
+echo $HELM_PLUGIN_DIR
+echo $HYPPER_PLUGIN_NAME
+echo $HYPPER_PLUGIN_DIR
+echo $HYPPER_PLUGINS
+echo $HYPPER_REPOSITORY_CONFIG
+echo $HYPPER_REPOSITORY_CACHE
+echo $HYPPER_BIN
@@ -17,22 +17,29 @@ limitations under the License.
 package main
 
 import (
+	"bufio"
+	"os"
 	"time"
 
 	"github.com/Masterminds/log-go"
 	logio "github.com/Masterminds/log-go/io"
+	"github.com/jinzhu/copier"
 	"github.com/rancher-sandbox/hypper/internal/solver"
 	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
 	"github.com/rancher-sandbox/hypper/pkg/action"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cluster"
 	"helm.sh/helm/v3/cmd/helm/require"
 	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/cli/output"
 	"helm.sh/helm/v3/pkg/cli/values"
 	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/release"
 	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
@@ -52,6 +59,26 @@ where the chart will be upgraded. By priority order:
 3. By using catalog.cattle.io annotations in the Chart.yaml
 4. By using the current namespace as configured with the kubeconfig
 
+Before upgrading, the shared dependencies of the chart that are missing get
+installed, unless '--no-shared-deps' is set. Optional shared dependencies, of
+the chart and of its shared dependencies, are installed following
+'--optional-deps': 'ask' for each of them (default), 'all', 'none', or
+'best-effort' for as many of them as possible. Optional dependencies declined
+when asked are remembered, and not asked for again.
+
+Before installing the missing shared dependencies, when reading from a
+terminal, a summary of the solution is printed for confirming it, as in 'hypper
+install'. Pass '--yes' to upgrade without it.
+
+Upgrading a chart that only contains CRDs across a major version asks for
+confirmation first, unless '--allow-crd-major-upgrade' is passed.
+
+With '--dump-solver-problem FILE', the problem given to the solver for the
+shared dependencies is written to FILE, as in 'hypper install'.
+
+With '--install', a release that doesn't exist yet is installed as in 'hypper
+install', printing the status of every release created.
+
 To override values in a chart, use either the '--values' flag and pass in a file
 or use the '--set' flag and pass configuration from the command line, to force string
 values, use '--set-string'. In case a value is large and therefore
@@ -75,118 +102,51 @@ func newUpgradeCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command
 	client := action.NewUpgrade(cfg)
 	valueOpts := &values.Options{}
 	var outfmt output.Format
-	var noCreateNamespace bool
+	var yes bool
+	clusterOpts := &clusterOptions{}
 
 	cmd := &cobra.Command{
 		Use:   "upgrade [CHART]",
 		Short: "upgrade a chart",
-		Long:  upgradeDesc,
+		Long:  upgradeDesc + clustersHelp,
 		Args:  require.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			client.Namespace = settings.Namespace()
-
-			wInfo := logio.NewWriter(logger, log.InfoLevel)
-
-			chartPath, err := client.ChartPathOptions.LocateChart(args[0], settings.EnvSettings)
-			if err != nil {
+			if err := setFlagsFromConfig(cmd.Flags()); err != nil {
 				return err
 			}
-
-			// Check chart dependencies to make sure all are present in /charts
-			ch, err := loader.Load(chartPath)
+			client.OptionalDeps = optionalDepsStrategy()
+			clusters, err := clusterOpts.clusters()
 			if err != nil {
 				return err
 			}
-			if req := ch.Metadata.Dependencies; req != nil {
-				if err := action.CheckDependencies(ch, req); err != nil {
-					return err
-				}
-			}
-
-			if ch.Metadata.Deprecated {
-				logger.Warn(eyecandy.ESPrint(settings.NoEmojis, "This chart has been deprecated :exclamation:"))
-
-			}
-			if client.ReleaseName == "" {
-				client.ReleaseName, err = action.GetName(ch, "")
-				if err != nil {
-					return err
-				}
-				logger.Debugf("client.ReleaseName was empty, setting release name to %s", client.ReleaseName)
-			}
-
-			// Fixes helm#7002 - Support reading values from STDIN for `upgrade` command
-			// Must load values AFTER determining if we have to call install so that values loaded from stdin are are not read twice
-			if client.Install {
-				// If a release does not exist, install it.
-				histClient := action.NewHistory(cfg)
-				histClient.Max = 1
-				if _, err := histClient.Run(client.ReleaseName); err == driver.ErrReleaseNotFound {
-					// Only print this to stdout for table output
-					if outfmt == output.Table {
-						logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":toolbox: Release %q does not exist. Installing it now.\n", client.ReleaseName))
-					}
-					instClient := action.NewInstall(cfg)
-					// Set namespace for the install client
-					action.SetNamespace(client, ch, settings.Namespace(), settings.NamespaceFromFlag)
-
-					instClient.CreateNamespace = !noCreateNamespace
-					instClient.ChartPathOptions = client.ChartPathOptions
-					instClient.DryRun = client.DryRun
-					instClient.DisableHooks = client.DisableHooks
-					instClient.SkipCRDs = client.SkipCRDs
-					instClient.Timeout = client.Timeout
-					instClient.Wait = client.Wait
-					instClient.WaitForJobs = client.WaitForJobs
-					instClient.Devel = client.Devel
-					instClient.Namespace = client.Namespace
-					instClient.Atomic = client.Atomic
-					instClient.PostRenderer = client.PostRenderer
-					instClient.DisableOpenAPIValidation = client.DisableOpenAPIValidation
-					instClient.SubNotes = client.SubNotes
-					instClient.Description = client.Description
-					instClient.ReleaseName = client.ReleaseName
-
-					rels, err := runInstall(solver.InstallOne, args, instClient, valueOpts, logger)
-					if err != nil {
-						return err
-					}
-					return outfmt.Write(wInfo, &statusPrinter{rels[0], settings.Debug, false}) // TODO should be all rels, not rels[0]
-				} else if err != nil {
-					return err
-				}
-			}
-
-			if client.Version == "" && client.Devel {
-				logger.Debug("setting version to >0.0.0-0")
-				client.Version = ">0.0.0-0"
+			if clusters != nil {
+				return upgradeOnClusters(args, client, valueOpts, outfmt, cmd.Flags(), clusters, clusterOpts.maxParallel, logger)
 			}
+			client.Review = reviewBeforeInstall(yes, outfmt)
 
+			wInfo := logio.NewWriter(logger, log.InfoLevel)
 			vals, err := valueOpts.MergeValues(getter.All(settings.EnvSettings))
 			if err != nil {
 				return err
 			}
-			// Set namespace for the upgrade client
-			action.SetNamespace(client, ch, settings.Namespace(), settings.NamespaceFromFlag)
-
-			rel, err := client.Run(client.ReleaseName, ch, vals)
+			rels, rs, err := runUpgrade(args, client, vals, outfmt, cfg, settings, logger)
 			if err != nil {
-				return errors.Wrap(err, "UPGRADE FAILED")
-			}
-
-			if outfmt == output.Table {
-				logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":partying_face: Release %q has been upgraded.", client.ReleaseName))
+				writeSolvedReleases(wInfo, outfmt, client.DryRun, rs, rels)
+				return err
 			}
-
-			return outfmt.Write(wInfo, &statusPrinter{rel, settings.Debug, false})
-
+			return outfmt.Write(wInfo, newReleasesPrinter(client.DryRun, rs, rels))
 		},
 	}
 
 	f := cmd.Flags()
-	f.BoolVar(&noCreateNamespace, "no-create-namespace", false, "if --install is set, don't create the release namespace if not present")
+	f.BoolVar(&client.NoCreateNamespace, "no-create-namespace", false, "don't create the namespace of the release if --install is set, nor of its shared dependencies, if not present")
+	f.BoolVar(&client.NoSharedDeps, "no-shared-deps", false, "skip installation of missing shared dependencies")
+	f.BoolVarP(&yes, "yes", "y", false, "install missing shared dependencies without reviewing the summary of the solution first")
+	f.BoolVar(&client.AllowCRDMajorUpgrade, "allow-crd-major-upgrade", false, "upgrade a chart that only contains CRDs across a major version without asking")
+	f.StringVar(&client.DumpSolverProblem, "dump-solver-problem", "", "write the solver problem of the shared dependencies to a file, as OPB if it has the .opb extension, or as YAML")
+	addOptionalDepsFlag(f, "install optional shared dependencies, also of the shared dependencies [ask|all|none|best-effort]")
 	f.BoolVarP(&client.Install, "install", "i", false, "if a release by this name doesn't already exist, run an install")
-	f.BoolVar(&client.Devel, "devel", false, "use development versions, too. Equivalent to version '>0.0.0-0'. If --version is set, this is ignored")
+	f.BoolVar(&client.Devel, "devel", false, "use development versions, also for shared dependencies. Equivalent to version '>0.0.0-0'. If --version is set, this is ignored")
 	f.BoolVar(&client.DryRun, "dry-run", false, "simulate an upgrade")
 	f.BoolVar(&client.Recreate, "recreate-pods", false, "performs pods restart for the resource if applicable")
 	_ = f.MarkDeprecated("recreate-pods", "functionality will no longer be updated. Consult the documentation for other methods to recreate pods")
@@ -207,8 +167,176 @@ func newUpgradeCmd(cfg *action.Configuration, logger log.Logger) *cobra.Command
 	f.StringVar(&client.ReleaseName, "release-name", "", "add a custom release name, overrides annotations")
 	addChartPathOptionsFlags(f, &client.ChartPathOptions)
 	addValueOptionsFlags(f, valueOpts)
+	addClusterFlags(f, clusterOpts)
 	bindOutputFlag(cmd, &outfmt)
 	bindPostRenderFlag(cmd, &client.PostRenderer)
 
 	return cmd
 }
+
+// runUpgrade upgrades the release of the chart in args with client and the
+// values vals, on the cluster of cfg and settings. With '--install', a release that doesn't
+// exist is installed instead.
+//
+// It returns the releases installed, in order, ending with the release
+// upgraded, and the solution of their shared dependencies, nil if the solver
+// wasn't run.
+func runUpgrade(args []string, client *action.Upgrade, vals map[string]interface{}, outfmt output.Format,
+	cfg *action.Configuration, settings *cli.EnvSettings, logger log.Logger) ([]*release.Release, *solver.PkgResultSet, error) {
+	client.Namespace = settings.Namespace()
+
+	chartPath, err := action.LocateChart(&client.ChartPathOptions, args[0], settings, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Check chart dependencies to make sure all are present in /charts
+	ch, err := loader.Load(chartPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if req := ch.Metadata.Dependencies; req != nil {
+		if err := action.CheckDependencies(ch, req); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if ch.Metadata.Deprecated {
+		logger.Warn(eyecandy.ESPrint(settings.NoEmojis, "This chart has been deprecated :exclamation:"))
+
+	}
+	if client.ReleaseName == "" {
+		client.ReleaseName, err = action.GetName(ch, "")
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.Debugf("client.ReleaseName was empty, setting release name to %s", client.ReleaseName)
+	}
+
+	if client.Install {
+		// If a release does not exist, install it.
+		histClient := action.NewHistory(cfg)
+		histClient.Max = 1
+		if _, err := histClient.Run(client.ReleaseName); err == driver.ErrReleaseNotFound {
+			// Only print this to stdout for table output
+			if outfmt == output.Table {
+				logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":toolbox: Release %q does not exist. Installing it now.\n", client.ReleaseName))
+			}
+			instClient := action.NewInstall(cfg)
+			// Set namespace for the install client
+			action.SetNamespace(client, ch, settings.Namespace(), settings.NamespaceFromFlag)
+
+			instClient.NoSharedDeps = client.NoSharedDeps
+			instClient.OptionalDeps = client.OptionalDeps
+			instClient.NoCreateNamespace = client.NoCreateNamespace
+			instClient.DumpSolverProblem = client.DumpSolverProblem
+			instClient.Review = client.Review
+			instClient.Unattended = client.Unattended
+			instClient.ChartPathOptions = client.ChartPathOptions
+			instClient.DryRun = client.DryRun
+			instClient.DisableHooks = client.DisableHooks
+			instClient.SkipCRDs = client.SkipCRDs
+			instClient.Timeout = client.Timeout
+			instClient.Wait = client.Wait
+			instClient.WaitForJobs = client.WaitForJobs
+			instClient.Devel = client.Devel
+			instClient.Namespace = client.Namespace
+			instClient.Atomic = client.Atomic
+			instClient.PostRenderer = client.PostRenderer
+			instClient.DisableOpenAPIValidation = client.DisableOpenAPIValidation
+			instClient.SubNotes = client.SubNotes
+			instClient.Description = client.Description
+			instClient.ReleaseName = client.ReleaseName
+
+			rels, err := runInstall(solver.InstallOne, args, instClient, vals, settings, outputLogger(logger, outfmt))
+			return rels, instClient.PkgResultSet, err
+		} else if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	// the policy checks the chart by the URL of its repository. Not set
+	// before --install, as runInstall locates the chart again by its name:
+	client.ChartPathOptions.RepoURL = action.ChartRepoURL(&client.ChartPathOptions, args[0], settings)
+	if err := client.CheckPolicy(ch, settings); err != nil {
+		return nil, nil, errors.New(eyecandy.ESPrintf(settings.NoEmojis, ":x: %s", err))
+	}
+
+	if client.Version == "" && client.Devel {
+		logger.Debug("setting version to >0.0.0-0")
+		client.Version = ">0.0.0-0"
+	}
+
+	// Set namespace for the upgrade client
+	action.SetNamespace(client, ch, settings.Namespace(), settings.NamespaceFromFlag)
+
+	if err := client.ConfirmCRDMajorUpgrade(ch, bufio.NewReader(os.Stdin), settings, logger); err != nil {
+		return nil, nil, errors.New(eyecandy.ESPrintf(settings.NoEmojis, ":x: %s", err))
+	}
+
+	rels, err := client.InstallSharedDeps(ch, chartPath, settings, outputLogger(logger, outfmt))
+	if err != nil {
+		return rels, client.PkgResultSet, errors.New(eyecandy.ESPrintf(settings.NoEmojis, ":x: %s", err))
+	}
+
+	rel, err := client.Run(client.ReleaseName, ch, vals)
+	if err != nil {
+		return rels, client.PkgResultSet, errors.Wrap(err, "UPGRADE FAILED")
+	}
+
+	if outfmt == output.Table {
+		logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":partying_face: Release %q has been upgraded.", client.ReleaseName))
+	}
+	return append(rels, rel), client.PkgResultSet, nil
+}
+
+// upgradeOnClusters upgrades the release of the chart in args on each of the
+// clusters, at most maxParallel at once, with a copy of client for each.
+// Nothing is asked: missing shared dependencies are installed without review,
+// and upgrades of CRD-only charts across a major version fail unless allowed.
+// It prints the result of every cluster.
+//
+// As for installOnClusters, the values are merged once for all the clusters.
+func upgradeOnClusters(args []string, client *action.Upgrade, valueOpts *values.Options, outfmt output.Format,
+	f *pflag.FlagSet, clusters []*cluster.Cluster, maxParallel int, logger log.Logger) error {
+
+	vals, err := valueOpts.MergeValues(getter.All(settings.EnvSettings))
+	if err != nil {
+		return err
+	}
+	unset := unsetConfigFlags(f)
+
+	rels := make([][]*release.Release, len(clusters))
+	errs := runOnClusters(clusters, maxParallel, false, logger,
+		func(idx int, settings *cli.EnvSettings, cfg *action.Configuration, logger log.Logger) error {
+			// copy Helm's client on its own, copying it embedded changes
+			// its configuration:
+			helmClient := action.NewUpgrade(cfg).Upgrade
+			if err := copier.Copy(helmClient, client.Upgrade); err != nil {
+				return err
+			}
+			clusterClient := *client
+			clusterClient.Upgrade = helmClient
+			clusterClient.Config = cfg
+			clusterClient.Review = false
+			clusterClient.Unattended = true
+			clusterClient.DumpSolverProblem = clusterPath(client.DumpSolverProblem, settings.KubeContext)
+			if err := setClusterFlags(unset, &settings.Profile, &clusterClient.OptionalDeps, &clusterClient.Timeout,
+				&clusterClient.AllowCRDMajorUpgrade); err != nil {
+				return err
+			}
+			clusterVals, err := clusterValues(vals)
+			if err != nil {
+				return err
+			}
+
+			rels[idx], _, err = runUpgrade(args, &clusterClient, clusterVals, outfmt, cfg, settings, outputLogger(logger, outfmt))
+			return err
+		})
+
+	wInfo := logio.NewWriter(logger, log.InfoLevel)
+	if err := outfmt.Write(wInfo, newClusterResultsWriter(clusters, rels, errs)); err != nil {
+		return err
+	}
+	return clustersError(clusters, errs)
+}
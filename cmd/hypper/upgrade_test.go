@@ -78,6 +78,11 @@ func TestUpgradeCmd(t *testing.T) {
 		t.Fatalf("Error loading updated chart: %v", err)
 	}
 
+	sharedDepsCh, err := loader.Load("testdata/testcharts/shared-deps")
+	if err != nil {
+		t.Fatalf("Error loading chart with shared deps: %v", err)
+	}
+
 	missingDepsPath := "testdata/testcharts/chart-missing-deps"
 	badDepsPath := "testdata/testcharts/chart-bad-requirements"
 
@@ -136,6 +141,23 @@ func TestUpgradeCmd(t *testing.T) {
 			cmd:    fmt.Sprintf("upgrade -i --release-name jojo '%s' %s", chartPath, repoSetup),
 			golden: "output/upgrade-with-install-release-name.txt",
 		},
+		{
+			name:   "install a release with shared deps with 'upgrade --install'",
+			cmd:    "upgrade -i testdata/testcharts/shared-deps --repository-config testdata/testcharts/repositories.yaml --repository-cache testdata/testcharts",
+			golden: "output/upgrade-with-install-shared-deps.txt",
+		},
+		{
+			name:   "install a release with shared deps with 'upgrade --install', output as json",
+			cmd:    "upgrade -i testdata/testcharts/shared-deps -o json --repository-config testdata/testcharts/repositories.yaml --repository-cache testdata/testcharts",
+			golden: "output/upgrade-with-install-shared-deps-json.txt",
+		},
+		{
+			name:   "upgrade a release installing its shared deps, output as json",
+			cmd:    "upgrade testdata/testcharts/shared-deps -o json --repository-config testdata/testcharts/repositories.yaml --repository-cache testdata/testcharts",
+			golden: "output/upgrade-with-shared-deps-json.txt",
+			rels: []*release.Release{release.Mock(&release.MockReleaseOptions{
+				Name: "my-hypper-name", Namespace: "hypper", Version: 1, Chart: sharedDepsCh})},
+		},
 		{
 			name:   "upgrade a release with --release-name",
 			cmd:    fmt.Sprintf("upgrade --release-name jojo '%s' %s", chartPath, repoSetup),
@@ -436,3 +458,26 @@ func TestUpgradeVersionCompletion(t *testing.T) {
 	}}
 	runTestCmd(t, tests)
 }
+
+func TestUpgradeCmdPolicyDeniesRepoAlias(t *testing.T) {
+	defer resetEnv()()
+
+	repoSetup, repoURL := policyRepoFixture(t)
+	_, _, err := executeActionCommandC(storageFixture(), "upgrade untrusted/compressedchart "+repoSetup)
+	expected := fmt.Sprintf("repository %q is not allowed", repoURL)
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error containing %q, got %v", expected, err)
+	}
+}
+
+func TestUpgradeCmdPolicyDeniesAbsoluteURL(t *testing.T) {
+	defer resetEnv()()
+
+	repoSetup, repoURL := policyRepoFixture(t)
+	cmd := fmt.Sprintf("upgrade %s/compressedchart-0.1.0.tgz %s", repoURL, repoSetup)
+	_, _, err := executeActionCommandC(storageFixture(), cmd)
+	expected := fmt.Sprintf("repository %q is not allowed", repoURL)
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error containing %q, got %v", expected, err)
+	}
+}
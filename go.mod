@@ -9,13 +9,15 @@ replace github.com/docker/distribution => github.com/docker/distribution v0.0.0-
 require (
 	github.com/Masterminds/log-go v0.4.0
 	github.com/Masterminds/semver/v3 v3.1.1
-	github.com/crillab/gophersat v1.3.1
+	github.com/Masterminds/vcs v1.13.1
+	github.com/crillab/gophersat v1.4.0
 	github.com/fatih/color v1.10.0
 	github.com/gofrs/flock v0.8.0
 	github.com/gosuri/uitable v0.0.4
 	github.com/jinzhu/copier v0.2.8
 	github.com/kyokomi/emoji/v2 v2.2.8
 	github.com/mattn/go-shellwords v1.0.11
+	github.com/mitchellh/copystructure v1.1.1
 	github.com/mitchellh/hashstructure/v2 v2.0.2
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cobra v1.2.1
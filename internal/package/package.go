@@ -48,6 +48,7 @@ type Pkg struct {
 	CurrentState       tristate  // current state of the package
 	DesiredState       tristate  // desired state of the package
 	PinnedVer          tristate  // if we have a pinnedVer or not in pkg.Version
+	CRDOnly            bool      `json:",omitempty" yaml:",omitempty"` // chart only contains CRDs, never removed
 }
 
 // PkgRel codifies a shared dependency relation to another package
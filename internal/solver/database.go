@@ -17,8 +17,8 @@ limitations under the License.
 package solver
 
 import (
-	"math"
 	"sort"
+	"strings"
 	"sync"
 
 	"github.com/Masterminds/log-go"
@@ -42,8 +42,6 @@ type PkgDB struct {
 	*sync.Mutex
 }
 
-var PkgDBInstance *PkgDB
-
 func (pkgdb *PkgDB) GetPackageByFingerprint(fp string) *pkg.Pkg {
 	p, ok := pkgdb.mapFingerprintToPkg[fp]
 	if !ok {
@@ -71,15 +69,14 @@ func (pkgdb *PkgDB) GetOrderedPackageFingerprintsThatDifferOnVersionByPackage(p
 		fps = append(fps, fp)
 	}
 
-	// Sort fps by weight
+	// Sort fps by semver precedence, the newest last:
 	sort.Slice(fps,
 		func(i, j int) bool {
-			semverI := CalculateSemverDistanceToZero(pkgdb.GetPackageByFingerprint(fps[i]).Version)
-			semverJ := CalculateSemverDistanceToZero(pkgdb.GetPackageByFingerprint(fps[j]).Version)
-			return semverI < semverJ
+			return compareVersions(pkgdb.GetPackageByFingerprint(fps[i]).Version,
+				pkgdb.GetPackageByFingerprint(fps[j]).Version) < 0
 		},
 	)
-	// create corresponding weight slice
+	// create corresponding weight slice, by rank:
 	for i := range fps {
 		weights = append(weights, i+1)
 	}
@@ -87,10 +84,25 @@ func (pkgdb *PkgDB) GetOrderedPackageFingerprintsThatDifferOnVersionByPackage(p
 	return fps, weights
 }
 
-func CalculateSemverDistanceToZero(semversion string) (distance int) {
-	sv := semver.MustParse(semversion)
-	distance = (int(sv.Major())*int(math.Pow(10, 13)) + int(sv.Minor())*int(math.Pow(10, 9)) + int(sv.Patch()))
-	return distance
+// compareVersions compares versions a and b by semver precedence: prereleases
+// go before their release, and build metadata is ignored. Versions that
+// differ only in build metadata, or are not valid semver, are compared as
+// strings, for a stable order.
+func compareVersions(a, b string) int {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	if c := va.Compare(vb); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
 }
 
 func (pkgdb *PkgDB) DebugPrintDB(logger log.Logger) {
@@ -100,17 +112,46 @@ func (pkgdb *PkgDB) DebugPrintDB(logger log.Logger) {
 	}
 }
 
-func CreatePkgDBInstance() *PkgDB {
-	PkgDBInstance = &PkgDB{
+// Remove removes package p from the database.
+func (pkgdb *PkgDB) Remove(p *pkg.Pkg) {
+	pkgdb.Lock()
+	defer pkgdb.Unlock()
+
+	fp := p.GetFingerPrint()
+	delete(pkgdb.mapFingerprintToPkg, fp)
+
+	bfp := p.GetBaseFingerPrint()
+	if versions, ok := pkgdb.mapBaseFingerprintToVersions[bfp]; ok && versions[p.Version] == fp {
+		delete(versions, p.Version)
+		if len(versions) == 0 {
+			delete(pkgdb.mapBaseFingerprintToVersions, bfp)
+		}
+	}
+}
+
+// Len returns the number of packages in the database.
+func (pkgdb *PkgDB) Len() int {
+	return len(pkgdb.mapFingerprintToPkg)
+}
+
+// sortedFingerprints returns the fingerprints of all packages in the database,
+// sorted.
+func (pkgdb *PkgDB) sortedFingerprints() []string {
+	fps := []string{}
+	for fp := range pkgdb.mapFingerprintToPkg {
+		fps = append(fps, fp)
+	}
+	sort.Strings(fps)
+	return fps
+}
+
+// NewPkgDB returns an empty package database.
+func NewPkgDB() *PkgDB {
+	return &PkgDB{
 		mapFingerprintToPkg:          make(map[string]*pkg.Pkg),
 		mapBaseFingerprintToVersions: make(map[string]map[string]string),
 		Mutex:                        &sync.Mutex{},
 	}
-	return PkgDBInstance
-}
-
-func GetPkgdDBInstance() *PkgDB {
-	return PkgDBInstance
 }
 
 // mergePkgs gives you a resulting package that is a copy of the new package,
@@ -134,6 +175,9 @@ func mergePkgs(old pkg.Pkg, new pkg.Pkg) (result *pkg.Pkg) {
 	if old.PinnedVer == pkg.Unknown {
 		result.PinnedVer = new.PinnedVer
 	}
+	// the chart of a release may be detected as CRD-only, while its chart in
+	// the repositories is only known by annotations:
+	result.CRDOnly = old.CRDOnly || new.CRDOnly
 
 	// Merge Depends and DependsOptional slices
 	if len(old.DependsRel) == 0 {
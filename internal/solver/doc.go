@@ -44,16 +44,26 @@ To perform a package operation, for example, "install packageA", we:
  present.
 
  2. Iterate through the package database and create pseudo-boolean
- constraints for the package fingerprint:
+ constraints for the package fingerprint. Packages not reachable from the
+ releases and the requested changes, through their dependency relations, are
+ pruned from the database first, as they can't be part of a solution (see
+ Solver.PruneUnreachable):
  - If package needs to be installed or not
  - If it depends on another package(s)
  - If it conflicts with other similar packages that differ with it only in
    version).
  - If we want to minimize or maximize the distance between present version
   and wanted version (upgrade to major versions, never upgrade, etc)
+ - If we want to install as many optional dependencies as possible, or as few
+   (soft clauses, see OptionalObjective)
+ - If present releases may be changed or removed, the cost of doing so (soft
+   clauses, see AllowChanges). Soft clauses are weighted so the objective is
+   lexicographic: fewest removals first, then fewest changes, then optional
+   dependencies, then newest versions.
 
  3. Find a solution to the SAT dependency problem if exists, or the
- contradiction if there's no solution.
+ contradiction if there's no solution. If the solver times out (see
+ Solver.Timeout), the best solution found so far is taken.
  The result is a list of tuple of:
  - Fingerprints (each corresponding with a package), and
  - Resulting state of the package (if the package should be present in the
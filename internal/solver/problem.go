@@ -0,0 +1,236 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	"github.com/crillab/gophersat/maxsat"
+	"github.com/pkg/errors"
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"gopkg.in/yaml.v2"
+)
+
+// ProblemFormat is the format of a dumped dependency problem.
+type ProblemFormat int
+
+const (
+	// ProblemYAML is a CUDF-like YAML document with the package database and
+	// the request, that can be replayed with LoadProblem.
+	ProblemYAML ProblemFormat = iota
+	// ProblemOPB is the pseudo-boolean constraints in the OPB format, WBO when
+	// there are soft constraints, for comparing against other solvers.
+	ProblemOPB
+)
+
+// Problem is a standalone dependency problem: the package database, and the
+// package to solve for, with the options of the solver. It doesn't depend on
+// the cluster nor the repositories, and is solved again in the same way.
+type Problem struct {
+	Strategy          SolverStrategy    `yaml:"strategy"`
+	OptionalObjective OptionalObjective `yaml:"optionalObjective"`
+	AllowChanges      bool              `yaml:"allowChanges"`
+	Devel             bool              `yaml:"devel"`
+	// Timeout bounds the time spent solving, zero for no timeout.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Request is the fingerprint of the wanted package, if any.
+	Request  string     `yaml:"request,omitempty"`
+	Packages []*pkg.Pkg `yaml:"packages"`
+	// Constraints generated for the packages, for reference. They are
+	// generated again when loading the problem.
+	Constraints []string `yaml:"constraints,omitempty"`
+}
+
+// WriteProblem writes the problem of the last solving to w, in format. It must
+// be called from OnProblemBuilt, or after Solve or SolveAlternatives.
+func (s *Solver) WriteProblem(w io.Writer, wantedPkg *pkg.Pkg, format ProblemFormat) error {
+	constrs := sortedConstrs(s.constrs)
+
+	if format == ProblemOPB {
+		return writeOPB(w, constrs)
+	}
+
+	p := Problem{
+		Strategy:          s.Strategy,
+		OptionalObjective: s.OptionalObjective,
+		AllowChanges:      s.AllowChanges,
+		Devel:             s.Devel,
+		Timeout:           s.Timeout,
+		Packages:          []*pkg.Pkg{},
+		Constraints:       []string{},
+	}
+	if wantedPkg != nil {
+		p.Request = wantedPkg.GetFingerPrint()
+	}
+	for _, fp := range s.PkgDB.sortedFingerprints() {
+		p.Packages = append(p.Packages, s.PkgDB.GetPackageByFingerprint(fp))
+	}
+	for _, c := range constrs {
+		p.Constraints = append(p.Constraints, formatConstr(c, func(v string) string { return v }))
+	}
+
+	o, err := yaml.Marshal(p)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(o)
+	return err
+}
+
+// LoadProblem reads a problem in the ProblemYAML format from r, and returns a
+// solver with its package database and options, and the wanted package, ready
+// for solving.
+func LoadProblem(r io.Reader, logger log.Logger) (*Solver, *pkg.Pkg, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	p := Problem{}
+	if err := yaml.UnmarshalStrict(b, &p); err != nil {
+		return nil, nil, errors.Wrap(err, "cannot read solver problem")
+	}
+
+	s := New(p.Strategy, logger)
+	s.OptionalObjective = p.OptionalObjective
+	s.AllowChanges = p.AllowChanges
+	s.Devel = p.Devel
+	s.Timeout = p.Timeout
+	s.BuildWorldMock(p.Packages)
+
+	var wantedPkg *pkg.Pkg
+	if p.Request != "" {
+		wantedPkg = s.PkgDB.GetPackageByFingerprint(p.Request)
+		if wantedPkg == nil {
+			return nil, nil, errors.Errorf("requested package %q is not in the solver problem", p.Request)
+		}
+	}
+	return s, wantedPkg, nil
+}
+
+// writeOPB writes constrs to w in the OPB format, naming the variables x1, x2…
+// and listing their fingerprints in comments. Soft constraints are written as
+// in the WBO format.
+func writeOPB(w io.Writer, constrs []maxsat.Constr) error {
+	vars := map[string]int{}
+	fps := []string{}
+	numSoft, minCost, maxCost, sumCost := 0, 0, 0, 0
+	for _, c := range constrs {
+		for _, l := range c.Lits {
+			if _, ok := vars[l.Var]; !ok {
+				fps = append(fps, l.Var)
+				vars[l.Var] = len(fps)
+			}
+		}
+		if c.Weight == 0 {
+			continue
+		}
+		numSoft++
+		sumCost += c.Weight
+		if minCost == 0 || c.Weight < minCost {
+			minCost = c.Weight
+		}
+		if c.Weight > maxCost {
+			maxCost = c.Weight
+		}
+	}
+
+	var sb strings.Builder
+	if numSoft == 0 {
+		sb.WriteString(fmt.Sprintf("* #variable= %d #constraint= %d\n", len(fps), len(constrs)))
+	} else {
+		sb.WriteString(fmt.Sprintf("* #variable= %d #constraint= %d #soft= %d mincost= %d maxcost= %d sumcost= %d\n",
+			len(fps), len(constrs), numSoft, minCost, maxCost, sumCost))
+	}
+	for i, fp := range fps {
+		sb.WriteString(fmt.Sprintf("* x%d %s\n", i+1, fp))
+	}
+	if numSoft != 0 {
+		// violating all soft constraints costs less than the top cost:
+		sb.WriteString(fmt.Sprintf("soft: %d ;\n", sumCost+1))
+	}
+	for _, c := range constrs {
+		sb.WriteString(formatConstr(c, func(v string) string { return fmt.Sprintf("x%d", vars[v]) }))
+		sb.WriteString("\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// formatConstr returns constraint c in the OPB syntax, with its weight in
+// brackets if soft, and the variables named by name. E.g:
+//
+//	[3] +1 x1 +1 ~x2 >= 1 ;
+func formatConstr(c maxsat.Constr, name func(string) string) string {
+	var sb strings.Builder
+	if c.Weight != 0 {
+		sb.WriteString(fmt.Sprintf("[%d] ", c.Weight))
+	}
+	for i, l := range c.Lits {
+		coeff := 1
+		if c.Coeffs != nil {
+			coeff = c.Coeffs[i]
+		}
+		neg := ""
+		if l.Negated {
+			neg = "~"
+		}
+		sb.WriteString(fmt.Sprintf("%+d %s%s ", coeff, neg, name(l.Var)))
+	}
+	sb.WriteString(fmt.Sprintf(">= %d ;", c.AtLeast))
+	return sb.String()
+}
+
+// sortedConstrs returns a copy of constrs sorted by their OPB syntax, and with
+// their literals sorted by variable, as they get generated in no particular
+// order.
+func sortedConstrs(constrs []maxsat.Constr) []maxsat.Constr {
+	sorted := []maxsat.Constr{}
+	for _, c := range constrs {
+		sorted = append(sorted, sortedLits(c))
+	}
+	key := func(c maxsat.Constr) string {
+		return formatConstr(c, func(v string) string { return v })
+	}
+	sort.SliceStable(sorted, func(i, j int) bool { return key(sorted[i]) < key(sorted[j]) })
+	return sorted
+}
+
+// sortedLits returns a copy of constraint c with its literals, and their
+// coefficients, sorted by variable.
+func sortedLits(c maxsat.Constr) maxsat.Constr {
+	idx := make([]int, len(c.Lits))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(i, j int) bool { return c.Lits[idx[i]].Var < c.Lits[idx[j]].Var })
+
+	result := maxsat.Constr{AtLeast: c.AtLeast, Weight: c.Weight}
+	for _, i := range idx {
+		result.Lits = append(result.Lits, c.Lits[i])
+		if c.Coeffs != nil {
+			result.Coeffs = append(result.Coeffs, c.Coeffs[i])
+		}
+	}
+	return result
+}
@@ -0,0 +1,126 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package solver
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+
+	"github.com/rancher-sandbox/hypper/internal/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func problemPkgs() []*pkg.Pkg {
+	rel := func(name, semverRange string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{
+			ReleaseName: name,
+			Namespace:   "targetns",
+			SemverRange: semverRange,
+			ChartName:   name,
+		}}
+	}
+	return []*pkg.Pkg{
+		pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+		pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("opt", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+	}
+}
+
+func TestLoadProblem(t *testing.T) {
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+	is := assert.New(t)
+
+	s := New(InstallOne, logger)
+	s.OptionalObjective = OptionalMaximize
+	s.Devel = true
+	s.Timeout = 90 * time.Second
+	s.BuildWorldMock(problemPkgs())
+	wantedPkg := s.PkgDB.GetPackageByFingerprint(pkg.CreateFingerPrint("wanted", "1.0.0", "targetns", "wanted"))
+	s.Solve(wantedPkg)
+	is.Equal("SAT", s.PkgResultSet.Status)
+
+	buf := new(bytes.Buffer)
+	is.NoError(s.WriteProblem(buf, wantedPkg, ProblemYAML))
+	dump := buf.String()
+
+	replayed, replayedWantedPkg, err := LoadProblem(strings.NewReader(dump), logger)
+	is.NoError(err)
+	is.Equal(wantedPkg, replayedWantedPkg)
+	is.Equal(OptionalMaximize, replayed.OptionalObjective)
+	is.True(replayed.Devel)
+	is.Equal(90*time.Second, replayed.Timeout)
+	is.Contains(dump, "timeout: 1m30s\n")
+	replayed.Solve(replayedWantedPkg)
+
+	// same solution, out of the same problem:
+	is.Equal(s.PkgResultSet.Status, replayed.PkgResultSet.Status)
+	is.ElementsMatch(treeFingerprints(s.PkgResultSet.ToInstall), treeFingerprints(replayed.PkgResultSet.ToInstall))
+	buf.Reset()
+	is.NoError(replayed.WriteProblem(buf, replayedWantedPkg, ProblemYAML))
+	is.Equal(dump, buf.String())
+
+	_, _, err = LoadProblem(strings.NewReader("request: foo\npackages: []\n"), logger)
+	is.EqualError(err, `requested package "foo" is not in the solver problem`)
+
+	_, _, err = LoadProblem(strings.NewReader("* #variable= 1 #constraint= 1\n+1 x1 >= 1 ;\n"), logger)
+	is.Error(err)
+}
+
+func TestWriteProblemOnProblemBuilt(t *testing.T) {
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+	is := assert.New(t)
+
+	s := New(InstallOne, logger)
+	s.BuildWorldMock(problemPkgs())
+	wantedPkg := s.PkgDB.GetPackageByFingerprint(pkg.CreateFingerPrint("wanted", "1.0.0", "targetns", "wanted"))
+	built := new(bytes.Buffer)
+	s.OnProblemBuilt = func() {
+		// not solved yet:
+		is.Equal("", s.PkgResultSet.Status)
+		is.NoError(s.WriteProblem(built, wantedPkg, ProblemYAML))
+	}
+	s.Solve(wantedPkg)
+	is.Equal("SAT", s.PkgResultSet.Status)
+
+	// the same problem as written after solving:
+	solved := new(bytes.Buffer)
+	is.NoError(s.WriteProblem(solved, wantedPkg, ProblemYAML))
+	is.NotEmpty(built.String())
+	is.Equal(solved.String(), built.String())
+}
+
+func TestWriteProblemOPB(t *testing.T) {
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	s := New(InstallOne, logger)
+	s.OptionalObjective = OptionalMaximize
+	s.BuildWorldMock(problemPkgs())
+	wantedPkg := s.PkgDB.GetPackageByFingerprint(pkg.CreateFingerPrint("wanted", "1.0.0", "targetns", "wanted"))
+	s.Solve(wantedPkg)
+
+	buf := new(bytes.Buffer)
+	assert.NoError(t, s.WriteProblem(buf, wantedPkg, ProblemOPB))
+	test.AssertGoldenString(t, buf.String(), "output/problem-opb.txt")
+}
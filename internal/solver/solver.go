@@ -19,11 +19,14 @@ check integrity and others.
 package solver
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"runtime"
 	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/Masterminds/log-go"
 	"github.com/Masterminds/semver/v3"
@@ -61,6 +64,39 @@ const (
 	//                dependencies.
 )
 
+// OptionalObjective is the objective of the solver regarding the optional
+// dependencies of packages, which are encoded as weighted soft clauses.
+type OptionalObjective int
+
+const (
+	// OptionalIgnore doesn't encode optional dependencies. Only those promoted
+	// to dependencies get installed.
+	OptionalIgnore OptionalObjective = iota
+	// OptionalMaximize installs as many optional dependencies as possible,
+	// without making the problem UNSAT.
+	OptionalMaximize
+	// OptionalMinimize installs as few optional dependencies as possible.
+	OptionalMinimize
+)
+
+// Weights of the soft clauses, by criteria. The objective is lexicographic:
+// the weight of a criteria is bigger than the sum of the weights of all the
+// soft clauses of the less important criteria, so a solution never trades a
+// worse result in a criteria for better results in the less important ones.
+// From most to least important:
+//
+//  1. Removal: minimize the present releases that get removed.
+//  2. Change: minimize the present releases that get changed to another
+//     version (or removed).
+//  3. Optional: maximize or minimize the optional dependencies installed.
+//  4. Freshness: prefer the newest versions of the packages to install. The
+//     weight of each version is its position when ordered by version.
+type objectiveWeights struct {
+	removal  int
+	change   int
+	optional int
+}
+
 // Solver performs SAT solving of dependency problems. It codifies the state of
 // the world into packages, saved into a package database. It gets created with
 // a specific SolverStrategy, and contains the results in PkgResultSet.
@@ -68,8 +104,41 @@ type Solver struct {
 	PkgDB        *PkgDB       // DB containing packages
 	PkgResultSet PkgResultSet // outcome of sat solving
 	Strategy     SolverStrategy
-	logger       log.Logger
-	model        maxsat.Model
+	// OptionalObjective is the objective for optional dependencies, ignored
+	// by default.
+	OptionalObjective OptionalObjective
+	// AllowChanges allows present releases to be changed to another version,
+	// or removed, if needed to find a solution. Removing a release is the last
+	// resort. By default, present releases are never changed, as when the
+	// solution is only used to install new releases.
+	AllowChanges bool
+	// Devel allows prereleases of a version to satisfy the ranges that its
+	// release satisfies. E.g: 1.1.0-rc1 satisfies ^1.0.0. By default, only
+	// ranges with prereleases are satisfied by prereleases.
+	Devel bool
+	// Timeout bounds the time spent solving. When reached, the best solution
+	// found so far is used, even if not optimal. Zero means no timeout, and
+	// the optimal solution is searched at once. With a timeout, the solution
+	// is improved step by step instead; the step in progress when the timeout
+	// is reached can't be interrupted, and finishes in the background without
+	// starting another.
+	Timeout time.Duration
+	// OnProblemBuilt, if set, is called once the constraints are built and
+	// before solving them, so the problem can be written even if solving
+	// doesn't finish.
+	OnProblemBuilt func()
+	logger         log.Logger
+	// keepUnreachable skips pruning the database before building the
+	// constraints, for benchmarking.
+	keepUnreachable bool
+	model           maxsat.Model
+	weights         objectiveWeights
+	constrs         []maxsat.Constr // constraints of the last solving
+	// pkgInconsistencies are the inconsistencies found when building the
+	// constraints of each package, by fingerprint. Guarded by inconsMu, as
+	// constraints are built concurrently.
+	pkgInconsistencies map[string][]string
+	inconsMu           sync.Mutex
 }
 
 // PkgTree is a polytree (directed, acyclic graph) of packages.
@@ -101,10 +170,13 @@ const (
 // New creates a new Solver, initializing its database.
 func New(strategy SolverStrategy, logger log.Logger) (s *Solver) {
 	s = &Solver{
-		PkgDB:        CreatePkgDBInstance(),
+		PkgDB:        NewPkgDB(),
 		PkgResultSet: PkgResultSet{},
 		Strategy:     strategy,
 		logger:       logger,
+		weights:      objectiveWeights{removal: 1, change: 1, optional: 1},
+
+		pkgInconsistencies: map[string][]string{},
 	}
 	s.PkgResultSet.Inconsistencies = []string{}
 	return s
@@ -128,7 +200,17 @@ func (s *Solver) BuildConstraints(p *pkg.Pkg) (constrs []maxsat.Constr) {
 
 	if p.CurrentState == pkg.Present && p.DesiredState != pkg.Absent {
 		// p is a release, and is not going to be changed
-		packageConstrs := s.buildConstraintPresent(p)
+		if s.AllowChanges {
+			packageConstrs = s.buildConstraintKeepPresent(p)
+		} else {
+			packageConstrs = s.buildConstraintPresent(p)
+		}
+		constrs = append(constrs, packageConstrs...)
+	}
+
+	if p.CRDOnly && p.CurrentState == pkg.Present {
+		// p is a release of a CRD-only chart, never removed
+		packageConstrs := s.buildConstraintCRDOnly(p)
 		constrs = append(constrs, packageConstrs...)
 	}
 
@@ -142,58 +224,453 @@ func (s *Solver) BuildConstraints(p *pkg.Pkg) (constrs []maxsat.Constr) {
 	packageConstrs = s.buildConstraintAtMost1(p)
 	constrs = append(constrs, packageConstrs...)
 
+	if s.OptionalObjective != OptionalIgnore {
+		// add soft constraints for optional relationships
+		packageConstrs = s.buildConstraintOptionalRelations(p)
+		constrs = append(constrs, packageConstrs...)
+	}
+
 	return constrs
 }
 
+// Alternative is a solution of the dependency problem, with its cost: the sum
+// of the weights of the soft constraints it doesn't satisfy. The lower the
+// cost, the better the solution.
+type Alternative struct {
+	PkgResultSet PkgResultSet
+	Cost         int
+}
+
 func (s *Solver) Solve(wantedPkg *pkg.Pkg) {
-	// generate constraints for all packages
-	s.logger.Debug("Building constraints…")
+	s.SolveContext(context.Background(), wantedPkg)
+}
+
+// SolveContext solves as Solve, until ctx is done or s.Timeout is reached.
+// Then, it uses the best solution found so far. If none was found, the status
+// of the result is UNKNOWN.
+func (s *Solver) SolveContext(ctx context.Context, wantedPkg *pkg.Pkg) {
+	constrs := s.buildAllConstraints()
+
+	ctx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	var optimal bool
+	s.model, _, optimal = s.solveConstrs(ctx, constrs)
+
+	if s.model != nil { // SAT
+		//	there is a result model, generate pkg sets then:
+		s.GeneratePkgSets(wantedPkg)
+		s.PkgResultSet.Status = "SAT"
+		s.logger.Debug("Result: SAT\n")
+		s.logger.Debug(s.FormatOutput(Table))
+	} else if optimal {
+		s.PkgResultSet.Status = "UNSAT"
+		s.logger.Debug("Result: UNSAT\n")
+	} else {
+		s.PkgResultSet.Status = "UNKNOWN"
+		s.PkgResultSet.Inconsistencies = append(s.PkgResultSet.Inconsistencies,
+			"No solution found before the solver timed out.\n")
+		s.logger.Debug("Result: UNKNOWN\n")
+	}
+}
+
+// SolveAlternatives solves as Solve, and then solves again and again blocking
+// the solutions already found, for up to n solutions. It returns them ordered
+// by increasing cost, and leaves the solver with the optimal one, as Solve
+// does.
+//
+// Solutions are told apart by their packages to install and the releases
+// they keep or remove.
+func (s *Solver) SolveAlternatives(wantedPkg *pkg.Pkg, n int) []*Alternative {
+	constrs := s.buildAllConstraints()
+
+	ctx, cancel := s.withTimeout(context.Background())
+	defer cancel()
+
+	alternatives := []*Alternative{}
+	var optimal maxsat.Model
+	for len(alternatives) < n {
+		s.logger.Debugf("Solving for alternative %d…\n", len(alternatives)+1)
+		model, cost, _ := s.solveConstrs(ctx, constrs)
+		if model == nil {
+			break
+		}
+		if optimal == nil {
+			optimal = model
+		}
+		s.model = model
+		s.GeneratePkgSets(wantedPkg)
+		s.SortPkgSets()
+		s.PkgResultSet.Status = "SAT"
+		alternatives = append(alternatives, &Alternative{
+			PkgResultSet: s.PkgResultSet,
+			Cost:         cost,
+		})
+		constrs = append(constrs, s.buildConstraintBlocking())
+	}
+
+	if optimal == nil {
+		s.PkgResultSet.Status = "UNSAT"
+		s.logger.Debug("Result: UNSAT\n")
+		return alternatives
+	}
+	s.model = optimal
+	s.PkgResultSet = alternatives[0].PkgResultSet
+	s.logger.Debugf("Result: SAT, %d alternatives\n", len(alternatives))
+	return alternatives
+}
+
+// buildAllConstraints generates the constraints for all packages in the
+// database.
+func (s *Solver) buildAllConstraints() []maxsat.Constr {
+	s.pkgInconsistencies = map[string][]string{}
+	invalidConstrs := s.pruneInvalidVersions()
+	if !s.keepUnreachable {
+		start := time.Now()
+		total := s.PkgDB.Len()
+		pruned := s.PruneUnreachable()
+		s.logger.Debugf("Pruned %d of %d packages, unreachable from the releases and the requested changes, in %s\n",
+			pruned, total, time.Since(start))
+	}
+
+	s.weights = s.calculateWeights()
+	s.logger.Debugf("Objective weights: removal %d, change %d, optional %d\n",
+		s.weights.removal, s.weights.change, s.weights.optional)
+
+	// generate constraints for all packages, with a worker per CPU:
+	s.logger.Debugf("Building constraints for %d packages…\n", s.PkgDB.Len())
+	start := time.Now()
 	var (
 		mu      = &sync.Mutex{}
-		constrs = make([]maxsat.Constr, 0)
+		constrs = append(make([]maxsat.Constr, 0), invalidConstrs...)
+		queue   = make(chan *pkg.Pkg)
 	)
 	var waitgroup sync.WaitGroup
-	for _, p := range s.PkgDB.mapFingerprintToPkg {
+	for w := 0; w < runtime.NumCPU(); w++ {
 		waitgroup.Add(1)
-		go func(p *pkg.Pkg) {
+		go func() {
 			defer waitgroup.Done()
-			tmpConstrs := s.BuildConstraints(p)
-			mu.Lock()
-			constrs = append(constrs, tmpConstrs...)
-			mu.Unlock()
-		}(p)
+			for p := range queue {
+				tmpConstrs := s.BuildConstraints(p)
+				mu.Lock()
+				constrs = append(constrs, tmpConstrs...)
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, p := range s.PkgDB.mapFingerprintToPkg {
+		queue <- p
 	}
+	close(queue)
 	waitgroup.Wait()
+	s.logger.Debugf("Built %d constraints in %s\n", len(constrs), time.Since(start))
 
 	s.logger.Debug("Constraints:")
 	for _, c := range constrs {
 		s.logger.Debugf("    %v\n", c)
 	}
+	s.constrs = constrs
+	if s.OnProblemBuilt != nil {
+		s.OnProblemBuilt()
+	}
+	return constrs
+}
 
+// pruneInvalidVersions removes from the database the packages whose version is
+// not valid semver, with a warning, as they can't be ordered nor checked
+// against ranges. The ones to be installed are kept instead, and it returns
+// constraints that make installing them an inconsistency. It also warns about
+// the dependency ranges that are not valid, which aren't satisfied by any
+// version.
+func (s *Solver) pruneInvalidVersions() (constr []maxsat.Constr) {
+	for _, fp := range s.PkgDB.sortedFingerprints() {
+		p := s.PkgDB.GetPackageByFingerprint(fp)
+		for _, deprel := range append(append([]*pkg.PkgRel{}, p.DependsRel...), p.DependsOptionalRel...) {
+			if _, err := semver.NewConstraint(deprel.SemverRange); err != nil {
+				s.logger.Warnf("Chart %q version %q depends on chart %q with an invalid version range %q: %s",
+					p.ChartName, p.Version, deprel.ChartName, deprel.SemverRange, err)
+			}
+		}
+
+		if _, err := semver.NewVersion(p.Version); err == nil {
+			continue
+		}
+		if p.DesiredState == pkg.Present {
+			incons := fmt.Sprintf("Version \"%s\" of chart \"%s\" is not a valid semantic version",
+				p.Version, p.ChartName)
+			s.addInconsistency(p, incons)
+			constr = append(constr, maxsat.HardClause(maxsat.Lit{
+				Var:     p.GetFingerPrint(),
+				Negated: true, // not installed
+			}))
+			continue
+		}
+		s.logger.Warnf("Skipping chart %q version %q: not a valid semantic version", p.ChartName, p.Version)
+		s.PkgDB.Remove(p)
+	}
+	return constr
+}
+
+// PruneUnreachable removes from the database the packages that can't be part
+// of the solution, and returns how many. Their constraints can always be
+// satisfied by not installing them, so they only slow down the solving.
+//
+// It is called when solving.
+func (s *Solver) PruneUnreachable() int {
+	reachable := map[string]bool{}
+	for _, p := range s.reachablePkgs() {
+		reachable[p.GetFingerPrint()] = true
+	}
+	pruned := 0
+	for _, fp := range s.PkgDB.sortedFingerprints() {
+		if !reachable[fp] {
+			s.PkgDB.Remove(s.PkgDB.GetPackageByFingerprint(fp))
+			pruned++
+		}
+	}
+	return pruned
+}
+
+// reachablePkgs returns the packages of the database that can be part of the
+// solution: the releases and the packages to change, with all their versions,
+// and their dependencies over DependsRel, transitively. Also over
+// DependsOptionalRel, if the solver may install optional dependencies.
+func (s *Solver) reachablePkgs() []*pkg.Pkg {
+	pkgs := []*pkg.Pkg{}
+	visited := map[string]bool{}
+	queue := []string{} // base fingerprints
+	enqueue := func(bfp string) {
+		if !visited[bfp] {
+			visited[bfp] = true
+			queue = append(queue, bfp)
+		}
+	}
+
+	for _, fp := range s.PkgDB.sortedFingerprints() {
+		p := s.PkgDB.GetPackageByFingerprint(fp)
+		if p.CurrentState != pkg.Unknown || p.DesiredState != pkg.Unknown {
+			enqueue(p.GetBaseFingerPrint())
+		}
+	}
+	for len(queue) > 0 {
+		bfp := queue[0]
+		queue = queue[1:]
+		versions := s.PkgDB.GetMapOfVersionsByBaseFingerPrint(bfp)
+		fps := make([]string, 0, len(versions))
+		for _, fp := range versions {
+			fps = append(fps, fp)
+		}
+		sort.Strings(fps)
+		for _, fp := range fps {
+			p := s.PkgDB.GetPackageByFingerprint(fp)
+			pkgs = append(pkgs, p)
+			depRels := p.DependsRel
+			if s.OptionalObjective != OptionalIgnore {
+				depRels = append(append([]*pkg.PkgRel{}, p.DependsRel...), p.DependsOptionalRel...)
+			}
+			for _, depRel := range depRels {
+				enqueue(pkg.CreateBaseFingerPrint(depRel.ReleaseName, depRel.Namespace, depRel.ChartName))
+			}
+		}
+	}
+	return pkgs
+}
+
+// withTimeout returns ctx bounded by s.Timeout, if set.
+func (s *Solver) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.Timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, s.Timeout)
+}
+
+// solveConstrs solves the problem made of constrs, and returns its optimal
+// model and cost. If ctx is done before, it returns the best model found so
+// far, with optimal false. The model is nil if there's none, and its cost -1.
+func (s *Solver) solveConstrs(ctx context.Context, constrs []maxsat.Constr) (model maxsat.Model, cost int, optimal bool) {
 	s.logger.Debug("Solving…")
+	start := time.Now()
+	defer func() {
+		s.logger.Debugf("Solved in %s, cost %d, optimal %t\n", time.Since(start), cost, optimal)
+	}()
+
+	if ctx.Done() == nil {
+		// nothing can stop the solving, maxsat finds the optimal model at
+		// once, faster than bounding the cost step by step:
+		model, cost = maxsat.New(constrs...).Solve()
+		return model, cost, true
+	}
 
-	// create problem with constraints, and solve
-	problem := maxsat.New(constrs...)
-	s.model, _ = problem.Solve()
+	// each better model found is sent on results, until the optimal one is
+	// found and results is closed, or ctx is done. Once returned, optimize is
+	// stopped too:
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan solution, 1)
+	go optimize(ctx, constrs, results)
+
+	cost = -1
+	for {
+		select {
+		case res, ok := <-results:
+			if ok {
+				model, cost = res.model, res.cost
+				continue
+			}
+			if ctx.Err() == nil {
+				return model, cost, true
+			}
+		case <-ctx.Done():
+			// keep the solution sent right before ctx was done, if any:
+			select {
+			case res, ok := <-results:
+				if ok {
+					model, cost = res.model, res.cost
+				}
+			default:
+			}
+		}
+		s.logger.Warn("The solver timed out, using the best solution found so far")
+		return model, cost, false
+	}
+}
 
-	if s.model != nil { // SAT
-		//	there is a result model, generate pkg sets then:
-		s.GeneratePkgSets(wantedPkg)
-		s.PkgResultSet.Status = "SAT"
-		s.logger.Debug("Result: SAT\n")
-		s.logger.Debug(s.FormatOutput(Table))
-	} else {
-		s.PkgResultSet.Status = "UNSAT"
-		s.logger.Debug("Result: UNSAT\n")
+// solution is a model of a problem, by the names of its variables, and its
+// cost.
+type solution struct {
+	model maxsat.Model
+	cost  int
+}
+
+// optimize solves the problem made of constrs again and again, each time
+// bounding its cost below the cost of the last solution found, and sends each
+// solution on results. It closes results once there's no better solution, or
+// once ctx is done.
+//
+// gophersat's solvers can't be interrupted while solving, so ctx is checked
+// between bounds: once done, no more bounds are solved, but the one being
+// solved runs to completion before optimize returns. Each bound is solved from
+// scratch, as gophersat's Solver.Optimal, which keeps the solver between
+// bounds, ignores its stop channel.
+func optimize(ctx context.Context, constrs []maxsat.Constr, results chan<- solution) {
+	defer close(results)
+
+	// the soft constraints are relaxed into hard ones, each with a variable
+	// that is true only if the soft constraint is satisfied:
+	hard := []maxsat.Constr{}
+	soft := []maxsat.Constr{}
+	relaxed := []maxsat.Lit{}
+	weights := []int{}
+	maxCost := 0
+	for i, c := range constrs {
+		if c.Weight == 0 {
+			hard = append(hard, c)
+			continue
+		}
+		relaxVar := maxsat.Lit{Var: fmt.Sprintf("soft#%d", i)}
+		lits := append(append([]maxsat.Lit{}, c.Lits...), maxsat.Lit{Var: relaxVar.Var, Negated: true})
+		var coeffs []int
+		if len(c.Coeffs) != 0 {
+			coeffs = append(append([]int{}, c.Coeffs...), c.AtLeast)
+		} else if c.AtLeast != 1 {
+			coeffs = make([]int, len(c.Lits), len(lits))
+			for j := range coeffs {
+				coeffs[j] = 1
+			}
+			coeffs = append(coeffs, c.AtLeast)
+		}
+		hard = append(hard, maxsat.HardPBConstr(lits, coeffs, c.AtLeast))
+		soft = append(soft, c)
+		relaxed = append(relaxed, relaxVar)
+		weights = append(weights, c.Weight)
+		maxCost += c.Weight
+	}
+
+	bounded := hard
+	for ctx.Err() == nil {
+		model, _ := maxsat.New(bounded...).Solve()
+		if model == nil {
+			return
+		}
+		cost := 0
+		for i, lit := range relaxed {
+			delete(model, lit.Var)
+			if !isSatisfied(soft[i], model) {
+				cost += weights[i]
+			}
+		}
+		select {
+		case results <- solution{model: model, cost: cost}:
+		case <-ctx.Done():
+			return
+		}
+		if cost == 0 {
+			return
+		}
+		// the satisfied soft constraints must weigh more:
+		bounded = append(hard[:len(hard):len(hard)],
+			maxsat.HardPBConstr(relaxed, weights, maxCost-cost+1))
+	}
+}
+
+// isSatisfied returns true if constraint c is satisfied by model.
+func isSatisfied(c maxsat.Constr, model maxsat.Model) bool {
+	sum := 0
+	for i, lit := range c.Lits {
+		if model[lit.Var] != lit.Negated {
+			if len(c.Coeffs) != 0 {
+				sum += c.Coeffs[i]
+			} else {
+				sum++
+			}
+		}
 	}
+	return sum >= c.AtLeast
+}
 
-	// s.logger.Debugf("Result %v\n", s.model)
+// calculateWeights returns the weights of the soft clauses for each criteria of
+// the objective, bounding the sum of the weights of the soft clauses that the
+// packages in the database generate for the less important criteria.
+func (s *Solver) calculateWeights() objectiveWeights {
+	freshnessSum, numOptional, numPresent := 0, 0, 0
+	for _, p := range s.PkgDB.mapFingerprintToPkg {
+		if p.DesiredState == pkg.Present {
+			// as weighted by buildConstraintAtMost1, once per version:
+			fps, coeffs := s.PkgDB.GetOrderedPackageFingerprintsThatDifferOnVersionByPackage(p)
+			for i, fp := range fps {
+				if fp == p.GetFingerPrint() && len(fps) > 1 {
+					freshnessSum += coeffs[i]
+				}
+			}
+		}
+		if s.OptionalObjective != OptionalIgnore {
+			for _, deprel := range p.DependsOptionalRel {
+				numOptional += len(s.satisfyingVersions(deprel))
+			}
+		}
+		if s.AllowChanges && p.CurrentState == pkg.Present && p.DesiredState != pkg.Absent {
+			numPresent++
+		}
+	}
+
+	w := objectiveWeights{}
+	w.optional = freshnessSum + 1
+	optionalSum := w.optional*numOptional + freshnessSum
+	w.change = optionalSum + 1
+	w.removal = w.change*numPresent + optionalSum + 1
+	return w
 }
 
 func (s *Solver) IsSAT() bool {
 	return s.PkgResultSet.Status == "SAT"
 }
 
+// TimedOut returns true if the solver timed out before finding any solution,
+// so it's unknown whether there's one.
+func (s *Solver) TimedOut() bool {
+	return s.PkgResultSet.Status == "UNKNOWN"
+}
+
 // GeneratePkgSets obtains back the sets of packages from IDs.
 func (s *Solver) GeneratePkgSets(wantedPkg *pkg.Pkg) {
 
@@ -206,7 +683,8 @@ func (s *Solver) GeneratePkgSets(wantedPkg *pkg.Pkg) {
 		// segregate packages into PkgResultSet:
 		if pkgResult && p.CurrentState == pkg.Present {
 			s.PkgResultSet.PresentUnchanged = append(s.PkgResultSet.PresentUnchanged, p)
-		} else if !pkgResult && p.CurrentState == pkg.Present {
+		} else if !pkgResult && p.CurrentState == pkg.Present && !s.isAnotherVersionInModel(p) {
+			// releases changed to another version are not removed
 			s.PkgResultSet.ToRemove = append(s.PkgResultSet.ToRemove, p)
 		}
 	}
@@ -214,11 +692,31 @@ func (s *Solver) GeneratePkgSets(wantedPkg *pkg.Pkg) {
 	if s.Strategy == InstallOne {
 		s.PkgResultSet.ToInstall = &PkgTree{}
 		visited := map[string]bool{}
+		// the solution may have chosen another version of wantedPkg:
+		if wantedPkg != nil {
+			for _, fp := range s.PkgDB.GetMapOfVersionsByBaseFingerPrint(wantedPkg.GetBaseFingerPrint()) {
+				if s.model[fp] {
+					wantedPkg = s.PkgDB.GetPackageByFingerprint(fp)
+					break
+				}
+			}
+		}
 		// add dependencies of wantedPkg
 		s.PkgResultSet.ToInstall = s.recBuildTree(wantedPkg, visited)
 	}
 }
 
+// isAnotherVersionInModel returns true if a package that differs from p only
+// in version is to be present in the model.
+func (s *Solver) isAnotherVersionInModel(p *pkg.Pkg) bool {
+	for _, fp := range s.PkgDB.GetMapOfVersionsByBaseFingerPrint(p.GetBaseFingerPrint()) {
+		if fp != p.GetFingerPrint() && s.model[fp] {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Solver) recBuildTree(p *pkg.Pkg, visited map[string]bool) *PkgTree {
 	if p == nil {
 		// we are a leaf, stop
@@ -234,8 +732,13 @@ func (s *Solver) recBuildTree(p *pkg.Pkg, visited map[string]bool) *PkgTree {
 	// add p to visited:
 	visited[p.GetFingerPrint()] = true
 
-	// recursively create trees with dependencies of p:
-	for _, depRel := range p.DependsRel {
+	// recursively create trees with dependencies of p, and optional
+	// dependencies if the solver chose them:
+	depRels := p.DependsRel
+	if s.OptionalObjective != OptionalIgnore {
+		depRels = append(append([]*pkg.PkgRel{}, p.DependsRel...), p.DependsOptionalRel...)
+	}
+	for _, depRel := range depRels {
 		depBFP := pkg.CreateBaseFingerPrint(depRel.ReleaseName, depRel.Namespace, depRel.ChartName)
 		// see if dependency is in the model:
 		for modelFP, pkgResult := range s.model {
@@ -369,6 +872,138 @@ func (s *Solver) buildConstraintPresent(p *pkg.Pkg) (constr []maxsat.Constr) {
 	return constr
 }
 
+// buildConstraintKeepPresent returns soft constraints that penalize changing
+// the present package p to another version, and more so removing it.
+func (s *Solver) buildConstraintKeepPresent(p *pkg.Pkg) (constr []maxsat.Constr) {
+	// Soft constraints:
+	//
+	// Cost if A gets changed or removed:  A-1.0.0
+	// Cost if no version of A is kept:    A-1.0.0 or A-2.0.0 ... or A-3.0.0
+	//
+	// Removing A has the cost of both.
+
+	lit := maxsat.Lit{
+		Var:     p.GetFingerPrint(),
+		Negated: false, // installed
+	}
+	constr = append(constr, maxsat.WeightedClause([]maxsat.Lit{lit}, s.weights.change))
+
+	lits := []maxsat.Lit{}
+	fps, _ := s.PkgDB.GetOrderedPackageFingerprintsThatDifferOnVersionByPackage(p)
+	for _, fp := range fps { // for all the packages that only differ in version
+		lits = append(lits, maxsat.Lit{
+			Var:     fp,
+			Negated: false, // installed
+		})
+	}
+	constr = append(constr, maxsat.WeightedClause(lits, s.weights.removal))
+
+	return constr
+}
+
+// addInconsistency adds incons to the inconsistencies of the solving, found
+// when building the constraints of package p.
+func (s *Solver) addInconsistency(p *pkg.Pkg, incons string) {
+	s.inconsMu.Lock()
+	defer s.inconsMu.Unlock()
+	s.PkgResultSet.Inconsistencies = append(s.PkgResultSet.Inconsistencies, incons)
+	s.pkgInconsistencies[p.GetFingerPrint()] = append(s.pkgInconsistencies[p.GetFingerPrint()], incons)
+}
+
+// PkgInconsistencies returns the inconsistencies found when building the
+// constraints of the package with fingerprint fp.
+func (s *Solver) PkgInconsistencies(fp string) []string {
+	s.inconsMu.Lock()
+	defer s.inconsMu.Unlock()
+	return s.pkgInconsistencies[fp]
+}
+
+// buildConstraintCRDOnly returns a constraint specifying that the present
+// package p, of a CRD-only chart, is never removed, nor changed to a version of
+// another major. Removing the CRDs would delete all their custom resources,
+// and changing their major may break them.
+func (s *Solver) buildConstraintCRDOnly(p *pkg.Pkg) (constr []maxsat.Constr) {
+	// Boolean equation, for the versions of A with the same major as A-1.0.0:
+	// A-1.0.0 or A-1.1.0 or ... A-1.5.0
+
+	if p.DesiredState == pkg.Absent {
+		incons := fmt.Sprintf("Chart \"%s\" of release \"%s\" in namespace \"%s\" only contains CRDs, and is never removed",
+			p.ChartName, p.ReleaseName, p.Namespace)
+		s.addInconsistency(p, incons)
+		lit := maxsat.Lit{
+			Var:     p.GetFingerPrint(),
+			Negated: false, // installed
+		}
+		return append(constr, maxsat.HardClause(lit))
+	}
+
+	pVer, err := semver.NewVersion(p.Version)
+	if err != nil {
+		// its major is unknown, keep it as it is:
+		lit := maxsat.Lit{
+			Var:     p.GetFingerPrint(),
+			Negated: false, // installed
+		}
+		return append(constr, maxsat.HardClause(lit))
+	}
+	lits := []maxsat.Lit{}
+	fps, _ := s.PkgDB.GetOrderedPackageFingerprintsThatDifferOnVersionByPackage(p)
+	for _, fp := range fps { // for all the packages that only differ in version
+		v, err := semver.NewVersion(s.PkgDB.GetPackageByFingerprint(fp).Version)
+		if err != nil || v.Major() != pVer.Major() {
+			continue
+		}
+		lits = append(lits, maxsat.Lit{
+			Var:     fp,
+			Negated: false, // installed
+		})
+	}
+	constr = append(constr, maxsat.HardClause(lits...))
+
+	return constr
+}
+
+// buildConstraintBlocking returns a constraint that rules out the current
+// solution: installing the same packages, while keeping and removing the same
+// releases.
+func (s *Solver) buildConstraintBlocking() maxsat.Constr {
+	// Boolean equation, for installing B and C, keeping A and removing D:
+	// not(B) or not(C) or not(A) or D
+
+	lits := []maxsat.Lit{}
+	for _, p := range treePkgs(s.PkgResultSet.ToInstall) {
+		lits = append(lits, maxsat.Lit{
+			Var:     p.GetFingerPrint(),
+			Negated: true, // not installed
+		})
+	}
+	for _, p := range s.PkgResultSet.PresentUnchanged {
+		lits = append(lits, maxsat.Lit{
+			Var:     p.GetFingerPrint(),
+			Negated: true, // not installed
+		})
+	}
+	for _, p := range s.PkgResultSet.ToRemove {
+		lits = append(lits, maxsat.Lit{
+			Var:     p.GetFingerPrint(),
+			Negated: false, // installed
+		})
+	}
+	return maxsat.HardClause(lits...)
+}
+
+// treePkgs returns the packages of the nodes of tree tr.
+func treePkgs(tr *PkgTree) []*pkg.Pkg {
+	if tr == nil || tr.Node == nil {
+		return []*pkg.Pkg{}
+	}
+	pkgs := []*pkg.Pkg{tr.Node}
+	for _, rel := range tr.Relations {
+		pkgs = append(pkgs, treePkgs(rel)...)
+	}
+	return pkgs
+}
+
 func (s *Solver) buildConstraintToModify(p *pkg.Pkg) (constr []maxsat.Constr) {
 
 	if p.CurrentState == pkg.Present { // if is a release
@@ -381,7 +1016,7 @@ func (s *Solver) buildConstraintToModify(p *pkg.Pkg) (constr []maxsat.Constr) {
 					// as we aren't separating install and upgrade implementation yet
 					incons := fmt.Sprintf("Package %s is scheduled for upgrade, did you mean \"hypper upgrade\" instead of \"hypper install\"\n",
 						p.GetFingerPrint())
-					s.PkgResultSet.Inconsistencies = append(s.PkgResultSet.Inconsistencies, incons)
+					s.addInconsistency(p, incons)
 					break
 				}
 				if s.Strategy == UpgradeOne {
@@ -475,16 +1110,7 @@ func (s *Solver) buildConstraintRelations(p *pkg.Pkg) (constr []maxsat.Constr) {
 
 	// build constraints for 'Depends' relations
 	for _, deprel := range p.DependsRel {
-		// obtain all IDs for the packages that only differ in version
-		mapOfVersions := s.PkgDB.GetMapOfVersionsByBaseFingerPrint(pkg.CreateBaseFingerPrint(deprel.ReleaseName, deprel.Namespace, deprel.ChartName))
-		satisfyingVersions := []string{} // slice of fingerprints
-		for depVersion, depFingerprint := range mapOfVersions {
-			// build list of packages that differ only in version and that satisfy semver
-			if semverSatisfies(deprel.SemverRange, depVersion) {
-				// efficiently build a slice of version IDs for use in the constraint:
-				satisfyingVersions = append(satisfyingVersions, depFingerprint)
-			}
-		}
+		satisfyingVersions := s.satisfyingVersions(deprel) // slice of fingerprints
 
 		// build lits:  not(A) , B1, B2, B3, B4
 		lits := []maxsat.Lit{}
@@ -511,7 +1137,7 @@ func (s *Solver) buildConstraintRelations(p *pkg.Pkg) (constr []maxsat.Constr) {
 			// that to inconsistencies
 			incons := fmt.Sprintf("Chart \"%s\" depends on \"%s\" in namespace \"%s\", semver \"%s\", but nothing satisfies it",
 				p.ChartName, deprel.ReleaseName, deprel.Namespace, deprel.SemverRange)
-			s.PkgResultSet.Inconsistencies = append(s.PkgResultSet.Inconsistencies, incons)
+			s.addInconsistency(p, incons)
 		}
 
 		// at least 1 of all the versions that satisfy semver, and not(A)
@@ -527,6 +1153,98 @@ func (s *Solver) buildConstraintRelations(p *pkg.Pkg) (constr []maxsat.Constr) {
 	return constr
 }
 
+// DepClosure returns package p and the packages of the database that it may
+// transitively depend on over DependsRel, following only the versions that
+// satisfy each relation.
+func (s *Solver) DepClosure(p *pkg.Pkg) []*pkg.Pkg {
+	pkgs := []*pkg.Pkg{p}
+	visited := map[string]bool{p.GetFingerPrint(): true}
+	for i := 0; i < len(pkgs); i++ {
+		for _, deprel := range pkgs[i].DependsRel {
+			fps := s.satisfyingVersions(deprel)
+			sort.Strings(fps)
+			for _, fp := range fps {
+				if !visited[fp] {
+					visited[fp] = true
+					pkgs = append(pkgs, s.PkgDB.GetPackageByFingerprint(fp))
+				}
+			}
+		}
+	}
+	return pkgs
+}
+
+// Satisfies returns whether version satisfies the semver range of deprel,
+// as when solving.
+func (s *Solver) Satisfies(deprel *pkg.PkgRel, version string) bool {
+	ok, _ := semverSatisfies(deprel.SemverRange, version, s.Devel)
+	return ok
+}
+
+// satisfyingVersions returns the fingerprints of the packages that satisfy the
+// relation deprel: they only differ in version, and satisfy its semver range.
+func (s *Solver) satisfyingVersions(deprel *pkg.PkgRel) []string {
+	// obtain all IDs for the packages that only differ in version
+	mapOfVersions := s.PkgDB.GetMapOfVersionsByBaseFingerPrint(pkg.CreateBaseFingerPrint(deprel.ReleaseName, deprel.Namespace, deprel.ChartName))
+	satisfyingVersions := []string{} // slice of fingerprints
+	for depVersion, depFingerprint := range mapOfVersions {
+		// build list of packages that differ only in version and that satisfy semver
+		// invalid ranges and versions have already been warned about, and
+		// are not satisfied:
+		if ok, _ := semverSatisfies(deprel.SemverRange, depVersion, s.Devel); ok {
+			// efficiently build a slice of version IDs for use in the constraint:
+			satisfyingVersions = append(satisfyingVersions, depFingerprint)
+		}
+	}
+	return satisfyingVersions
+}
+
+func (s *Solver) buildConstraintOptionalRelations(p *pkg.Pkg) (constr []maxsat.Constr) {
+	// E.g: A optionally depends on B,~1.0.0, with B having several or zero
+	// versions to chose from.
+	//
+	// To maximize optional deps, add a soft constraint that has a cost if A
+	// gets installed without B:
+	//    not(A) or B-1.0.0 or ... B-1.5.0
+	//
+	// To minimize optional deps, add a soft constraint for each satisfying
+	// version of B that has a cost if B gets installed:
+	//    not(B-1.0.0), ..., not(B-1.5.0)
+	//
+	// Optional deps that nothing satisfies are not an inconsistency, they
+	// just never get installed.
+	for _, deprel := range p.DependsOptionalRel {
+		satisfyingVersions := s.satisfyingVersions(deprel)
+		if len(satisfyingVersions) == 0 {
+			continue
+		}
+
+		switch s.OptionalObjective {
+		case OptionalMaximize:
+			lits := []maxsat.Lit{{
+				Var:     p.GetFingerPrint(),
+				Negated: true, // not installed
+			}}
+			for _, fp := range satisfyingVersions {
+				lits = append(lits, maxsat.Lit{
+					Var:     fp,
+					Negated: false, // installed
+				})
+			}
+			constr = append(constr, maxsat.WeightedClause(lits, s.weights.optional))
+		case OptionalMinimize:
+			for _, fp := range satisfyingVersions {
+				lit := []maxsat.Lit{{
+					Var:     fp,
+					Negated: true, // not installed
+				}}
+				constr = append(constr, maxsat.WeightedClause(lit, s.weights.optional))
+			}
+		}
+	}
+	return constr
+}
+
 func (s *Solver) buildConstraintAtMost1(p *pkg.Pkg) (constr []maxsat.Constr) {
 	// E.g: B having several versions: B-1.0.0, B-2.0.0, B-3.0.0
 	// Only one can be installed, as they all share releaseName and ns.
@@ -544,13 +1262,18 @@ func (s *Solver) buildConstraintAtMost1(p *pkg.Pkg) (constr []maxsat.Constr) {
 	// In case that there's only 1 version of B, we can skip adding a constraint
 
 	// obtain all fps, weights, for the packages that only differ in version
-	fps, coeffs := PkgDBInstance.GetOrderedPackageFingerprintsThatDifferOnVersionByPackage(p)
+	fps, coeffs := s.PkgDB.GetOrderedPackageFingerprintsThatDifferOnVersionByPackage(p)
 
 	if len(fps) == 1 {
 		// there is only one package on that releaseName and Namespace. No need
 		// to create the constraint.
 		return []maxsat.Constr{}
 	}
+	if fps[0] != p.GetFingerPrint() {
+		// the constraints are the same for all the versions, build them once,
+		// for the oldest:
+		return []maxsat.Constr{}
+	}
 
 	lits := []maxsat.Lit{}
 	for i, fp := range fps { // for all the packages that only differ in version
@@ -582,15 +1305,28 @@ func (s *Solver) buildConstraintAtMost1(p *pkg.Pkg) (constr []maxsat.Constr) {
 	return constr
 }
 
-func semverSatisfies(semverRange string, ourSemver string) bool {
-
-	// generate semver constraint and check:
-	c, _ := semver.NewConstraint(semverRange)
-	// p.DepRel have already been marshalled, no error possible here
-
-	v, _ := semver.NewVersion(ourSemver)
-	// dependency has already been marshalled, no error possible here
+// semverSatisfies returns true if version ourSemver is in semverRange. With
+// devel, a prerelease is also in the ranges its release is in.
+func semverSatisfies(semverRange string, ourSemver string, devel bool) (bool, error) {
+	c, err := semver.NewConstraint(semverRange)
+	if err != nil {
+		return false, err
+	}
+	v, err := semver.NewVersion(ourSemver)
+	if err != nil {
+		return false, err
+	}
 
 	// Check if the version meets the constraints.
-	return c.Check(v)
+	if c.Check(v) {
+		return true, nil
+	}
+	if devel && v.Prerelease() != "" {
+		release, err := v.SetPrerelease("")
+		if err != nil {
+			return false, err
+		}
+		return c.Check(&release), nil
+	}
+	return false, nil
 }
@@ -18,10 +18,14 @@ package solver
 
 import (
 	"bytes"
+	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/Masterminds/log-go"
 	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/crillab/gophersat/maxsat"
 	pkg "github.com/rancher-sandbox/hypper/internal/package"
 
 	"github.com/rancher-sandbox/hypper/internal/test"
@@ -384,3 +388,886 @@ func TestFormatOutput(t *testing.T) {
 		test.AssertGoldenString(t, s.FormatOutput(Table), tcase.goldenTable)
 	}
 }
+
+// treeFingerprints returns the fingerprints of the packages in tr.
+func treeFingerprints(tr *PkgTree) []string {
+	if tr == nil || tr.Node == nil {
+		return []string{}
+	}
+	fps := []string{tr.Node.GetFingerPrint()}
+	for _, rel := range tr.Relations {
+		fps = append(fps, treeFingerprints(rel)...)
+	}
+	return fps
+}
+
+func TestOptionalObjective(t *testing.T) {
+	rel := func(name, semverRange string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{
+			ReleaseName: name,
+			Namespace:   "targetns",
+			SemverRange: semverRange,
+			ChartName:   name,
+		}}
+	}
+	fp := func(name, version string) string {
+		return pkg.CreateFingerPrint(name, version, "targetns", name)
+	}
+
+	for _, tcase := range []struct {
+		name         string
+		objective    OptionalObjective
+		wantedPkg    *pkg.Pkg
+		pkgs         []*pkg.Pkg
+		resultStatus string
+		toInstall    []string
+	}{
+		{
+			name:      "maximize, optional dep installed",
+			objective: OptionalMaximize,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("opt", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0"), fp("opt", "1.0.0")},
+		},
+		{
+			name:      "ignore, optional dep not installed",
+			objective: OptionalIgnore,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("opt", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0")},
+		},
+		{
+			name:      "maximize, optional dep that nothing satisfies",
+			objective: OptionalMaximize,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, rel("opt", "^2.0.0"), pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, rel("opt", "^2.0.0"), pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("opt", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0")},
+		},
+		{
+			name:      "maximize, optional dep left out as it would conflict",
+			objective: OptionalMaximize,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "~1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "~1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("opt", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0"), fp("dep", "1.0.0")},
+		},
+		{
+			name:      "minimize, version of dep without the optional dep chosen",
+			objective: OptionalMinimize,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", rel("opt", "^1.0.0"), nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("dep", "1.1.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("opt", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0"), fp("dep", "1.1.0")},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+
+			s := New(InstallOne, logger)
+			s.OptionalObjective = tcase.objective
+			s.BuildWorldMock(tcase.pkgs)
+			s.Solve(s.PkgDB.GetPackageByFingerprint(tcase.wantedPkg.GetFingerPrint()))
+			is := assert.New(t)
+			is.Equal(tcase.resultStatus, s.PkgResultSet.Status)
+			is.ElementsMatch(tcase.toInstall, treeFingerprints(s.PkgResultSet.ToInstall))
+		})
+	}
+}
+
+func TestAllowChanges(t *testing.T) {
+	rel := func(name, semverRange string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{
+			ReleaseName: name,
+			Namespace:   "targetns",
+			SemverRange: semverRange,
+			ChartName:   name,
+		}}
+	}
+	fp := func(name, version string) string {
+		return pkg.CreateFingerPrint(name, version, "targetns", name)
+	}
+
+	for _, tcase := range []struct {
+		name             string
+		allowChanges     bool
+		objective        OptionalObjective
+		wantedPkg        *pkg.Pkg
+		pkgs             []*pkg.Pkg
+		resultStatus     string
+		toInstall        []string
+		toRemove         []string
+		presentUnchanged []string
+	}{
+		{
+			name:      "present release not changed by default",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "UNSAT",
+		},
+		{
+			name:         "present release changed, not removed",
+			allowChanges: true,
+			wantedPkg:    pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus:     "SAT",
+			toInstall:        []string{fp("wanted", "1.0.0"), fp("dep", "2.0.0")},
+			toRemove:         []string{},
+			presentUnchanged: []string{},
+		},
+		{
+			name:         "dependent releases changed instead of removed",
+			allowChanges: true,
+			wantedPkg:    pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("app", "1.0.0", "targetns", rel("dep", "~1.0.0"), nil, pkg.Present, pkg.Unknown),
+				pkg.NewPkgMock("app", "2.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("other", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+			},
+			resultStatus:     "SAT",
+			toInstall:        []string{fp("wanted", "1.0.0"), fp("dep", "2.0.0")},
+			toRemove:         []string{},
+			presentUnchanged: []string{fp("other", "1.0.0")},
+		},
+		{
+			name:         "release removed as last resort",
+			allowChanges: true,
+			wantedPkg:    pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("app", "1.0.0", "targetns", rel("dep", "~1.0.0"), nil, pkg.Present, pkg.Unknown),
+			},
+			resultStatus:     "SAT",
+			toInstall:        []string{fp("wanted", "1.0.0"), fp("dep", "2.0.0")},
+			toRemove:         []string{fp("app", "1.0.0")},
+			presentUnchanged: []string{},
+		},
+		{
+			name:         "present release not changed for an optional dep",
+			allowChanges: true,
+			objective:    OptionalMaximize,
+			wantedPkg:    pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("opt", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus:     "SAT",
+			toInstall:        []string{fp("wanted", "1.0.0")},
+			toRemove:         []string{},
+			presentUnchanged: []string{fp("dep", "1.0.0")},
+		},
+		{
+			name:         "present release not changed for a newer version of several",
+			allowChanges: true,
+			wantedPkg:    pkg.NewPkgMock("wanted", "2.1.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("wanted", "2.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("wanted", "2.1.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+				pkg.NewPkgMock("dep", "1.1.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.1.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus:     "SAT",
+			toInstall:        []string{fp("wanted", "1.0.0")},
+			toRemove:         []string{},
+			presentUnchanged: []string{fp("dep", "1.0.0")},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+
+			s := New(InstallOne, logger)
+			s.AllowChanges = tcase.allowChanges
+			s.OptionalObjective = tcase.objective
+			s.BuildWorldMock(tcase.pkgs)
+			s.Solve(s.PkgDB.GetPackageByFingerprint(tcase.wantedPkg.GetFingerPrint()))
+			is := assert.New(t)
+			is.Equal(tcase.resultStatus, s.PkgResultSet.Status)
+			if !s.IsSAT() {
+				return
+			}
+			is.ElementsMatch(tcase.toInstall, treeFingerprints(s.PkgResultSet.ToInstall))
+			fps := func(pkgs []*pkg.Pkg) []string {
+				res := []string{}
+				for _, p := range pkgs {
+					res = append(res, p.GetFingerPrint())
+				}
+				return res
+			}
+			is.ElementsMatch(tcase.toRemove, fps(s.PkgResultSet.ToRemove))
+			is.ElementsMatch(tcase.presentUnchanged, fps(s.PkgResultSet.PresentUnchanged))
+		})
+	}
+}
+
+func TestCRDOnly(t *testing.T) {
+	rel := func(name, semverRange string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{
+			ReleaseName: name,
+			Namespace:   "targetns",
+			SemverRange: semverRange,
+			ChartName:   name,
+		}}
+	}
+	fp := func(name, version string) string {
+		return pkg.CreateFingerPrint(name, version, "targetns", name)
+	}
+	crdOnly := func(p *pkg.Pkg) *pkg.Pkg {
+		p.CRDOnly = true
+		return p
+	}
+
+	for _, tcase := range []struct {
+		name            string
+		wantedPkg       *pkg.Pkg
+		pkgs            []*pkg.Pkg
+		resultStatus    string
+		toInstall       []string
+		inconsistencies []string
+	}{
+		{
+			name:      "crd-only release changed within its major",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("crds", "^1.1.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("crds", "^1.1.0"), nil, pkg.Unknown, pkg.Present),
+				crdOnly(pkg.NewPkgMock("crds", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown)),
+				crdOnly(pkg.NewPkgMock("crds", "1.1.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown)),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0"), fp("crds", "1.1.0")},
+		},
+		{
+			name:      "crd-only release not changed across a major",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("crds", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("crds", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				crdOnly(pkg.NewPkgMock("crds", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown)),
+				crdOnly(pkg.NewPkgMock("crds", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown)),
+			},
+			resultStatus: "UNSAT",
+		},
+		{
+			name:      "crd-only release not removed",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				crdOnly(pkg.NewPkgMock("crds", "1.0.0", "targetns", rel("dep", "~1.0.0"), nil, pkg.Present, pkg.Unknown)),
+			},
+			resultStatus: "UNSAT",
+		},
+		{
+			name:      "crd-only release desired absent",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Present),
+				crdOnly(pkg.NewPkgMock("crds", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Absent)),
+			},
+			resultStatus: "UNSAT",
+			inconsistencies: []string{
+				"Chart \"crds\" of release \"crds\" in namespace \"targetns\" only contains CRDs, and is never removed",
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+
+			s := New(InstallOne, logger)
+			s.AllowChanges = true
+			s.BuildWorldMock(tcase.pkgs)
+			s.Solve(s.PkgDB.GetPackageByFingerprint(tcase.wantedPkg.GetFingerPrint()))
+			is := assert.New(t)
+			is.Equal(tcase.resultStatus, s.PkgResultSet.Status)
+			if tcase.inconsistencies != nil {
+				is.Equal(tcase.inconsistencies, s.PkgResultSet.Inconsistencies)
+			}
+			if !s.IsSAT() {
+				return
+			}
+			is.ElementsMatch(tcase.toInstall, treeFingerprints(s.PkgResultSet.ToInstall))
+			is.Empty(s.PkgResultSet.ToRemove)
+		})
+	}
+}
+
+func TestCRDOnlyInvalidVersions(t *testing.T) {
+	crdOnly := func(p *pkg.Pkg) *pkg.Pkg {
+		p.CRDOnly = true
+		return p
+	}
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	s := New(InstallOne, logger)
+	s.BuildWorldMock([]*pkg.Pkg{
+		crdOnly(pkg.NewPkgMock("crds", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown)),
+		crdOnly(pkg.NewPkgMock("crds", "1.1.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown)),
+		crdOnly(pkg.NewPkgMock("crds", "latest", "targetns", nil, nil, pkg.Unknown, pkg.Unknown)),
+		crdOnly(pkg.NewPkgMock("other", "latest", "targetns", nil, nil, pkg.Present, pkg.Unknown)),
+	})
+	is := assert.New(t)
+
+	// versions that aren't semver are skipped:
+	p := s.PkgDB.GetPackageByFingerprint(pkg.CreateFingerPrint("crds", "1.0.0", "targetns", "crds"))
+	is.Equal([]maxsat.Constr{maxsat.HardClause(
+		maxsat.Lit{Var: pkg.CreateFingerPrint("crds", "1.0.0", "targetns", "crds")},
+		maxsat.Lit{Var: pkg.CreateFingerPrint("crds", "1.1.0", "targetns", "crds")},
+	)}, s.buildConstraintCRDOnly(p))
+
+	// a release that isn't semver is kept as it is:
+	p = s.PkgDB.GetPackageByFingerprint(pkg.CreateFingerPrint("other", "latest", "targetns", "other"))
+	is.Equal([]maxsat.Constr{maxsat.HardClause(maxsat.Lit{Var: p.GetFingerPrint()})}, s.buildConstraintCRDOnly(p))
+}
+
+func TestSolveAlternatives(t *testing.T) {
+	rel := func(name, semverRange string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{
+			ReleaseName: name,
+			Namespace:   "targetns",
+			SemverRange: semverRange,
+			ChartName:   name,
+		}}
+	}
+	fp := func(name, version string) string {
+		return pkg.CreateFingerPrint(name, version, "targetns", name)
+	}
+
+	for _, tcase := range []struct {
+		name         string
+		n            int
+		wantedPkg    *pkg.Pkg
+		pkgs         []*pkg.Pkg
+		resultStatus string
+		toInstall    [][]string
+	}{
+		{
+			name:      "alternatives by increasing cost",
+			n:         5,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("opt", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall: [][]string{
+				{fp("wanted", "1.0.0"), fp("dep", "1.0.0"), fp("opt", "1.0.0")},
+				{fp("wanted", "1.0.0"), fp("dep", "1.0.0")},
+			},
+		},
+		{
+			name:      "only the best n alternatives",
+			n:         1,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), rel("opt", "^1.0.0"), pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("opt", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall: [][]string{
+				{fp("wanted", "1.0.0"), fp("dep", "1.0.0"), fp("opt", "1.0.0")},
+			},
+		},
+		{
+			name:      "unsat has no alternatives",
+			n:         5,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^2.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "UNSAT",
+			toInstall:    [][]string{},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+
+			s := New(InstallOne, logger)
+			s.OptionalObjective = OptionalMaximize
+			s.BuildWorldMock(tcase.pkgs)
+			alternatives := s.SolveAlternatives(s.PkgDB.GetPackageByFingerprint(tcase.wantedPkg.GetFingerPrint()), tcase.n)
+			is := assert.New(t)
+			is.Equal(tcase.resultStatus, s.PkgResultSet.Status)
+			is.Equal(len(tcase.toInstall), len(alternatives))
+			for i, alt := range alternatives {
+				is.ElementsMatch(tcase.toInstall[i], treeFingerprints(alt.PkgResultSet.ToInstall))
+				if i > 0 {
+					is.Less(alternatives[i-1].Cost, alt.Cost)
+				}
+			}
+			if len(alternatives) > 0 {
+				// the solver is left with the optimal solution:
+				is.ElementsMatch(tcase.toInstall[0], treeFingerprints(s.PkgResultSet.ToInstall))
+			}
+		})
+	}
+}
+
+func TestSolveContext(t *testing.T) {
+	wantedPkg := pkg.NewPkgMock("wanted", "1.0.0", "targetns",
+		[]*pkg.PkgRel{{ReleaseName: "dep", Namespace: "targetns", SemverRange: "^1.0.0", ChartName: "dep"}},
+		nil, pkg.Unknown, pkg.Present)
+	pkgs := []*pkg.Pkg{
+		wantedPkg,
+		pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+	}
+
+	t.Run("solved before the timeout", func(t *testing.T) {
+		logger := logcli.NewStandard()
+		logger.InfoOut = new(bytes.Buffer)
+
+		s := New(InstallOne, logger)
+		s.Timeout = time.Minute
+		s.BuildWorldMock(pkgs)
+		s.SolveContext(context.Background(), wantedPkg)
+		is := assert.New(t)
+		is.Equal("SAT", s.PkgResultSet.Status)
+		is.ElementsMatch([]string{wantedPkg.GetFingerPrint(), pkgs[1].GetFingerPrint()},
+			treeFingerprints(s.PkgResultSet.ToInstall))
+	})
+
+	t.Run("timed out without solution", func(t *testing.T) {
+		logger := logcli.NewStandard()
+		logger.InfoOut = new(bytes.Buffer)
+		logger.WarnOut = new(bytes.Buffer)
+
+		s := New(InstallOne, logger)
+		s.BuildWorldMock(pkgs)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		s.SolveContext(ctx, wantedPkg)
+		is := assert.New(t)
+		is.Equal("UNKNOWN", s.PkgResultSet.Status)
+		is.False(s.IsSAT())
+		is.Equal([]string{"No solution found before the solver timed out.\n"}, s.PkgResultSet.Inconsistencies)
+	})
+}
+
+func TestSolveConstrs(t *testing.T) {
+	lit := func(v string) maxsat.Lit { return maxsat.Lit{Var: v} }
+	notLit := func(v string) maxsat.Lit { return maxsat.Lit{Var: v, Negated: true} }
+	// at most one of a and b, preferring b:
+	constrs := []maxsat.Constr{
+		maxsat.HardPBConstr([]maxsat.Lit{notLit("a"), notLit("b")}, nil, 1),
+		maxsat.WeightedClause([]maxsat.Lit{lit("a")}, 2),
+		maxsat.WeightedClause([]maxsat.Lit{lit("b")}, 3),
+	}
+
+	for _, tcase := range []struct {
+		name        string
+		timeout     time.Duration
+		cancelled   bool
+		wantModel   maxsat.Model
+		wantCost    int
+		wantOptimal bool
+	}{
+		{
+			name:        "without timeout",
+			wantModel:   maxsat.Model{"a": false, "b": true},
+			wantCost:    2,
+			wantOptimal: true,
+		},
+		{
+			name:        "solved before the timeout",
+			timeout:     time.Minute,
+			wantModel:   maxsat.Model{"a": false, "b": true},
+			wantCost:    2,
+			wantOptimal: true,
+		},
+		{
+			name:      "timed out",
+			timeout:   time.Minute,
+			cancelled: true,
+			wantCost:  -1,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+			logger.WarnOut = new(bytes.Buffer)
+			is := assert.New(t)
+
+			s := New(InstallOne, logger)
+			s.Timeout = tcase.timeout
+			ctx, cancel := s.withTimeout(context.Background())
+			defer cancel()
+			if tcase.cancelled {
+				cancel()
+			}
+			model, cost, optimal := s.solveConstrs(ctx, constrs)
+			is.Equal(tcase.wantModel, model)
+			is.Equal(tcase.wantCost, cost)
+			is.Equal(tcase.wantOptimal, optimal)
+		})
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	lit := func(v string) maxsat.Lit { return maxsat.Lit{Var: v} }
+	notLit := func(v string) maxsat.Lit { return maxsat.Lit{Var: v, Negated: true} }
+	// at most one of a and b, preferring b:
+	constrs := []maxsat.Constr{
+		maxsat.HardPBConstr([]maxsat.Lit{notLit("a"), notLit("b")}, nil, 1),
+		maxsat.WeightedClause([]maxsat.Lit{lit("a")}, 2),
+		maxsat.WeightedClause([]maxsat.Lit{lit("b")}, 3),
+	}
+
+	t.Run("solved to the optimal", func(t *testing.T) {
+		results := make(chan solution, 1)
+		go optimize(context.Background(), constrs, results)
+		var last solution
+		for res := range results {
+			last = res
+		}
+		is := assert.New(t)
+		is.Equal(maxsat.Model{"a": false, "b": true}, last.model)
+		is.Equal(2, last.cost)
+	})
+
+	t.Run("stopped", func(t *testing.T) {
+		results := make(chan solution)
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		done := make(chan struct{})
+		go func() {
+			optimize(ctx, constrs, results)
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("optimize didn't return once stopped")
+		}
+		_, ok := <-results
+		assert.False(t, ok, "optimize solved once stopped")
+	})
+}
+
+func TestReachablePkgs(t *testing.T) {
+	rel := func(name string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{ReleaseName: name, Namespace: "targetns", SemverRange: "^1.0.0", ChartName: name}}
+	}
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	s := New(InstallOne, logger)
+	s.BuildWorldMock([]*pkg.Pkg{
+		pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep"), rel("opt"), pkg.Unknown, pkg.Present),
+		pkg.NewPkgMock("wanted", "0.1.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("dep", "1.0.0", "targetns", rel("transitive"), nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("dep", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("transitive", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("opt", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("release", "1.0.0", "targetns", nil, nil, pkg.Present, pkg.Unknown),
+		pkg.NewPkgMock("unrelated", "1.0.0", "targetns", rel("dep"), nil, pkg.Unknown, pkg.Unknown),
+	})
+	fps := func(pkgs []*pkg.Pkg) []string {
+		result := []string{}
+		for _, p := range pkgs {
+			result = append(result, p.GetFingerPrint())
+		}
+		return result
+	}
+	fp := func(name, version string) string {
+		return pkg.CreateFingerPrint(name, version, "targetns", name)
+	}
+
+	assert.ElementsMatch(t, []string{
+		fp("wanted", "1.0.0"), fp("wanted", "0.1.0"), fp("dep", "1.0.0"), fp("dep", "2.0.0"),
+		fp("transitive", "1.0.0"), fp("release", "1.0.0"),
+	}, fps(s.reachablePkgs()))
+
+	// optional dependencies are reachable when the solver may install them:
+	s.OptionalObjective = OptionalMaximize
+	assert.Contains(t, fps(s.reachablePkgs()), fp("opt", "1.0.0"))
+}
+
+func TestPruneUnreachable(t *testing.T) {
+	rel := func(name string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{ReleaseName: name, Namespace: "targetns", SemverRange: "^1.0.0", ChartName: name}}
+	}
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	s := New(InstallOne, logger)
+	s.BuildWorldMock([]*pkg.Pkg{
+		pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep"), nil, pkg.Unknown, pkg.Present),
+		pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("unrelated", "1.0.0", "targetns", rel("dep"), nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("unrelated", "2.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+	})
+
+	is := assert.New(t)
+	is.Equal(2, s.PruneUnreachable())
+	is.Equal(2, s.PkgDB.Len())
+	is.Nil(s.PkgDB.GetPackageByFingerprint(pkg.CreateFingerPrint("unrelated", "1.0.0", "targetns", "unrelated")))
+	is.Empty(s.PkgDB.GetMapOfVersionsByBaseFingerPrint(pkg.CreateBaseFingerPrint("unrelated", "targetns", "unrelated")))
+
+	// solving prunes, and still finds the solution:
+	s.Solve(s.PkgDB.GetPackageByFingerprint(pkg.CreateFingerPrint("wanted", "1.0.0", "targetns", "wanted")))
+	is.Equal("SAT", s.PkgResultSet.Status)
+	is.Equal(0, s.PruneUnreachable())
+}
+
+func TestDepClosure(t *testing.T) {
+	rel := func(name, semverRange string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{ReleaseName: name, Namespace: "targetns", SemverRange: semverRange, ChartName: name}}
+	}
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	s := New(InstallOne, logger)
+	s.BuildWorldMock([]*pkg.Pkg{
+		pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), nil, pkg.Unknown, pkg.Present),
+		pkg.NewPkgMock("dep", "1.0.0", "targetns", rel("missing", "~0.1.0"), nil, pkg.Unknown, pkg.Unknown),
+		pkg.NewPkgMock("dep", "2.0.0", "targetns", rel("missing", "~0.2.0"), nil, pkg.Unknown, pkg.Unknown),
+	})
+	wantedPkg := s.PkgDB.GetPackageByFingerprint(pkg.CreateFingerPrint("wanted", "1.0.0", "targetns", "wanted"))
+
+	is := assert.New(t)
+	closure := []string{}
+	for _, p := range s.DepClosure(wantedPkg) {
+		closure = append(closure, p.GetFingerPrint())
+	}
+	dep1 := pkg.CreateFingerPrint("dep", "1.0.0", "targetns", "dep")
+	is.Equal([]string{wantedPkg.GetFingerPrint(), dep1}, closure)
+
+	// inconsistencies are kept by the package whose constraints found them:
+	s.Solve(wantedPkg)
+	is.Equal("UNSAT", s.PkgResultSet.Status)
+	is.Empty(s.PkgInconsistencies(wantedPkg.GetFingerPrint()))
+	is.Equal([]string{"Chart \"dep\" depends on \"missing\" in namespace \"targetns\", semver \"~0.1.0\", but nothing satisfies it"},
+		s.PkgInconsistencies(dep1))
+	is.Len(s.PkgInconsistencies(pkg.CreateFingerPrint("dep", "2.0.0", "targetns", "dep")), 1)
+}
+
+// synthetic10kIndex returns the packages of a synthetic repository index of
+// 10k chart versions: 2500 charts with 4 versions each, in chains of 10 charts
+// depending on the next one, and a wanted package depending on 2 of the
+// chains.
+func synthetic10kIndex() (wantedPkg *pkg.Pkg, pkgs []*pkg.Pkg) {
+	rel := func(i int) *pkg.PkgRel {
+		name := fmt.Sprintf("chart%d", i)
+		return &pkg.PkgRel{ReleaseName: name, Namespace: "targetns", SemverRange: "^1.0.0", ChartName: name}
+	}
+	for i := 0; i < 2500; i++ {
+		var deps []*pkg.PkgRel
+		if i%10 != 9 {
+			deps = []*pkg.PkgRel{rel(i + 1)}
+		}
+		for v := 0; v < 4; v++ {
+			pkgs = append(pkgs, pkg.NewPkgMock(fmt.Sprintf("chart%d", i), fmt.Sprintf("1.%d.0", v), "targetns",
+				deps, nil, pkg.Unknown, pkg.Unknown))
+		}
+	}
+	wantedPkg = pkg.NewPkgMock("wanted", "1.0.0", "targetns", []*pkg.PkgRel{rel(0), rel(1230)}, nil, pkg.Unknown, pkg.Present)
+	return wantedPkg, append(pkgs, wantedPkg)
+}
+
+func BenchmarkSolve10kCharts(b *testing.B) {
+	for _, bcase := range []struct {
+		name            string
+		keepUnreachable bool
+	}{
+		{name: "pruned"},
+		{name: "unpruned", keepUnreachable: true},
+	} {
+		b.Run(bcase.name, func(b *testing.B) {
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+			logger.WarnOut = new(bytes.Buffer)
+			for n := 0; n < b.N; n++ {
+				b.StopTimer()
+				wantedPkg, pkgs := synthetic10kIndex()
+				s := New(InstallOne, logger)
+				s.keepUnreachable = bcase.keepUnreachable
+				s.BuildWorldMock(pkgs)
+				b.StartTimer()
+
+				s.Solve(wantedPkg)
+				if !s.IsSAT() {
+					b.Fatal("expected SAT")
+				}
+			}
+		})
+	}
+}
+
+func TestVersionOrdering(t *testing.T) {
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	s := New(InstallOne, logger)
+	versions := []string{"1.0.0", "1.0.0-rc1", "1.0.0-alpha", "1.10000.0", "1.9999.0", "999.0.0", "1000.0.0", "1.0.0-rc1+build2", "1.0.0-rc1+build1"}
+	for _, v := range versions {
+		s.PkgDB.Add(pkg.NewPkgMock("foo", v, "targetns", nil, nil, pkg.Unknown, pkg.Unknown))
+	}
+	fps, weights := s.PkgDB.GetOrderedPackageFingerprintsThatDifferOnVersionByPackage(
+		pkg.NewPkgMock("foo", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown))
+
+	ordered := []string{}
+	for _, fp := range fps {
+		ordered = append(ordered, s.PkgDB.GetPackageByFingerprint(fp).Version)
+	}
+	is := assert.New(t)
+	is.Equal([]string{"1.0.0-alpha", "1.0.0-rc1", "1.0.0-rc1+build1", "1.0.0-rc1+build2", "1.0.0", "1.9999.0", "1.10000.0", "999.0.0", "1000.0.0"}, ordered)
+	is.Equal([]int{1, 2, 3, 4, 5, 6, 7, 8, 9}, weights)
+}
+
+func TestPrereleases(t *testing.T) {
+	rel := func(name, semverRange string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{ReleaseName: name, Namespace: "targetns", SemverRange: semverRange, ChartName: name}}
+	}
+	fp := func(name, version string) string {
+		return pkg.CreateFingerPrint(name, version, "targetns", name)
+	}
+
+	for _, tcase := range []struct {
+		name            string
+		devel           bool
+		wantedPkg       *pkg.Pkg
+		pkgs            []*pkg.Pkg
+		resultStatus    string
+		toInstall       []string
+		inconsistencies []string
+		warnings        string
+	}{
+		{
+			name:      "newest release is preferred over its prerelease",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("wanted", "1.0.0-rc1", "targetns", nil, nil, pkg.Unknown, pkg.Present),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0")},
+		},
+		{
+			name:      "prereleases don't satisfy ranges without prereleases",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.1.0-rc1", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "UNSAT",
+			toInstall:    []string{},
+			inconsistencies: []string{
+				"Chart \"wanted\" depends on \"dep\" in namespace \"targetns\", semver \"^1.0.0\", but nothing satisfies it",
+			},
+		},
+		{
+			name:      "with devel, prereleases satisfy the ranges of their release",
+			devel:     true,
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.1.0-rc1", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("dep", "2.0.0-rc1", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0"), fp("dep", "1.1.0-rc1")},
+		},
+		{
+			name:      "invalid versions are skipped",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "^1.0.0"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+				pkg.NewPkgMock("dep", "latest", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "SAT",
+			toInstall:    []string{fp("wanted", "1.0.0"), fp("dep", "1.0.0")},
+			warnings:     "Skipping chart \"dep\" version \"latest\": not a valid semantic version",
+		},
+		{
+			name:      "invalid dependency ranges are not satisfied",
+			wantedPkg: pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "not-a-range"), nil, pkg.Unknown, pkg.Present),
+			pkgs: []*pkg.Pkg{
+				pkg.NewPkgMock("wanted", "1.0.0", "targetns", rel("dep", "not-a-range"), nil, pkg.Unknown, pkg.Present),
+				pkg.NewPkgMock("dep", "1.0.0", "targetns", nil, nil, pkg.Unknown, pkg.Unknown),
+			},
+			resultStatus: "UNSAT",
+			toInstall:    []string{},
+			inconsistencies: []string{
+				"Chart \"wanted\" depends on \"dep\" in namespace \"targetns\", semver \"not-a-range\", but nothing satisfies it",
+			},
+			warnings: "Chart \"wanted\" version \"1.0.0\" depends on chart \"dep\" with an invalid version range \"not-a-range\"",
+		},
+		{
+			name:         "invalid version of the wanted package is an inconsistency",
+			wantedPkg:    pkg.NewPkgMock("wanted", "latest", "targetns", nil, nil, pkg.Unknown, pkg.Present),
+			pkgs:         []*pkg.Pkg{pkg.NewPkgMock("wanted", "latest", "targetns", nil, nil, pkg.Unknown, pkg.Present)},
+			resultStatus: "UNSAT",
+			toInstall:    []string{},
+			inconsistencies: []string{
+				"Version \"latest\" of chart \"wanted\" is not a valid semantic version",
+			},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+			warnings := new(bytes.Buffer)
+			logger.WarnOut = warnings
+
+			s := New(InstallOne, logger)
+			s.Devel = tcase.devel
+			s.BuildWorldMock(tcase.pkgs)
+			s.Solve(s.PkgDB.GetPackageByFingerprint(tcase.wantedPkg.GetFingerPrint()))
+			is := assert.New(t)
+			is.Equal(tcase.resultStatus, s.PkgResultSet.Status)
+			if s.IsSAT() {
+				is.ElementsMatch(tcase.toInstall, treeFingerprints(s.PkgResultSet.ToInstall))
+			}
+			if tcase.inconsistencies != nil {
+				is.Equal(tcase.inconsistencies, s.PkgResultSet.Inconsistencies)
+			}
+			is.Contains(warnings.String(), tcase.warnings)
+		})
+	}
+}
@@ -0,0 +1,98 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// ResolveAlternatives builds the database of packages as Resolve does, and
+// solves for up to i.ShowAlternatives solutions for installing the wanted
+// chart, ordered by increasing cost. It doesn't install anything.
+//
+// It returns an error with the inconsistencies if there's no solution.
+func (i *Install) ResolveAlternatives(strategy solver.SolverStrategy,
+	wantedChrt *helmChart.Chart, wantedChrtAbsPath string, rels []*release.Release,
+	settings *cli.EnvSettings, logger log.Logger) ([]*solver.Alternative, error) {
+
+	s, wantedPkgInDB, err := i.buildSolver(strategy, wantedChrt, wantedChrtAbsPath, rels, settings, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var dumpErr error
+	if i.DumpSolverProblem != "" {
+		// dumped before solving, to replay solvings that time out too:
+		s.OnProblemBuilt = func() {
+			dumpErr = dumpSolverProblem(s, wantedPkgInDB, i.DumpSolverProblem, logger)
+		}
+	}
+	alternatives := s.SolveAlternatives(wantedPkgInDB, i.ShowAlternatives)
+	if dumpErr != nil {
+		return nil, dumpErr
+	}
+	if !s.IsSAT() {
+		i.addPolicyInconsistencies(s, wantedPkgInDB)
+		return nil, errors.New(strings.Join(s.PkgResultSet.Inconsistencies, ""))
+	}
+	return alternatives, nil
+}
+
+// printAlternatives prints each alternative with its cost: the tree of charts
+// to install, the releases reused as dependencies, and the releases to remove.
+func printAlternatives(alternatives []*solver.Alternative, settings *cli.EnvSettings, logger log.Logger) {
+	for idx, alt := range alternatives {
+		logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":scroll: Alternative %d, cost %d:", idx+1, alt.Cost))
+		logger.Infof("%s", solver.PrintPkgTree(alt.PkgResultSet.ToInstall))
+		for _, p := range reusedReleases(alt.PkgResultSet) {
+			logger.Infof(" Reusing release %q v%s in namespace %q\n", p.ReleaseName, p.Version, p.Namespace)
+		}
+		for _, p := range alt.PkgResultSet.ToRemove {
+			logger.Infof(" Removing release %q v%s in namespace %q\n", p.ReleaseName, p.Version, p.Namespace)
+		}
+		logger.Info("")
+	}
+}
+
+// reusedReleases returns the releases kept in rs that the packages to install
+// depend on.
+func reusedReleases(rs solver.PkgResultSet) []*pkg.Pkg {
+	depBFPs := map[string]bool{}
+	for _, p := range flattenPkgTree(rs.ToInstall) {
+		for _, rel := range append(append([]*pkg.PkgRel{}, p.DependsRel...), p.DependsOptionalRel...) {
+			depBFPs[pkg.CreateBaseFingerPrint(rel.ReleaseName, rel.Namespace, rel.ChartName)] = true
+		}
+	}
+	reused := []*pkg.Pkg{}
+	for _, p := range rs.PresentUnchanged {
+		if depBFPs[p.GetBaseFingerPrint()] {
+			reused = append(reused, p)
+		}
+	}
+	return reused
+}
@@ -0,0 +1,47 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"testing"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReusedReleases(t *testing.T) {
+	rel := func(name string) []*pkg.PkgRel {
+		return []*pkg.PkgRel{{ReleaseName: name, Namespace: "ns", SemverRange: "^1.0.0", ChartName: name}}
+	}
+	prometheus := pkg.NewPkgMock("prometheus", "13.1.0", "ns", nil, nil, pkg.Present, pkg.Unknown)
+	tracing := pkg.NewPkgMock("tracing", "1.0.0", "ns", nil, nil, pkg.Present, pkg.Unknown)
+	unrelated := pkg.NewPkgMock("unrelated", "1.0.0", "ns", nil, nil, pkg.Present, pkg.Unknown)
+
+	rs := solver.PkgResultSet{
+		ToInstall: &solver.PkgTree{
+			Node: pkg.NewPkgMock("app", "1.0.0", "ns", rel("lib"), rel("tracing"), pkg.Unknown, pkg.Present),
+			Relations: []*solver.PkgTree{{
+				Node:      pkg.NewPkgMock("lib", "1.0.0", "ns", rel("prometheus"), nil, pkg.Unknown, pkg.Unknown),
+				Relations: []*solver.PkgTree{},
+			}},
+		},
+		PresentUnchanged: []*pkg.Pkg{prometheus, tracing, unrelated},
+	}
+
+	assert.Equal(t, []*pkg.Pkg{prometheus, tracing}, reusedReleases(rs))
+}
@@ -0,0 +1,518 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/jinzhu/copier"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/release"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+)
+
+const (
+	// BundleManifestFile is the name of the file listing the requested charts
+	// of a bundle.
+	BundleManifestFile = "bundle.yaml"
+	// BundleRepoName is the name of the temporary repository registered when
+	// installing from a bundle.
+	BundleRepoName = "bundle"
+)
+
+// Bundle is the action for creating bundles and installing from them. A bundle
+// is an archive containing some charts, all the charts from their
+// shared-dependency closure, and an index.yaml for them. Bundles allow
+// installing charts in sites without network access.
+//
+// It provides the implementation of 'hypper bundle create' and
+// 'hypper bundle install'.
+type Bundle struct {
+	// InstallClient contains the chart path options used for locating the
+	// charts when creating a bundle, and the install options used when
+	// installing from a bundle.
+	InstallClient *Install
+
+	// IncludeOptionalDeps adds the optional shared dependencies to the bundle.
+	IncludeOptionalDeps bool
+}
+
+// BundleManifest describes the content of a bundle.
+type BundleManifest struct {
+	// Charts are the charts requested when creating the bundle, which get
+	// installed when installing from the bundle.
+	Charts []*BundleChart `json:"charts"`
+	// OptionalDeps is true if the optional shared dependencies of the charts
+	// have been included.
+	OptionalDeps bool `json:"optionalDeps"`
+}
+
+// BundleChart identifies a chart requested when creating a bundle.
+type BundleChart struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// NewBundle creates a new Bundle object with the given configuration.
+func NewBundle(cfg *Configuration) *Bundle {
+	return &Bundle{
+		InstallClient: NewInstall(cfg),
+	}
+}
+
+// Create executes 'hypper bundle create'.
+//
+// For each of the passed chart references, it resolves its shared-dependency
+// closure with the solver, without taking releases into account. Then, it
+// saves the charts and all their dependencies together with an index.yaml and
+// a manifest into the archive at dest.
+func (b *Bundle) Create(chartRefs []string, dest string,
+	settings *cli.EnvSettings, logger log.Logger) (*BundleManifest, error) {
+
+	bundleDir, err := ioutil.TempDir("", "hypper-bundle")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create temp dir for the bundle")
+	}
+	defer os.RemoveAll(bundleDir)
+
+	manifest := &BundleManifest{
+		Charts:       []*BundleChart{},
+		OptionalDeps: b.IncludeOptionalDeps,
+	}
+	for _, chartRef := range chartRefs {
+		chartPath, err := LocateChart(&b.InstallClient.ChartPathOptions, chartRef, settings, logger)
+		if err != nil {
+			return nil, err
+		}
+		chartAbsPath, err := filepath.Abs(chartPath)
+		if err != nil {
+			return nil, err
+		}
+		chrt, err := loader.Load(chartPath)
+		if err != nil {
+			return nil, err
+		}
+
+		client := NewInstall(b.InstallClient.Config)
+		client.ChartPathOptions = b.InstallClient.ChartPathOptions
+		client.OptionalDeps = OptionalDepsNone
+		if b.IncludeOptionalDeps {
+			client.OptionalDeps = OptionalDepsAll
+		}
+
+		// releases don't matter, the bundle will be installed elsewhere:
+		s, wantedPkg, err := client.Resolve(solver.InstallOne, chrt, chartAbsPath, nil, settings, logger)
+		if err != nil {
+			return nil, err
+		}
+		if !s.IsSAT() {
+			return nil, errors.Errorf("unable to resolve the shared dependencies of chart %q: %s",
+				chrt.Name(), strings.Join(s.PkgResultSet.Inconsistencies, ""))
+		}
+
+		logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":package: Bundling chart \"%s\" v%s", chrt.Name(), chrt.Metadata.Version))
+		if _, err := chartutil.Save(chrt, bundleDir); err != nil {
+			return nil, err
+		}
+		for _, p := range flattenPkgTree(s.PkgResultSet.ToInstall) {
+			if p.GetFingerPrint() == wantedPkg.GetFingerPrint() {
+				continue
+			}
+			logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":package: Bundling shared dependency \"%s\" v%s", p.ChartName, p.Version))
+			if err := client.saveChartOfPkg(p, bundleDir, settings, logger); err != nil {
+				return nil, err
+			}
+		}
+
+		manifest.Charts = append(manifest.Charts, &BundleChart{
+			Name:    chrt.Name(),
+			Version: chrt.Metadata.Version,
+		})
+	}
+
+	// trimmed index, only containing the bundled charts:
+	index, err := repo.IndexDirectory(bundleDir, "")
+	if err != nil {
+		return nil, err
+	}
+	index.SortEntries()
+	if err := index.WriteFile(filepath.Join(bundleDir, "index.yaml"), 0644); err != nil {
+		return nil, err
+	}
+
+	manifestBytes, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(filepath.Join(bundleDir, BundleManifestFile), manifestBytes, 0644); err != nil {
+		return nil, err
+	}
+
+	if err := writeBundleArchive(bundleDir, dest); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Install executes 'hypper bundle install'.
+//
+// It extracts the bundle and registers it as a temporary `file://` repository,
+// which is the only repository used. Then, it installs the charts listed in the
+// bundle manifest, in order, together with their shared dependencies. No
+// network access is needed.
+func (b *Bundle) Install(bundlePath string,
+	settings *cli.EnvSettings, logger log.Logger) ([]*release.Release, error) {
+
+	tmpDir, err := ioutil.TempDir("", "hypper-bundle")
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to create temp dir for the bundle")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	bundleDir := filepath.Join(tmpDir, "bundle")
+	if err := extractBundleArchive(bundlePath, bundleDir); err != nil {
+		return nil, err
+	}
+
+	manifestBytes, err := ioutil.ReadFile(filepath.Join(bundleDir, BundleManifestFile))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%q is not a valid bundle", bundlePath)
+	}
+	manifest := &BundleManifest{}
+	if err := yaml.UnmarshalStrict(manifestBytes, manifest); err != nil {
+		return nil, errors.Wrapf(err, "%q is not a valid bundle", bundlePath)
+	}
+
+	index, err := repo.LoadIndexFile(filepath.Join(bundleDir, "index.yaml"))
+	if err != nil {
+		return nil, errors.Wrapf(err, "%q is not a valid bundle", bundlePath)
+	}
+
+	// register the bundle as the only repository, for this run:
+	bundleSettings, err := bundleRepoSettings(tmpDir, bundleDir, index, settings)
+	if err != nil {
+		return nil, err
+	}
+	repoURL := "file://" + bundleDir
+
+	installedRels := []*release.Release{}
+	for _, bc := range manifest.Charts {
+		chrt, err := loadChartFromLocalRepo(bundleDir, bc.Name, bc.Version)
+		if err != nil {
+			return installedRels, err
+		}
+
+		client := NewInstall(b.InstallClient.Config)
+		// deep copy, to honour all the install options:
+		if err := copier.Copy(&client, &b.InstallClient); err != nil {
+			return installedRels, err
+		}
+		client.ChartPathOptions.RepoURL = repoURL
+		client.ChartPathOptions.Version = bc.Version
+		client.OptionalDeps = OptionalDepsNone
+		if manifest.OptionalDeps {
+			client.OptionalDeps = OptionalDepsAll
+		}
+
+		installed, err := client.isInstalled(chrt, bundleSettings)
+		if err != nil {
+			return installedRels, err
+		}
+		if installed {
+			logger.Info(eyecandy.ESPrintf(settings.NoEmojis, ":next_track_button: Skipping chart \"%s\" v%s, it is already installed",
+				bc.Name, bc.Version))
+			continue
+		}
+
+		rels, err := client.Run(solver.InstallOne, chrt, bundleDir, map[string]interface{}{}, bundleSettings, logger)
+		installedRels = append(installedRels, rels...)
+		if err != nil {
+			return installedRels, err
+		}
+	}
+	return installedRels, nil
+}
+
+// isInstalled returns true if there's a release of chrt, with the release name
+// and namespace that the chart would be installed to.
+func (i *Install) isInstalled(chrt *helmChart.Chart, settings *cli.EnvSettings) (bool, error) {
+	ns := settings.Namespace()
+	if !settings.NamespaceFromFlag {
+		ns = GetNamespace(chrt, ns)
+	}
+	name, err := GetName(chrt, i.NameTemplate)
+	if err != nil {
+		return false, err
+	}
+
+	clientGetRels := NewInstall(i.Config)
+	rels, err := clientGetRels.GetAllReleases()
+	if err != nil {
+		return false, err
+	}
+	for _, r := range rels {
+		if r.Name == name && r.Namespace == ns && r.Chart.Metadata.Version == chrt.Metadata.Version {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// saveChartOfPkg saves the chart archive of package p into dir.
+func (i *Install) saveChartOfPkg(p *pkg.Pkg, dir string,
+	settings *cli.EnvSettings, logger log.Logger) error {
+
+	if p.Repository == "" || strings.HasPrefix(p.Repository, "file://") {
+		// local chart, package it:
+		chrt, err := i.LoadChart(p.ChartName, p.ParentChartPath, p.Repository, p.Version, settings, logger)
+		if err != nil {
+			return err
+		}
+		_, err = chartutil.Save(chrt, dir)
+		return err
+	}
+
+	// chart from a repo, copy the downloaded archive as is:
+	cpo := i.ChartPathOptions
+	cpo.RepoURL = p.Repository
+	cpo.Version = p.Version
+	cp, err := LocateChart(&cpo, p.ChartName, settings, logger)
+	if err != nil {
+		return err
+	}
+	return copyFile(cp, filepath.Join(dir, fmt.Sprintf("%s-%s.tgz", p.ChartName, p.Version)))
+}
+
+// bundleRepoSettings returns a copy of settings where the only repository is
+// the extracted bundle at bundleDir. The repository config and cache are saved
+// into tmpDir.
+func bundleRepoSettings(tmpDir, bundleDir string, index *repo.IndexFile,
+	settings *cli.EnvSettings) (*cli.EnvSettings, error) {
+
+	bundleSettings := *settings
+	helmSettings := *settings.EnvSettings
+	bundleSettings.EnvSettings = &helmSettings
+	bundleSettings.RepositoryConfig = filepath.Join(tmpDir, "repositories.yaml")
+	bundleSettings.RepositoryCache = filepath.Join(tmpDir, "repository")
+	bundleSettings.FillHelmSettings()
+
+	rf := repo.NewFile()
+	rf.Add(&helmRepo.Entry{
+		Name: BundleRepoName,
+		URL:  "file://" + bundleDir,
+	})
+	if err := rf.WriteFile(bundleSettings.RepositoryConfig, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(bundleSettings.RepositoryCache, 0755); err != nil {
+		return nil, err
+	}
+	if err := index.WriteFile(filepath.Join(bundleSettings.RepositoryCache, helmpath.CacheIndexFile(BundleRepoName)), 0644); err != nil {
+		return nil, err
+	}
+	return &bundleSettings, nil
+}
+
+// isLocalRepo returns true if path is a directory containing a chart
+// repository, instead of a chart.
+func isLocalRepo(path string) bool {
+	_, err := os.Stat(filepath.Join(path, "index.yaml"))
+	return err == nil
+}
+
+// loadChartFromLocalRepo loads the chart with chartName and version, or
+// version range, from the chart repository at directory repoDir.
+func loadChartFromLocalRepo(repoDir, chartName, version string) (*helmChart.Chart, error) {
+	archive, err := localRepoChartPath(repoDir, chartName, version)
+	if err != nil {
+		return nil, err
+	}
+	return loader.Load(archive)
+}
+
+// localRepoChartPath returns the path of the archive of the chart with
+// chartName and version, or version range, in the chart repository at
+// directory repoDir.
+func localRepoChartPath(repoDir, chartName, version string) (string, error) {
+	index, err := repo.LoadIndexFile(filepath.Join(repoDir, "index.yaml"))
+	if err != nil {
+		return "", err
+	}
+	cv, err := index.Get(chartName, version)
+	if err != nil {
+		return "", errors.Wrapf(err, "chart %q version %q not found in local repository %q", chartName, version, repoDir)
+	}
+	if len(cv.URLs) == 0 {
+		return "", errors.Errorf("chart %q version %q has no downloadable URLs", chartName, version)
+	}
+	return filepath.Join(repoDir, cv.URLs[0]), nil
+}
+
+// flattenPkgTree returns the nodes of tr, in pre-order.
+func flattenPkgTree(tr *solver.PkgTree) []*pkg.Pkg {
+	if tr == nil || tr.Node == nil {
+		return []*pkg.Pkg{}
+	}
+	pkgs := []*pkg.Pkg{tr.Node}
+	for _, rel := range tr.Relations {
+		pkgs = append(pkgs, flattenPkgTree(rel)...)
+	}
+	return pkgs
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeBundleArchive writes the files in the flat directory srcDir into a
+// gzipped tarball at dest.
+func writeBundleArchive(srcDir, dest string) error {
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	err = writeBundleTarball(f, srcDir, files)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// writeBundleTarball writes files of srcDir to w as a gzipped tarball.
+func writeBundleTarball(w io.Writer, srcDir string, files []os.FileInfo) error {
+	zw := gzip.NewWriter(w)
+	tw := tar.NewWriter(zw)
+	err := writeBundleFiles(tw, srcDir, files)
+
+	// closing the tar and gzip writers flushes their trailers, the tarball
+	// isn't complete until both are closed:
+	for _, c := range []io.Closer{tw, zw} {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// writeBundleFiles writes the regular files of srcDir to tw.
+func writeBundleFiles(tw *tar.Writer, srcDir string, files []os.FileInfo) error {
+	for _, fi := range files {
+		if !fi.Mode().IsRegular() {
+			continue
+		}
+		hdr, err := tar.FileInfoHeader(fi, "")
+		if err != nil {
+			return err
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		in, err := os.Open(filepath.Join(srcDir, fi.Name()))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(tw, in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractBundleArchive extracts the gzipped tarball at src into destDir.
+// Bundles are flat, any entry that isn't a regular file at the top level is
+// rejected.
+func extractBundleArchive(src, destDir string) error {
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrapf(err, "%q is not a valid bundle", src)
+	}
+	defer zr.Close()
+
+	if err := os.MkdirAll(destDir, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%q is not a valid bundle", src)
+		}
+		if hdr.Typeflag != tar.TypeReg || hdr.Name != filepath.Base(hdr.Name) || hdr.Name == ".." {
+			return errors.Errorf("%q is not a valid bundle, unexpected entry %q", src, hdr.Name)
+		}
+		out, err := os.Create(filepath.Join(destDir, hdr.Name))
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, tr)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
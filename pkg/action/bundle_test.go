@@ -0,0 +1,118 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundleCreateAndInstall(t *testing.T) {
+	is := assert.New(t)
+
+	settings := cli.New()
+	settings.RepositoryCache = "non-existent-dir"
+	settings.RepositoryConfig = "non-existent-dir/repositories.yaml"
+
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	tmpDir, err := ioutil.TempDir("", "hypper-bundle-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	bundlePath := filepath.Join(tmpDir, "bundle.tgz")
+
+	config := actionConfigFixture(t)
+	client := NewBundle(config)
+	manifest, err := client.Create([]string{"testdata/charts/bundled"}, bundlePath, settings, logger)
+	is.NoError(err)
+	is.Equal([]*BundleChart{{Name: "bundled", Version: "0.1.0"}}, manifest.Charts)
+	is.False(manifest.OptionalDeps)
+
+	// check the content of the archive:
+	extractDir := filepath.Join(tmpDir, "extracted")
+	is.NoError(extractBundleArchive(bundlePath, extractDir))
+	files, err := ioutil.ReadDir(extractDir)
+	is.NoError(err)
+	names := []string{}
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	is.Equal([]string{
+		"bundle.yaml",
+		"bundled-0.1.0.tgz",
+		"index.yaml",
+		"local-dep-empty-0.1.0.tgz",
+		"local-dep2-empty-0.1.0.tgz",
+	}, names)
+
+	// install from the bundle, without any repository:
+	client.InstallClient.Namespace = "spaced"
+	rels, err := client.Install(bundlePath, settings, logger)
+	is.NoError(err)
+	is.Equal(3, len(rels))
+
+	// installing again skips the already installed charts:
+	rels, err = client.Install(bundlePath, settings, logger)
+	is.NoError(err)
+	is.Equal(0, len(rels))
+}
+
+func TestExtractBundleArchiveInvalid(t *testing.T) {
+	err := extractBundleArchive("testdata/charts/corrupted-compressed-chart.tgz", t.TempDir())
+	assert.Error(t, err)
+}
+
+// shortWriter fails writing past its first n bytes.
+type shortWriter struct {
+	n int
+}
+
+func (w *shortWriter) Write(p []byte) (int, error) {
+	if len(p) > w.n {
+		return 0, io.ErrShortWrite
+	}
+	w.n -= len(p)
+	return len(p), nil
+}
+
+func TestWriteBundleTarballFlushError(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(srcDir, "index.yaml"), []byte("apiVersion: v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files, err := ioutil.ReadDir(srcDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the gzip header fits, the compressed files are flushed on close:
+	err = writeBundleTarball(&shortWriter{n: 10}, srcDir, files)
+	assert.Equal(t, io.ErrShortWrite, err)
+}
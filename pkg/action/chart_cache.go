@@ -0,0 +1,226 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/pkg/chartcache"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/downloader"
+	"helm.sh/helm/v3/pkg/getter"
+	"helm.sh/helm/v3/pkg/helmpath"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+)
+
+// NewChartCache returns the local cache of downloaded charts, as configured in
+// settings.
+func NewChartCache(settings *cli.EnvSettings) *chartcache.Cache {
+	return chartcache.New(settings.ChartCache, int64(settings.ChartCacheMaxSize)*1024*1024)
+}
+
+// LocateChart is like Helm's ChartPathOptions.LocateChart, but charts from the
+// configured repositories are obtained from the local chart cache, and moved
+// into it when downloaded, instead of being left in the repository cache. It
+// is safe to call concurrently.
+//
+// Only charts that can be verified against the digest of the cached repository
+// index are cached. The rest (local charts, URLs, unknown repositories, charts
+// requiring provenance verification) are located as usual.
+func LocateChart(cpo *action.ChartPathOptions, name string,
+	settings *cli.EnvSettings, logger log.Logger) (string, error) {
+
+	cv, repoURL := findChartVersionInIndex(cpo, name, settings)
+	if cv == nil {
+		return cpo.LocateChart(name, settings.EnvSettings)
+	}
+
+	cache := NewChartCache(settings)
+	if cp, ok := cache.Get(repoURL, cv.Name, cv.Version, cv.Digest); ok {
+		logger.Debugf("Chart %q version %q found in the chart cache\n", cv.Name, cv.Version)
+		return cp, nil
+	}
+
+	// download exactly the version we found in the index:
+	cp, err := downloadChart(cpo, name, cv.Version, settings)
+	if err != nil {
+		return "", err
+	}
+
+	cachedPath, err := cache.Put(cp, repoURL, cv.Name, cv.Version, cv.Digest)
+	if err != nil {
+		if errors.Is(err, chartcache.ErrDigestMismatch) {
+			removeDownloadedChart(cp, logger)
+			return "", errors.Wrap(err, "try 'hypper repo update'")
+		}
+		// the cache is an optimization, don't fail because of it. The
+		// download is left in its temporary directory:
+		logger.Warnf("Unable to save chart %q version %q in the chart cache: %s", cv.Name, cv.Version, err)
+		return cp, nil
+	}
+	// the chart cache has its own copy now, subject to its size limit:
+	removeDownloadedChart(cp, logger)
+	return cachedPath, nil
+}
+
+// downloadChart downloads the version of the chart name, from the configured
+// repository that it resolves to with cpo, into a temporary directory of its
+// own, and returns the path of the archive. Unlike Helm, which downloads into
+// the repository cache, concurrent downloads of the same chart, e.g. on
+// several clusters, don't overwrite nor remove each other's archive.
+func downloadChart(cpo *action.ChartPathOptions, name, version string, settings *cli.EnvSettings) (string, error) {
+	entry, chartName := findRepoEntry(cpo, name, settings)
+	if entry == nil {
+		return "", errors.Errorf("no configured repository for chart %q", name)
+	}
+
+	dir, err := ioutil.TempDir("", "hypper-chart")
+	if err != nil {
+		return "", err
+	}
+	dl := downloader.ChartDownloader{
+		Out:     os.Stdout,
+		Keyring: cpo.Keyring,
+		Getters: getter.All(settings.EnvSettings),
+		Options: []getter.Option{
+			getter.WithPassCredentialsAll(cpo.PassCredentialsAll),
+			getter.WithTLSClientConfig(cpo.CertFile, cpo.KeyFile, cpo.CaFile),
+			getter.WithInsecureSkipVerifyTLS(cpo.InsecureSkipTLSverify),
+			getter.WithBasicAuth(cpo.Username, cpo.Password),
+		},
+		RepositoryConfig: settings.RepositoryConfig,
+		RepositoryCache:  settings.RepositoryCache,
+	}
+	// by the name of the repository, for its credentials to be used:
+	cp, _, err := dl.DownloadTo(entry.Name+"/"+chartName, version, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return cp, nil
+}
+
+// removeDownloadedChart removes the chart archive at path that downloadChart
+// downloaded, with its temporary directory.
+func removeDownloadedChart(path string, logger log.Logger) {
+	if err := os.RemoveAll(filepath.Dir(path)); err != nil {
+		logger.Debugf("Unable to remove downloaded chart %s: %s", path, err)
+	}
+}
+
+// findChartVersionInIndex returns the chart version that name resolves to in
+// the cached index of a configured repository, together with the repository
+// URL. It returns nil if the chart can't be cached.
+func findChartVersionInIndex(cpo *action.ChartPathOptions, name string,
+	settings *cli.EnvSettings) (*helmRepo.ChartVersion, string) {
+
+	if cpo.Verify {
+		// provenance files are not cached
+		return nil, ""
+	}
+	if _, err := os.Stat(name); err == nil {
+		// local chart
+		return nil, ""
+	}
+	if strings.Contains(name, "://") {
+		// absolute URL
+		return nil, ""
+	}
+
+	entry, chartName := findRepoEntry(cpo, name, settings)
+	if entry == nil {
+		return nil, ""
+	}
+
+	index, err := repo.LoadIndexFile(filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(entry.Name)))
+	if err != nil {
+		return nil, ""
+	}
+	cv, err := index.Get(chartName, cpo.Version)
+	if err != nil || cv.Digest == "" {
+		return nil, ""
+	}
+	return cv, entry.URL
+}
+
+// ChartRepoURL returns the URL of the configured repository that the chart
+// name, as passed to LocateChart, is located in. E.g: the URL of repository
+// "myrepo" for "myrepo/mychart".
+//
+// For absolute URLs, it returns the URL of the configured repository that
+// contains them, or else the URL of the directory they are in, so that the
+// policy can check them. It returns an empty string for local charts and
+// unknown repositories, which can't be located.
+func ChartRepoURL(cpo *action.ChartPathOptions, name string, settings *cli.EnvSettings) string {
+	if cpo.RepoURL != "" {
+		return cpo.RepoURL
+	}
+	if _, err := os.Stat(name); err == nil {
+		// local chart
+		return ""
+	}
+	if strings.Contains(name, "://") {
+		// absolute URL
+		if rf, err := repo.LoadFile(settings.RepositoryConfig); err == nil {
+			for _, e := range rf.Repositories {
+				if strings.HasPrefix(name, strings.TrimSuffix(e.URL, "/")+"/") {
+					return e.URL
+				}
+			}
+		}
+		return name[:strings.LastIndex(name, "/")]
+	}
+	entry, _ := findRepoEntry(cpo, name, settings)
+	if entry == nil {
+		return ""
+	}
+	return entry.URL
+}
+
+// findRepoEntry returns the configured repository entry that name resolves to,
+// either by cpo.RepoURL or by the repository prefix of name, together with the
+// name of the chart in that repository.
+func findRepoEntry(cpo *action.ChartPathOptions, name string,
+	settings *cli.EnvSettings) (*helmRepo.Entry, string) {
+
+	rf, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		return nil, ""
+	}
+
+	if cpo.RepoURL != "" {
+		for _, e := range rf.Repositories {
+			if strings.TrimSuffix(e.URL, "/") == strings.TrimSuffix(cpo.RepoURL, "/") {
+				return e, name
+			}
+		}
+	} else if parts := strings.SplitN(name, "/", 2); len(parts) == 2 {
+		if e := rf.Get(parts[0]); e != nil {
+			return e, parts[1]
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,179 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/repo/repotest"
+
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+)
+
+func TestLocateChartStoresChartsOnce(t *testing.T) {
+	srv, err := repotest.NewTempServerWithCleanup(t, "testdata/charts/compressedchart-0.1.0.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the repository cache only has the index of the served repository:
+	repoCache := t.TempDir()
+	index, err := ioutil.ReadFile(filepath.Join(srv.Root(), "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repoCache, "test-index.yaml"), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(srv.Root(), "repositories.yaml")
+	settings.RepositoryCache = repoCache
+	settings.ChartCache = filepath.Join(t.TempDir(), "charts")
+	settings.FillHelmSettings()
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+	logger.DebugOut = new(bytes.Buffer)
+
+	is := assert.New(t)
+	for i := 0; i < 2; i++ {
+		p, err := LocateChart(&action.ChartPathOptions{}, "test/compressedchart", settings, logger)
+		is.NoError(err)
+		is.True(strings.HasPrefix(p, settings.ChartCache), "chart %s is not in the chart cache", p)
+
+		files, err := ioutil.ReadDir(repoCache)
+		is.NoError(err)
+		names := []string{}
+		for _, f := range files {
+			names = append(names, f.Name())
+		}
+		is.Equal([]string{"test-index.yaml"}, names, "the downloaded chart is left in the repository cache")
+	}
+}
+
+func TestLocateChartConcurrently(t *testing.T) {
+	srv, err := repotest.NewTempServerWithCleanup(t, "testdata/charts/compressedchart-0.1.0.tgz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	if err := srv.LinkIndices(); err != nil {
+		t.Fatal(err)
+	}
+
+	repoCache := t.TempDir()
+	index, err := ioutil.ReadFile(filepath.Join(srv.Root(), "index.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repoCache, "test-index.yaml"), index, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	settings := cli.New()
+	settings.RepositoryConfig = filepath.Join(srv.Root(), "repositories.yaml")
+	settings.RepositoryCache = repoCache
+	settings.ChartCache = filepath.Join(t.TempDir(), "charts")
+	settings.FillHelmSettings()
+
+	// as on several clusters, no download removes the chart that another
+	// one is loading:
+	errs := make(chan error, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+			logger.DebugOut = new(bytes.Buffer)
+			logger.WarnOut = new(bytes.Buffer)
+			p, err := LocateChart(&action.ChartPathOptions{}, "test/compressedchart", settings, logger)
+			if err == nil {
+				_, err = loader.Load(p)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+}
+
+func TestChartRepoURL(t *testing.T) {
+	dir := t.TempDir()
+	repoConfig := filepath.Join(dir, "repositories.yaml")
+	repoFile := "apiVersion: v1\nrepositories:\n  - name: stable\n    url: https://charts.example.com/stable/\n"
+	if err := ioutil.WriteFile(repoConfig, []byte(repoFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := cli.New()
+	settings.RepositoryConfig = repoConfig
+
+	for _, tcase := range []struct {
+		name    string
+		repoURL string
+		chart   string
+		want    string
+	}{
+		{
+			name:    "repository flag",
+			repoURL: "https://charts.example.com/other",
+			chart:   "foo",
+			want:    "https://charts.example.com/other",
+		},
+		{
+			name:  "repository alias",
+			chart: "stable/foo",
+			want:  "https://charts.example.com/stable/",
+		},
+		{
+			name:  "local chart",
+			chart: "testdata/charts/compressedchart-0.1.0.tgz",
+		},
+		{
+			name:  "absolute URL in a configured repository",
+			chart: "https://charts.example.com/stable/foo-1.0.0.tgz",
+			want:  "https://charts.example.com/stable/",
+		},
+		{
+			name:  "absolute URL in another repository",
+			chart: "https://evil.example.com/charts/foo-1.0.0.tgz",
+			want:  "https://evil.example.com/charts",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			cpo := &action.ChartPathOptions{RepoURL: tcase.repoURL}
+			assert.Equal(t, tcase.want, ChartRepoURL(cpo, tcase.chart, settings))
+		})
+	}
+}
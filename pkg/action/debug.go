@@ -0,0 +1,89 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+)
+
+// DebugSolve is the action for solving again a solver problem dumped with
+// '--dump-solver-problem', offline.
+//
+// It provides the implementation of 'hypper debug solve'.
+type DebugSolve struct{}
+
+// NewDebugSolve creates a new DebugSolve object.
+func NewDebugSolve() *DebugSolve {
+	return &DebugSolve{}
+}
+
+// Run executes 'hypper debug solve'.
+//
+// It loads the solver problem in problemPath, and solves it with the same
+// strategy and options it was dumped with. It returns the solver containing
+// the outcome of the solving.
+func (d *DebugSolve) Run(problemPath string, logger log.Logger) (*solver.Solver, error) {
+	if problemFormat(problemPath) != solver.ProblemYAML {
+		return nil, errors.Errorf("cannot replay %q: only YAML solver problems can be replayed", problemPath)
+	}
+	f, err := os.Open(problemPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s, wantedPkg, err := solver.LoadProblem(f, logger)
+	if err != nil {
+		return nil, err
+	}
+	s.Solve(wantedPkg)
+	s.SortPkgSets()
+	return s, nil
+}
+
+// dumpSolverProblem writes the problem of the last solving of s to path, in
+// the OPB format if path has the '.opb' extension, or as YAML otherwise.
+func dumpSolverProblem(s *solver.Solver, wantedPkg *pkg.Pkg, path string, logger log.Logger) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "cannot dump solver problem")
+	}
+	defer f.Close()
+
+	if err := s.WriteProblem(f, wantedPkg, problemFormat(path)); err != nil {
+		return errors.Wrap(err, "cannot dump solver problem")
+	}
+	logger.Debugf("Solver problem dumped to %s", path)
+	return nil
+}
+
+// problemFormat returns the format of the solver problem in path, by its
+// extension.
+func problemFormat(path string) solver.ProblemFormat {
+	if strings.ToLower(filepath.Ext(path)) == ".opb" {
+		return solver.ProblemOPB
+	}
+	return solver.ProblemYAML
+}
@@ -27,6 +27,7 @@ import (
 	"helm.sh/helm/v3/pkg/action"
 	helmChart "helm.sh/helm/v3/pkg/chart"
 	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/release"
 )
 
 // SharedDependency is the action for building a given chart's shared dependency tree.
@@ -37,13 +38,16 @@ type SharedDependency struct {
 
 	// hypper specific:
 	Config *Configuration
+	// OptionalDeps selects whether optional shared dependencies are listed.
+	// They are listed unless it is OptionalDepsNone.
+	OptionalDeps OptionalDepsStrategy
 }
 
 // NewSharedDependency creates a new SharedDependency object with the given configuration.
 func NewSharedDependency(cfg *Configuration) *SharedDependency {
 	return &SharedDependency{
-		action.NewDependency(),
-		cfg,
+		Dependency: action.NewDependency(),
+		Config:     cfg,
 	}
 }
 
@@ -80,6 +84,13 @@ func (d *SharedDependency) SharedDependencyStatus(depChart *helmChart.Chart, dep
 		return "", err
 	}
 
+	return sharedDependencyStatus(releases, depName, depNS, depVersion)
+}
+
+// sharedDependencyStatus returns the status of the release with depName and
+// depNS among releases: "not-installed" if there's none, "out-of-range" if its
+// chart version doesn't satisfy depVersion, or else the release status.
+func sharedDependencyStatus(releases []*release.Release, depName, depNS, depVersion string) (string, error) {
 	for _, r := range releases {
 		if r.Name == depName && r.Namespace == depNS {
 			if r.Chart.Metadata.Version != depVersion {
@@ -103,15 +114,33 @@ func (d *SharedDependency) SharedDependencyStatus(depChart *helmChart.Chart, dep
 
 // printSharedDependencies prints all of the shared dependencies in the yaml file.
 // It will respect settings.NamespaceFromFlag when iterating through releases.
+// Optional dependencies that are not installed and were declined for the
+// release of the parent chart, on the cluster, have status "declined".
 func (d *SharedDependency) printSharedDependencies(parentChart *helmChart.Chart, logger log.Logger, deps []*chart.Dependency, settings *cli.EnvSettings) error {
 
+	declined, err := LoadDeclinedOptionalDeps(settings.DeclinedOptionalDepsFile)
+	if err != nil {
+		return err
+	}
+	parentName, err := GetName(parentChart, "")
+	if err != nil {
+		return err
+	}
+	parentNS := settings.Namespace()
+	if !settings.NamespaceFromFlag {
+		parentNS = GetNamespace(parentChart, parentNS)
+	}
+
 	table := uitable.New()
 	table.MaxColWidth = 80
 	table.AddRow("NAME", "VERSION", "REPOSITORY", "STATUS", "NAMESPACE", "TYPE")
 	for _, dep := range deps {
+		if dep.IsOptional && d.OptionalDeps == OptionalDepsNone {
+			continue
+		}
 		chartPathOptions := action.ChartPathOptions{}
 		chartPathOptions.RepoURL = dep.Repository
-		cp, err := chartPathOptions.LocateChart(dep.Name, settings.EnvSettings)
+		cp, err := LocateChart(&chartPathOptions, dep.Name, settings, logger)
 		if err != nil {
 			return err
 		}
@@ -141,6 +170,9 @@ func (d *SharedDependency) printSharedDependencies(parentChart *helmChart.Chart,
 		if err != nil {
 			return err
 		}
+		if dep.IsOptional && depStatus == "not-installed" && declined.Has(settings.CurrentKubeContext(), parentName, parentNS, dep.Name) {
+			depStatus = "declined"
+		}
 		var depType string
 		switch dep.IsOptional {
 		case true:
@@ -18,6 +18,7 @@ package action
 
 import (
 	"bytes"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -29,6 +30,7 @@ import (
 	"github.com/Masterminds/log-go"
 	logcli "github.com/Masterminds/log-go/impl/cli"
 	"github.com/rancher-sandbox/hypper/internal/test"
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
 	hypperChart "github.com/rancher-sandbox/hypper/pkg/chart"
 	"github.com/rancher-sandbox/hypper/pkg/cli"
 )
@@ -40,10 +42,19 @@ func newSharedDepFixture(t *testing.T, ns string) *SharedDependency {
 }
 
 func TestSharedDepsList(t *testing.T) {
+	declinedFile := filepath.Join(ensure.TempDir(t), "declined-optional-deps.yaml")
+	declined := &DeclinedOptionalDeps{}
+	declined.Add("my-cluster", "my-hypper-name", "hypper", "testdata/charts/vanilla-helm")
+	if err := declined.WriteFile(declinedFile, 0644); err != nil {
+		t.Fatal(err)
+	}
+
 	for _, tcase := range []struct {
-		chart     string
-		golden    string
-		wantError bool
+		chart        string
+		golden       string
+		wantError    bool
+		optionalDeps OptionalDepsStrategy
+		declinedFile string
 	}{
 		{
 			chart:     "no/such/chart",
@@ -70,6 +81,16 @@ func TestSharedDepsList(t *testing.T) {
 			chart:  "testdata/charts/shared-and-optional-deps",
 			golden: "output/shared-and-optional-deps.txt",
 		},
+		{
+			chart:        "testdata/charts/shared-and-optional-deps",
+			golden:       "output/shared-and-optional-deps-none.txt",
+			optionalDeps: OptionalDepsNone,
+		},
+		{
+			chart:        "testdata/charts/shared-and-optional-deps",
+			golden:       "output/shared-and-optional-deps-declined.txt",
+			declinedFile: declinedFile,
+		},
 	} {
 		// create our own Logger that satisfies impl/cli.Logger, but with a buffer for tests
 		buf := new(bytes.Buffer)
@@ -80,8 +101,14 @@ func TestSharedDepsList(t *testing.T) {
 		log.Current = logger
 
 		settings := cli.New()
+		settings.KubeContext = "my-cluster"
+		settings.DeclinedOptionalDepsFile = "testdata/non-existent-declined-optional-deps.yaml"
+		if tcase.declinedFile != "" {
+			settings.DeclinedOptionalDepsFile = tcase.declinedFile
+		}
 
 		sharedDepAction := newSharedDepFixture(t, "hypper")
+		sharedDepAction.OptionalDeps = tcase.optionalDeps
 		err := sharedDepAction.List(tcase.chart, settings, log.Current)
 		if (err != nil) != tcase.wantError {
 			t.Errorf("expected error, got '%v'", err)
@@ -0,0 +1,197 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// DriftKind is a kind of drift between the releases and what their charts
+// declare.
+type DriftKind string
+
+const (
+	// DriftMissingDep is a shared dependency that is not installed.
+	DriftMissingDep DriftKind = "missing-dependency"
+	// DriftOutOfRange is a dependency installed with a version outside of the
+	// range of a dependent.
+	DriftOutOfRange DriftKind = "out-of-range"
+	// DriftWrongNamespace is a release installed in another namespace than
+	// the one in its hypper.cattle.io/namespace annotation.
+	DriftWrongNamespace DriftKind = "wrong-namespace"
+	// DriftOptionalNotInstalled is an optional dependency that is not
+	// installed. It is informational.
+	DriftOptionalNotInstalled DriftKind = "optional-not-installed"
+)
+
+// Drift is a difference between a release and what its chart declares.
+type Drift struct {
+	Kind DriftKind `json:"kind"`
+	// Release and Namespace identify the release with the drift.
+	Release   string `json:"release"`
+	Namespace string `json:"namespace"`
+	// Dependency is the chart name of the dependency with the drift, if any.
+	Dependency string `json:"dependency,omitempty"`
+	Message    string `json:"message"`
+}
+
+// Diff is the action for detecting drift between the deployed releases and
+// the shared dependencies declared by their charts.
+//
+// It provides the implementation of 'hypper diff'.
+type Diff struct {
+	Config *Configuration
+}
+
+// NewDiff creates a new Diff object with the given configuration.
+func NewDiff(cfg *Configuration) *Diff {
+	return &Diff{
+		Config: cfg,
+	}
+}
+
+// Run executes 'hypper diff'.
+//
+// For all releases, or those in the namespace passed by flag, it checks that
+// the release is in the namespace of its chart annotations, and that each of
+// the shared and optional dependencies of its chart is installed with a
+// version in range. The release name and namespace of a dependency are
+// obtained from the annotations of the dependency chart, in the cached
+// repository indexes or else in its releases.
+//
+// It only reads releases and cached indexes, and never contacts the
+// repositories.
+func (d *Diff) Run(settings *cli.EnvSettings, logger log.Logger) ([]*Drift, error) {
+	rels, err := NewInstall(d.Config).GetAllReleases()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rels, func(i, j int) bool {
+		if rels[i].Namespace != rels[j].Namespace {
+			return rels[i].Namespace < rels[j].Namespace
+		}
+		return rels[i].Name < rels[j].Name
+	})
+
+	rf, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			return nil, err
+		}
+		logger.Debug("No repository present, continuing…")
+	}
+	repoEntries, err := loadRepoEntries(rf.Repositories, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	settingsNS := settings.Namespace()
+	drifts := []*Drift{}
+	for _, r := range rels {
+		if settings.NamespaceFromFlag && r.Namespace != settingsNS {
+			continue
+		}
+
+		if ns, ok := r.Chart.Metadata.Annotations["hypper.cattle.io/namespace"]; ok && ns != r.Namespace {
+			drifts = append(drifts, &Drift{
+				Kind:      DriftWrongNamespace,
+				Release:   r.Name,
+				Namespace: r.Namespace,
+				Message:   fmt.Sprintf("chart %q is annotated with namespace %q", r.Chart.Name(), ns),
+			})
+		}
+
+		deps, err := chart.GetSharedDeps(r.Chart, logger)
+		if err != nil {
+			return nil, errors.Wrapf(err, "release %q has malformed shared dependencies", r.Name)
+		}
+		for _, dep := range deps {
+			depName, depNS := depReleaseNameAndNamespace(dep.Name, rels, repoEntries, settingsNS)
+			status, err := sharedDependencyStatus(rels, depName, depNS, dep.Version)
+			if err != nil {
+				return nil, errors.Wrapf(err, "release %q has an invalid version for dependency %q", r.Name, dep.Name)
+			}
+
+			drift := &Drift{
+				Release:    r.Name,
+				Namespace:  r.Namespace,
+				Dependency: dep.Name,
+			}
+			switch status {
+			case "not-installed":
+				drift.Kind = DriftMissingDep
+				drift.Message = fmt.Sprintf("shared dependency %q %q is not installed in namespace %q",
+					dep.Name, dep.Version, depNS)
+				if dep.IsOptional {
+					drift.Kind = DriftOptionalNotInstalled
+					drift.Message = fmt.Sprintf("optional dependency %q %q is not installed in namespace %q",
+						dep.Name, dep.Version, depNS)
+				}
+				for _, other := range rels {
+					if other.Name == depName && other.Chart.Metadata.Name == dep.Name {
+						drift.Message += fmt.Sprintf(", but release %q is in namespace %q", other.Name, other.Namespace)
+						break
+					}
+				}
+			case "out-of-range":
+				drift.Kind = DriftOutOfRange
+				for _, other := range rels {
+					if other.Name == depName && other.Namespace == depNS {
+						drift.Message = fmt.Sprintf("release %q in namespace %q has version %s, outside of range %q",
+							depName, depNS, other.Chart.Metadata.Version, dep.Version)
+					}
+				}
+			default:
+				continue
+			}
+			drifts = append(drifts, drift)
+		}
+	}
+	return drifts, nil
+}
+
+// depReleaseNameAndNamespace returns the release name and namespace of the
+// dependency with chart depChartName, from the annotations of the chart in the
+// repositories, or of a release of it. It defaults to the chart name and
+// settingsNS.
+func depReleaseNameAndNamespace(depChartName string, rels []*release.Release,
+	repoEntries map[string]chrtEntry, settingsNS string) (string, string) {
+
+	// TODO each version can have a different default ns
+	if ce, ok := repoEntries[depChartName]; ok && len(ce.chartVersions) > 0 {
+		annot := ce.chartVersions[0].Annotations
+		return GetNameFromAnnot(annot, depChartName), GetNamespaceFromAnnot(annot, settingsNS)
+	}
+	for _, r := range rels {
+		if r.Chart.Metadata.Name == depChartName {
+			annot := r.Chart.Metadata.Annotations
+			return GetNameFromAnnot(annot, depChartName), GetNamespaceFromAnnot(annot, settingsNS)
+		}
+	}
+	return depChartName, settingsNS
+}
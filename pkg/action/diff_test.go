@@ -0,0 +1,145 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"testing"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestDiffRun(t *testing.T) {
+	app := syncRelStub("app", "app-ns", "app", "2.0.0")
+	app.Chart.Metadata.Annotations = map[string]string{
+		"hypper.cattle.io/namespace":             "app-ns",
+		"hypper.cattle.io/shared-dependencies":   "- name: lib\n  version: \"^1.0.0\"\n",
+		"hypper.cattle.io/optional-dependencies": "- name: extra\n  version: \"^1.0.0\"\n",
+	}
+	libInRange := syncRelStub("lib", "lib-ns", "lib", "1.0.0")
+	libInRange.Chart.Metadata.Annotations = map[string]string{"hypper.cattle.io/namespace": "lib-ns"}
+	libOutOfRange := syncRelStub("lib", "lib-ns", "lib", "2.0.0")
+	libOutOfRange.Chart.Metadata.Annotations = map[string]string{"hypper.cattle.io/namespace": "lib-ns"}
+	libMisplaced := syncRelStub("lib", "default", "lib", "1.0.0")
+	libMisplaced.Chart.Metadata.Annotations = map[string]string{"hypper.cattle.io/namespace": "lib-ns"}
+	extra := syncRelStub("extra", "extra-ns", "extra", "1.0.0")
+	web := syncRelStub("web", "default", "web", "1.0.0")
+	web.Chart.Metadata.Annotations = map[string]string{
+		"hypper.cattle.io/shared-dependencies": "- name: db\n  version: \"~1.2.0\"\n",
+	}
+
+	for _, tcase := range []struct {
+		name        string
+		rels        []*release.Release
+		namespace   string
+		drifts      []*Drift
+		wantError   bool
+		expectedErr string
+	}{
+		{
+			name:   "no drift",
+			rels:   []*release.Release{app, libInRange, extra},
+			drifts: []*Drift{},
+		},
+		{
+			name: "out of range and optional dependency not installed",
+			rels: []*release.Release{app, libOutOfRange},
+			drifts: []*Drift{
+				{Kind: DriftOutOfRange, Release: "app", Namespace: "app-ns", Dependency: "lib",
+					Message: "release \"lib\" in namespace \"lib-ns\" has version 2.0.0, outside of range \"^1.0.0\""},
+				{Kind: DriftOptionalNotInstalled, Release: "app", Namespace: "app-ns", Dependency: "extra",
+					Message: "optional dependency \"extra\" \"^1.0.0\" is not installed in namespace \"extra-ns\""},
+			},
+		},
+		{
+			name: "dependency in wrong namespace",
+			rels: []*release.Release{app, libMisplaced, extra},
+			drifts: []*Drift{
+				{Kind: DriftMissingDep, Release: "app", Namespace: "app-ns", Dependency: "lib",
+					Message: "shared dependency \"lib\" \"^1.0.0\" is not installed in namespace \"lib-ns\", but release \"lib\" is in namespace \"default\""},
+				{Kind: DriftWrongNamespace, Release: "lib", Namespace: "default",
+					Message: "chart \"lib\" is annotated with namespace \"lib-ns\""},
+			},
+		},
+		{
+			name: "dependency not in repositories nor installed",
+			rels: []*release.Release{web},
+			drifts: []*Drift{
+				{Kind: DriftMissingDep, Release: "web", Namespace: "default", Dependency: "db",
+					Message: "shared dependency \"db\" \"~1.2.0\" is not installed in namespace \"default\""},
+			},
+		},
+		{
+			name:      "only releases in namespace",
+			rels:      []*release.Release{app, libMisplaced, web},
+			namespace: "app-ns",
+			drifts: []*Drift{
+				{Kind: DriftMissingDep, Release: "app", Namespace: "app-ns", Dependency: "lib",
+					Message: "shared dependency \"lib\" \"^1.0.0\" is not installed in namespace \"lib-ns\", but release \"lib\" is in namespace \"default\""},
+				{Kind: DriftOptionalNotInstalled, Release: "app", Namespace: "app-ns", Dependency: "extra",
+					Message: "optional dependency \"extra\" \"^1.0.0\" is not installed in namespace \"extra-ns\""},
+			},
+		},
+		{
+			name: "malformed shared dependencies",
+			rels: []*release.Release{func() *release.Release {
+				r := syncRelStub("broken", "default", "broken", "1.0.0")
+				r.Chart.Metadata.Annotations = map[string]string{"hypper.cattle.io/shared-dependencies": "- name: [\n"}
+				return r
+			}()},
+			wantError:   true,
+			expectedErr: "release \"broken\" has malformed shared dependencies",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			var settings *cli.EnvSettings
+			if tcase.namespace != "" {
+				settings = cli.NewWithNamespace(tcase.namespace)
+				settings.NamespaceFromFlag = true
+			} else {
+				settings = cli.New()
+			}
+			settings.RepositoryConfig = "testdata/sync/repositories.yaml"
+			settings.RepositoryCache = "testdata/sync/repository"
+
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+			logger.WarnOut = new(bytes.Buffer)
+
+			config := actionConfigFixture(t)
+			for _, r := range tcase.rels {
+				if err := config.Releases.Create(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			drifts, err := NewDiff(config).Run(settings, logger)
+			if tcase.wantError {
+				is.Error(err)
+				is.Contains(err.Error(), tcase.expectedErr)
+				return
+			}
+			is.NoError(err)
+			is.Equal(tcase.drifts, drifts)
+		})
+	}
+}
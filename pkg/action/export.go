@@ -0,0 +1,165 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+
+	"helm.sh/helm/v3/pkg/helmpath"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// Export is the action for snapshotting the releases of the cluster into a
+// Hypperfile.
+//
+// It provides the implementation of 'hypper export'.
+type Export struct {
+	Config *Configuration
+}
+
+// NewExport creates a new Export object with the given configuration.
+func NewExport(cfg *Configuration) *Export {
+	return &Export{
+		Config: cfg,
+	}
+}
+
+// Run executes 'hypper export'.
+//
+// It returns a Hypperfile listing all the releases of the cluster with their
+// exact chart version and digest, their user-supplied values, and whether they
+// were installed as shared dependencies of other releases. Syncing it on
+// another cluster recreates the same releases.
+//
+// The repository of each release is the first configured repository, by name,
+// whose index contains its chart version. Releases of charts not found in any
+// repository are exported without repository, with a warning.
+func (e *Export) Run(settings *cli.EnvSettings, logger log.Logger) (*Hypperfile, error) {
+	rels, err := NewInstall(e.Config).GetAllReleases()
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(rels, func(i, j int) bool {
+		if rels[i].Namespace != rels[j].Namespace {
+			return rels[i].Namespace < rels[j].Namespace
+		}
+		return rels[i].Name < rels[j].Name
+	})
+
+	rf, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			return nil, err
+		}
+		logger.Debug("No repository present, continuing…")
+	}
+	repositories := rf.Repositories
+	sort.SliceStable(repositories, func(i, j int) bool {
+		return repositories[i].Name < repositories[j].Name
+	})
+	indexes := map[string]*repo.IndexFile{}
+	for _, r := range repositories {
+		idxFilepath := filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(r.Name))
+		if indexes[r.Name], err = repo.LoadIndexFile(idxFilepath); err != nil {
+			return nil, err
+		}
+	}
+
+	autoRels, err := autoInstalledReleases(rels, settings.Namespace(), logger)
+	if err != nil {
+		return nil, err
+	}
+
+	hf := &Hypperfile{
+		Repositories: []*HypperfileRepository{},
+		Releases:     []*HypperfileRelease{},
+	}
+	usedRepos := map[string]bool{}
+	for _, r := range rels {
+		hr := &HypperfileRelease{
+			Chart:     r.Chart.Metadata.Name,
+			Version:   r.Chart.Metadata.Version,
+			Name:      r.Name,
+			Namespace: r.Namespace,
+			Values:    r.Config,
+			Auto:      autoRels[r],
+		}
+		found := false
+		for _, re := range repositories {
+			cv, err := indexes[re.Name].Get(r.Chart.Metadata.Name, r.Chart.Metadata.Version)
+			if err != nil {
+				continue
+			}
+			hr.Chart = re.Name + "/" + r.Chart.Metadata.Name
+			hr.Digest = cv.Digest
+			if !usedRepos[re.Name] {
+				usedRepos[re.Name] = true
+				hf.Repositories = append(hf.Repositories, &HypperfileRepository{
+					Name: re.Name,
+					URL:  re.URL,
+				})
+			}
+			found = true
+			break
+		}
+		if !found {
+			logger.Warnf("Chart %q v%s of release %q in namespace %q was not found in any repository",
+				r.Chart.Metadata.Name, r.Chart.Metadata.Version, r.Name, r.Namespace)
+		}
+		hf.Releases = append(hf.Releases, hr)
+	}
+	return hf, nil
+}
+
+// autoInstalledReleases returns the releases that are shared or optional
+// dependencies of other releases: those whose chart, version, release name
+// and namespace satisfy a dependency in the annotations of another release.
+// Hypper doesn't record why a release was installed, hence the inference.
+func autoInstalledReleases(rels []*release.Release, settingsNS string,
+	logger log.Logger) (map[*release.Release]bool, error) {
+
+	auto := map[*release.Release]bool{}
+	for _, dependent := range rels {
+		deps, err := chart.GetSharedDeps(dependent.Chart, logger)
+		if err != nil {
+			return nil, errors.Wrapf(err, "release %q has malformed shared dependencies", dependent.Name)
+		}
+		for _, dep := range deps {
+			for _, r := range rels {
+				if r == dependent || r.Chart.Metadata.Name != dep.Name {
+					continue
+				}
+				annot := r.Chart.Metadata.Annotations
+				if r.Name == GetNameFromAnnot(annot, r.Chart.Metadata.Name) &&
+					r.Namespace == GetNamespaceFromAnnot(annot, settingsNS) &&
+					inSemverRange(dep.Version, r.Chart.Metadata.Version) {
+					auto[r] = true
+				}
+			}
+		}
+	}
+	return auto, nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"testing"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+func TestExportRun(t *testing.T) {
+	is := assert.New(t)
+
+	settings := cli.New()
+	settings.RepositoryConfig = "testdata/sync/repositories.yaml"
+	settings.RepositoryCache = "testdata/sync/repository"
+	settings.PolicyFile = "non-existent-dir/policy.yaml"
+
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+	warnings := new(bytes.Buffer)
+	logger.WarnOut = warnings
+
+	app := syncRelStub("app", "app-ns", "app", "2.0.0")
+	app.Chart.Metadata.Annotations = map[string]string{
+		"hypper.cattle.io/namespace":           "app-ns",
+		"hypper.cattle.io/shared-dependencies": "- name: lib\n  version: \"^1.0.0\"\n",
+	}
+	app.Config = map[string]interface{}{"replicas": 2}
+	lib := syncRelStub("lib", "lib-ns", "lib", "1.0.0")
+	lib.Chart.Metadata.Annotations = map[string]string{"hypper.cattle.io/namespace": "lib-ns"}
+	// same chart, but not where app expects its dependency:
+	otherLib := syncRelStub("other-lib", "lib-ns", "lib", "1.0.0")
+	unknown := syncRelStub("unknown", "default", "unknown", "0.1.0")
+
+	config := actionConfigFixture(t)
+	for _, r := range []*release.Release{app, lib, otherLib, unknown} {
+		if err := config.Releases.Create(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hf, err := NewExport(config).Run(settings, logger)
+	is.NoError(err)
+	is.Equal([]*HypperfileRepository{{Name: "ours", URL: "http://example.com/ours"}}, hf.Repositories)
+	is.Equal([]*HypperfileRelease{
+		{Chart: "ours/app", Version: "2.0.0", Name: "app", Namespace: "app-ns",
+			Values: map[string]interface{}{"replicas": 2}},
+		{Chart: "unknown", Version: "0.1.0", Name: "unknown", Namespace: "default"},
+		{Chart: "ours/lib", Version: "1.0.0", Name: "lib", Namespace: "lib-ns", Auto: true,
+			Digest: "5a0b6a8c7ea8b4bb7e3f8cbe5b9d6c9f2d3c1f0e4b7a6d5c8e9f0a1b2c3d4e5f"},
+		{Chart: "ours/lib", Version: "1.0.0", Name: "other-lib", Namespace: "lib-ns",
+			Digest: "5a0b6a8c7ea8b4bb7e3f8cbe5b9d6c9f2d3c1f0e4b7a6d5c8e9f0a1b2c3d4e5f"},
+	}, hf.Releases)
+	is.Contains(warnings.String(), "Chart \"unknown\" v0.1.0 of release \"unknown\" in namespace \"default\" was not found in any repository")
+
+	// syncing the export of the releases in repositories changes nothing:
+	hf.Releases = append(hf.Releases[:1], hf.Releases[2:]...)
+	client := NewSync(config)
+	client.DryRun = true
+	changes, err := client.Run(hf, settings, logger)
+	is.NoError(err)
+	is.Equal(3, len(changes))
+	for _, c := range changes {
+		is.Equal(SyncUnchanged, c.Action)
+	}
+}
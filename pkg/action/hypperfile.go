@@ -0,0 +1,97 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"io/ioutil"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// HypperfileName is the default file name of a Hypperfile.
+const HypperfileName = "Hypperfile.yaml"
+
+// Hypperfile describes the desired state of the releases of a cluster.
+type Hypperfile struct {
+	// Repositories are the chart repositories of the releases. They need to be
+	// configured with 'hypper repo add', under any name, before syncing.
+	Repositories []*HypperfileRepository `json:"repositories,omitempty"`
+	// Releases are the releases that should be present.
+	Releases []*HypperfileRelease `json:"releases"`
+}
+
+// HypperfileRelease describes a release that should be present.
+type HypperfileRelease struct {
+	// Chart is the chart reference, either "repo/chart" or the name of a chart
+	// found in any of the configured repositories.
+	Chart string `json:"chart"`
+	// Version is a version or a semver range of the chart. If empty, any
+	// version satisfies it.
+	Version string `json:"version,omitempty"`
+	// Name is the release name. If empty, it is obtained from the chart
+	// annotations, or the chart name.
+	Name string `json:"name,omitempty"`
+	// Namespace is the release namespace. If empty, it is obtained from the
+	// chart annotations, or the current namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// Values are the values used when installing or upgrading the release.
+	Values map[string]interface{} `json:"values,omitempty"`
+	// Digest locks the chart archive of an exact Version. If set, syncing
+	// fails when the digest in the repository index is different.
+	Digest string `json:"digest,omitempty"`
+	// Auto is true if the release was installed as a shared dependency of
+	// other releases, instead of explicitly. It is informational only.
+	Auto bool `json:"auto,omitempty"`
+}
+
+// HypperfileRepository is a chart repository of a Hypperfile.
+type HypperfileRepository struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+// LoadHypperfile loads and validates the Hypperfile at path.
+func LoadHypperfile(path string) (*Hypperfile, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read Hypperfile %q", path)
+	}
+	hf := &Hypperfile{}
+	if err := yaml.UnmarshalStrict(b, hf); err != nil {
+		return nil, errors.Wrapf(err, "Hypperfile %q is malformed", path)
+	}
+	for _, r := range hf.Repositories {
+		if r.Name == "" || r.URL == "" {
+			return nil, errors.Errorf("Hypperfile %q has a repository without name or url", path)
+		}
+	}
+	for _, r := range hf.Releases {
+		if r.Chart == "" {
+			return nil, errors.Errorf("Hypperfile %q has a release without chart", path)
+		}
+		if r.Version == "" {
+			continue
+		}
+		if _, err := semver.NewConstraint(r.Version); err != nil {
+			return nil, errors.Wrapf(err, "Hypperfile %q has an invalid version %q for chart %q",
+				path, r.Version, r.Chart)
+		}
+	}
+	return hf, nil
+}
@@ -18,8 +18,10 @@ package action
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 
@@ -30,8 +32,12 @@ import (
 
 	pkg "github.com/rancher-sandbox/hypper/internal/package"
 	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/chart"
 	"github.com/rancher-sandbox/hypper/pkg/cli"
 	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
+	"github.com/rancher-sandbox/hypper/pkg/plugin"
+	"github.com/rancher-sandbox/hypper/pkg/policy"
 
 	"github.com/rancher-sandbox/hypper/internal/third-party/helm/resolver"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
@@ -44,15 +50,18 @@ import (
 )
 
 // OptionalDepsStrategy defines a strategy for determining wether to use optional deps
-type optionalDepsStrategy int
+type OptionalDepsStrategy int
 
 const (
 	// OptionalDepsAll will use all the optional deps
-	OptionalDepsAll optionalDepsStrategy = iota
+	OptionalDepsAll OptionalDepsStrategy = iota
 	// OptionalDepsAsk will interactively prompt on each optional dep
 	OptionalDepsAsk
 	// OptionalDepsNone with skip all the optional deps
 	OptionalDepsNone
+	// OptionalDepsBestEffort will install as many optional deps as possible
+	// without making the solving UNSAT
+	OptionalDepsBestEffort
 )
 
 // Install is a composite type of Helm's Install type
@@ -61,11 +70,49 @@ type Install struct {
 
 	// Hypper specific:
 	NoSharedDeps      bool
-	OptionalDeps      optionalDepsStrategy
+	OptionalDeps      OptionalDepsStrategy
 	NoCreateNamespace bool
+	// ShowAlternatives is the number of alternative solutions to print
+	// instead of installing. Zero to install.
+	ShowAlternatives int
+	// DumpSolverProblem is the path of the file where to dump the solver
+	// problem, if set.
+	DumpSolverProblem string
+
+	// Review prints a summary of the solution before installing, and asks for
+	// confirmation. Optional shared dependencies can be toggled, solving again.
+	// Ignored on dry run.
+	Review bool
+	// Unattended doesn't ask anything: optional shared dependencies are
+	// installed unless declined before, as when reviewing, and the solution
+	// isn't reviewed.
+	Unattended bool
+
+	// PkgResultSet is the outcome of the solving of the last Run, nil if it
+	// didn't get to solve.
+	PkgResultSet *solver.PkgResultSet
 
 	// Config stores the actionconfig so it can be retrieved and used again
 	Config *Configuration
+
+	// policy is the policy enforced when building the package database, and
+	// policyDenials the reasons why packages were left out of it, by chart
+	// name and version.
+	policy        *policy.Policy
+	policyDenials map[string]map[string]string
+
+	// optionalDeps are the optional shared dependencies considered in the
+	// last solving, and optionalDepsChoices the ones toggled on review, by
+	// key, overriding the OptionalDeps strategy.
+	optionalDeps        []*optionalDep
+	optionalDepsChoices map[string]bool
+	// declinedChanges are the changes to the declined optional shared
+	// dependencies made by the last solving. They are recorded once the
+	// solution is installed.
+	declinedChanges []*declinedChange
+	// upgradedVersion is the version of the release of the wanted chart, when
+	// solving for its shared dependencies before upgrading it.
+	upgradedVersion string
 }
 
 // NewInstall creates a new Install object with the given configuration,
@@ -114,6 +161,101 @@ func (i *Install) Run(strategy solver.SolverStrategy,
 		return nil, err
 	}
 
+	if i.ShowAlternatives > 0 {
+		alternatives, err := i.ResolveAlternatives(strategy, wantedChrt, wantedChrtAbsPath, rels, settings, logger)
+		if err != nil {
+			return nil, err
+		}
+		printAlternatives(alternatives, settings, logger)
+		return make([]*release.Release, 0), nil
+	}
+
+	s, wantedPkgInDB, err := i.resolveReviewed(strategy, wantedChrt, wantedChrtAbsPath, rels,
+		bufio.NewReader(os.Stdin), settings, logger)
+	if s != nil {
+		i.PkgResultSet = &s.PkgResultSet
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.IsSAT() {
+		if len(s.PkgResultSet.ToInstall.Relations) != 0 && !(i.Review && !i.DryRun) {
+			logger.Info("The following charts are going to be installed:")
+			logger.Infof("%s\n", solver.PrintPkgTree(s.PkgResultSet.ToInstall))
+		}
+		if i.ChartPathOptions.Verify && !i.NoSharedDeps {
+			// verify everything before installing anything:
+			if err := i.VerifyPkgTree(s.PkgResultSet.ToInstall, wantedPkgInDB, settings, logger); err != nil {
+				return make([]*release.Release, 0), err
+			}
+		}
+		installedRels, err := i.postOrderInstall(s.PkgResultSet.ToInstall, wantedPkgInDB, wantedChrt, vals, settings, logger)
+		if err != nil {
+			return installedRels, err
+		}
+		return installedRels, i.recordDeclinedOptionalDeps(settings)
+	} else {
+		// UNSAT, error with inconsistencies
+		incons := ""
+		for _, incon := range s.PkgResultSet.Inconsistencies {
+			incons = incons + incon
+		}
+		return make([]*release.Release, 0), errors.New(incons)
+	}
+}
+
+// Resolve builds the database of packages out of the known repositories, the
+// passed releases and the wanted chart, and solves for installing the wanted
+// chart. It doesn't install anything.
+//
+// It returns the solver containing the outcome of the solving, and the wanted
+// package as present in the package database.
+func (i *Install) Resolve(strategy solver.SolverStrategy,
+	wantedChrt *helmChart.Chart, wantedChrtAbsPath string, rels []*release.Release,
+	settings *cli.EnvSettings, logger log.Logger) (*solver.Solver, *pkg.Pkg, error) {
+
+	s, wantedPkgInDB, err := i.buildSolver(strategy, wantedChrt, wantedChrtAbsPath, rels, settings, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := plugin.RunHooks(plugin.PreSolve, wantedPkgInDB, nil, settings, logger); err != nil {
+		return nil, nil, err
+	}
+	logjson.Event(logger, logjson.SolveStarted, pkgEventFields(wantedPkgInDB))
+	start := time.Now()
+	var dumpErr error
+	if i.DumpSolverProblem != "" {
+		// dumped before solving, to replay solvings that time out too:
+		s.OnProblemBuilt = func() {
+			dumpErr = dumpSolverProblem(s, wantedPkgInDB, i.DumpSolverProblem, logger)
+		}
+	}
+	s.Solve(wantedPkgInDB)
+	if dumpErr != nil {
+		return nil, nil, dumpErr
+	}
+	if !s.IsSAT() {
+		i.addPolicyInconsistencies(s, wantedPkgInDB)
+	}
+	logjson.Event(logger, logjson.SolveFinished, solveEventFields(s, start))
+	if err := plugin.RunHooks(plugin.PostSolve, s.PkgResultSet, nil, settings, logger); err != nil {
+		return nil, nil, err
+	}
+
+	return s, wantedPkgInDB, nil
+}
+
+// buildSolver creates a solver with the database of packages out of the known
+// repositories, the passed releases and the wanted chart, ready for solving.
+//
+// It returns the solver, and the wanted package as present in the package
+// database.
+func (i *Install) buildSolver(strategy solver.SolverStrategy,
+	wantedChrt *helmChart.Chart, wantedChrtAbsPath string, rels []*release.Release,
+	settings *cli.EnvSettings, logger log.Logger) (*solver.Solver, *pkg.Pkg, error) {
+
 	// honour settings.NamespaceFromFlag:
 	SetNamespace(i, wantedChrt, settings.Namespace(), settings.NamespaceFromFlag)
 
@@ -122,7 +264,7 @@ func (i *Install) Run(strategy solver.SolverStrategy,
 		var err error
 		i.ReleaseName, err = GetName(wantedChrt, i.NameTemplate)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
@@ -135,77 +277,51 @@ func (i *Install) Run(strategy solver.SolverStrategy,
 		i.ChartPathOptions.Version = version
 	} else {
 		pinnedVer = pkg.Present
+		if _, err := semver.StrictNewVersion(version); err != nil {
+			// pinned to a range, e.g: with --devel. Take the located chart,
+			// which is in range:
+			version = wantedChrt.Metadata.Version
+		}
 	}
 
 	wantedPkg := pkg.NewPkg(i.ReleaseName, wantedChrt.Metadata.Name, version, i.Namespace,
 		pkg.Unknown, pkg.Present, pinnedVer, i.ChartPathOptions.RepoURL, wantedChrtAbsPath)
+	wantedPkg.CRDOnly = chart.IsCRDOnly(wantedChrt)
 
 	// get all repo entries, continue if there's none:
 	rf, err := repo.LoadFile(settings.EnvSettings.RepositoryConfig)
 
 	if err != nil {
 		if !os.IsNotExist(errors.Cause(err)) {
-			return nil, err
+			return nil, nil, err
 		}
 		logger.Debug("No repository present, continuing…")
 	}
 
 	s := solver.New(strategy, logger)
+	s.Timeout = settings.SolverTimeout
+	s.Devel = i.Devel
+	if i.OptionalDeps == OptionalDepsBestEffort {
+		s.OptionalObjective = solver.OptionalMaximize
+	}
 
 	err = i.BuildWorld(s.PkgDB, rf.Repositories, rels, wantedPkg, wantedChrt, settings, logger)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	s.PkgDB.DebugPrintDB(logger)
 
 	// Promote optional deps to normal deps, depending on the strategy selected:
 	// TODO use wantedPkg instead of wantedPkgInDB once wantedPkg from local chart gets depRel correctly built
-	wantedPkgInDB := solver.PkgDBInstance.GetPackageByFingerprint(wantedPkg.GetFingerPrint())
-	switch i.OptionalDeps {
-	case OptionalDepsAll:
-		logger.Debugf("Promoting all optional deps of package %s to normal deps\n", wantedPkgInDB.GetFingerPrint())
-		// promote all optional deps of wanted package to normal deps:
-		wantedPkgInDB.DependsRel = append(wantedPkgInDB.DependsRel, wantedPkgInDB.DependsOptionalRel...)
-	case OptionalDepsNone:
-		logger.Debugf("Disregarding all optional deps of package %s\n", wantedPkgInDB.GetFingerPrint())
-	case OptionalDepsAsk:
-		logger.Debugf("Asking for each optional deps of package %s if they should be promoted\n", wantedPkgInDB.GetFingerPrint())
-		for _, rel := range wantedPkgInDB.DependsOptionalRel {
-			reader := bufio.NewReader(os.Stdin)
-			question := eyecandy.ESPrintf(settings.NoEmojis,
-				":red_question_mark:Install optional shared dependency \"%s\" of chart \"%s\"?",
-				rel.ReleaseName,
-				wantedPkgInDB.ChartName,
-			)
-			if promptBool(question, reader, logger) {
-				wantedPkgInDB.DependsRel = append(wantedPkgInDB.DependsRel, rel)
-			}
-		}
+	wantedPkgInDB := s.PkgDB.GetPackageByFingerprint(wantedPkg.GetFingerPrint())
+	if err := i.promoteOptionalDeps(s.PkgDB, wantedPkgInDB, bufio.NewReader(os.Stdin), settings, logger); err != nil {
+		return nil, nil, err
 	}
 
 	// s.PkgDB.DebugPrintDB(logger)
 
-	s.Solve(wantedPkgInDB)
-
-	if s.IsSAT() {
-		if len(s.PkgResultSet.ToInstall.Relations) != 0 {
-			logger.Info("The following charts are going to be installed:")
-			logger.Infof("%s\n", solver.PrintPkgTree(s.PkgResultSet.ToInstall))
-		}
-		installedRels, err := i.postOrderInstall(s.PkgResultSet.ToInstall, wantedPkgInDB, wantedChrt, vals, settings, logger)
-		if err != nil {
-			return installedRels, err
-		}
-		return installedRels, nil
-	} else {
-		// UNSAT, error with inconsistencies
-		incons := ""
-		for _, incon := range s.PkgResultSet.Inconsistencies {
-			incons = incons + incon
-		}
-		return make([]*release.Release, 0), errors.New(incons)
-	}
+	return s, wantedPkgInDB, nil
 }
 
 // postOrderInstall traverses the dependency tree in post-order, and calls for
@@ -231,6 +347,7 @@ func (i *Install) postOrderInstall(tr *solver.PkgTree,
 		// skip if node is a dependency and not wantedPkg:
 		logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":next_track_button: Skipping dependency \"%s\", flag `no-shared-deps` has been set",
 			tr.Node.ChartName))
+		logjson.Event(logger, logjson.InstallSkipped, pkgEventFields(tr.Node))
 	} else {
 		rel, err := i.InstallPkg(tr.Node, wantedPkg, wantedChrt, vals, 0, settings, logger)
 		if err != nil {
@@ -304,7 +421,12 @@ func (i *Install) LoadChart(chartName, parentChartPath, repo, version string,
 		if err != nil {
 			return nil, err
 		}
-		chartRequested, err := loader.LoadDir(localPath)
+		if isLocalRepo(localPath) {
+			// path is a chart repository (e.g: an extracted bundle), not a chart
+			return loadChartFromLocalRepo(localPath, chartName, version)
+		}
+		// either a chart directory or a chart archive:
+		chartRequested, err := loader.Load(localPath)
 		if err != nil {
 			return nil, err
 		}
@@ -328,7 +450,7 @@ func (i *Install) LoadChart(chartName, parentChartPath, repo, version string,
 
 	i.ChartPathOptions.RepoURL = repo
 	i.ChartPathOptions.Version = version
-	cp, err := i.ChartPathOptions.LocateChart(chartName, settings.EnvSettings)
+	cp, err := LocateChart(&i.ChartPathOptions, chartName, settings, logger)
 	if err != nil {
 		return nil, err
 	}
@@ -435,16 +557,79 @@ func (i *Install) InstallPkg(p *pkg.Pkg, wantedPkg *pkg.Pkg, wantedChart *helmCh
 	logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":cruise_ship: %sInstalling chart \"%s\" as \"%s\" in namespace \"%s\"…",
 		strings.Repeat("  ", lvl), chartRequested.Name(), clientInstall.ReleaseName, clientInstall.Namespace))
 
+	hookEnv := map[string]string{
+		"HYPPER_RELEASE_NAME":      clientInstall.ReleaseName,
+		"HYPPER_RELEASE_NAMESPACE": clientInstall.Namespace,
+		"HYPPER_CHART_NAME":        chartRequested.Name(),
+		"HYPPER_CHART_VERSION":     chartRequested.Metadata.Version,
+		"HYPPER_DRY_RUN":           fmt.Sprint(clientInstall.DryRun),
+	}
+	if err := plugin.RunHooks(plugin.PreInstallPackage, p, hookEnv, settings, logger); err != nil {
+		return nil, err
+	}
+
+	eventFields := func() log.Fields {
+		return log.Fields{
+			"release":   clientInstall.ReleaseName,
+			"namespace": clientInstall.Namespace,
+			"chart":     chartRequested.Name(),
+			"version":   chartRequested.Metadata.Version,
+			"dryRun":    clientInstall.DryRun,
+		}
+	}
+	logjson.Event(logger, logjson.InstallStarted, eventFields())
+	start := time.Now()
+
 	// perform install:
 	helmInstall := clientInstall.Install
 	i.Config.SetNamespace(clientInstall.Namespace)
 	rel, err := helmInstall.Run(chartRequested, vals) // wrap Helm's i.Run for now
 	if err != nil {
+		fields := eventFields()
+		fields["duration"] = time.Since(start).Seconds()
+		fields["error"] = err.Error()
+		logjson.Event(logger, logjson.InstallFailed, fields)
+		return rel, err
+	}
+	fields := eventFields()
+	fields["duration"] = time.Since(start).Seconds()
+	fields["revision"] = rel.Version
+	fields["status"] = rel.Info.Status.String()
+	logjson.Event(logger, logjson.InstallFinished, fields)
+
+	if err := plugin.RunHooks(plugin.PostInstallPackage, p, hookEnv, settings, logger); err != nil {
 		return rel, err
 	}
 	return rel, nil
 }
 
+// pkgEventFields returns the fields describing p in structured events.
+func pkgEventFields(p *pkg.Pkg) log.Fields {
+	if p == nil {
+		return log.Fields{}
+	}
+	return log.Fields{
+		"release":   p.ReleaseName,
+		"namespace": p.Namespace,
+		"chart":     p.ChartName,
+		"version":   p.Version,
+	}
+}
+
+// solveEventFields returns the fields describing the outcome of s, solved
+// since start, in structured events.
+func solveEventFields(s *solver.Solver, start time.Time) log.Fields {
+	fields := log.Fields{
+		// "sat", "unsat", or "unknown" if the solver timed out:
+		"result":   strings.ToLower(s.PkgResultSet.Status),
+		"duration": time.Since(start).Seconds(),
+	}
+	if !s.IsSAT() {
+		fields["inconsistencies"] = s.PkgResultSet.Inconsistencies
+	}
+	return fields
+}
+
 func promptBool(question string, reader *bufio.Reader, logger log.Logger) bool {
 	for {
 		log.Infof("%s [Y/n]:", question)
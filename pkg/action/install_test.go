@@ -57,12 +57,13 @@ func TestInstallRun(t *testing.T) {
 		wantDebug             bool
 		debug                 string
 		addRelStub            bool
-		optionalDeps          optionalDepsStrategy
+		optionalDeps          OptionalDepsStrategy
 		wantNSFromFlag        string
 		numReturnedRels       int
 		wantDryRun            bool
 		skipActionReleaseName bool
 		NoRepo                bool
+		policy                string
 	}{
 		{
 			name:            "non existent cache and repo.yaml, chart with no deps",
@@ -119,6 +120,15 @@ func TestInstallRun(t *testing.T) {
 			golden:          "output/install-correctly-shared-deps-repo-file.txt",
 			numReturnedRels: 2,
 		},
+		{
+			name:      "dependencies with repo file:// denied by policy",
+			chart:     buildChart(withHypperAnnotations(), withSharedDepsFileRepo()),
+			policy:    "testdata/policy-deny-shared-dep.yaml",
+			wantError: true,
+			error: "Chart \"hello\" depends on \"my-shared-dep\" in namespace \"my-shared-dep-ns\", semver \"0.1.0\", but nothing satisfies it" +
+				"Chart \"shared-dep-empty\" version \"0.1.0\" is denied by policy: chart is denied",
+			numReturnedRels: 0,
+		},
 		{
 			name:            "looped dependencies with repo file:// correctly installed",
 			chart:           buildChart(withHypperAnnotations(), withSharedDepsLoopedFileRepo()),
@@ -180,6 +190,10 @@ func TestInstallRun(t *testing.T) {
 				settings.RepositoryConfig = "testdata/hypperhome/hypper/repositories.yaml"
 			}
 			settings.Debug = tcase.wantDebug
+			settings.PolicyFile = "testdata/non-existent-policy.yaml"
+			if tcase.policy != "" {
+				settings.PolicyFile = tcase.policy
+			}
 
 			// create our own Logger that satisfies impl/cli.Logger, but with a buffer for tests
 			buf := new(bytes.Buffer)
@@ -443,3 +457,26 @@ func TestPromptBool(t *testing.T) {
 		is.Equal(tcase.doInstall, promptBool(question, reader, logger))
 	}
 }
+
+func TestSolveEventFields(t *testing.T) {
+	for _, tcase := range []struct {
+		status     string
+		wantResult string
+		wantIncons bool
+	}{
+		{status: "SAT", wantResult: "sat"},
+		{status: "UNSAT", wantResult: "unsat", wantIncons: true},
+		{status: "UNKNOWN", wantResult: "unknown", wantIncons: true},
+	} {
+		t.Run(tcase.status, func(t *testing.T) {
+			is := assert.New(t)
+
+			s := solver.New(solver.InstallOne, logcli.NewStandard())
+			s.PkgResultSet.Status = tcase.status
+			fields := solveEventFields(s, time.Now().Time)
+			is.Equal(tcase.wantResult, fields["result"])
+			_, ok := fields["inconsistencies"]
+			is.Equal(tcase.wantIncons, ok)
+		})
+	}
+}
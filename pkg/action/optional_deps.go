@@ -0,0 +1,343 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bufio"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	"github.com/gofrs/flock"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+)
+
+// DeclinedOptionalDep is an optional shared dependency that the user declined
+// to install for a release, on the cluster of a kube context.
+type DeclinedOptionalDep struct {
+	KubeContext string `json:"kubeContext,omitempty"`
+	Release     string `json:"release"`
+	Namespace   string `json:"namespace"`
+	Dependency  string `json:"dependency"`
+}
+
+// DeclinedOptionalDeps records the optional shared dependencies that the user
+// declined when asked, so they aren't asked about again.
+type DeclinedOptionalDeps struct {
+	Declined []*DeclinedOptionalDep `json:"declined"`
+}
+
+// LoadDeclinedOptionalDeps loads the declined optional dependencies from path.
+// If the file doesn't exist, nothing has been declined.
+func LoadDeclinedOptionalDeps(path string) (*DeclinedOptionalDeps, error) {
+	d := &DeclinedOptionalDeps{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return d, nil
+		}
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(b, d); err != nil {
+		return nil, errors.Wrapf(err, "failed to load declined optional dependencies from %s", path)
+	}
+	return d, nil
+}
+
+// WriteFile writes the declined optional dependencies to path.
+func (d *DeclinedOptionalDeps) WriteFile(path string, perm os.FileMode) error {
+	b, err := yaml.Marshal(d)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, perm)
+}
+
+// UpdateDeclinedOptionalDeps loads the declined optional dependencies from
+// path, changes them with update, and writes them back, holding a lock on the
+// file meanwhile. Concurrent updates, e.g: when installing on several clusters
+// at once, are applied one after another, so none gets lost.
+func UpdateDeclinedOptionalDeps(path string, update func(*DeclinedOptionalDeps)) error {
+	// Ensure the file directory exists as it is required for file locking
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	fileLock := flock.New(strings.TrimSuffix(path, filepath.Ext(path)) + ".lock")
+	lockCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	locked, err := fileLock.TryLockContext(lockCtx, 100*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	if locked {
+		defer func() {
+			_ = fileLock.Unlock()
+		}()
+	}
+
+	d, err := LoadDeclinedOptionalDeps(path)
+	if err != nil {
+		return err
+	}
+	update(d)
+	return d.WriteFile(path, 0644)
+}
+
+// Has returns true if dependency has been declined for the release relName in
+// namespace ns, on the cluster of kubeContext.
+func (d *DeclinedOptionalDeps) Has(kubeContext, relName, ns, dependency string) bool {
+	for _, decl := range d.Declined {
+		if decl.matches(kubeContext, relName, ns, dependency) {
+			return true
+		}
+	}
+	return false
+}
+
+// Add records dependency as declined for the release relName in namespace ns,
+// on the cluster of kubeContext.
+func (d *DeclinedOptionalDeps) Add(kubeContext, relName, ns, dependency string) {
+	if d.Has(kubeContext, relName, ns, dependency) {
+		return
+	}
+	d.Declined = append(d.Declined, &DeclinedOptionalDep{
+		KubeContext: kubeContext,
+		Release:     relName,
+		Namespace:   ns,
+		Dependency:  dependency,
+	})
+}
+
+// Remove forgets that dependency was declined for the release relName in
+// namespace ns, on the cluster of kubeContext. It returns true if it was
+// declined.
+func (d *DeclinedOptionalDeps) Remove(kubeContext, relName, ns, dependency string) bool {
+	for idx, decl := range d.Declined {
+		if decl.matches(kubeContext, relName, ns, dependency) {
+			d.Declined = append(d.Declined[:idx], d.Declined[idx+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// matches returns true if decl is of dependency for the release relName in
+// namespace ns, on the cluster of kubeContext.
+func (decl *DeclinedOptionalDep) matches(kubeContext, relName, ns, dependency string) bool {
+	return decl.KubeContext == kubeContext && decl.Release == relName &&
+		decl.Namespace == ns && decl.Dependency == dependency
+}
+
+// promoteOptionalDeps promotes optional dependencies to normal dependencies
+// following the i.OptionalDeps strategy, for wantedPkg and transitively for
+// all the packages that may get installed as its dependencies. Packages
+// already present are left as they are.
+//
+// When best-effort, nothing is promoted, and optional dependencies are left to
+// the objective of the solver instead.
+//
+// When asking, optional dependencies that are already present are promoted
+// without asking, and those that were declined before are skipped. The answer
+// for an optional dependency of a release applies to all its versions. New
+// declines are kept in i.declinedChanges, to be recorded with
+// recordDeclinedOptionalDeps once installed. With Review or Unattended set,
+// nothing is asked: they are promoted, to be toggled on review instead.
+//
+// Optional dependencies toggled on review override the strategy, and are
+// recorded as declined or not the same way. The optional dependencies
+// considered are kept in i.optionalDeps, for the review.
+func (i *Install) promoteOptionalDeps(pkgdb *solver.PkgDB, wantedPkg *pkg.Pkg,
+	reader *bufio.Reader, settings *cli.EnvSettings, logger log.Logger) error {
+
+	if i.OptionalDeps == OptionalDepsBestEffort {
+		logger.Debugf("Leaving optional deps of package %s to the solver\n", wantedPkg.GetFingerPrint())
+		return nil
+	}
+
+	declined, err := LoadDeclinedOptionalDeps(settings.DeclinedOptionalDepsFile)
+	if err != nil {
+		return err
+	}
+	// declines are remembered by cluster:
+	kubeContext := settings.CurrentKubeContext()
+	i.optionalDeps = nil
+	i.declinedChanges = nil
+	setDeclined := func(p *pkg.Pkg, rel *pkg.PkgRel, decline bool) {
+		if declined.Has(kubeContext, p.ReleaseName, p.Namespace, rel.ChartName) == decline {
+			return
+		}
+		if decline {
+			declined.Add(kubeContext, p.ReleaseName, p.Namespace, rel.ChartName)
+		} else {
+			declined.Remove(kubeContext, p.ReleaseName, p.Namespace, rel.ChartName)
+		}
+		i.declinedChanges = append(i.declinedChanges, &declinedChange{
+			dep: DeclinedOptionalDep{
+				KubeContext: kubeContext,
+				Release:     p.ReleaseName,
+				Namespace:   p.Namespace,
+				Dependency:  rel.ChartName,
+			},
+			declined: decline,
+		})
+	}
+
+	// answers by base fingerprint of the dependent and chart name of the dep
+	answers := map[string]bool{}
+	visited := map[string]bool{wantedPkg.GetFingerPrint(): true}
+	toVisit := []*pkg.Pkg{wantedPkg}
+	for len(toVisit) > 0 {
+		p := toVisit[0]
+		toVisit = toVisit[1:]
+
+		switch i.OptionalDeps {
+		case OptionalDepsAll:
+			logger.Debugf("Promoting all optional deps of package %s to normal deps\n", p.GetFingerPrint())
+		case OptionalDepsNone:
+			logger.Debugf("Disregarding all optional deps of package %s\n", p.GetFingerPrint())
+		case OptionalDepsAsk:
+			logger.Debugf("Asking for each optional deps of package %s if they should be promoted\n", p.GetFingerPrint())
+		}
+		for _, rel := range p.DependsOptionalRel {
+			key := p.GetBaseFingerPrint() + "/" + rel.ChartName
+			promote, answered := answers[key]
+			choice, chosen := i.optionalDepsChoices[key]
+			if !answered && chosen && !isRelPresent(pkgdb, rel) {
+				promote = choice
+				setDeclined(p, rel, !choice)
+				answers[key] = promote
+			} else if !answered {
+				switch i.OptionalDeps {
+				case OptionalDepsAll:
+					promote = true
+					setDeclined(p, rel, false)
+				case OptionalDepsNone:
+					promote = false
+				case OptionalDepsAsk:
+					switch {
+					case isRelPresent(pkgdb, rel):
+						promote = true
+					case declined.Has(kubeContext, p.ReleaseName, p.Namespace, rel.ChartName):
+						logger.Infof(eyecandy.ESPrintf(settings.NoEmojis,
+							":next_track_button: Skipping optional shared dependency \"%s\" of chart \"%s\", declined before",
+							rel.ReleaseName, p.ChartName))
+						promote = false
+					case i.Review || i.Unattended:
+						// asked on review instead, or not at all:
+						promote = true
+					default:
+						question := eyecandy.ESPrintf(settings.NoEmojis,
+							":red_question_mark:Install optional shared dependency \"%s\" of chart \"%s\"?",
+							rel.ReleaseName,
+							p.ChartName,
+						)
+						promote = promptBool(question, reader, logger)
+						if !promote {
+							setDeclined(p, rel, true)
+						}
+					}
+				}
+				answers[key] = promote
+			}
+			if !answered && !isRelPresent(pkgdb, rel) {
+				i.optionalDeps = append(i.optionalDeps, &optionalDep{
+					key:       key,
+					dependent: p,
+					rel:       rel,
+					promoted:  promote,
+				})
+			}
+			if promote {
+				p.DependsRel = append(p.DependsRel, rel)
+			}
+		}
+
+		// visit the packages that may get installed as dependencies of p:
+		for _, rel := range p.DependsRel {
+			bfp := pkg.CreateBaseFingerPrint(rel.ReleaseName, rel.Namespace, rel.ChartName)
+			fps := []string{}
+			for _, fp := range pkgdb.GetMapOfVersionsByBaseFingerPrint(bfp) {
+				fps = append(fps, fp)
+			}
+			sort.Strings(fps)
+			for _, fp := range fps {
+				dep := pkgdb.GetPackageByFingerprint(fp)
+				if visited[fp] || dep.CurrentState == pkg.Present {
+					continue
+				}
+				visited[fp] = true
+				toVisit = append(toVisit, dep)
+			}
+		}
+	}
+	return nil
+}
+
+// declinedChange is a dependency declined, or no longer declined, when
+// promoting optional dependencies.
+type declinedChange struct {
+	dep      DeclinedOptionalDep
+	declined bool
+}
+
+// recordDeclinedOptionalDeps records the changes to the declined optional
+// dependencies made when promoting them in settings.DeclinedOptionalDepsFile,
+// unless on dry run. It is called once the solution has been installed.
+func (i *Install) recordDeclinedOptionalDeps(settings *cli.EnvSettings) error {
+	if len(i.declinedChanges) == 0 || i.DryRun {
+		return nil
+	}
+	err := UpdateDeclinedOptionalDeps(settings.DeclinedOptionalDepsFile, func(d *DeclinedOptionalDeps) {
+		for _, c := range i.declinedChanges {
+			if c.declined {
+				d.Add(c.dep.KubeContext, c.dep.Release, c.dep.Namespace, c.dep.Dependency)
+			} else {
+				d.Remove(c.dep.KubeContext, c.dep.Release, c.dep.Namespace, c.dep.Dependency)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	i.declinedChanges = nil
+	return nil
+}
+
+// isRelPresent returns true if any version of the package of rel is present.
+func isRelPresent(pkgdb *solver.PkgDB, rel *pkg.PkgRel) bool {
+	bfp := pkg.CreateBaseFingerPrint(rel.ReleaseName, rel.Namespace, rel.ChartName)
+	for _, fp := range pkgdb.GetMapOfVersionsByBaseFingerPrint(bfp) {
+		if pkgdb.GetPackageByFingerprint(fp).CurrentState == pkg.Present {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,280 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeclinedOptionalDeps(t *testing.T) {
+	is := assert.New(t)
+	path := filepath.Join(ensure.TempDir(t), "data", "declined-optional-deps.yaml")
+
+	declined, err := LoadDeclinedOptionalDeps(path)
+	is.NoError(err)
+	is.Empty(declined.Declined)
+
+	declined.Add("my-cluster", "app", "app-ns", "tracing")
+	declined.Add("my-cluster", "app", "app-ns", "tracing")
+	declined.Add("my-cluster", "app", "app-ns", "metrics")
+	declined.Add("other-cluster", "app", "app-ns", "metrics")
+	is.True(declined.Has("my-cluster", "app", "app-ns", "tracing"))
+	is.False(declined.Has("my-cluster", "app", "other-ns", "tracing"))
+	is.False(declined.Has("other-cluster", "app", "app-ns", "tracing"))
+	is.NoError(declined.WriteFile(path, 0644))
+
+	declined, err = LoadDeclinedOptionalDeps(path)
+	is.NoError(err)
+	is.Equal(3, len(declined.Declined))
+	is.True(declined.Remove("my-cluster", "app", "app-ns", "tracing"))
+	is.False(declined.Remove("my-cluster", "app", "app-ns", "tracing"))
+	is.False(declined.Has("my-cluster", "app", "app-ns", "tracing"))
+	is.True(declined.Remove("my-cluster", "app", "app-ns", "metrics"))
+	is.True(declined.Has("other-cluster", "app", "app-ns", "metrics"))
+
+	_, err = LoadDeclinedOptionalDeps("testdata/policy-deny-shared-dep.yaml")
+	is.Error(err)
+}
+
+func TestUpdateDeclinedOptionalDepsConcurrently(t *testing.T) {
+	is := assert.New(t)
+	path := filepath.Join(ensure.TempDir(t), "declined-optional-deps.yaml")
+
+	// as when installing on several clusters at once:
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for idx := range errs {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			errs[idx] = UpdateDeclinedOptionalDeps(path, func(d *DeclinedOptionalDeps) {
+				// widen the window between loading and writing:
+				time.Sleep(10 * time.Millisecond)
+				d.Add(fmt.Sprintf("cluster-%d", idx), "app", "app-ns", "tracing")
+			})
+		}(idx)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		is.NoError(err)
+	}
+
+	declined, err := LoadDeclinedOptionalDeps(path)
+	is.NoError(err)
+	is.Len(declined.Declined, len(errs))
+}
+
+// optionalDepsDB returns a database where the wanted package "app" has the
+// optional deps "tracing", not present, and "metrics", present. "tracing"
+// has the optional dep "storage" in turn.
+func optionalDepsDB(t *testing.T) (*solver.PkgDB, *pkg.Pkg) {
+	logger := logcli.NewStandard()
+	s := solver.New(solver.InstallOne, logger)
+
+	app := pkg.NewPkg("app", "app", "1.0.0", "app-ns",
+		pkg.Unknown, pkg.Present, pkg.Unknown, "", "")
+	app.DependsOptionalRel = []*pkg.PkgRel{
+		{ReleaseName: "tracing", Namespace: "tracing-ns", SemverRange: "^1.0.0", ChartName: "tracing"},
+		{ReleaseName: "metrics", Namespace: "metrics-ns", SemverRange: "^1.0.0", ChartName: "metrics"},
+	}
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		tracing := pkg.NewPkg("tracing", "tracing", v, "tracing-ns",
+			pkg.Unknown, pkg.Unknown, pkg.Unknown, "", "")
+		tracing.DependsOptionalRel = []*pkg.PkgRel{
+			{ReleaseName: "storage", Namespace: "storage-ns", SemverRange: "^1.0.0", ChartName: "storage"},
+		}
+		s.PkgDB.Add(tracing)
+	}
+	s.PkgDB.Add(pkg.NewPkg("metrics", "metrics", "1.0.0", "metrics-ns",
+		pkg.Present, pkg.Unknown, pkg.Unknown, "", ""))
+	s.PkgDB.Add(pkg.NewPkg("storage", "storage", "1.0.0", "storage-ns",
+		pkg.Unknown, pkg.Unknown, pkg.Unknown, "", ""))
+	s.PkgDB.Add(app)
+
+	return s.PkgDB, s.PkgDB.GetPackageByFingerprint(app.GetFingerPrint())
+}
+
+func TestPromoteOptionalDeps(t *testing.T) {
+	tracingFPs := []string{
+		pkg.CreateFingerPrint("tracing", "1.0.0", "tracing-ns", "tracing"),
+		pkg.CreateFingerPrint("tracing", "1.1.0", "tracing-ns", "tracing"),
+	}
+
+	for _, tcase := range []struct {
+		name             string
+		strategy         OptionalDepsStrategy
+		declined         []*DeclinedOptionalDep
+		input            string
+		dryRun           bool
+		unattended       bool
+		appDeps          []string
+		tracingDeps      []string
+		questions        int
+		expectedDeclined []*DeclinedOptionalDep
+	}{
+		{
+			name:        "all, transitively",
+			strategy:    OptionalDepsAll,
+			declined:    []*DeclinedOptionalDep{{KubeContext: "my-cluster", Release: "app", Namespace: "app-ns", Dependency: "tracing"}},
+			appDeps:     []string{"tracing", "metrics"},
+			tracingDeps: []string{"storage"},
+			// installing it forgets that it was declined:
+			expectedDeclined: []*DeclinedOptionalDep{},
+		},
+		{
+			name:        "none",
+			strategy:    OptionalDepsNone,
+			appDeps:     []string{},
+			tracingDeps: []string{},
+		},
+		{
+			name:        "ask, transitively and once for all versions",
+			strategy:    OptionalDepsAsk,
+			input:       "y\nn\n",
+			appDeps:     []string{"tracing", "metrics"},
+			tracingDeps: []string{},
+			questions:   2,
+			expectedDeclined: []*DeclinedOptionalDep{
+				{KubeContext: "my-cluster", Release: "tracing", Namespace: "tracing-ns", Dependency: "storage"},
+			},
+		},
+		{
+			name:        "ask, declined deps of dependencies not visited",
+			strategy:    OptionalDepsAsk,
+			input:       "n\n",
+			appDeps:     []string{"metrics"},
+			tracingDeps: []string{},
+			questions:   1,
+			expectedDeclined: []*DeclinedOptionalDep{
+				{KubeContext: "my-cluster", Release: "app", Namespace: "app-ns", Dependency: "tracing"},
+			},
+		},
+		{
+			name:        "ask, declined before",
+			strategy:    OptionalDepsAsk,
+			declined:    []*DeclinedOptionalDep{{KubeContext: "my-cluster", Release: "app", Namespace: "app-ns", Dependency: "tracing"}},
+			appDeps:     []string{"metrics"},
+			tracingDeps: []string{},
+			expectedDeclined: []*DeclinedOptionalDep{
+				{KubeContext: "my-cluster", Release: "app", Namespace: "app-ns", Dependency: "tracing"},
+			},
+		},
+		{
+			name:        "ask, unattended installs those not declined before",
+			strategy:    OptionalDepsAsk,
+			unattended:  true,
+			declined:    []*DeclinedOptionalDep{{KubeContext: "my-cluster", Release: "tracing", Namespace: "tracing-ns", Dependency: "storage"}},
+			appDeps:     []string{"tracing", "metrics"},
+			tracingDeps: []string{},
+			expectedDeclined: []*DeclinedOptionalDep{
+				{KubeContext: "my-cluster", Release: "tracing", Namespace: "tracing-ns", Dependency: "storage"},
+			},
+		},
+		{
+			name:        "ask, declined on another cluster",
+			strategy:    OptionalDepsAsk,
+			declined:    []*DeclinedOptionalDep{{KubeContext: "other-cluster", Release: "app", Namespace: "app-ns", Dependency: "tracing"}},
+			input:       "y\nn\n",
+			appDeps:     []string{"tracing", "metrics"},
+			tracingDeps: []string{},
+			questions:   2,
+			expectedDeclined: []*DeclinedOptionalDep{
+				{KubeContext: "other-cluster", Release: "app", Namespace: "app-ns", Dependency: "tracing"},
+				{KubeContext: "my-cluster", Release: "tracing", Namespace: "tracing-ns", Dependency: "storage"},
+			},
+		},
+		{
+			name:        "ask, on dry-run declines aren't recorded",
+			strategy:    OptionalDepsAsk,
+			input:       "n\n",
+			dryRun:      true,
+			appDeps:     []string{"metrics"},
+			tracingDeps: []string{},
+			questions:   1,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			settings := cli.New()
+			settings.KubeContext = "my-cluster"
+			settings.DeclinedOptionalDepsFile = filepath.Join(ensure.TempDir(t), "declined-optional-deps.yaml")
+			if tcase.declined != nil {
+				d := &DeclinedOptionalDeps{Declined: tcase.declined}
+				if err := d.WriteFile(settings.DeclinedOptionalDepsFile, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			buf := new(bytes.Buffer)
+			logger := logcli.NewStandard()
+			logger.InfoOut = buf
+			log.Current = logger
+
+			pkgdb, app := optionalDepsDB(t)
+			instAction := installAction(t)
+			instAction.OptionalDeps = tcase.strategy
+			instAction.DryRun = tcase.dryRun
+			instAction.Unattended = tcase.unattended
+
+			reader := bufio.NewReader(strings.NewReader(tcase.input))
+			is.NoError(instAction.promoteOptionalDeps(pkgdb, app, reader, settings, logger))
+
+			depNames := func(p *pkg.Pkg) []string {
+				names := []string{}
+				for _, rel := range p.DependsRel {
+					names = append(names, rel.ChartName)
+				}
+				return names
+			}
+			is.Equal(tcase.appDeps, depNames(app))
+			for _, fp := range tracingFPs {
+				is.Equal(tcase.tracingDeps, depNames(pkgdb.GetPackageByFingerprint(fp)))
+			}
+			is.Equal(tcase.questions, strings.Count(buf.String(), "Install optional shared dependency"))
+
+			// nothing is recorded until installed:
+			declined, err := LoadDeclinedOptionalDeps(settings.DeclinedOptionalDepsFile)
+			is.NoError(err)
+			is.Equal(tcase.declined, declined.Declined)
+
+			is.NoError(instAction.recordDeclinedOptionalDeps(settings))
+			declined, err = LoadDeclinedOptionalDeps(settings.DeclinedOptionalDepsFile)
+			is.NoError(err)
+			if tcase.expectedDeclined == nil {
+				is.Empty(declined.Declined)
+			} else {
+				is.ElementsMatch(tcase.expectedDeclined, declined.Declined)
+			}
+		})
+	}
+}
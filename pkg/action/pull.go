@@ -15,7 +15,18 @@ limitations under the License.
 
 package action
 
-import "helm.sh/helm/v3/pkg/action"
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/chartutil"
+)
 
 type PullOpt func(*Pull)
 
@@ -34,3 +45,47 @@ func NewPull(cfg *Configuration) *Pull {
 		cfg,
 	}
 }
+
+// Run executes 'hypper pull' against the given chart reference.
+//
+// Charts from the configured repositories are obtained through the local chart
+// cache. Charts that can't be cached, or that need their provenance file, are
+// pulled as Helm does.
+func (p *Pull) Run(chartRef string, settings *cli.EnvSettings, logger log.Logger) (string, error) {
+	if p.Verify || p.VerifyLater {
+		return p.Pull.Run(chartRef)
+	}
+	cv, _ := findChartVersionInIndex(&p.ChartPathOptions, chartRef, settings)
+	if cv == nil {
+		return p.Pull.Run(chartRef)
+	}
+
+	saved, err := LocateChart(&p.ChartPathOptions, chartRef, settings, logger)
+	if err != nil {
+		return "", err
+	}
+
+	if !p.Untar {
+		return "", copyFile(saved, filepath.Join(p.DestDir, filepath.Base(saved)))
+	}
+
+	// same semantics as Helm's untar:
+	ud := p.UntarDir
+	if !filepath.IsAbs(ud) {
+		ud = filepath.Join(p.DestDir, ud)
+	}
+	udCheck := ud
+	if udCheck == "." {
+		_, udCheck = filepath.Split(chartRef)
+	} else {
+		_, chartName := filepath.Split(chartRef)
+		udCheck = filepath.Join(udCheck, chartName)
+	}
+	if _, err := os.Stat(udCheck); err == nil {
+		return "", errors.Errorf("failed to untar: a file or directory with the name %s already exists", udCheck)
+	}
+	if err := os.MkdirAll(udCheck, 0755); err != nil {
+		return "", errors.Wrap(err, "failed to untar (mkdir)")
+	}
+	return "", chartutil.ExpandFile(ud, saved)
+}
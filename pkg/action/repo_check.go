@@ -0,0 +1,195 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/policy"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+
+	"helm.sh/helm/v3/pkg/action"
+	"helm.sh/helm/v3/pkg/helmpath"
+)
+
+// RepoCheck is the action for checking the installability of the charts of a
+// repository, in the spirit of Debian's debcheck.
+//
+// It provides the implementation of 'hypper repo check'.
+type RepoCheck struct {
+	// install is only used for building the package database, it never
+	// installs anything.
+	install *Install
+}
+
+// The results of checking a chart version that isn't known to be installable.
+const (
+	// RepoCheckUninstallable is for chart versions that can't be installed.
+	RepoCheckUninstallable = "uninstallable"
+	// RepoCheckUndetermined is for chart versions for which the solver timed
+	// out, before knowing whether they can be installed.
+	RepoCheckUndetermined = "undetermined (solver timeout)"
+)
+
+// RepoCheckResult describes a chart version that is not installable, or that
+// may not be.
+type RepoCheckResult struct {
+	Chart           string   `json:"chart"`
+	Version         string   `json:"version"`
+	Result          string   `json:"result"`
+	Inconsistencies []string `json:"inconsistencies"`
+}
+
+// NewRepoCheck creates a new RepoCheck object.
+func NewRepoCheck() *RepoCheck {
+	return &RepoCheck{
+		install: NewInstall(&Configuration{
+			Configuration: new(action.Configuration),
+		}),
+	}
+}
+
+// Run executes 'hypper repo check'.
+//
+// For every chart version in the index of the repository named repoName, it
+// builds the world out of the configured repositories only (releases are not
+// taken into account), and solves for installing that chart version.
+// It returns the chart versions whose shared dependencies can never be
+// satisfied, and those for which the solver timed out.
+func (r *RepoCheck) Run(repoName string, settings *cli.EnvSettings, logger log.Logger) ([]*RepoCheckResult, error) {
+
+	rf, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		return nil, err
+	}
+	if !rf.Has(repoName) {
+		return nil, errors.Errorf("no repo named %q found", repoName)
+	}
+	checkedRepo := rf.Get(repoName)
+
+	idxFilepath := filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(repoName))
+	index, err := repo.LoadIndexFile(idxFilepath)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load index of repo %q, try 'hypper repo update'", repoName)
+	}
+
+	// load the entries of all repos only once, they are shared by all the
+	// worlds that we build:
+	repoEntries, err := loadRepoEntries(rf.Repositories, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	// load the policy only once too:
+	if r.install.policy, err = policy.Load(settings.PolicyFile); err != nil {
+		return nil, err
+	}
+
+	// save ns from kube client, for performance reasons
+	settingsNS := settings.Namespace()
+
+	// iterate the charts in order, to have a reproducible report:
+	chrtNames := make([]string, 0, len(index.Entries))
+	for chrtName := range index.Entries {
+		chrtNames = append(chrtNames, chrtName)
+	}
+	sort.Strings(chrtNames)
+
+	results := []*RepoCheckResult{}
+	for _, chrtName := range chrtNames {
+		for _, chrtVer := range index.Entries[chrtName] {
+			logger.Debugf("Checking chart %q version %q\n", chrtName, chrtVer.Version)
+
+			if reason := r.install.policy.Check(checkedRepo.URL, chrtName, chrtVer.Version, chrtVer.Annotations); reason != "" {
+				results = append(results, &RepoCheckResult{
+					Chart:           chrtName,
+					Version:         chrtVer.Version,
+					Result:          RepoCheckUninstallable,
+					Inconsistencies: []string{reason},
+				})
+				continue
+			}
+
+			ns := GetNamespaceFromAnnot(chrtVer.Annotations, settingsNS)
+			relName := GetNameFromAnnot(chrtVer.Annotations, chrtVer.Name)
+			// we want exactly this version installed:
+			wantedPkg := pkg.NewPkg(relName, chrtName, chrtVer.Version, ns,
+				pkg.Unknown, pkg.Present, pkg.Present, checkedRepo.URL, "")
+			wantedPkg.CRDOnly = chart.DeclaresCRDOnly(chrtVer.Annotations)
+
+			s := solver.New(solver.InstallOne, logger)
+			s.Timeout = settings.SolverTimeout
+			if err := r.install.buildWorldFromEntries(s.PkgDB, repoEntries, nil,
+				wantedPkg, chrtVer.Annotations, settings, logger); err != nil {
+				return nil, err
+			}
+
+			wantedPkgInDB := s.PkgDB.GetPackageByFingerprint(wantedPkg.GetFingerPrint())
+			s.Solve(wantedPkgInDB)
+			if s.IsSAT() {
+				continue
+			}
+			if s.TimedOut() {
+				// no verdict, it may be installable:
+				incons := []string{}
+				for _, incon := range s.PkgResultSet.Inconsistencies {
+					incons = append(incons, strings.TrimSpace(incon))
+				}
+				results = append(results, &RepoCheckResult{
+					Chart:           chrtName,
+					Version:         chrtVer.Version,
+					Result:          RepoCheckUndetermined,
+					Inconsistencies: incons,
+				})
+				continue
+			}
+
+			// only report the inconsistencies of the chart versions that
+			// the wanted package may depend on, the world contains all of
+			// them:
+			closure := s.DepClosure(wantedPkgInDB)
+			incons := []string{}
+			for _, p := range closure {
+				for _, incon := range s.PkgInconsistencies(p.GetFingerPrint()) {
+					incons = append(incons, strings.TrimSpace(incon))
+				}
+			}
+			incons = append(incons, r.install.closurePolicyDenials(s, closure)...)
+			sort.Strings(incons)
+			if len(incons) == 0 {
+				incons = append(incons, "No combination of versions satisfies its shared dependencies")
+			}
+			results = append(results, &RepoCheckResult{
+				Chart:           chrtName,
+				Version:         chrtVer.Version,
+				Result:          RepoCheckUninstallable,
+				Inconsistencies: incons,
+			})
+		}
+	}
+
+	return results, nil
+}
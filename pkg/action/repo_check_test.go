@@ -0,0 +1,151 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRepoCheckRun(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		repo      string
+		policy    string
+		timeout   time.Duration
+		want      []*RepoCheckResult
+		wantError string
+	}{
+		{
+			name: "repo with uninstallable chart versions",
+			repo: "ours",
+			want: []*RepoCheckResult{
+				{
+					Chart:   "backend",
+					Version: "2.0.0",
+					Result:  RepoCheckUninstallable,
+					Inconsistencies: []string{
+						"Chart \"backend\" depends on \"database\" in namespace \"database-ns\", semver \"~0.2.0\", but nothing satisfies it",
+					},
+				},
+				{
+					Chart:   "frontend",
+					Version: "2.0.0",
+					Result:  RepoCheckUninstallable,
+					Inconsistencies: []string{
+						"Chart \"frontend\" depends on \"backend\" in namespace \"backend-ns\", semver \"^3.0.0\", but nothing satisfies it",
+					},
+				},
+			},
+		},
+		{
+			name: "repo with all chart versions installable",
+			repo: "theirs",
+			want: []*RepoCheckResult{},
+		},
+		{
+			name:   "repo with chart versions denied by policy",
+			repo:   "ours",
+			policy: "testdata/repocheck/policy.yaml",
+			want: []*RepoCheckResult{
+				{
+					Chart:   "backend",
+					Version: "2.0.0",
+					Result:  RepoCheckUninstallable,
+					Inconsistencies: []string{
+						"Chart \"backend\" depends on \"database\" in namespace \"database-ns\", semver \"~0.2.0\", but nothing satisfies it",
+					},
+				},
+				{
+					Chart:   "backend",
+					Version: "1.0.2",
+					Result:  RepoCheckUninstallable,
+					Inconsistencies: []string{
+						"Chart \"backend\" depends on \"database\" in namespace \"database-ns\", semver \"~0.1.0\", but nothing satisfies it",
+						"Chart \"database\" version \"0.1.5\" is denied by policy: repository \"http://example.com/theirs\" is not allowed",
+					},
+				},
+				{
+					Chart:   "frontend",
+					Version: "2.0.0",
+					Result:  RepoCheckUninstallable,
+					Inconsistencies: []string{
+						"Chart \"frontend\" version \"2.0.0\" is denied by policy: versions \">=2.0.0\" are denied",
+					},
+				},
+				{
+					Chart:   "frontend",
+					Version: "1.0.0",
+					Result:  RepoCheckUninstallable,
+					Inconsistencies: []string{
+						"Chart \"backend\" depends on \"database\" in namespace \"database-ns\", semver \"~0.1.0\", but nothing satisfies it",
+						"Chart \"database\" version \"0.1.5\" is denied by policy: repository \"http://example.com/theirs\" is not allowed",
+					},
+				},
+			},
+		},
+		{
+			name:    "repo checked with the solver timing out",
+			repo:    "theirs",
+			timeout: time.Nanosecond,
+			want: []*RepoCheckResult{
+				{
+					Chart:   "database",
+					Version: "0.1.5",
+					Result:  RepoCheckUndetermined,
+					Inconsistencies: []string{
+						"No solution found before the solver timed out.",
+					},
+				},
+			},
+		},
+		{
+			name:      "repo not found",
+			repo:      "foo",
+			wantError: "no repo named \"foo\" found",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			settings := cli.New()
+			settings.RepositoryConfig = "testdata/repocheck/repositories.yaml"
+			settings.RepositoryCache = "testdata/repocheck/repository"
+			settings.PolicyFile = "testdata/repocheck/non-existent-policy.yaml"
+			if tcase.policy != "" {
+				settings.PolicyFile = tcase.policy
+			}
+			settings.SolverTimeout = tcase.timeout
+
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+
+			results, err := NewRepoCheck().Run(tcase.repo, settings, logger)
+			if tcase.wantError != "" {
+				is.EqualError(err, tcase.wantError)
+				return
+			}
+			is.NoError(err)
+			is.Equal(tcase.want, results)
+		})
+	}
+}
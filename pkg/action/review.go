@@ -0,0 +1,188 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/gosuri/uitable"
+	"github.com/pkg/errors"
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+)
+
+// ErrNotConfirmed is returned when the solution isn't confirmed on review.
+var ErrNotConfirmed = errors.New("installation not confirmed")
+
+// optionalDep is an optional shared dependency of a package that may get
+// installed, as considered when promoting optional dependencies.
+type optionalDep struct {
+	// key identifies the optional dependency: the base fingerprint of the
+	// dependent and the chart name of the dependency.
+	key       string
+	dependent *pkg.Pkg
+	rel       *pkg.PkgRel
+	promoted  bool
+}
+
+// resolveReviewed resolves as Resolve does. If Review is set and not on dry
+// run, it then prints a summary of the solution and asks for confirmation
+// through reader, solving again each time an optional shared dependency is
+// toggled. It returns ErrNotConfirmed if the solution isn't confirmed.
+func (i *Install) resolveReviewed(strategy solver.SolverStrategy,
+	wantedChrt *helmChart.Chart, wantedChrtAbsPath string, rels []*release.Release,
+	reader *bufio.Reader, settings *cli.EnvSettings, logger log.Logger) (*solver.Solver, *pkg.Pkg, error) {
+
+	// Resolve fills the version in, keep it for solving again:
+	version := i.Version
+	for {
+		s, wantedPkgInDB, err := i.Resolve(strategy, wantedChrt, wantedChrtAbsPath, rels, settings, logger)
+		if err != nil || !s.IsSAT() || !i.Review || i.Unattended || i.DryRun {
+			return s, wantedPkgInDB, err
+		}
+		resolve, err := i.reviewSolution(s, wantedPkgInDB, reader, settings, logger)
+		if err != nil || !resolve {
+			return s, wantedPkgInDB, err
+		}
+		i.Version = version
+	}
+}
+
+// reviewSolution prints the summary of the solution of s for installing
+// wantedPkg, and asks for confirmation through reader. Answering with the
+// number of an optional shared dependency toggles it, and returns true for
+// solving again with it toggled.
+func (i *Install) reviewSolution(s *solver.Solver, wantedPkg *pkg.Pkg, reader *bufio.Reader,
+	settings *cli.EnvSettings, logger log.Logger) (bool, error) {
+
+	i.printSolutionSummary(s, wantedPkg, settings, logger)
+	question := "Continue? [y/n]"
+	if len(i.optionalDeps) > 0 {
+		question = fmt.Sprintf("Continue? [y/n/1-%d toggles an optional dependency]", len(i.optionalDeps))
+	}
+	for {
+		log.Infof("%s (y):", question)
+
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return false, ErrNotConfirmed
+		}
+		response = strings.ToLower(strings.TrimSpace(response))
+
+		switch response {
+		case "y", "yes", "":
+			return false, nil
+		case "n", "no":
+			return false, ErrNotConfirmed
+		}
+		if n, err := strconv.Atoi(response); err == nil && n >= 1 && n <= len(i.optionalDeps) {
+			dep := i.optionalDeps[n-1]
+			if i.optionalDepsChoices == nil {
+				i.optionalDepsChoices = map[string]bool{}
+			}
+			i.optionalDepsChoices[dep.key] = !dep.promoted
+			return true, nil
+		}
+	}
+}
+
+// printSolutionSummary prints the releases that installing wantedPkg creates,
+// upgrades and removes following the solution of s, and the optional shared
+// dependencies that can be toggled, numbered.
+func (i *Install) printSolutionSummary(s *solver.Solver, wantedPkg *pkg.Pkg,
+	settings *cli.EnvSettings, logger log.Logger) {
+
+	toInstall := uitable.New()
+	toUpgrade := uitable.New()
+	installs, upgrades := 0, 0
+	for _, p := range flattenPkgTree(s.PkgResultSet.ToInstall) {
+		if i.NoSharedDeps && p.GetFingerPrint() != wantedPkg.GetFingerPrint() {
+			continue
+		}
+		repo := p.Repository
+		if repo == "" {
+			repo = "local"
+		}
+		from := presentVersion(s.PkgDB, p)
+		if p.GetFingerPrint() == wantedPkg.GetFingerPrint() && i.upgradedVersion != "" {
+			from = i.upgradedVersion
+		}
+		if from != "" {
+			toUpgrade.AddRow(" "+p.ReleaseName, p.ChartName, from+" -> "+p.Version, p.Namespace, repo)
+			upgrades++
+		} else {
+			toInstall.AddRow(" "+p.ReleaseName, p.ChartName, p.Version, p.Namespace, repo)
+			installs++
+		}
+	}
+	toRemove := uitable.New()
+	for _, p := range s.PkgResultSet.ToRemove {
+		toRemove.AddRow(" "+p.ReleaseName, p.ChartName, p.Version, p.Namespace)
+	}
+
+	if installs > 0 {
+		logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":ship: The following %s going to be INSTALLED:", countReleases(installs)))
+		logger.Info(toInstall.String())
+	}
+	if upgrades > 0 {
+		logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":up_arrow: The following %s going to be UPGRADED:", countReleases(upgrades)))
+		logger.Info(toUpgrade.String())
+	}
+	if len(s.PkgResultSet.ToRemove) > 0 {
+		logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":wastebasket: The following %s going to be REMOVED:", countReleases(len(s.PkgResultSet.ToRemove))))
+		logger.Info(toRemove.String())
+	}
+	if len(i.optionalDeps) > 0 {
+		logger.Info("Optional shared dependencies:")
+		for n, dep := range i.optionalDeps {
+			mark := " "
+			if dep.promoted {
+				mark = "x"
+			}
+			logger.Infof(" %d [%s] %q of chart %q", n+1, mark, dep.rel.ReleaseName, dep.dependent.ChartName)
+		}
+	}
+	logger.Info("")
+}
+
+// presentVersion returns the version of the release of p that is present, if
+// it is present with another version. Otherwise, it returns "".
+func presentVersion(pkgdb *solver.PkgDB, p *pkg.Pkg) string {
+	for _, fp := range pkgdb.GetMapOfVersionsByBaseFingerPrint(p.GetBaseFingerPrint()) {
+		present := pkgdb.GetPackageByFingerprint(fp)
+		if fp != p.GetFingerPrint() && present.CurrentState == pkg.Present {
+			return present.Version
+		}
+	}
+	return ""
+}
+
+func countReleases(n int) string {
+	if n == 1 {
+		return "release is"
+	}
+	return fmt.Sprintf("%d releases are", n)
+}
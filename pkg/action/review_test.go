@@ -0,0 +1,139 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bufio"
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/log-go"
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReviewSolution(t *testing.T) {
+	for _, tcase := range []struct {
+		name           string
+		input          string
+		expectedErr    error
+		expectResolve  bool
+		expectedChoice map[string]bool
+	}{
+		{
+			name:  "confirmed by default",
+			input: "\n",
+		},
+		{
+			name:        "not confirmed",
+			input:       "n\n",
+			expectedErr: ErrNotConfirmed,
+		},
+		{
+			name:        "not confirmed on EOF",
+			expectedErr: ErrNotConfirmed,
+		},
+		{
+			name:           "toggling an optional dependency",
+			input:          "9\nfoo\n1\n",
+			expectResolve:  true,
+			expectedChoice: map[string]bool{"app_app-ns_app/tracing": false},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			settings := cli.New()
+			settings.NoEmojis = true
+			settings.KubeContext = "my-cluster"
+			settings.DeclinedOptionalDepsFile = filepath.Join(ensure.TempDir(t), "declined-optional-deps.yaml")
+
+			buf := new(bytes.Buffer)
+			logger := logcli.NewStandard()
+			logger.InfoOut = buf
+			log.Current = logger
+
+			pkgdb, app := optionalDepsDB(t)
+			instAction := installAction(t)
+			instAction.OptionalDeps = OptionalDepsAsk
+			instAction.Review = true
+
+			// nothing is asked before the review:
+			is.NoError(instAction.promoteOptionalDeps(pkgdb, app, bufio.NewReader(strings.NewReader("")), settings, logger))
+			is.Equal(0, strings.Count(buf.String(), "Install optional shared dependency"))
+
+			s := solver.New(solver.InstallOne, logger)
+			s.PkgDB = pkgdb
+			s.PkgResultSet.ToInstall = &solver.PkgTree{Node: app}
+			reader := bufio.NewReader(strings.NewReader(tcase.input))
+			resolve, err := instAction.reviewSolution(s, app, reader, settings, logger)
+			is.Equal(tcase.expectedErr, err)
+			is.Equal(tcase.expectResolve, resolve)
+			is.Equal(tcase.expectedChoice, instAction.optionalDepsChoices)
+
+			out := buf.String()
+			is.Contains(out, "The following release is going to be INSTALLED:")
+			is.Contains(out, ` 1 [x] "tracing" of chart "app"`)
+			is.Contains(out, ` 2 [x] "storage" of chart "tracing"`)
+			is.NotContains(out, `"metrics" of chart "app"`)
+		})
+	}
+}
+
+func TestPromoteOptionalDepsChoices(t *testing.T) {
+	is := assert.New(t)
+
+	settings := cli.New()
+	settings.KubeContext = "my-cluster"
+	settings.DeclinedOptionalDepsFile = filepath.Join(ensure.TempDir(t), "declined-optional-deps.yaml")
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	instAction := installAction(t)
+	instAction.OptionalDeps = OptionalDepsAll
+	instAction.optionalDepsChoices = map[string]bool{"app_app-ns_app/tracing": false}
+
+	pkgdb, app := optionalDepsDB(t)
+	is.NoError(instAction.promoteOptionalDeps(pkgdb, app, bufio.NewReader(strings.NewReader("")), settings, logger))
+	depNames := []string{}
+	for _, rel := range app.DependsRel {
+		depNames = append(depNames, rel.ChartName)
+	}
+	is.Equal([]string{"metrics"}, depNames)
+	is.Equal(1, len(instAction.optionalDeps))
+	is.False(instAction.optionalDeps[0].promoted)
+
+	is.NoError(instAction.recordDeclinedOptionalDeps(settings))
+	declined, err := LoadDeclinedOptionalDeps(settings.DeclinedOptionalDepsFile)
+	is.NoError(err)
+	is.Equal([]*DeclinedOptionalDep{{KubeContext: "my-cluster", Release: "app", Namespace: "app-ns", Dependency: "tracing"}}, declined.Declined)
+
+	// toggling it back on forgets that it was declined:
+	instAction.optionalDepsChoices["app_app-ns_app/tracing"] = true
+	pkgdb, app = optionalDepsDB(t)
+	is.NoError(instAction.promoteOptionalDeps(pkgdb, app, bufio.NewReader(strings.NewReader("")), settings, logger))
+	is.True(instAction.optionalDeps[0].promoted)
+	is.NoError(instAction.recordDeclinedOptionalDeps(settings))
+	declined, err = LoadDeclinedOptionalDeps(settings.DeclinedOptionalDepsFile)
+	is.NoError(err)
+	is.Empty(declined.Declined)
+}
@@ -0,0 +1,629 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/log-go"
+	"github.com/Masterminds/semver/v3"
+	"github.com/jinzhu/copier"
+	"github.com/pkg/errors"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"github.com/rancher-sandbox/hypper/pkg/logjson"
+	"github.com/rancher-sandbox/hypper/pkg/plugin"
+	"github.com/rancher-sandbox/hypper/pkg/policy"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// SyncAction is the change that 'hypper sync' makes to a release.
+type SyncAction string
+
+const (
+	// SyncInstall installs a missing release.
+	SyncInstall SyncAction = "install"
+	// SyncUpgrade upgrades a release to another version of its chart.
+	SyncUpgrade SyncAction = "upgrade"
+	// SyncRemove uninstalls a release.
+	SyncRemove SyncAction = "remove"
+	// SyncUnchanged leaves a listed release as is.
+	SyncUnchanged SyncAction = "unchanged"
+)
+
+// hypperfileRootName is the release and chart name of the virtual package that
+// depends on all the releases listed in a Hypperfile.
+const hypperfileRootName = "hypperfile"
+
+// Sync is the action for bringing the releases of the cluster to the desired
+// state described in a Hypperfile.
+//
+// It provides the implementation of 'hypper sync'.
+type Sync struct {
+	// InstallClient contains the options used when installing and upgrading
+	// releases.
+	InstallClient *Install
+
+	// Prune removes the releases that are neither listed in the Hypperfile
+	// nor shared dependencies of the listed ones.
+	Prune bool
+	// DryRun computes the changes without applying them.
+	DryRun bool
+	// AllowCRDMajorUpgrade allows upgrading releases of CRD-only charts
+	// across a major version.
+	AllowCRDMajorUpgrade bool
+}
+
+// SyncChange is a change to a release computed by 'hypper sync'.
+type SyncChange struct {
+	Action      SyncAction `json:"action"`
+	ReleaseName string     `json:"release"`
+	Namespace   string     `json:"namespace"`
+	Chart       string     `json:"chart"`
+	Version     string     `json:"version"`
+	// FromVersion is the chart version of the release before upgrading it.
+	FromVersion string `json:"fromVersion,omitempty"`
+
+	pkg   *pkg.Pkg
+	entry *syncEntry
+}
+
+// syncEntry is a release of a Hypperfile, resolved against the configured
+// repositories.
+type syncEntry struct {
+	release     *HypperfileRelease
+	chartName   string
+	releaseName string
+	namespace   string
+	semverRange string
+	chrtEntry   chrtEntry
+}
+
+// NewSync creates a new Sync object with the given configuration.
+func NewSync(cfg *Configuration) *Sync {
+	return &Sync{
+		InstallClient: NewInstall(cfg),
+	}
+}
+
+// Run executes 'hypper sync'.
+//
+// It computes the changes with Plan and, unless DryRun is set, applies them:
+// first installs and upgrades, dependencies before their dependents, and then
+// removals.
+func (s *Sync) Run(hf *Hypperfile, settings *cli.EnvSettings, logger log.Logger) ([]*SyncChange, error) {
+	changes, err := s.Plan(hf, settings, logger)
+	if err != nil || s.DryRun {
+		return changes, err
+	}
+
+	for _, c := range changes {
+		switch c.Action {
+		case SyncInstall:
+			err = s.installRelease(c, settings, logger)
+		case SyncUpgrade:
+			err = s.upgradeRelease(c, settings, logger)
+		case SyncRemove:
+			err = s.removeRelease(c, settings, logger)
+		}
+		if err != nil {
+			return changes, err
+		}
+	}
+	return changes, nil
+}
+
+// Plan computes the changes needed for bringing the releases of the cluster to
+// the state described in hf, in one solver run.
+//
+// Every listed release becomes a dependency of a virtual root package. Listed
+// releases that are present and in range stay as they are, missing ones get
+// installed, and those out of range get upgraded to the newest version in
+// range that satisfies all dependencies. With Prune, releases not needed by
+// the root package get removed, and releases that conflict with the listed
+// ones get changed to another version, or removed as a last resort.
+func (s *Sync) Plan(hf *Hypperfile, settings *cli.EnvSettings, logger log.Logger) ([]*SyncChange, error) {
+	i := s.InstallClient
+
+	rels, err := NewInstall(i.Config).GetAllReleases()
+	if err != nil {
+		return nil, err
+	}
+
+	rf, err := repo.LoadFile(settings.RepositoryConfig)
+	if err != nil {
+		if !os.IsNotExist(errors.Cause(err)) {
+			return nil, err
+		}
+		logger.Debug("No repository present, continuing…")
+	}
+	repoEntries, err := loadRepoEntries(rf.Repositories, settings)
+	if err != nil {
+		return nil, err
+	}
+	if i.policy, err = policy.Load(settings.PolicyFile); err != nil {
+		return nil, err
+	}
+
+	// save ns from kube client, for performance reasons
+	settingsNS := settings.Namespace()
+
+	entries, err := resolveSyncEntries(hf, rf, repoEntries, settingsNS)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug("Building package DB…")
+	sol := solver.New(solver.InstallOne, logger)
+	sol.Timeout = settings.SolverTimeout
+	// when pruning, releases in the way of the listed ones may be changed, or
+	// removed as a last resort. Only sync allows it, as install and upgrade
+	// can't change nor remove other releases:
+	sol.AllowChanges = s.Prune
+	i.policyDenials = map[string]map[string]string{}
+	if err := i.addRepoEntriesToDB(sol.PkgDB, repoEntries, settingsNS, settings, logger); err != nil {
+		return nil, err
+	}
+	// entries with another release name or namespace than the chart default
+	// need their own packages, before adding the releases:
+	if err := i.addSyncEntriesToDB(sol.PkgDB, entries, repoEntries, settingsNS, settings, logger); err != nil {
+		return nil, err
+	}
+	if err := i.addReleasesToDB(sol.PkgDB, rels, repoEntries, settings, logger); err != nil {
+		return nil, err
+	}
+
+	relsByBFP := map[string]*release.Release{}
+	for _, r := range rels {
+		relsByBFP[pkg.CreateBaseFingerPrint(r.Name, r.Namespace, r.Chart.Metadata.Name)] = r
+	}
+
+	root := pkg.NewPkg(hypperfileRootName, hypperfileRootName, "0.0.0", "",
+		pkg.Unknown, pkg.Present, pkg.Present, "", "")
+	for _, e := range entries {
+		root.DependsRel = append(root.DependsRel, &pkg.PkgRel{
+			ReleaseName: e.releaseName,
+			Namespace:   e.namespace,
+			SemverRange: e.semverRange,
+			ChartName:   e.chartName,
+		})
+
+		for _, r := range rels {
+			if r.Name == e.releaseName && r.Namespace == e.namespace && r.Chart.Metadata.Name != e.chartName {
+				return nil, errors.Errorf("release %q in namespace %q is of chart %q instead of %q",
+					r.Name, r.Namespace, r.Chart.Metadata.Name, e.chartName)
+			}
+		}
+
+		bfp := pkg.CreateBaseFingerPrint(e.releaseName, e.namespace, e.chartName)
+		if r, ok := relsByBFP[bfp]; ok {
+			if inSemverRange(e.semverRange, r.Chart.Metadata.Version) {
+				// nothing to do, the release stays
+				continue
+			}
+			// the release gets replaced by another version of its chart:
+			fp := pkg.CreateFingerPrint(r.Name, r.Chart.Metadata.Version, r.Namespace, r.Chart.Metadata.Name)
+			sol.PkgDB.GetPackageByFingerprint(fp).CurrentState = pkg.Unknown
+		}
+		// prefer the newest versions in range:
+		for version, fp := range sol.PkgDB.GetMapOfVersionsByBaseFingerPrint(bfp) {
+			if inSemverRange(e.semverRange, version) {
+				sol.PkgDB.GetPackageByFingerprint(fp).DesiredState = pkg.Present
+			}
+		}
+	}
+	sol.PkgDB.Add(root)
+
+	sol.PkgDB.DebugPrintDB(logger)
+
+	if err := plugin.RunHooks(plugin.PreSolve, root, nil, settings, logger); err != nil {
+		return nil, err
+	}
+	logjson.Event(logger, logjson.SolveStarted, log.Fields{})
+	start := time.Now()
+	sol.Solve(root)
+	if s.Prune && sol.IsSAT() && markUnneededReleasesAbsent(sol, root, rels) {
+		logger.Debug("Solving again, removing unneeded releases…")
+		sol.PkgResultSet.Inconsistencies = []string{}
+		sol.Solve(root)
+	}
+	if !sol.IsSAT() {
+		i.addPolicyInconsistencies(sol, root)
+	}
+	logjson.Event(logger, logjson.SolveFinished, solveEventFields(sol, start))
+	if err := plugin.RunHooks(plugin.PostSolve, sol.PkgResultSet, nil, settings, logger); err != nil {
+		return nil, err
+	}
+	if !sol.IsSAT() {
+		return nil, errors.New(strings.Join(sol.PkgResultSet.Inconsistencies, "\n"))
+	}
+	sol.SortPkgSets()
+
+	changes := []*SyncChange{}
+	for _, p := range postOrderPkgs(sol.PkgResultSet.ToInstall) {
+		if p.GetFingerPrint() == root.GetFingerPrint() {
+			continue
+		}
+		c := newSyncChange(SyncInstall, p)
+		bfp := p.GetBaseFingerPrint()
+		if r, ok := relsByBFP[bfp]; ok {
+			c.Action = SyncUpgrade
+			c.FromVersion = r.Chart.Metadata.Version
+			if !s.AllowCRDMajorUpgrade && crossesMajor(c.FromVersion, c.Version) &&
+				(p.CRDOnly || chart.IsCRDOnly(r.Chart)) {
+				return nil, errors.Errorf("release %q of CRD-only chart %q would be upgraded from v%s to v%s, across a major version; confirm it with --allow-crd-major-upgrade",
+					c.ReleaseName, c.Chart, c.FromVersion, c.Version)
+			}
+		}
+		for _, e := range entries {
+			if pkg.CreateBaseFingerPrint(e.releaseName, e.namespace, e.chartName) == bfp {
+				c.entry = e
+			}
+		}
+		if err := c.checkDigest(); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	for _, p := range sol.PkgResultSet.ToRemove {
+		changes = append(changes, newSyncChange(SyncRemove, p))
+	}
+	for _, e := range entries {
+		bfp := pkg.CreateBaseFingerPrint(e.releaseName, e.namespace, e.chartName)
+		for _, p := range sol.PkgResultSet.PresentUnchanged {
+			if p.GetBaseFingerPrint() != bfp {
+				continue
+			}
+			c := newSyncChange(SyncUnchanged, p)
+			c.entry = e
+			if r := relsByBFP[bfp]; !sameValues(r.Config, c.values()) {
+				// the values drifted, upgrade to the same version with the
+				// values of the Hypperfile:
+				c.Action = SyncUpgrade
+				c.FromVersion = r.Chart.Metadata.Version
+				if err := c.checkDigest(); err != nil {
+					return nil, err
+				}
+			}
+			changes = append(changes, c)
+		}
+	}
+	return changes, nil
+}
+
+// sameValues returns true if the values a and b are the same once encoded, as
+// values decoded from YAML and from JSON differ in the types of numbers.
+func sameValues(a, b map[string]interface{}) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	aJSON, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bJSON, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aJSON, bJSON)
+}
+
+func newSyncChange(action SyncAction, p *pkg.Pkg) *SyncChange {
+	return &SyncChange{
+		Action:      action,
+		ReleaseName: p.ReleaseName,
+		Namespace:   p.Namespace,
+		Chart:       p.ChartName,
+		Version:     p.Version,
+		pkg:         p,
+	}
+}
+
+// resolveSyncEntries finds the chart of each release of hf in the configured
+// repositories, and fills in the defaults for the release name, namespace and
+// version range.
+func resolveSyncEntries(hf *Hypperfile, rf *repo.File, repoEntries map[string]chrtEntry,
+	settingsNS string) ([]*syncEntry, error) {
+
+	// repositories of the Hypperfile, by name, once checked they are configured:
+	hfRepoURLs := map[string]string{}
+	for _, hr := range hf.Repositories {
+		configured := false
+		for _, re := range rf.Repositories {
+			if strings.TrimSuffix(re.URL, "/") == strings.TrimSuffix(hr.URL, "/") {
+				configured = true
+			}
+		}
+		if !configured {
+			return nil, errors.Errorf("repository %q at %q is not configured, add it with 'hypper repo add %s %s'",
+				hr.Name, hr.URL, hr.Name, hr.URL)
+		}
+		hfRepoURLs[hr.Name] = hr.URL
+	}
+
+	entries := []*syncEntry{}
+	listed := map[string]bool{}
+	for _, r := range hf.Releases {
+		chartName, repoURL := r.Chart, ""
+		if idx := strings.Index(r.Chart, "/"); idx != -1 {
+			repoName := r.Chart[:idx]
+			chartName = r.Chart[idx+1:]
+			if re := rf.Get(repoName); re != nil {
+				repoURL = re.URL
+			} else if url, ok := hfRepoURLs[repoName]; ok {
+				repoURL = url
+			} else {
+				return nil, errors.Errorf("repository %q of chart %q not found, add it with 'hypper repo add'",
+					repoName, r.Chart)
+			}
+			repoURL = strings.TrimSuffix(repoURL, "/")
+		}
+		ce, ok := repoEntries[chartName]
+		if !ok || len(ce.chartVersions) == 0 ||
+			(repoURL != "" && strings.TrimSuffix(ce.url, "/") != repoURL) {
+			return nil, errors.Errorf("chart %q not found in the configured repositories", r.Chart)
+		}
+
+		// TODO each version can have a different default ns
+		annot := ce.chartVersions[0].Annotations
+		e := &syncEntry{
+			release:     r,
+			chartName:   chartName,
+			releaseName: r.Name,
+			namespace:   r.Namespace,
+			semverRange: r.Version,
+			chrtEntry:   ce,
+		}
+		if e.releaseName == "" {
+			e.releaseName = GetNameFromAnnot(annot, chartName)
+		}
+		if e.namespace == "" {
+			e.namespace = GetNamespaceFromAnnot(annot, settingsNS)
+		}
+		if e.semverRange == "" {
+			e.semverRange = "*"
+		}
+
+		bfp := pkg.CreateBaseFingerPrint(e.releaseName, e.namespace, e.chartName)
+		if listed[bfp] {
+			return nil, errors.Errorf("release %q in namespace %q is listed more than once",
+				e.releaseName, e.namespace)
+		}
+		listed[bfp] = true
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// addSyncEntriesToDB adds packages for the versions of the charts of entries
+// with a release name or namespace different from the chart defaults.
+func (i *Install) addSyncEntriesToDB(pkgdb *solver.PkgDB, entries []*syncEntry,
+	repoEntries map[string]chrtEntry,
+	settingsNS string, settings *cli.EnvSettings, logger log.Logger) error {
+
+	for _, e := range entries {
+		for _, chrtVer := range e.chrtEntry.chartVersions {
+			if GetNameFromAnnot(chrtVer.Annotations, chrtVer.Name) == e.releaseName &&
+				GetNamespaceFromAnnot(chrtVer.Annotations, settingsNS) == e.namespace {
+				// already added by addRepoEntriesToDB
+				continue
+			}
+			if reason := i.policy.Check(e.chrtEntry.url, e.chartName, chrtVer.Version, chrtVer.Annotations); reason != "" {
+				// already recorded by addRepoEntriesToDB
+				continue
+			}
+			p := pkg.NewPkg(e.releaseName, e.chartName, chrtVer.Version, e.namespace,
+				pkg.Unknown, pkg.Unknown, pkg.Unknown, e.chrtEntry.url, "")
+			p.CRDOnly = chart.DeclaresCRDOnly(chrtVer.Annotations)
+			if err := i.CreateDepRelsFromAnnot(p, chrtVer.Annotations, repoEntries,
+				pkgdb, settings, logger); err != nil {
+				return err
+			}
+			pkgdb.Add(p)
+		}
+	}
+	return nil
+}
+
+// markUnneededReleasesAbsent marks as to be removed the releases in rels kept,
+// or changed, by the last solving that root doesn't transitively depend on. It
+// returns true if any release was marked.
+func markUnneededReleasesAbsent(sol *solver.Solver, root *pkg.Pkg, rels []*release.Release) bool {
+	// packages present after applying the result, by base fingerprint:
+	resulting := map[string]*pkg.Pkg{}
+	for _, p := range sol.PkgResultSet.PresentUnchanged {
+		resulting[p.GetBaseFingerPrint()] = p
+	}
+	for _, p := range flattenPkgTree(sol.PkgResultSet.ToInstall) {
+		resulting[p.GetBaseFingerPrint()] = p
+	}
+
+	needed := map[string]bool{}
+	toVisit := []*pkg.Pkg{root}
+	for len(toVisit) > 0 {
+		p := toVisit[0]
+		toVisit = toVisit[1:]
+		for _, rel := range p.DependsRel {
+			bfp := pkg.CreateBaseFingerPrint(rel.ReleaseName, rel.Namespace, rel.ChartName)
+			if needed[bfp] {
+				continue
+			}
+			needed[bfp] = true
+			if dep, ok := resulting[bfp]; ok {
+				toVisit = append(toVisit, dep)
+			}
+		}
+	}
+
+	// releases kept or changed to another version by the solving:
+	marked := false
+	for _, r := range rels {
+		fp := pkg.CreateFingerPrint(r.Name, r.Chart.Metadata.Version, r.Namespace, r.Chart.Metadata.Name)
+		p := sol.PkgDB.GetPackageByFingerprint(fp)
+		if p == nil || p.CurrentState != pkg.Present || p.DesiredState == pkg.Absent {
+			continue
+		}
+		if p.CRDOnly {
+			// releases of CRD-only charts are never removed
+			continue
+		}
+		if !needed[p.GetBaseFingerPrint()] {
+			p.DesiredState = pkg.Absent
+			marked = true
+		}
+	}
+	return marked
+}
+
+// postOrderPkgs returns the nodes of tr in post-order, visiting sibling nodes
+// by fingerprint for a stable order.
+func postOrderPkgs(tr *solver.PkgTree) []*pkg.Pkg {
+	if tr == nil || tr.Node == nil {
+		return []*pkg.Pkg{}
+	}
+	relations := make([]*solver.PkgTree, len(tr.Relations))
+	copy(relations, tr.Relations)
+	sort.SliceStable(relations, func(i, j int) bool {
+		return relations[i].Node.GetFingerPrint() < relations[j].Node.GetFingerPrint()
+	})
+	pkgs := []*pkg.Pkg{}
+	for _, rel := range relations {
+		pkgs = append(pkgs, postOrderPkgs(rel)...)
+	}
+	return append(pkgs, tr.Node)
+}
+
+// inSemverRange returns true if version satisfies semverRange.
+func inSemverRange(semverRange, version string) bool {
+	c, err := semver.NewConstraint(semverRange)
+	if err != nil {
+		return false
+	}
+	v, err := semver.NewVersion(version)
+	if err != nil {
+		return false
+	}
+	return c.Check(v)
+}
+
+// newInstallClient returns a deep copy of the install client, for installing
+// or loading the chart of a single package.
+func (s *Sync) newInstallClient() (*Install, error) {
+	client := NewInstall(s.InstallClient.Config)
+	if err := copier.Copy(&client, &s.InstallClient); err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// values returns the values of the change, from the Hypperfile.
+func (c *SyncChange) values() map[string]interface{} {
+	if c.entry == nil || c.entry.release.Values == nil {
+		return map[string]interface{}{}
+	}
+	return c.entry.release.Values
+}
+
+// checkDigest fails if the Hypperfile locks a digest for the chart of the
+// change, and the digest in the repository index is different.
+func (c *SyncChange) checkDigest() error {
+	if c.entry == nil || c.entry.release.Digest == "" {
+		return nil
+	}
+	for _, cv := range c.entry.chrtEntry.chartVersions {
+		if cv.Version == c.Version && cv.Digest != c.entry.release.Digest {
+			return errors.Errorf("chart %q version %q has digest %q in the repository, but the Hypperfile locks %q",
+				c.Chart, c.Version, cv.Digest, c.entry.release.Digest)
+		}
+	}
+	return nil
+}
+
+func (s *Sync) installRelease(c *SyncChange, settings *cli.EnvSettings, logger log.Logger) error {
+	client, err := s.newInstallClient()
+	if err != nil {
+		return err
+	}
+	chrt, err := client.LoadChart(c.pkg.ChartName, c.pkg.ParentChartPath, c.pkg.Repository, c.pkg.Version, settings, logger)
+	if err != nil {
+		return err
+	}
+	// the namespace of the package has precedence over the chart annotations:
+	pkgSettings := *settings
+	pkgSettings.NamespaceFromFlag = true
+	_, err = client.InstallPkg(c.pkg, c.pkg, chrt, c.values(), 0, &pkgSettings, logger)
+	return err
+}
+
+func (s *Sync) upgradeRelease(c *SyncChange, settings *cli.EnvSettings, logger log.Logger) error {
+	client, err := s.newInstallClient()
+	if err != nil {
+		return err
+	}
+	chrt, err := client.LoadChart(c.pkg.ChartName, c.pkg.ParentChartPath, c.pkg.Repository, c.pkg.Version, settings, logger)
+	if err != nil {
+		return err
+	}
+
+	upgrade := NewUpgrade(s.InstallClient.Config)
+	upgrade.Namespace = c.Namespace
+	upgrade.Timeout = client.Timeout
+	upgrade.Wait = client.Wait
+	upgrade.WaitForJobs = client.WaitForJobs
+	upgrade.Atomic = client.Atomic
+	upgrade.DisableHooks = client.DisableHooks
+	// shared dependencies not listed in the Hypperfile keep their values:
+	upgrade.ReuseValues = c.entry == nil
+
+	if c.FromVersion == c.Version {
+		logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":cruise_ship: Upgrading release \"%s\" in namespace \"%s\" to the values of the Hypperfile…",
+			c.ReleaseName, c.Namespace))
+	} else {
+		logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":cruise_ship: Upgrading release \"%s\" in namespace \"%s\" from v%s to v%s…",
+			c.ReleaseName, c.Namespace, c.FromVersion, c.Version))
+	}
+	s.InstallClient.Config.SetNamespace(c.Namespace)
+	if _, err := upgrade.Run(c.ReleaseName, chrt, c.values()); err != nil {
+		return errors.Wrapf(err, "unable to upgrade release %q", c.ReleaseName)
+	}
+	return nil
+}
+
+func (s *Sync) removeRelease(c *SyncChange, settings *cli.EnvSettings, logger log.Logger) error {
+	uninstall := NewUninstall(s.InstallClient.Config)
+	uninstall.Timeout = s.InstallClient.Timeout
+	uninstall.DisableHooks = s.InstallClient.DisableHooks
+
+	logger.Infof(eyecandy.ESPrintf(settings.NoEmojis, ":fire: Removing release \"%s\" in namespace \"%s\"…",
+		c.ReleaseName, c.Namespace))
+	s.InstallClient.Config.SetNamespace(c.Namespace)
+	if _, err := uninstall.Run(c.ReleaseName); err != nil {
+		return errors.Wrapf(err, "unable to remove release %q", c.ReleaseName)
+	}
+	return nil
+}
@@ -0,0 +1,418 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/repo"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/time"
+)
+
+func syncRelStub(name, ns, chartName, version string) *release.Release {
+	now := time.Now()
+	return &release.Release{
+		Name: name,
+		Info: &release.Info{
+			FirstDeployed: now,
+			LastDeployed:  now,
+			Status:        release.StatusDeployed,
+			Description:   "Named Release Stub",
+		},
+		Version:   1,
+		Namespace: ns,
+		Chart:     buildChart(withName(chartName), withChartVersion(version)),
+	}
+}
+
+func TestLoadHypperfile(t *testing.T) {
+	is := assert.New(t)
+
+	hf, err := LoadHypperfile("testdata/sync/Hypperfile.yaml")
+	is.NoError(err)
+	is.Equal(2, len(hf.Releases))
+	is.Equal("ours/app", hf.Releases[0].Chart)
+	is.Equal("^2.0.0", hf.Releases[0].Version)
+	is.Equal(map[string]interface{}{"replicas": float64(2)}, hf.Releases[0].Values)
+	is.Equal("my-extra", hf.Releases[1].Name)
+	is.Equal("tools", hf.Releases[1].Namespace)
+
+	_, err = LoadHypperfile("testdata/sync/malformed-Hypperfile.yaml")
+	is.Error(err)
+	_, err = LoadHypperfile("testdata/sync/invalid-range-Hypperfile.yaml")
+	is.Error(err)
+	_, err = LoadHypperfile("testdata/sync/non-existent.yaml")
+	is.Error(err)
+}
+
+func TestSyncPlan(t *testing.T) {
+	hf, err := LoadHypperfile("testdata/sync/Hypperfile.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name       string
+		hypperfile *Hypperfile
+		rels       []*release.Release
+		prune      bool
+		allowCRD   bool
+		want       []*SyncChange
+		wantError  string
+	}{
+		{
+			name:       "install everything, with newest versions in range",
+			hypperfile: hf,
+			want: []*SyncChange{
+				{Action: SyncInstall, ReleaseName: "lib", Namespace: "lib-ns", Chart: "lib", Version: "1.0.0"},
+				{Action: SyncInstall, ReleaseName: "app", Namespace: "app-ns", Chart: "app", Version: "2.1.0"},
+				{Action: SyncInstall, ReleaseName: "my-extra", Namespace: "tools", Chart: "extra", Version: "1.0.0"},
+			},
+		},
+		{
+			name:       "upgrade out of range release, keep unlisted release",
+			hypperfile: hf,
+			rels: []*release.Release{
+				syncRelStub("app", "app-ns", "app", "1.0.0"),
+				syncRelStub("lib", "lib-ns", "lib", "1.0.0"),
+				syncRelStub("my-extra", "tools", "extra", "1.0.0"),
+				syncRelStub("extra", "extra-ns", "extra", "1.0.0"),
+			},
+			want: []*SyncChange{
+				{Action: SyncUpgrade, ReleaseName: "app", Namespace: "app-ns", Chart: "app", Version: "2.1.0", FromVersion: "1.0.0"},
+				{Action: SyncUnchanged, ReleaseName: "my-extra", Namespace: "tools", Chart: "extra", Version: "1.0.0"},
+			},
+		},
+		{
+			name:       "prune unlisted release, keep shared dependency",
+			hypperfile: hf,
+			rels: []*release.Release{
+				func() *release.Release {
+					r := syncRelStub("app", "app-ns", "app", "2.0.0")
+					r.Config = map[string]interface{}{"replicas": float64(2)}
+					return r
+				}(),
+				syncRelStub("lib", "lib-ns", "lib", "1.0.0"),
+				syncRelStub("extra", "extra-ns", "extra", "1.0.0"),
+			},
+			prune: true,
+			want: []*SyncChange{
+				{Action: SyncInstall, ReleaseName: "my-extra", Namespace: "tools", Chart: "extra", Version: "1.0.0"},
+				{Action: SyncRemove, ReleaseName: "extra", Namespace: "extra-ns", Chart: "extra", Version: "1.0.0"},
+				{Action: SyncUnchanged, ReleaseName: "app", Namespace: "app-ns", Chart: "app", Version: "2.0.0"},
+			},
+		},
+		{
+			name:       "upgrade release whose values drifted to the same version",
+			hypperfile: hf,
+			rels: []*release.Release{
+				func() *release.Release {
+					r := syncRelStub("app", "app-ns", "app", "2.0.0")
+					r.Config = map[string]interface{}{"replicas": float64(3)}
+					return r
+				}(),
+				syncRelStub("lib", "lib-ns", "lib", "1.0.0"),
+				syncRelStub("my-extra", "tools", "extra", "1.0.0"),
+			},
+			want: []*SyncChange{
+				{Action: SyncUpgrade, ReleaseName: "app", Namespace: "app-ns", Chart: "app", Version: "2.0.0", FromVersion: "2.0.0"},
+				{Action: SyncUnchanged, ReleaseName: "my-extra", Namespace: "tools", Chart: "extra", Version: "1.0.0"},
+			},
+		},
+		{
+			name: "prune dependency no longer needed",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "app", Version: "~1.0.0"},
+			}},
+			rels: []*release.Release{
+				syncRelStub("app", "app-ns", "app", "2.0.0"),
+				syncRelStub("lib", "lib-ns", "lib", "1.0.0"),
+			},
+			prune: true,
+			want: []*SyncChange{
+				{Action: SyncUpgrade, ReleaseName: "app", Namespace: "app-ns", Chart: "app", Version: "1.0.0", FromVersion: "2.0.0"},
+				{Action: SyncRemove, ReleaseName: "lib", Namespace: "lib-ns", Chart: "lib", Version: "1.0.0"},
+			},
+		},
+		{
+			name: "prune release in the way of a listed one",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "lib", Version: "^2.0.0"},
+			}},
+			rels: []*release.Release{
+				func() *release.Release {
+					r := syncRelStub("app", "app-ns", "app", "2.0.0")
+					r.Chart.Metadata.Annotations = map[string]string{
+						"hypper.cattle.io/namespace":           "app-ns",
+						"hypper.cattle.io/shared-dependencies": "- name: lib\n  version: \"^1.0.0\"\n",
+					}
+					return r
+				}(),
+				syncRelStub("lib", "lib-ns", "lib", "1.0.0"),
+			},
+			prune: true,
+			want: []*SyncChange{
+				{Action: SyncUpgrade, ReleaseName: "lib", Namespace: "lib-ns", Chart: "lib", Version: "2.0.0", FromVersion: "1.0.0"},
+				{Action: SyncRemove, ReleaseName: "app", Namespace: "app-ns", Chart: "app", Version: "2.0.0"},
+			},
+		},
+		{
+			name:       "prune keeps release of CRD-only chart",
+			hypperfile: hf,
+			rels: []*release.Release{
+				func() *release.Release {
+					r := syncRelStub("app", "app-ns", "app", "2.0.0")
+					r.Config = map[string]interface{}{"replicas": float64(2)}
+					return r
+				}(),
+				syncRelStub("lib", "lib-ns", "lib", "1.0.0"),
+				func() *release.Release {
+					r := syncRelStub("extra", "extra-ns", "extra", "1.0.0")
+					r.Chart.Metadata.Annotations = map[string]string{"hypper.cattle.io/crd-only": "true"}
+					return r
+				}(),
+			},
+			prune: true,
+			want: []*SyncChange{
+				{Action: SyncInstall, ReleaseName: "my-extra", Namespace: "tools", Chart: "extra", Version: "1.0.0"},
+				{Action: SyncUnchanged, ReleaseName: "app", Namespace: "app-ns", Chart: "app", Version: "2.0.0"},
+			},
+		},
+		{
+			name: "upgrade of CRD-only chart across a major version not allowed",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "lib", Version: "^2.0.0"},
+			}},
+			rels: []*release.Release{
+				func() *release.Release {
+					r := syncRelStub("lib", "lib-ns", "lib", "1.0.0")
+					r.Chart.Metadata.Annotations = map[string]string{"hypper.cattle.io/crd-only": "true"}
+					return r
+				}(),
+			},
+			wantError: "release \"lib\" of CRD-only chart \"lib\" would be upgraded from v1.0.0 to v2.0.0, across a major version; confirm it with --allow-crd-major-upgrade",
+		},
+		{
+			name: "upgrade of CRD-only chart across a major version allowed",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "lib", Version: "^2.0.0"},
+			}},
+			rels: []*release.Release{
+				func() *release.Release {
+					r := syncRelStub("lib", "lib-ns", "lib", "1.0.0")
+					r.Chart.Metadata.Annotations = map[string]string{"hypper.cattle.io/crd-only": "true"}
+					return r
+				}(),
+			},
+			allowCRD: true,
+			want: []*SyncChange{
+				{Action: SyncUpgrade, ReleaseName: "lib", Namespace: "lib-ns", Chart: "lib", Version: "2.0.0", FromVersion: "1.0.0"},
+			},
+		},
+		{
+			name: "nothing satisfies the range",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "app", Version: "^3.0.0"},
+			}},
+			wantError: "Chart \"hypperfile\" depends on \"app\" in namespace \"app-ns\", semver \"^3.0.0\", but nothing satisfies it",
+		},
+		{
+			name: "release of another chart",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "extra", Name: "app", Namespace: "app-ns"},
+			}},
+			rels: []*release.Release{
+				syncRelStub("app", "app-ns", "app", "2.0.0"),
+			},
+			wantError: "release \"app\" in namespace \"app-ns\" is of chart \"app\" instead of \"extra\"",
+		},
+		{
+			name: "chart not found",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "ours/foo"},
+			}},
+			wantError: "chart \"ours/foo\" not found in the configured repositories",
+		},
+		{
+			name: "repository not found",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "theirs/app"},
+			}},
+			wantError: "repository \"theirs\" of chart \"theirs/app\" not found, add it with 'hypper repo add'",
+		},
+		{
+			name: "locked digest differs from the repository",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "lib", Version: "1.0.0", Digest: "0123456789abcdef"},
+			}},
+			wantError: "chart \"lib\" version \"1.0.0\" has digest \"5a0b6a8c7ea8b4bb7e3f8cbe5b9d6c9f2d3c1f0e4b7a6d5c8e9f0a1b2c3d4e5f\" in the repository, but the Hypperfile locks \"0123456789abcdef\"",
+		},
+		{
+			name: "repository of the Hypperfile not configured",
+			hypperfile: &Hypperfile{
+				Repositories: []*HypperfileRepository{{Name: "theirs", URL: "http://example.com/theirs"}},
+				Releases:     []*HypperfileRelease{{Chart: "theirs/database"}},
+			},
+			wantError: "repository \"theirs\" at \"http://example.com/theirs\" is not configured, add it with 'hypper repo add theirs http://example.com/theirs'",
+		},
+		{
+			name: "repository of the Hypperfile configured under another name",
+			hypperfile: &Hypperfile{
+				Repositories: []*HypperfileRepository{{Name: "staging", URL: "http://example.com/ours/"}},
+				Releases:     []*HypperfileRelease{{Chart: "staging/extra", Version: "1.0.0"}},
+			},
+			want: []*SyncChange{
+				{Action: SyncInstall, ReleaseName: "extra", Namespace: "extra-ns", Chart: "extra", Version: "1.0.0"},
+			},
+		},
+		{
+			name: "release listed twice",
+			hypperfile: &Hypperfile{Releases: []*HypperfileRelease{
+				{Chart: "app"},
+				{Chart: "ours/app", Version: "^2.0.0"},
+			}},
+			wantError: "release \"app\" in namespace \"app-ns\" is listed more than once",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			settings := cli.New()
+			settings.RepositoryConfig = "testdata/sync/repositories.yaml"
+			settings.RepositoryCache = "testdata/sync/repository"
+			settings.PolicyFile = "non-existent-dir/policy.yaml"
+
+			logger := logcli.NewStandard()
+			logger.InfoOut = new(bytes.Buffer)
+
+			client := NewSync(actionConfigFixture(t))
+			client.Prune = tcase.prune
+			client.AllowCRDMajorUpgrade = tcase.allowCRD
+			client.DryRun = true
+			for _, r := range tcase.rels {
+				if err := client.InstallClient.Config.Releases.Create(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			changes, err := client.Run(tcase.hypperfile, settings, logger)
+			if tcase.wantError != "" {
+				is.EqualError(err, tcase.wantError)
+				return
+			}
+			is.NoError(err)
+			for _, c := range changes {
+				c.pkg = nil
+				c.entry = nil
+			}
+			is.Equal(tcase.want, changes)
+		})
+	}
+}
+
+func TestSyncRun(t *testing.T) {
+	is := assert.New(t)
+
+	// local repository with the charts:
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	for _, version := range []string{"0.1.0", "0.2.0"} {
+		chrt := buildChart(withName("app"), withChartVersion(version))
+		if _, err := chartutil.Save(chrt, repoDir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, err := repo.IndexDirectory(repoDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := index.WriteFile(filepath.Join(repoDir, "index.yaml"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings := cli.New()
+	settings.PolicyFile = "non-existent-dir/policy.yaml"
+	repoSettings, err := bundleRepoSettings(tmpDir, repoDir, index, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger := logcli.NewStandard()
+	logger.InfoOut = new(bytes.Buffer)
+
+	config := actionConfigFixture(t)
+	for _, r := range []*release.Release{
+		syncRelStub("app", "default", "app", "0.1.0"),
+		syncRelStub("old", "default", "app", "0.1.0"),
+	} {
+		if err := config.Releases.Create(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hf := &Hypperfile{Releases: []*HypperfileRelease{
+		{Chart: "app", Version: "0.2.0", Namespace: "default", Values: map[string]interface{}{"foo": "bar"}},
+		{Chart: "app", Name: "other", Namespace: "default"},
+	}}
+	client := NewSync(config)
+	client.Prune = true
+	changes, err := client.Run(hf, repoSettings, logger)
+	is.NoError(err)
+	is.Equal(3, len(changes))
+
+	rels, err := NewInstall(config).GetAllReleases()
+	is.NoError(err)
+	deployed := map[string]string{}
+	for _, r := range rels {
+		if r.Info.Status == release.StatusDeployed {
+			deployed[r.Name] = r.Chart.Metadata.Version
+			if r.Name == "app" {
+				is.Equal(map[string]interface{}{"foo": "bar"}, r.Config)
+			}
+		}
+	}
+	is.Equal(map[string]string{"app": "0.2.0", "other": "0.2.0"}, deployed)
+
+	// syncing again doesn't change anything:
+	changes, err = client.Run(hf, repoSettings, logger)
+	is.NoError(err)
+	for _, c := range changes {
+		is.Equal(SyncUnchanged, c.Action)
+	}
+
+	// values of the Hypperfile are enforced, keeping the version:
+	hf.Releases[0].Values = map[string]interface{}{"foo": "baz"}
+	changes, err = client.Run(hf, repoSettings, logger)
+	is.NoError(err)
+	upgraded := []string{}
+	for _, c := range changes {
+		if c.Action == SyncUpgrade {
+			upgraded = append(upgraded, c.ReleaseName)
+		}
+	}
+	is.Equal([]string{"app"}, upgraded)
+	r, err := config.Releases.Last("app")
+	is.NoError(err)
+	is.Equal("0.2.0", r.Chart.Metadata.Version)
+	is.Equal(map[string]interface{}{"foo": "baz"}, r.Config)
+}
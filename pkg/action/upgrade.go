@@ -17,7 +17,23 @@ limitations under the License.
 package action
 
 import (
+	"bufio"
+	"os"
+
+	"github.com/Masterminds/log-go"
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/chart"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+	"github.com/rancher-sandbox/hypper/pkg/policy"
+
 	"helm.sh/helm/v3/pkg/action"
+	helmChart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
 )
 
 // Upgrade is a composite type of Helm's Upgrade type
@@ -25,6 +41,28 @@ type Upgrade struct {
 	*action.Upgrade
 	Config      *Configuration
 	ReleaseName string
+
+	// Hypper specific:
+	NoSharedDeps      bool
+	OptionalDeps      OptionalDepsStrategy
+	NoCreateNamespace bool
+	// AllowCRDMajorUpgrade upgrades releases of CRD-only charts across a
+	// major version without asking.
+	AllowCRDMajorUpgrade bool
+	// DumpSolverProblem is the path of the file where to dump the solver
+	// problem of the shared dependencies, if set.
+	DumpSolverProblem string
+	// Review prints a summary of the shared dependencies to install before
+	// installing them, and asks for confirmation, as Install.Review.
+	Review bool
+	// Unattended doesn't ask anything, as Install.Unattended. Upgrades of
+	// CRD-only charts across a major version fail unless
+	// AllowCRDMajorUpgrade is set.
+	Unattended bool
+
+	// PkgResultSet is the outcome of the solving of the shared dependencies
+	// in the last InstallSharedDeps, nil if it didn't get to solve.
+	PkgResultSet *solver.PkgResultSet
 }
 
 // NewUpgrade creates a new Upgrade object with the given configuration.
@@ -34,3 +72,162 @@ func NewUpgrade(cfg *Configuration) *Upgrade {
 		Config:  cfg,
 	}
 }
+
+// InstallSharedDeps installs the shared dependencies of chart ch that are
+// missing for upgrading the release to it, together with the optional ones
+// selected by the OptionalDeps strategy, transitively. It doesn't upgrade the
+// release itself.
+//
+// It returns the installed releases. Nothing is installed if NoSharedDeps is
+// set or the chart doesn't declare shared dependencies.
+//
+// chartAbsPath is needed for evaluating `file://` repositories in the shared
+// dependency annotations.
+func (u *Upgrade) InstallSharedDeps(ch *helmChart.Chart, chartAbsPath string,
+	settings *cli.EnvSettings, logger log.Logger) ([]*release.Release, error) {
+
+	u.PkgResultSet = nil
+	if u.NoSharedDeps {
+		return nil, nil
+	}
+	deps, err := chart.GetSharedDeps(ch, logger)
+	if err != nil || len(deps) == 0 {
+		return nil, err
+	}
+
+	i := NewInstall(u.Config)
+	i.ReleaseName = u.ReleaseName
+	i.Namespace = u.Namespace
+	i.ChartPathOptions = u.ChartPathOptions
+	i.OptionalDeps = u.OptionalDeps
+	i.NoCreateNamespace = u.NoCreateNamespace
+	i.DumpSolverProblem = u.DumpSolverProblem
+	i.Review = u.Review
+	i.Unattended = u.Unattended
+	i.Devel = u.Devel
+	i.CreateNamespace = !u.NoCreateNamespace
+	i.DryRun = u.DryRun
+	i.DisableHooks = u.DisableHooks
+	i.SkipCRDs = u.SkipCRDs
+	i.Timeout = u.Timeout
+	i.Wait = u.Wait
+	i.WaitForJobs = u.WaitForJobs
+	i.Atomic = u.Atomic
+	i.DisableOpenAPIValidation = u.DisableOpenAPIValidation
+
+	// installing moves the configuration to other namespaces; move it back
+	// to the release's for upgrading it:
+	defer u.Config.SetNamespace(u.Namespace)
+
+	rels, err := i.GetAllReleases()
+	if err != nil {
+		return nil, err
+	}
+	// leave the release out, as its chart version is going to change:
+	otherRels := []*release.Release{}
+	for _, r := range rels {
+		if r.Name != u.ReleaseName || r.Namespace != u.Namespace {
+			otherRels = append(otherRels, r)
+		} else if r.Chart != nil && r.Chart.Metadata != nil {
+			i.upgradedVersion = r.Chart.Metadata.Version
+		}
+	}
+
+	s, wantedPkgInDB, err := i.resolveReviewed(solver.InstallOne, ch, chartAbsPath, otherRels,
+		bufio.NewReader(os.Stdin), settings, logger)
+	if err != nil {
+		return nil, err
+	}
+	u.PkgResultSet = &s.PkgResultSet
+	if !s.IsSAT() {
+		incons := ""
+		for _, incon := range s.PkgResultSet.Inconsistencies {
+			incons = incons + incon
+		}
+		return nil, errors.New(incons)
+	}
+
+	if len(s.PkgResultSet.ToInstall.Relations) == 0 {
+		return nil, i.recordDeclinedOptionalDeps(settings)
+	}
+	if !(i.Review && !i.DryRun) {
+		logger.Info("The following charts are going to be installed:")
+		logger.Infof("%s\n", solver.PrintPkgTree(s.PkgResultSet.ToInstall))
+	}
+	if i.ChartPathOptions.Verify {
+		if err := i.VerifyPkgTree(s.PkgResultSet.ToInstall, wantedPkgInDB, settings, logger); err != nil {
+			return nil, err
+		}
+	}
+	installedRels := []*release.Release{}
+	for _, depTr := range s.PkgResultSet.ToInstall.Relations {
+		rels, err := i.postOrderInstall(depTr, wantedPkgInDB, ch, map[string]interface{}{}, settings, logger)
+		installedRels = append(installedRels, rels...)
+		if err != nil {
+			return installedRels, err
+		}
+	}
+	return installedRels, i.recordDeclinedOptionalDeps(settings)
+}
+
+// CheckPolicy returns an error if chart ch, from the repository at
+// ChartPathOptions.RepoURL, is denied by the policy at settings.PolicyFile.
+// InstallSharedDeps only checks the charts it solves for, so the upgraded
+// chart needs checking even when it has no shared dependencies.
+func (u *Upgrade) CheckPolicy(ch *helmChart.Chart, settings *cli.EnvSettings) error {
+	p, err := policy.Load(settings.PolicyFile)
+	if err != nil {
+		return err
+	}
+	if reason := p.Check(u.ChartPathOptions.RepoURL, ch.Metadata.Name, ch.Metadata.Version,
+		ch.Metadata.Annotations); reason != "" {
+		return errors.New(reason)
+	}
+	return nil
+}
+
+// ConfirmCRDMajorUpgrade asks for confirmation through reader when upgrading
+// the release to chart ch crosses a major version, and either chart only
+// contains CRDs. It returns an error if not confirmed.
+//
+// Nothing is asked if AllowCRDMajorUpgrade is set, or the release doesn't
+// exist yet. When Unattended, it isn't confirmed.
+func (u *Upgrade) ConfirmCRDMajorUpgrade(ch *helmChart.Chart, reader *bufio.Reader,
+	settings *cli.EnvSettings, logger log.Logger) error {
+
+	last, err := u.Config.Releases.Last(u.ReleaseName)
+	if errors.Is(err, driver.ErrReleaseNotFound) {
+		// nothing to upgrade from, as with upgrade --install:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	from, to := last.Chart.Metadata.Version, ch.Metadata.Version
+	if u.AllowCRDMajorUpgrade || !crossesMajor(from, to) ||
+		!(chart.IsCRDOnly(last.Chart) || chart.IsCRDOnly(ch)) {
+		return nil
+	}
+
+	question := eyecandy.ESPrintf(settings.NoEmojis,
+		":warning: Chart \"%s\" only contains CRDs. Upgrade release \"%s\" from v%s to v%s, across a major version?",
+		ch.Metadata.Name, u.ReleaseName, from, to)
+	if u.Unattended || !promptBool(question, reader, logger) {
+		return errors.Errorf("upgrade of release %q of CRD-only chart %q across a major version not confirmed",
+			u.ReleaseName, ch.Metadata.Name)
+	}
+	return nil
+}
+
+// crossesMajor returns true if versions from and to have different majors.
+func crossesMajor(from, to string) bool {
+	vFrom, err := semver.NewVersion(from)
+	if err != nil {
+		return false
+	}
+	vTo, err := semver.NewVersion(to)
+	if err != nil {
+		return false
+	}
+	return vFrom.Major() != vTo.Major()
+}
@@ -16,8 +16,21 @@ limitations under the License.
 
 package action
 
-import "github.com/stretchr/testify/assert"
-import "testing"
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/log-go"
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/pkg/errors"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/release"
+	"helm.sh/helm/v3/pkg/storage/driver"
+)
 
 func upgradeAction(t *testing.T) *Upgrade {
 	config := actionConfigFixture(t)
@@ -75,3 +88,188 @@ func TestUpgradeName(t *testing.T) {
 	}
 	is.Equal("hello", name)
 }
+
+func TestUpgradeInstallSharedDeps(t *testing.T) {
+	sharedDep := syncRelStub("my-shared-dep", "my-shared-dep-ns", "testdata/charts/shared-dep", "0.1.0")
+
+	for _, tcase := range []struct {
+		name         string
+		rels         []*release.Release
+		noSharedDeps bool
+		installed    []string
+	}{
+		{
+			name:      "missing shared dep gets installed",
+			installed: []string{"my-shared-dep"},
+		},
+		{
+			name:         "no shared deps",
+			noSharedDeps: true,
+			installed:    []string{},
+		},
+		{
+			name:      "shared dep already present",
+			rels:      []*release.Release{sharedDep},
+			installed: []string{},
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			settings := cli.New()
+			settings.RepositoryCache = "testdata/hypperhome/hypper/repository"
+			settings.RepositoryConfig = "testdata/hypperhome/hypper/repositories.yaml"
+			settings.PolicyFile = "testdata/non-existent-policy.yaml"
+
+			buf := new(bytes.Buffer)
+			logger := logcli.NewStandard()
+			logger.InfoOut = buf
+			log.Current = logger
+
+			upgrAction := upgradeAction(t)
+			upgrAction.ReleaseName = "my-hypper-name"
+			upgrAction.Namespace = "hypper"
+			upgrAction.NoSharedDeps = tcase.noSharedDeps
+			// the release being upgraded, of an older chart version:
+			rels := append([]*release.Release{syncRelStub("my-hypper-name", "hypper", "hello", "0.0.1")}, tcase.rels...)
+			for _, r := range rels {
+				if err := upgrAction.Config.Releases.Create(r); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cwd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			installed, err := upgrAction.InstallSharedDeps(buildChart(withHypperAnnotations(), withSharedDeps()),
+				cwd+"/testdata/charts/unexistent-chart", settings, logger)
+			is.NoError(err)
+
+			names := []string{}
+			for _, r := range installed {
+				names = append(names, r.Name)
+			}
+			is.Equal(tcase.installed, names)
+		})
+	}
+}
+
+func TestUpgradeConfirmCRDMajorUpgrade(t *testing.T) {
+	crdOnly := map[string]string{"hypper.cattle.io/crd-only": "true"}
+
+	for _, tcase := range []struct {
+		name         string
+		relAnnot     map[string]string
+		fromVersion  string
+		toVersion    string
+		allow        bool
+		unattended   bool
+		answer       string
+		noRelease    bool
+		queryErr     bool
+		wantQuestion bool
+		wantError    string
+	}{
+		{
+			name:      "no release to upgrade from",
+			relAnnot:  crdOnly,
+			toVersion: "2.0.0",
+			noRelease: true,
+		},
+		{
+			name:        "CRD-only, failing to get the release",
+			relAnnot:    crdOnly,
+			fromVersion: "1.0.0",
+			toVersion:   "2.0.0",
+			queryErr:    true,
+			wantError:   "query failed",
+		},
+		{
+			name:        "not CRD-only, across a major version",
+			fromVersion: "1.0.0",
+			toVersion:   "2.0.0",
+		},
+		{
+			name:        "CRD-only, same major version",
+			relAnnot:    crdOnly,
+			fromVersion: "1.0.0",
+			toVersion:   "1.1.0",
+		},
+		{
+			name:         "CRD-only, across a major version, confirmed",
+			relAnnot:     crdOnly,
+			fromVersion:  "1.0.0",
+			toVersion:    "2.0.0",
+			answer:       "y\n",
+			wantQuestion: true,
+		},
+		{
+			name:         "CRD-only, across a major version, not confirmed",
+			relAnnot:     crdOnly,
+			fromVersion:  "1.0.0",
+			toVersion:    "2.0.0",
+			answer:       "n\n",
+			wantQuestion: true,
+			wantError:    "upgrade of release \"crds\" of CRD-only chart \"crds\" across a major version not confirmed",
+		},
+		{
+			name:        "CRD-only, across a major version, unattended",
+			relAnnot:    crdOnly,
+			fromVersion: "1.0.0",
+			toVersion:   "2.0.0",
+			unattended:  true,
+			wantError:   "upgrade of release \"crds\" of CRD-only chart \"crds\" across a major version not confirmed",
+		},
+		{
+			name:        "CRD-only, across a major version, allowed",
+			relAnnot:    crdOnly,
+			fromVersion: "1.0.0",
+			toVersion:   "2.0.0",
+			allow:       true,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			buf := new(bytes.Buffer)
+			logger := logcli.NewStandard()
+			logger.InfoOut = buf
+			log.Current = logger
+
+			upgrAction := upgradeAction(t)
+			upgrAction.ReleaseName = "crds"
+			upgrAction.AllowCRDMajorUpgrade = tcase.allow
+			upgrAction.Unattended = tcase.unattended
+			if !tcase.noRelease {
+				rel := syncRelStub("crds", "default", "crds", tcase.fromVersion)
+				rel.Chart.Metadata.Annotations = tcase.relAnnot
+				if err := upgrAction.Config.Releases.Create(rel); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tcase.queryErr {
+				upgrAction.Config.Releases.Driver = &queryErrDriver{upgrAction.Config.Releases.Driver}
+			}
+
+			ch := buildChart(withName("crds"), withChartVersion(tcase.toVersion))
+			err := upgrAction.ConfirmCRDMajorUpgrade(ch, bufio.NewReader(strings.NewReader(tcase.answer)),
+				cli.New(), logger)
+			if tcase.wantError != "" {
+				is.EqualError(err, tcase.wantError)
+			} else {
+				is.NoError(err)
+			}
+			is.Equal(tcase.wantQuestion, strings.Contains(buf.String(), "across a major version?"))
+		})
+	}
+}
+
+// queryErrDriver is a storage driver that fails to query releases.
+type queryErrDriver struct {
+	driver.Driver
+}
+
+func (d *queryErrDriver) Query(labels map[string]string) ([]*release.Release, error) {
+	return nil, errors.New("query failed")
+}
@@ -0,0 +1,101 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"os"
+	"strings"
+
+	"github.com/Masterminds/log-go"
+	"github.com/pkg/errors"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/internal/third-party/helm/resolver"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/eyecandy"
+
+	"helm.sh/helm/v3/pkg/downloader"
+)
+
+// VerifyPkgTree verifies the provenance of the charts of all the shared
+// dependencies in tr, with the keyring of the install options. The wanted
+// package is skipped, as it gets verified when located.
+//
+// Charts from repositories must have a valid provenance file. Local `file://`
+// charts are verified if they are archives with a provenance file next to
+// them, and skipped with a warning otherwise.
+//
+// It returns an error on the first chart that fails verification.
+func (i *Install) VerifyPkgTree(tr *solver.PkgTree, wantedPkg *pkg.Pkg,
+	settings *cli.EnvSettings, logger log.Logger) error {
+
+	for _, p := range flattenPkgTree(tr) {
+		if p.GetFingerPrint() == wantedPkg.GetFingerPrint() {
+			continue
+		}
+		if err := i.verifyPkg(p, settings, logger); err != nil {
+			return errors.Wrapf(err, "shared dependency %q v%s failed verification", p.ChartName, p.Version)
+		}
+	}
+	return nil
+}
+
+// verifyPkg verifies the provenance of the chart of package p.
+func (i *Install) verifyPkg(p *pkg.Pkg, settings *cli.EnvSettings, logger log.Logger) error {
+	if !strings.HasPrefix(p.Repository, "file://") {
+		cpo := i.ChartPathOptions
+		cpo.RepoURL = p.Repository
+		cpo.Version = p.Version
+		cpo.Verify = true
+		// Helm's downloader fetches the provenance file and verifies it:
+		if _, err := LocateChart(&cpo, p.ChartName, settings, logger); err != nil {
+			return err
+		}
+		logger.Debugf("Chart %q v%s verified\n", p.ChartName, p.Version)
+		return nil
+	}
+
+	localPath, err := resolver.GetLocalPath(p.Repository, p.ParentChartPath)
+	if err != nil {
+		return err
+	}
+	archive := ""
+	if isLocalRepo(localPath) {
+		if archive, err = localRepoChartPath(localPath, p.ChartName, p.Version); err != nil {
+			return err
+		}
+	} else if fi, err := os.Stat(localPath); err == nil && !fi.IsDir() {
+		archive = localPath
+	}
+	if archive == "" {
+		logger.Warn(eyecandy.ESPrintf(settings.NoEmojis,
+			":warning: Shared dependency %q is an unpackaged local chart, it can't be verified", p.ChartName))
+		return nil
+	}
+	if _, err := os.Stat(archive + ".prov"); err != nil {
+		logger.Warn(eyecandy.ESPrintf(settings.NoEmojis,
+			":warning: Shared dependency %q has no provenance file, it can't be verified", p.ChartName))
+		return nil
+	}
+
+	if _, err := downloader.VerifyChart(archive, i.ChartPathOptions.Keyring); err != nil {
+		return err
+	}
+	logger.Debugf("Chart %q v%s verified\n", p.ChartName, p.Version)
+	return nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"bytes"
+	"testing"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/stretchr/testify/assert"
+
+	pkg "github.com/rancher-sandbox/hypper/internal/package"
+	"github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+)
+
+func TestVerifyPkgTree(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		chart     string
+		version   string
+		repo      string
+		wantError string
+		wantWarn  string
+	}{
+		{
+			name:    "local archive with valid provenance",
+			chart:   "signtest",
+			version: "0.1.0",
+			repo:    "file://signed/signtest-0.1.0.tgz",
+		},
+		{
+			name:      "local archive with provenance of a different archive",
+			chart:     "signtest",
+			version:   "0.1.0",
+			repo:      "file://tampered/signtest-0.1.0.tgz",
+			wantError: "shared dependency \"signtest\" v0.1.0 failed verification: sha256 sum does not match",
+		},
+		{
+			name:     "local archive without provenance",
+			chart:    "compressedchart",
+			version:  "0.1.0",
+			repo:     "file://unsigned/compressedchart-0.1.0.tgz",
+			wantWarn: "Shared dependency \"compressedchart\" has no provenance file, it can't be verified",
+		},
+		{
+			name:     "unpackaged local chart",
+			chart:    "local-dep-empty",
+			version:  "0.1.0",
+			repo:     "file://../charts/dep-repo-local",
+			wantWarn: "Shared dependency \"local-dep-empty\" is an unpackaged local chart, it can't be verified",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+
+			settings := cli.New()
+			settings.NoEmojis = true
+
+			buf := new(bytes.Buffer)
+			logger := logcli.NewStandard()
+			logger.InfoOut = buf
+			logger.WarnOut = buf
+
+			client := NewInstall(actionConfigFixture(t))
+			client.ChartPathOptions.Keyring = "testdata/verify/helm-test-key.pub"
+
+			wantedPkg := pkg.NewPkg("wanted", "wanted", "1.0.0", "default",
+				pkg.Unknown, pkg.Present, pkg.Unknown, "", "testdata/verify")
+			depPkg := pkg.NewPkg(tcase.chart, tcase.chart, tcase.version, "default",
+				pkg.Unknown, pkg.Present, pkg.Unknown, tcase.repo, "testdata/verify")
+			tr := &solver.PkgTree{
+				Node:      wantedPkg,
+				Relations: []*solver.PkgTree{{Node: depPkg}},
+			}
+
+			err := client.VerifyPkgTree(tr, wantedPkg, settings, logger)
+			if tcase.wantError != "" {
+				is.Error(err)
+				is.Contains(err.Error(), tcase.wantError)
+			} else {
+				is.NoError(err)
+			}
+			is.Contains(buf.String(), tcase.wantWarn)
+		})
+	}
+}
@@ -21,6 +21,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/Masterminds/log-go"
@@ -29,7 +30,9 @@ import (
 
 	pkg "github.com/rancher-sandbox/hypper/internal/package"
 	solver "github.com/rancher-sandbox/hypper/internal/solver"
+	"github.com/rancher-sandbox/hypper/pkg/chart"
 	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"github.com/rancher-sandbox/hypper/pkg/policy"
 	"github.com/rancher-sandbox/hypper/pkg/repo"
 
 	helmChart "helm.sh/helm/v3/pkg/chart"
@@ -43,6 +46,7 @@ import (
 type chrtEntry struct {
 	chartVersions []*helmRepo.ChartVersion
 	url           string
+	repo          string
 }
 
 // BuildWorld adds all known charts to the package database:
@@ -51,6 +55,9 @@ type chrtEntry struct {
 //   to the DB for each version of the chart.
 // - For all releases and wanted packages, it adds a package or updates a
 //   present package in the DB.
+//
+// Charts denied by the policy at settings.PolicyFile are not added, and the
+// reasons are saved for addPolicyInconsistencies. Releases are always added.
 func (i *Install) BuildWorld(pkgdb *solver.PkgDB, repositories []*helmRepo.Entry,
 	releases []*release.Release,
 	toModify *pkg.Pkg, toModifyChart *helmChart.Chart,
@@ -58,27 +65,92 @@ func (i *Install) BuildWorld(pkgdb *solver.PkgDB, repositories []*helmRepo.Entry
 
 	logger.Debug("Building package DB…")
 
+	if i.policy, err = policy.Load(settings.PolicyFile); err != nil {
+		return err
+	}
+
 	// concatenate all index entries from all repositories:
+	repoEntries, err := loadRepoEntries(repositories, settings)
+	if err != nil {
+		return err
+	}
+
+	return i.buildWorldFromEntries(pkgdb, repoEntries, releases,
+		toModify, toModifyChart.Metadata.Annotations, settings, logger)
+}
+
+// loadRepoEntries concatenates the chart entries of the index files of all
+// passed repositories, obtained from the repository cache. If a chart is in
+// several repositories, the one with the highest priority in the configuration
+// is used, or the last one on equal priorities.
+func loadRepoEntries(repositories []*helmRepo.Entry,
+	settings *cli.EnvSettings) (map[string]chrtEntry, error) {
+
 	repoEntries := make(map[string]chrtEntry)
 	for _, r := range repositories {
 		idxFilepath := filepath.Join(settings.RepositoryCache, helmpath.CacheIndexFile(r.Name))
 		// obtain repo index file from cache:
 		index, err := repo.LoadIndexFile(idxFilepath)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		for chrtName, chrtVers := range index.Entries {
-			// TODO this overrides other repos, if charts are in both
+			prios := settings.Profile.RepositoryPriorities
+			if e, ok := repoEntries[chrtName]; ok && prios[e.repo] > prios[r.Name] {
+				continue
+			}
 			repoEntries[chrtName] = chrtEntry{
 				chartVersions: chrtVers,
 				url:           r.URL,
+				repo:          r.Name,
 			}
 		}
 	}
+	return repoEntries, nil
+}
+
+// buildWorldFromEntries fills the package database from already loaded repo
+// entries, releases, and the package to modify together with the annotations
+// of its chart.
+func (i *Install) buildWorldFromEntries(pkgdb *solver.PkgDB, repoEntries map[string]chrtEntry,
+	releases []*release.Release,
+	toModify *pkg.Pkg, toModifyAnnot map[string]string,
+	settings *cli.EnvSettings, logger log.Logger) (err error) {
 
 	// save ns from kube client, for performance reasons
 	settingsNS := settings.Namespace()
 
+	i.policyDenials = map[string]map[string]string{}
+	if reason := i.policy.Check(toModify.Repository, toModify.ChartName, toModify.Version, toModifyAnnot); reason != "" {
+		// explicitly wanted, no need to solve:
+		return errors.New(reason)
+	}
+
+	if err := i.addRepoEntriesToDB(pkgdb, repoEntries, settingsNS, settings, logger); err != nil {
+		return err
+	}
+	if err := i.addReleasesToDB(pkgdb, releases, repoEntries, settings, logger); err != nil {
+		return err
+	}
+
+	// calculate dep rels for toModify
+	// fill dep relations
+	if err := i.CreateDepRelsFromAnnot(toModify, toModifyAnnot, repoEntries,
+		pkgdb, settings, logger); err != nil {
+		return err
+	}
+
+	// add toModify to db
+	pkgdb.Add(toModify)
+
+	return nil
+}
+
+// addRepoEntriesToDB adds a package to the database for each version of the
+// charts in repoEntries, unless denied by the policy.
+func (i *Install) addRepoEntriesToDB(pkgdb *solver.PkgDB, repoEntries map[string]chrtEntry,
+	settingsNS string, settings *cli.EnvSettings, logger log.Logger) error {
+
 	// add repos to db
 	// for all chart entries in repos:
 	for chrtName, chrtVersions := range repoEntries {
@@ -89,8 +161,14 @@ func (i *Install) BuildWorld(pkgdb *solver.PkgDB, repositories []*helmRepo.Entry
 			ns := GetNamespaceFromAnnot(chrtVer.Annotations, settingsNS)
 			relName := GetNameFromAnnot(chrtVer.Annotations, chrtVer.Metadata.Name)
 			repo := chrtVersions.url
+			if reason := i.policy.Check(repo, chrtName, chrtVer.Version, chrtVer.Annotations); reason != "" {
+				logger.Debug(reason)
+				i.addPolicyDenial(chrtName, chrtVer.Version, reason)
+				continue
+			}
 			p := pkg.NewPkg(relName, chrtName, chrtVer.Version, ns,
 				pkg.Unknown, pkg.Unknown, pkg.Unknown, repo, "")
+			p.CRDOnly = chart.DeclaresCRDOnly(chrtVer.Annotations)
 
 			// fill dep relations
 			if err := i.CreateDepRelsFromAnnot(p, chrtVer.Annotations, repoEntries,
@@ -102,6 +180,13 @@ func (i *Install) BuildWorld(pkgdb *solver.PkgDB, repositories []*helmRepo.Entry
 			pkgdb.Add(p)
 		}
 	}
+	return nil
+}
+
+// addReleasesToDB marks the packages of the releases as present in the
+// database, adding them as stale packages if they are not in repoEntries.
+func (i *Install) addReleasesToDB(pkgdb *solver.PkgDB, releases []*release.Release,
+	repoEntries map[string]chrtEntry, settings *cli.EnvSettings, logger log.Logger) error {
 
 	// add releases to db
 	for _, r := range releases {
@@ -110,6 +195,7 @@ func (i *Install) BuildWorld(pkgdb *solver.PkgDB, repositories []*helmRepo.Entry
 		if p != nil {
 			// release is in repos, hence it was added to db. Modify directly:
 			p.CurrentState = pkg.Present
+			p.CRDOnly = p.CRDOnly || chart.IsCRDOnly(r.Chart)
 		} else {
 			// release is not in repos
 			// we don't know the repo where the release has originally been
@@ -117,6 +203,7 @@ func (i *Install) BuildWorld(pkgdb *solver.PkgDB, repositories []*helmRepo.Entry
 			// string
 			p := pkg.NewPkg(r.Name, r.Chart.Name(), r.Chart.Metadata.Version, r.Namespace,
 				pkg.Present, pkg.Unknown, pkg.Present, "", "")
+			p.CRDOnly = chart.IsCRDOnly(r.Chart)
 			// fill dep relations:
 			if err := i.CreateDepRelsFromAnnot(p, r.Chart.Metadata.Annotations, repoEntries,
 				pkgdb, settings, logger); err != nil {
@@ -125,18 +212,43 @@ func (i *Install) BuildWorld(pkgdb *solver.PkgDB, repositories []*helmRepo.Entry
 			pkgdb.Add(p)
 		}
 	}
+	return nil
+}
 
-	// calculate dep rels for toModify
-	// fill dep relations
-	if err := i.CreateDepRelsFromAnnot(toModify, toModifyChart.Metadata.Annotations, repoEntries,
-		pkgdb, settings, logger); err != nil {
-		return err
+// addPolicyDenial saves the reason why version of chart chrtName was denied by
+// the policy.
+func (i *Install) addPolicyDenial(chrtName, version, reason string) {
+	if i.policyDenials[chrtName] == nil {
+		i.policyDenials[chrtName] = map[string]string{}
 	}
+	i.policyDenials[chrtName][version] = reason
+}
 
-	// add toModify to db
-	pkgdb.Add(toModify)
+// addPolicyInconsistencies adds to the inconsistencies of an UNSAT solving the
+// reasons why charts that wantedPkg may depend on were denied by the policy.
+func (i *Install) addPolicyInconsistencies(s *solver.Solver, wantedPkg *pkg.Pkg) {
+	s.PkgResultSet.Inconsistencies = append(s.PkgResultSet.Inconsistencies,
+		i.closurePolicyDenials(s, s.DepClosure(wantedPkg))...)
+}
 
-	return nil
+// closurePolicyDenials returns, sorted, the reasons why the chart versions
+// that would satisfy the dependencies of the packages in closure were denied
+// by the policy.
+func (i *Install) closurePolicyDenials(s *solver.Solver, closure []*pkg.Pkg) []string {
+	reasons := []string{}
+	seen := map[string]bool{}
+	for _, p := range closure {
+		for _, deprel := range p.DependsRel {
+			for version, reason := range i.policyDenials[deprel.ChartName] {
+				if !seen[reason] && s.Satisfies(deprel, version) {
+					seen[reason] = true
+					reasons = append(reasons, reason)
+				}
+			}
+		}
+	}
+	sort.Strings(reasons)
+	return reasons
 }
 
 // CreateDepRelsFromAnnot fills the p.DepRel and p.DepOptionalRel of a package,
@@ -202,8 +314,14 @@ func (i *Install) CreateDepRelsFromAnnot(p *pkg.Pkg,
 
 					depP := pkg.NewPkg(depRelName, dep.Name, depChart.Metadata.Version, depNS,
 						pkg.Unknown, pkg.Unknown, pkg.Unknown, dep.Repository, p.ParentChartPath)
-
-					if strings.HasPrefix(dep.Repository, "file://") /* depP local */ {
+					depP.CRDOnly = chart.IsCRDOnly(depChart)
+
+					if reason := i.policy.Check(dep.Repository, dep.Name, depChart.Metadata.Version,
+						depChart.Metadata.Annotations); reason != "" {
+						// leave depP out of the DB, the relation will be unsatisfiable
+						logger.Debug(reason)
+						i.addPolicyDenial(dep.Name, depChart.Metadata.Version, reason)
+					} else if strings.HasPrefix(dep.Repository, "file://") /* depP local */ {
 						// if depP is local, it can depend on local charts too: check recursively,
 						// but break loops by not recurse into charts already processed.
 
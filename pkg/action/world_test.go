@@ -0,0 +1,86 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/helmpath"
+	helmRepo "helm.sh/helm/v3/pkg/repo"
+
+	"github.com/rancher-sandbox/hypper/internal/test/ensure"
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+)
+
+func TestLoadRepoEntriesPriorities(t *testing.T) {
+	cache := ensure.TempDir(t)
+	defer os.RemoveAll(cache)
+
+	repositories := []*helmRepo.Entry{}
+	for _, name := range []string{"ours", "theirs"} {
+		idx := helmRepo.NewIndexFile()
+		url := "http://example.com/" + name
+		if err := idx.MustAdd(&chart.Metadata{APIVersion: "v2", Name: "app", Version: "1.0.0"}, "app-1.0.0.tgz", url, ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := idx.WriteFile(filepath.Join(cache, helmpath.CacheIndexFile(name)), 0644); err != nil {
+			t.Fatal(err)
+		}
+		repositories = append(repositories, &helmRepo.Entry{Name: name, URL: url})
+	}
+
+	for _, tcase := range []struct {
+		name       string
+		priorities map[string]int
+		wantRepo   string
+	}{
+		{
+			name:     "last repository without priorities",
+			wantRepo: "theirs",
+		},
+		{
+			name:       "repository with the highest priority",
+			priorities: map[string]int{"ours": 10},
+			wantRepo:   "ours",
+		},
+		{
+			name:       "last repository on equal priorities",
+			priorities: map[string]int{"ours": 10, "theirs": 10},
+			wantRepo:   "theirs",
+		},
+		{
+			name:       "repository with negative priority",
+			priorities: map[string]int{"theirs": -1},
+			wantRepo:   "ours",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			settings := cli.New()
+			settings.RepositoryCache = cache
+			settings.Profile.RepositoryPriorities = tcase.priorities
+
+			entries, err := loadRepoEntries(repositories, settings)
+			assert.NoError(t, err)
+			assert.Equal(t, tcase.wantRepo, entries["app"].repo)
+			assert.Equal(t, "http://example.com/"+tcase.wantRepo, entries["app"].url)
+		})
+	}
+}
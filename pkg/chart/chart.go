@@ -14,6 +14,10 @@
 package chart
 
 import (
+	"path"
+	"regexp"
+	"strings"
+
 	"github.com/Masterminds/log-go"
 	"github.com/mitchellh/hashstructure/v2"
 	"gopkg.in/yaml.v2"
@@ -68,6 +72,63 @@ func GetSharedDeps(c *helmChart.Chart, logger log.Logger) ([]*Dependency, error)
 	return sharedDeps, nil
 }
 
+// kindRegexp matches the kind of the objects in a template.
+var kindRegexp = regexp.MustCompile(`(?m)^kind:\s*["']?(\w+)`)
+
+// IsCRDOnly returns true if chart c only contains CRDs: either because its
+// hypper.cattle.io/crd-only annotation says so, or because ContainsOnlyCRDs
+// detects it.
+func IsCRDOnly(c *helmChart.Chart) bool {
+	if _, ok := c.Metadata.Annotations["hypper.cattle.io/crd-only"]; ok {
+		return DeclaresCRDOnly(c.Metadata.Annotations)
+	}
+	return ContainsOnlyCRDs(c)
+}
+
+// DeclaresCRDOnly returns true if the chart annotations annot declare that the
+// chart only contains CRDs. Useful when only the chart metadata is at hand,
+// as in repository indexes.
+func DeclaresCRDOnly(annot map[string]string) bool {
+	return annot["hypper.cattle.io/crd-only"] == "true"
+}
+
+// ContainsOnlyCRDs returns true if chart c, and its subcharts, contain CRDs in
+// their crds/ directory or templates, and no other objects. Templates whose
+// kinds can't be told are taken as other objects.
+func ContainsOnlyCRDs(c *helmChart.Chart) bool {
+	hasCRDs := len(c.CRDObjects()) > 0
+	for _, t := range c.Templates {
+		name := path.Base(t.Name)
+		if strings.HasPrefix(name, "_") || name == "NOTES.txt" {
+			// partials and notes don't create objects
+			continue
+		}
+		kinds := kindRegexp.FindAllSubmatch(t.Data, -1)
+		if len(kinds) == 0 {
+			if len(strings.TrimSpace(string(t.Data))) == 0 {
+				continue
+			}
+			return false
+		}
+		for _, kind := range kinds {
+			if string(kind[1]) != "CustomResourceDefinition" {
+				return false
+			}
+		}
+		hasCRDs = true
+	}
+	for _, dep := range c.Dependencies() {
+		if len(dep.Templates) == 0 && len(dep.CRDObjects()) == 0 {
+			continue
+		}
+		if !ContainsOnlyCRDs(dep) {
+			return false
+		}
+		hasCRDs = true
+	}
+	return hasCRDs
+}
+
 func Hash(c *helmChart.Chart) uint64 {
 	hash, err := hashstructure.Hash(c, hashstructure.FormatV2, nil)
 	if err != nil {
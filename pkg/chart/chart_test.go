@@ -144,3 +144,82 @@ func TestGetSharedDeps(t *testing.T) {
 		is.Equal(tcase.depsNumber, len(deps))
 	}
 }
+
+func TestIsCRDOnly(t *testing.T) {
+	crd := []byte("apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: foos.example.com\n")
+	deployment := []byte("apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: {{ .Release.Name }}\n")
+
+	newChart := func(annot map[string]string, crds, templates map[string][]byte) *helmChart.Chart {
+		c := Mock(&MockChartOptions{Name: "chartname", Version: "0.1.0"})
+		c.Metadata.Annotations = annot
+		c.Templates = []*helmChart.File{}
+		for name, data := range templates {
+			c.Templates = append(c.Templates, &helmChart.File{Name: name, Data: data})
+		}
+		for name, data := range crds {
+			c.Files = append(c.Files, &helmChart.File{Name: name, Data: data})
+		}
+		return c
+	}
+
+	withSubchart := newChart(nil, map[string][]byte{"crds/foo.yaml": crd}, nil)
+	withSubchart.AddDependency(newChart(nil, nil, map[string][]byte{"templates/deployment.yaml": deployment}))
+
+	for _, tcase := range []struct {
+		name  string
+		chart *helmChart.Chart
+		want  bool
+	}{
+		{
+			name:  "crds directory only",
+			chart: newChart(nil, map[string][]byte{"crds/foo.yaml": crd}, nil),
+			want:  true,
+		},
+		{
+			name: "crd templates, helpers and notes",
+			chart: newChart(nil, nil, map[string][]byte{
+				"templates/foo.yaml":     crd,
+				"templates/_helpers.tpl": []byte("{{- define \"name\" -}}foo{{- end -}}"),
+				"templates/NOTES.txt":    []byte("Installed"),
+			}),
+			want: true,
+		},
+		{
+			name: "crds and a deployment",
+			chart: newChart(nil, map[string][]byte{"crds/foo.yaml": crd},
+				map[string][]byte{"templates/deployment.yaml": deployment}),
+			want: false,
+		},
+		{
+			name:  "template without kind",
+			chart: newChart(nil, nil, map[string][]byte{"templates/foo.yaml": []byte("{{ .Values.manifest }}")}),
+			want:  false,
+		},
+		{
+			name:  "subchart with a deployment",
+			chart: withSubchart,
+			want:  false,
+		},
+		{
+			name:  "no objects",
+			chart: newChart(nil, nil, nil),
+			want:  false,
+		},
+		{
+			name: "declared by annotation",
+			chart: newChart(map[string]string{"hypper.cattle.io/crd-only": "true"}, nil,
+				map[string][]byte{"templates/deployment.yaml": deployment}),
+			want: true,
+		},
+		{
+			name: "declared not crd-only by annotation",
+			chart: newChart(map[string]string{"hypper.cattle.io/crd-only": "false"},
+				map[string][]byte{"crds/foo.yaml": crd}, nil),
+			want: false,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			assert.Equal(t, tcase.want, IsCRDOnly(tcase.chart))
+		})
+	}
+}
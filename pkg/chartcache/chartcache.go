@@ -0,0 +1,260 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*Package chartcache implements a local cache of chart archives downloaded from
+chart repositories.
+
+The cache is content-addressed: each archive is stored under a key derived from
+the repository URL, chart name, chart version and the digest of the archive as
+published in the repository index. Archives are verified against that digest
+when stored and when retrieved.
+*/
+package chartcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+// ErrDigestMismatch indicates that a chart archive doesn't match the digest
+// published in the repository index.
+var ErrDigestMismatch = errors.New("chart archive doesn't match the digest of the repository index")
+
+// Cache is a local cache of chart archives.
+type Cache struct {
+	// Dir is the directory where the chart archives are stored.
+	Dir string
+	// MaxSize is the maximum size in bytes of the cache. When surpassed, the
+	// least recently used archives are removed. 0 means no limit.
+	MaxSize int64
+}
+
+// entry is a chart archive stored in the cache.
+type entry struct {
+	dir     string
+	size    int64
+	modTime time.Time
+}
+
+// New creates a new Cache object.
+func New(dir string, maxSize int64) *Cache {
+	return &Cache{
+		Dir:     dir,
+		MaxSize: maxSize,
+	}
+}
+
+// Key returns the key under which the chart archive is stored.
+func Key(repoURL, name, version, digest string) string {
+	h := sha256.New()
+	// separate the fields, to avoid ambiguous concatenations:
+	fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s",
+		strings.TrimSuffix(repoURL, "/"), name, version, normalizeDigest(digest))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Get returns the path of the cached chart archive, and true if it is present
+// and matches the digest.
+//
+// Archives that don't match the digest are removed from the cache.
+func (c *Cache) Get(repoURL, name, version, digest string) (string, bool) {
+	key := Key(repoURL, name, version, digest)
+	p := c.archivePath(key, name, version)
+	if _, err := os.Stat(p); err != nil {
+		return "", false
+	}
+	if err := verify(p, digest); err != nil {
+		os.RemoveAll(filepath.Join(c.Dir, key))
+		return "", false
+	}
+	// mark as recently used:
+	now := time.Now()
+	_ = os.Chtimes(p, now, now)
+	return p, true
+}
+
+// Put verifies the chart archive at src against digest, and stores a copy of it
+// into the cache. It returns the path of the cached archive.
+//
+// If the cache surpasses its maximum size, the least recently used archives
+// are removed.
+func (c *Cache) Put(src, repoURL, name, version, digest string) (string, error) {
+	if err := verify(src, digest); err != nil {
+		return "", errors.Wrapf(err, "chart %q version %q from %q", name, version, repoURL)
+	}
+
+	key := Key(repoURL, name, version, digest)
+	entryDir := filepath.Join(c.Dir, key)
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return "", err
+	}
+
+	// write to a temp file and rename, so concurrent readers never see a
+	// partial archive:
+	tmp, err := ioutil.TempFile(entryDir, ".tmp-")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	in, err := os.Open(src)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	_, err = io.Copy(tmp, in)
+	in.Close()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", err
+	}
+	p := c.archivePath(key, name, version)
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		return "", err
+	}
+
+	if err := c.Prune(key); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+// Prune removes the least recently used archives until the cache doesn't
+// surpass its maximum size. The archive stored under keep is never removed.
+func (c *Cache) Prune(keep string) error {
+	if c.MaxSize <= 0 {
+		return nil
+	}
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, e := range entries {
+		size += e.size
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].modTime.Before(entries[j].modTime)
+	})
+	for _, e := range entries {
+		if size <= c.MaxSize {
+			break
+		}
+		if filepath.Base(e.dir) == keep {
+			continue
+		}
+		if err := os.RemoveAll(e.dir); err != nil {
+			return err
+		}
+		size -= e.size
+	}
+	return nil
+}
+
+// Size returns the number of archives in the cache, and their total size in
+// bytes.
+func (c *Cache) Size() (int, int64, error) {
+	entries, err := c.entries()
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	for _, e := range entries {
+		size += e.size
+	}
+	return len(entries), size, nil
+}
+
+// Clean removes all the archives from the cache. It returns the number of
+// removed archives and their total size in bytes.
+func (c *Cache) Clean() (int, int64, error) {
+	num, size, err := c.Size()
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := os.RemoveAll(c.Dir); err != nil {
+		return 0, 0, err
+	}
+	return num, size, nil
+}
+
+func (c *Cache) archivePath(key, name, version string) string {
+	return filepath.Join(c.Dir, key, fmt.Sprintf("%s-%s.tgz", name, version))
+}
+
+// entries returns the archives stored in the cache. A missing cache directory
+// is an empty cache.
+func (c *Cache) entries() ([]*entry, error) {
+	dirs, err := ioutil.ReadDir(c.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	entries := []*entry{}
+	for _, d := range dirs {
+		if !d.IsDir() {
+			continue
+		}
+		files, err := ioutil.ReadDir(filepath.Join(c.Dir, d.Name()))
+		if err != nil {
+			return nil, err
+		}
+		e := &entry{dir: filepath.Join(c.Dir, d.Name())}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasSuffix(f.Name(), ".tgz") {
+				continue
+			}
+			e.size += f.Size()
+			if f.ModTime().After(e.modTime) {
+				e.modTime = f.ModTime()
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// verify checks that the file at path matches digest.
+func verify(path, digest string) error {
+	got, err := provenance.DigestFile(path)
+	if err != nil {
+		return err
+	}
+	if got != normalizeDigest(digest) {
+		return ErrDigestMismatch
+	}
+	return nil
+}
+
+// normalizeDigest removes the optional algorithm prefix of digest, as only
+// sha256 is used by chart repositories.
+func normalizeDigest(digest string) string {
+	return strings.TrimPrefix(digest, "sha256:")
+}
@@ -0,0 +1,133 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package chartcache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"helm.sh/helm/v3/pkg/provenance"
+)
+
+const repoURL = "https://example.com/charts"
+
+// writeArchive writes a fake chart archive of size bytes, returning its path
+// and digest.
+func writeArchive(t *testing.T, dir, name string, size int) (string, string) {
+	t.Helper()
+	p := filepath.Join(dir, name)
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(len(name) + i)
+	}
+	if err := ioutil.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest, err := provenance.DigestFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, digest
+}
+
+func TestPutAndGet(t *testing.T) {
+	is := assert.New(t)
+	srcDir := t.TempDir()
+	c := New(filepath.Join(t.TempDir(), "charts"), 0)
+
+	src, digest := writeArchive(t, srcDir, "foo-1.0.0.tgz", 10)
+
+	_, ok := c.Get(repoURL, "foo", "1.0.0", digest)
+	is.False(ok, "empty cache")
+
+	cached, err := c.Put(src, repoURL, "foo", "1.0.0", digest)
+	is.NoError(err)
+	is.Equal("foo-1.0.0.tgz", filepath.Base(cached))
+
+	got, ok := c.Get(repoURL+"/", "foo", "1.0.0", "sha256:"+digest)
+	is.True(ok, "trailing slash in repo URL and digest prefix are ignored")
+	is.Equal(cached, got)
+
+	_, ok = c.Get("https://example.com/other", "foo", "1.0.0", digest)
+	is.False(ok, "different repo")
+
+	// a corrupted archive is a miss, and gets removed:
+	is.NoError(ioutil.WriteFile(cached, []byte("corrupted"), 0644))
+	_, ok = c.Get(repoURL, "foo", "1.0.0", digest)
+	is.False(ok)
+	_, err = os.Stat(cached)
+	is.True(os.IsNotExist(err))
+}
+
+func TestPutDigestMismatch(t *testing.T) {
+	is := assert.New(t)
+	srcDir := t.TempDir()
+	c := New(filepath.Join(t.TempDir(), "charts"), 0)
+
+	src, _ := writeArchive(t, srcDir, "foo-1.0.0.tgz", 10)
+	_, err := c.Put(src, repoURL, "foo", "1.0.0", "0123456789abcdef")
+	is.Error(err)
+	is.ErrorIs(err, ErrDigestMismatch)
+
+	num, _, err := c.Size()
+	is.NoError(err)
+	is.Equal(0, num)
+}
+
+func TestPruneAndClean(t *testing.T) {
+	is := assert.New(t)
+	srcDir := t.TempDir()
+	c := New(filepath.Join(t.TempDir(), "charts"), 250)
+
+	old, oldDigest := writeArchive(t, srcDir, "old-1.0.0.tgz", 100)
+	recent, recentDigest := writeArchive(t, srcDir, "recent-1.0.0.tgz", 100)
+	newer, newerDigest := writeArchive(t, srcDir, "newer-1.0.0.tgz", 100)
+
+	oldCached, err := c.Put(old, repoURL, "old", "1.0.0", oldDigest)
+	is.NoError(err)
+	recentCached, err := c.Put(recent, repoURL, "recent", "1.0.0", recentDigest)
+	is.NoError(err)
+	// make the usage order deterministic:
+	past := time.Now().Add(-time.Hour)
+	is.NoError(os.Chtimes(oldCached, past, past))
+	is.NoError(os.Chtimes(recentCached, past.Add(time.Minute), past.Add(time.Minute)))
+
+	// getting it makes it the most recently used:
+	_, ok := c.Get(repoURL, "old", "1.0.0", oldDigest)
+	is.True(ok)
+
+	// surpasses the max size, the least recently used gets removed:
+	_, err = c.Put(newer, repoURL, "newer", "1.0.0", newerDigest)
+	is.NoError(err)
+	_, ok = c.Get(repoURL, "recent", "1.0.0", recentDigest)
+	is.False(ok)
+	_, ok = c.Get(repoURL, "old", "1.0.0", oldDigest)
+	is.True(ok)
+
+	num, size, err := c.Clean()
+	is.NoError(err)
+	is.Equal(2, num)
+	is.Equal(int64(200), size)
+
+	num, _, err = c.Size()
+	is.NoError(err)
+	is.Equal(0, num)
+}
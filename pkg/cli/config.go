@@ -0,0 +1,335 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// repositoryPrioritiesKey is the prefix of the keys of the repository
+// priorities, e.g: repositoryPriorities.stable
+const repositoryPrioritiesKey = "repositoryPriorities"
+
+// ConfigKeys are the keys of the settings of a Profile, as used by 'hypper
+// config'.
+var ConfigKeys = []string{
+	"optionalDeps",
+	"noColors",
+	"noEmojis",
+	"timeout",
+	"solverTimeout",
+	"allowCRDMajorUpgrade",
+	repositoryPrioritiesKey + ".<repo>",
+}
+
+// optionalDepsModes are the valid values of the optionalDeps setting, as for
+// '--optional-deps'.
+var optionalDepsModes = []string{"ask", "all", "none", "best-effort"}
+
+// Config is the persistent configuration of hypper, read from config.yaml in
+// the configuration directory. Its top-level settings are the defaults for all
+// kube contexts, and Contexts has the profiles that override them for the kube
+// context of the same name:
+//
+//	optionalDeps: best-effort
+//	noEmojis: true
+//	contexts:
+//	  production:
+//	    optionalDeps: none
+//	    timeout: 10m
+//
+// Flags and env vars take precedence over the configuration.
+type Config struct {
+	Profile
+	Contexts map[string]*Profile `json:"contexts,omitempty"`
+}
+
+// Profile is a set of default settings. Unset settings are left to their
+// defaults.
+type Profile struct {
+	// OptionalDeps is the default of '--optional-deps' for install and
+	// upgrade.
+	OptionalDeps string `json:"optionalDeps,omitempty"`
+	// NoColors is the default of '--no-colors'.
+	NoColors *bool `json:"noColors,omitempty"`
+	// NoEmojis is the default of '--no-emojis'.
+	NoEmojis *bool `json:"noEmojis,omitempty"`
+	// Timeout is the default of '--timeout' for install and upgrade, e.g: 5m.
+	Timeout string `json:"timeout,omitempty"`
+	// SolverTimeout is the default of '--solver-timeout', e.g: 30s.
+	SolverTimeout string `json:"solverTimeout,omitempty"`
+	// AllowCRDMajorUpgrade is the default of '--allow-crd-major-upgrade' for
+	// upgrade.
+	AllowCRDMajorUpgrade *bool `json:"allowCRDMajorUpgrade,omitempty"`
+	// RepositoryPriorities are the priorities of the repositories, by name.
+	// When a chart is in several repositories, the one with the highest
+	// priority is used. Repositories have priority 0 by default.
+	RepositoryPriorities map[string]int `json:"repositoryPriorities,omitempty"`
+}
+
+// LoadConfig reads the configuration in path. A missing file is an empty
+// configuration.
+func LoadConfig(path string) (*Config, error) {
+	c := &Config{}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return c, nil
+		}
+		return nil, err
+	}
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return nil, errors.Wrapf(err, "config file (%s) is malformed", path)
+	}
+	for _, p := range append([]*Profile{&c.Profile}, c.profiles()...) {
+		for _, k := range p.Keys() {
+			v, _ := p.Get(k)
+			if err := (&Profile{}).Set(k, v); err != nil {
+				return nil, errors.Wrapf(err, "config file (%s) is invalid", path)
+			}
+		}
+	}
+	return c, nil
+}
+
+// WriteFile writes the configuration to path, creating its directory if
+// needed.
+func (c *Config) WriteFile(path string) error {
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0644)
+}
+
+// ProfileFor returns the settings for kubeContext: the ones of its profile,
+// and the defaults for the rest.
+func (c *Config) ProfileFor(kubeContext string) Profile {
+	result := Profile{}
+	for _, p := range []*Profile{&c.Profile, c.Contexts[kubeContext]} {
+		if p == nil {
+			continue
+		}
+		for _, k := range p.Keys() {
+			v, _ := p.Get(k)
+			// valid, as it was validated when loading:
+			_ = result.Set(k, v)
+		}
+	}
+	return result
+}
+
+// ContextProfile returns the profile of kubeContext, creating it if missing.
+// An empty kubeContext returns the defaults.
+func (c *Config) ContextProfile(kubeContext string) *Profile {
+	if kubeContext == "" {
+		return &c.Profile
+	}
+	if c.Contexts == nil {
+		c.Contexts = map[string]*Profile{}
+	}
+	if c.Contexts[kubeContext] == nil {
+		c.Contexts[kubeContext] = &Profile{}
+	}
+	return c.Contexts[kubeContext]
+}
+
+// profiles returns the profiles of the kube contexts, sorted by context.
+func (c *Config) profiles() []*Profile {
+	names := []string{}
+	for name := range c.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	profiles := []*Profile{}
+	for _, name := range names {
+		if c.Contexts[name] != nil {
+			profiles = append(profiles, c.Contexts[name])
+		}
+	}
+	return profiles
+}
+
+// Keys returns the keys of the settings that are set in the profile, in the
+// order of ConfigKeys.
+func (p *Profile) Keys() []string {
+	keys := []string{}
+	if p.OptionalDeps != "" {
+		keys = append(keys, "optionalDeps")
+	}
+	if p.NoColors != nil {
+		keys = append(keys, "noColors")
+	}
+	if p.NoEmojis != nil {
+		keys = append(keys, "noEmojis")
+	}
+	if p.Timeout != "" {
+		keys = append(keys, "timeout")
+	}
+	if p.SolverTimeout != "" {
+		keys = append(keys, "solverTimeout")
+	}
+	if p.AllowCRDMajorUpgrade != nil {
+		keys = append(keys, "allowCRDMajorUpgrade")
+	}
+	repos := []string{}
+	for repo := range p.RepositoryPriorities {
+		repos = append(repos, repo)
+	}
+	sort.Strings(repos)
+	for _, repo := range repos {
+		keys = append(keys, repositoryPrioritiesKey+"."+repo)
+	}
+	return keys
+}
+
+// Get returns the value of the setting key, or an empty string if it isn't
+// set.
+func (p *Profile) Get(key string) (string, error) {
+	if repo, ok := repositoryOfKey(key); ok {
+		prio, ok := p.RepositoryPriorities[repo]
+		if !ok {
+			return "", nil
+		}
+		return strconv.Itoa(prio), nil
+	}
+
+	switch key {
+	case "optionalDeps":
+		return p.OptionalDeps, nil
+	case "noColors":
+		return formatBool(p.NoColors), nil
+	case "noEmojis":
+		return formatBool(p.NoEmojis), nil
+	case "timeout":
+		return p.Timeout, nil
+	case "solverTimeout":
+		return p.SolverTimeout, nil
+	case "allowCRDMajorUpgrade":
+		return formatBool(p.AllowCRDMajorUpgrade), nil
+	}
+	return "", unknownKeyError(key)
+}
+
+// Set sets the setting key to value, after validating it. An empty value
+// unsets the setting.
+func (p *Profile) Set(key, value string) error {
+	if repo, ok := repositoryOfKey(key); ok {
+		if value == "" {
+			delete(p.RepositoryPriorities, repo)
+			if len(p.RepositoryPriorities) == 0 {
+				p.RepositoryPriorities = nil
+			}
+			return nil
+		}
+		prio, err := strconv.Atoi(value)
+		if err != nil {
+			return errors.Errorf("invalid value %q for %q: not an integer", value, key)
+		}
+		if p.RepositoryPriorities == nil {
+			p.RepositoryPriorities = map[string]int{}
+		}
+		p.RepositoryPriorities[repo] = prio
+		return nil
+	}
+
+	switch key {
+	case "optionalDeps":
+		if value != "" && !contains(optionalDepsModes, value) {
+			return errors.Errorf("invalid value %q for %q: must be one of %s",
+				value, key, strings.Join(optionalDepsModes, ", "))
+		}
+		p.OptionalDeps = value
+	case "noColors":
+		return setBool(&p.NoColors, key, value)
+	case "noEmojis":
+		return setBool(&p.NoEmojis, key, value)
+	case "timeout":
+		return setDuration(&p.Timeout, key, value)
+	case "solverTimeout":
+		return setDuration(&p.SolverTimeout, key, value)
+	case "allowCRDMajorUpgrade":
+		return setBool(&p.AllowCRDMajorUpgrade, key, value)
+	default:
+		return unknownKeyError(key)
+	}
+	return nil
+}
+
+func repositoryOfKey(key string) (string, bool) {
+	prefix := repositoryPrioritiesKey + "."
+	if !strings.HasPrefix(key, prefix) || key == prefix {
+		return "", false
+	}
+	return strings.TrimPrefix(key, prefix), true
+}
+
+func unknownKeyError(key string) error {
+	return errors.Errorf("unknown config key %q, must be one of %s", key, strings.Join(ConfigKeys, ", "))
+}
+
+func formatBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return fmt.Sprint(*b)
+}
+
+func setBool(b **bool, key, value string) error {
+	if value == "" {
+		*b = nil
+		return nil
+	}
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return errors.Errorf("invalid value %q for %q: not a boolean", value, key)
+	}
+	*b = &v
+	return nil
+}
+
+func setDuration(d *string, key, value string) error {
+	if value != "" {
+		if _, err := time.ParseDuration(value); err != nil {
+			return errors.Errorf("invalid value %q for %q: not a duration, e.g: 5m", value, key)
+		}
+	}
+	*d = value
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,265 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfig(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		path      string
+		context   string
+		want      map[string]string
+		wantError string
+	}{
+		{
+			name: "missing file",
+			path: "testdata/non-existent.yaml",
+			want: map[string]string{},
+		},
+		{
+			name: "defaults",
+			path: "testdata/config.yaml",
+			want: map[string]string{
+				"optionalDeps":              "best-effort",
+				"noEmojis":                  "true",
+				"solverTimeout":             "30s",
+				"repositoryPriorities.ours": "10",
+			},
+		},
+		{
+			name:    "profile of a kube context",
+			path:    "testdata/config.yaml",
+			context: "production",
+			want: map[string]string{
+				"optionalDeps":                "none",
+				"noEmojis":                    "true",
+				"timeout":                     "10m",
+				"solverTimeout":               "1m",
+				"repositoryPriorities.ours":   "10",
+				"repositoryPriorities.theirs": "20",
+			},
+		},
+		{
+			name:      "malformed file",
+			path:      "testdata/config-malformed.yaml",
+			wantError: "config file (testdata/config-malformed.yaml) is malformed",
+		},
+		{
+			name:      "invalid setting",
+			path:      "testdata/config-invalid.yaml",
+			wantError: "config file (testdata/config-invalid.yaml) is invalid: invalid value \"sometimes\" for \"optionalDeps\": must be one of ask, all, none, best-effort",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			c, err := LoadConfig(tcase.path)
+			if tcase.wantError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tcase.wantError)
+				return
+			}
+			assert.NoError(t, err)
+
+			p := c.ProfileFor(tcase.context)
+			got := map[string]string{}
+			for _, k := range p.Keys() {
+				got[k], _ = p.Get(k)
+			}
+			assert.Equal(t, tcase.want, got)
+		})
+	}
+}
+
+func TestProfileFor(t *testing.T) {
+	c, err := LoadConfig("testdata/config.yaml")
+	assert.NoError(t, err)
+
+	p := c.ProfileFor("production")
+	assert.NoError(t, p.Set("repositoryPriorities.ours", "1"))
+	assert.Equal(t, 10, c.RepositoryPriorities["ours"], "the defaults must not be modified")
+}
+
+func TestProfileSet(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		key       string
+		value     string
+		want      string
+		wantError string
+	}{
+		{name: "optional deps", key: "optionalDeps", value: "all", want: "all"},
+		{name: "bool", key: "noColors", value: "true", want: "true"},
+		{name: "duration", key: "timeout", value: "2m", want: "2m"},
+		{name: "repository priority", key: "repositoryPriorities.stable", value: "-5", want: "-5"},
+		{name: "unset", key: "noEmojis", value: "", want: ""},
+		{
+			name:      "invalid optional deps",
+			key:       "optionalDeps",
+			value:     "sometimes",
+			wantError: "invalid value \"sometimes\" for \"optionalDeps\": must be one of ask, all, none, best-effort",
+		},
+		{
+			name:      "invalid bool",
+			key:       "allowCRDMajorUpgrade",
+			value:     "maybe",
+			wantError: "invalid value \"maybe\" for \"allowCRDMajorUpgrade\": not a boolean",
+		},
+		{
+			name:      "invalid duration",
+			key:       "solverTimeout",
+			value:     "soon",
+			wantError: "invalid value \"soon\" for \"solverTimeout\": not a duration, e.g: 5m",
+		},
+		{
+			name:      "invalid repository priority",
+			key:       "repositoryPriorities.stable",
+			value:     "high",
+			wantError: "invalid value \"high\" for \"repositoryPriorities.stable\": not an integer",
+		},
+		{
+			name:      "unknown key",
+			key:       "colors",
+			value:     "true",
+			wantError: "unknown config key \"colors\"",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			p := &Profile{NoEmojis: new(bool)}
+			err := p.Set(tcase.key, tcase.value)
+			if tcase.wantError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tcase.wantError)
+				return
+			}
+			assert.NoError(t, err)
+			got, err := p.Get(tcase.key)
+			assert.NoError(t, err)
+			assert.Equal(t, tcase.want, got)
+		})
+	}
+}
+
+func TestConfigWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hypper-config")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "hypper", "config.yaml")
+
+	c := &Config{}
+	assert.NoError(t, c.ContextProfile("").Set("optionalDeps", "none"))
+	assert.NoError(t, c.ContextProfile("staging").Set("noColors", "true"))
+	assert.NoError(t, c.WriteFile(path))
+
+	got, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, c, got)
+}
+
+func TestEnvSettingsLoadConfig(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		envvars       map[string]string
+		noEmojis      bool
+		solverTimeout time.Duration
+	}{
+		{
+			name:          "config",
+			noEmojis:      true,
+			solverTimeout: 30 * time.Second,
+		},
+		{
+			name:          "env over config",
+			envvars:       map[string]string{"HYPPER_NOEMOJIS": "false", "HYPPER_SOLVER_TIMEOUT": "1m"},
+			noEmojis:      false,
+			solverTimeout: time.Minute,
+		},
+		{
+			name:          "flag over env and config",
+			args:          []string{"--solver-timeout=10s"},
+			envvars:       map[string]string{"HYPPER_SOLVER_TIMEOUT": "1m"},
+			noEmojis:      true,
+			solverTimeout: 10 * time.Second,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer resetEnv()()
+
+			os.Setenv("HYPPER_CONFIG", "testdata/config.yaml")
+			for k, v := range tt.envvars {
+				os.Setenv(k, v)
+			}
+
+			flags := pflag.NewFlagSet("testing", pflag.ContinueOnError)
+			settings := New()
+			settings.AddFlags(flags)
+			assert.NoError(t, flags.Parse(tt.args))
+			assert.NoError(t, settings.LoadConfig(flags))
+
+			assert.Equal(t, tt.noEmojis, settings.NoEmojis)
+			assert.Equal(t, tt.solverTimeout, settings.SolverTimeout)
+		})
+	}
+}
+
+func TestEnvSettingsForKubeContext(t *testing.T) {
+	defer resetEnv()()
+	os.Setenv("HYPPER_CONFIG", "testdata/config.yaml")
+
+	flags := pflag.NewFlagSet("testing", pflag.ContinueOnError)
+	settings := New()
+	settings.AddFlags(flags)
+	assert.NoError(t, flags.Parse([]string{"--kube-context=staging", "--kubeconfig=/tmp/kubeconfig"}))
+	settings.FillHelmSettings()
+	assert.NoError(t, settings.LoadConfig(flags))
+
+	c := settings.ForKubeContext("production", "")
+	assert.Equal(t, "production", c.KubeContext)
+	assert.Equal(t, "production", c.EnvSettings.KubeContext)
+	assert.Equal(t, "production", c.CurrentKubeContext())
+	assert.Equal(t, "/tmp/kubeconfig", c.KubeConfig)
+	assert.Equal(t, map[string]int{"ours": 10, "theirs": 20}, c.Profile.RepositoryPriorities)
+	assert.True(t, c.NoEmojis)
+	assert.Equal(t, time.Minute, c.SolverTimeout)
+
+	assert.Equal(t, "staging", settings.KubeContext)
+	assert.Equal(t, "staging", settings.EnvSettings.KubeContext)
+	assert.Equal(t, map[string]int{"ours": 10}, settings.Profile.RepositoryPriorities)
+
+	assert.Equal(t, 30*time.Second, settings.SolverTimeout)
+
+	c = settings.ForKubeContext("production", "/tmp/other")
+	assert.Equal(t, "/tmp/other", c.KubeConfig)
+	assert.Equal(t, "/tmp/kubeconfig", settings.KubeConfig)
+
+	// a solver timeout passed is kept:
+	assert.NoError(t, flags.Parse([]string{"--solver-timeout=10s"}))
+	assert.NoError(t, settings.LoadConfig(flags))
+	c = settings.ForKubeContext("production", "")
+	assert.Equal(t, 10*time.Second, c.SolverTimeout)
+}
@@ -27,6 +27,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rancher-sandbox/hypper/pkg/hypperpath"
 	"github.com/spf13/pflag"
@@ -38,6 +39,15 @@ import (
 // defaultMaxHistory sets the maximum number of releases to 0: unlimited
 const defaultMaxHistory = 10
 
+// defaultChartCacheMaxSize sets the maximum size of the chart cache, in MiB
+const defaultChartCacheMaxSize = 512
+
+// The formats of the output set with '--log-format'.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
 // EnvSettings describes all of the environment settings.
 // It contains a pointer to Helm settings for functions that need that exact type
 // We overwrite all of the helm settings values with our own on New so it contains the same
@@ -47,6 +57,9 @@ type EnvSettings struct {
 
 	namespace string
 	config    *genericclioptions.ConfigFlags
+	// solverTimeoutFromProfile is set when SolverTimeout isn't passed with
+	// a flag or env var, and so it's taken from the profile.
+	solverTimeoutFromProfile bool
 
 	// KubeConfig is the path to the kubeconfig file
 	KubeConfig string
@@ -80,6 +93,28 @@ type EnvSettings struct {
 	NoColors          bool
 	NoEmojis          bool
 	NamespaceFromFlag bool
+	// ChartCache is the path to the cache directory of downloaded charts.
+	ChartCache string
+	// ChartCacheMaxSize is the max size of the chart cache in MiB, 0 means no
+	// limit.
+	ChartCacheMaxSize int
+	// PolicyFile is the path to the file with the allow and deny rules for
+	// charts.
+	PolicyFile string
+	// DeclinedOptionalDepsFile is the path to the file recording the optional
+	// shared dependencies that the user declined to install.
+	DeclinedOptionalDepsFile string
+	// SolverTimeout bounds the time spent solving dependencies, 0 means no
+	// limit.
+	SolverTimeout time.Duration
+	// ConfigFile is the path to the hypper configuration file.
+	ConfigFile string
+	// Profile holds the settings of the configuration file for the current
+	// kube context, once loaded with LoadConfig.
+	Profile Profile
+	// LogFormat is the format of the output: "text", or "json" for JSON
+	// lines with structured events.
+	LogFormat string
 }
 
 // New is a constructor of EnvSettings
@@ -104,6 +139,15 @@ func NewWithNamespace(ns string) *EnvSettings {
 		RepositoryConfig: envOr("HYPPER_REPOSITORY_CONFIG", hypperpath.ConfigPath("repositories.yaml")),
 		RepositoryCache:  envOr("HYPPER_REPOSITORY_CACHE", hypperpath.CachePath("repository")),
 
+		ChartCache:        envOr("HYPPER_CHART_CACHE", hypperpath.CachePath("charts")),
+		ChartCacheMaxSize: envIntOr("HYPPER_CHART_CACHE_MAX_SIZE", defaultChartCacheMaxSize),
+		PolicyFile:        envOr("HYPPER_POLICY", hypperpath.ConfigPath("policy.yaml")),
+
+		DeclinedOptionalDepsFile: envOr("HYPPER_DECLINED_OPTIONAL_DEPS", hypperpath.DataPath("declined-optional-deps.yaml")),
+		SolverTimeout:            envDurationOr("HYPPER_SOLVER_TIMEOUT", 0),
+		ConfigFile:               envOr("HYPPER_CONFIG", hypperpath.ConfigPath("config.yaml")),
+		LogFormat:                envOr("HYPPER_LOG_FORMAT", LogFormatText),
+
 		Verbose:  false,
 		NoColors: false,
 		NoEmojis: false,
@@ -159,6 +203,7 @@ func (s *EnvSettings) AddFlags(fs *pflag.FlagSet) {
 	fs.BoolVar(&s.Debug, "debug", s.Debug, "enable verbose output")
 	fs.BoolVar(&s.NoColors, "no-colors", s.NoColors, "disable colors")
 	fs.BoolVar(&s.NoEmojis, "no-emojis", s.NoEmojis, "disable emojis")
+	fs.StringVar(&s.LogFormat, "log-format", s.LogFormat, "format of the output: text, or json for JSON lines with structured events")
 
 	// imported from Helm
 	fs.StringVar(&s.KubeConfig, "kubeconfig", "", "path to the kubeconfig file")
@@ -172,7 +217,90 @@ func (s *EnvSettings) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&s.RegistryConfig, "registry-config", s.RegistryConfig, "path to the registry config file")
 	fs.StringVar(&s.RepositoryConfig, "repository-config", s.RepositoryConfig, "path to the file containing repository names and URLs")
 	fs.StringVar(&s.RepositoryCache, "repository-cache", s.RepositoryCache, "path to the file containing cached repository indexes")
+	fs.StringVar(&s.ChartCache, "chart-cache", s.ChartCache, "path to the directory containing cached charts")
+	fs.DurationVar(&s.SolverTimeout, "solver-timeout", s.SolverTimeout, "time to spend solving dependencies before taking the best solution found so far. 0 means no limit")
+
+}
+
+// LoadConfig reads the configuration file, and sets the settings of the
+// profile of the current kube context that weren't set by the flags in fs,
+// nor by env vars. It must be called once flags are parsed.
+func (s *EnvSettings) LoadConfig(fs *pflag.FlagSet) error {
+	c, err := LoadConfig(s.ConfigFile)
+	if err != nil {
+		return err
+	}
+	s.Profile = c.ProfileFor(s.CurrentKubeContext())
+
+	// flag > env > config
+	unset := func(flag, env string) bool {
+		_, isEnv := os.LookupEnv(env)
+		return !fs.Changed(flag) && !isEnv
+	}
+	if s.Profile.NoColors != nil && unset("no-colors", "HYPPER_NOCOLORS") {
+		s.NoColors = *s.Profile.NoColors
+	}
+	if s.Profile.NoEmojis != nil && unset("no-emojis", "HYPPER_NOEMOJIS") {
+		s.NoEmojis = *s.Profile.NoEmojis
+	}
+	s.solverTimeoutFromProfile = unset("solver-timeout", "HYPPER_SOLVER_TIMEOUT")
+	s.setSolverTimeoutFromProfile()
+	return nil
+}
+
+// setSolverTimeoutFromProfile sets SolverTimeout to the one of the profile,
+// or to no limit if unset there, unless it was passed.
+func (s *EnvSettings) setSolverTimeoutFromProfile() {
+	if !s.solverTimeoutFromProfile {
+		return
+	}
+	// valid, as it was validated when loading:
+	s.SolverTimeout, _ = time.ParseDuration(s.Profile.SolverTimeout)
+}
 
+// ForKubeContext returns a copy of s that targets the cluster of the kube
+// context kubeContext, from the kubeconfig file kubeConfig, or from the one of
+// s if empty. The copy has the profile of the configuration file for
+// kubeContext, and its solver timeout unless passed, but keeps the output
+// settings already taken from the profile of s.
+func (s *EnvSettings) ForKubeContext(kubeContext, kubeConfig string) *EnvSettings {
+	c := *s
+	c.KubeContext = kubeContext
+	if kubeConfig != "" {
+		c.KubeConfig = kubeConfig
+	}
+	helmSettings := *s.EnvSettings
+	c.EnvSettings = &helmSettings
+	c.FillHelmSettings()
+	c.config = &genericclioptions.ConfigFlags{
+		Namespace:        &c.namespace,
+		Context:          &c.KubeContext,
+		BearerToken:      &c.KubeToken,
+		APIServer:        &c.KubeAPIServer,
+		CAFile:           &c.KubeCaFile,
+		KubeConfig:       &c.KubeConfig,
+		Impersonate:      &c.KubeAsUser,
+		ImpersonateGroup: &c.KubeAsGroups,
+	}
+	// valid, as it was loaded for s already:
+	if config, err := LoadConfig(s.ConfigFile); err == nil {
+		c.Profile = config.ProfileFor(kubeContext)
+	}
+	c.setSolverTimeoutFromProfile()
+	return &c
+}
+
+// CurrentKubeContext returns the kube context in use: the one passed with
+// '--kube-context' or $HYPPER_KUBECONTEXT, or the current context of the
+// kubeconfig otherwise.
+func (s *EnvSettings) CurrentKubeContext() string {
+	if s.KubeContext != "" {
+		return s.KubeContext
+	}
+	if raw, err := s.config.ToRawKubeConfigLoader().RawConfig(); err == nil {
+		return raw.CurrentContext
+	}
+	return ""
 }
 
 func envOr(name, def string) string {
@@ -194,6 +322,18 @@ func envIntOr(name string, def int) int {
 	return ret
 }
 
+func envDurationOr(name string, def time.Duration) time.Duration {
+	envVal, ok := os.LookupEnv(name)
+	if !ok {
+		return def
+	}
+	ret, err := time.ParseDuration(envVal)
+	if err != nil {
+		return def
+	}
+	return ret
+}
+
 func envCSV(name string) (ls []string) {
 	trimmed := strings.Trim(os.Getenv(name), ", ")
 	if trimmed != "" {
@@ -227,9 +367,27 @@ func (s *EnvSettings) EnvVars() map[string]string {
 		"HELM_KUBECAFILE":    s.KubeCaFile,
 
 		//hypper specific
+		"HYPPER_BIN":               os.Args[0],
+		"HYPPER_DEBUG":             fmt.Sprint(s.Debug),
+		"HYPPER_NAMESPACE":         s.Namespace(),
+		"HYPPER_KUBECONTEXT":       s.KubeContext,
+		"HYPPER_PLUGINS":           s.PluginsDirectory,
+		"HYPPER_REGISTRY_CONFIG":   s.RegistryConfig,
+		"HYPPER_REPOSITORY_CACHE":  s.RepositoryCache,
+		"HYPPER_REPOSITORY_CONFIG": s.RepositoryConfig,
+
 		"HYPPER_VERBOSE":  fmt.Sprint(s.Verbose),
 		"HYPPER_NOCOLORS": fmt.Sprint(s.NoColors),
 		"HYPPER_NOEMOJIS": fmt.Sprint(s.NoEmojis),
+
+		"HYPPER_CHART_CACHE":          s.ChartCache,
+		"HYPPER_CHART_CACHE_MAX_SIZE": strconv.Itoa(s.ChartCacheMaxSize),
+		"HYPPER_POLICY":               s.PolicyFile,
+
+		"HYPPER_DECLINED_OPTIONAL_DEPS": s.DeclinedOptionalDepsFile,
+		"HYPPER_SOLVER_TIMEOUT":         s.SolverTimeout.String(),
+		"HYPPER_CONFIG":                 s.ConfigFile,
+		"HYPPER_LOG_FORMAT":             s.LogFormat,
 	}
 	if s.KubeConfig != "" {
 		envvars["KUBECONFIG"] = s.KubeConfig
@@ -23,6 +23,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/pflag"
 )
@@ -36,14 +37,15 @@ func TestEnvSettings(t *testing.T) {
 		envvars map[string]string
 
 		// expected values
-		ns, kcontext string
-		debug        bool
-		noColors     bool
-		noEmojis     bool
-		maxhistory   int
-		kAsUser      string
-		kAsGroups    []string
-		kCaFile      string
+		ns, kcontext  string
+		debug         bool
+		noColors      bool
+		noEmojis      bool
+		maxhistory    int
+		kAsUser       string
+		kAsGroups     []string
+		kCaFile       string
+		solverTimeout time.Duration
 	}{
 		{
 			debug:      false,
@@ -54,41 +56,44 @@ func TestEnvSettings(t *testing.T) {
 			maxhistory: defaultMaxHistory,
 		},
 		{
-			debug:      true,
-			noColors:   true,
-			noEmojis:   true,
-			name:       "with flags set",
-			args:       "--debug --no-colors --no-emojis --namespace=myns --kube-as-user=poro --kube-as-group=admins --kube-as-group=teatime --kube-as-group=snackeaters --kube-ca-file=/tmp/ca.crt",
-			ns:         "myns",
-			maxhistory: defaultMaxHistory,
-			kAsUser:    "poro",
-			kAsGroups:  []string{"admins", "teatime", "snackeaters"},
-			kCaFile:    "/tmp/ca.crt",
+			debug:         true,
+			noColors:      true,
+			noEmojis:      true,
+			name:          "with flags set",
+			args:          "--debug --no-colors --no-emojis --namespace=myns --kube-as-user=poro --kube-as-group=admins --kube-as-group=teatime --kube-as-group=snackeaters --kube-ca-file=/tmp/ca.crt --solver-timeout=30s",
+			ns:            "myns",
+			maxhistory:    defaultMaxHistory,
+			kAsUser:       "poro",
+			kAsGroups:     []string{"admins", "teatime", "snackeaters"},
+			kCaFile:       "/tmp/ca.crt",
+			solverTimeout: 30 * time.Second,
 		},
 		{
-			debug:      true,
-			noColors:   true,
-			noEmojis:   true,
-			name:       "with envvars set",
-			envvars:    map[string]string{"HYPPER_DEBUG": "true", "HYPPER_NOCOLORS": "true", "HYPPER_NOEMOJIS": "true", "HYPPER_NAMESPACE": "yourns", "HYPPER_KUBEASUSER": "pikachu", "HYPPER_KUBEASGROUPS": ",,,operators,snackeaters,partyanimals", "HYPPER_MAX_HISTORY": "5", "HYPPER_KUBECAFILE": "/tmp/ca.crt"},
-			ns:         "yourns",
-			maxhistory: 5,
-			kAsUser:    "pikachu",
-			kAsGroups:  []string{"operators", "snackeaters", "partyanimals"},
-			kCaFile:    "/tmp/ca.crt",
+			debug:         true,
+			noColors:      true,
+			noEmojis:      true,
+			name:          "with envvars set",
+			envvars:       map[string]string{"HYPPER_DEBUG": "true", "HYPPER_NOCOLORS": "true", "HYPPER_NOEMOJIS": "true", "HYPPER_NAMESPACE": "yourns", "HYPPER_KUBEASUSER": "pikachu", "HYPPER_KUBEASGROUPS": ",,,operators,snackeaters,partyanimals", "HYPPER_MAX_HISTORY": "5", "HYPPER_KUBECAFILE": "/tmp/ca.crt", "HYPPER_SOLVER_TIMEOUT": "1m"},
+			ns:            "yourns",
+			maxhistory:    5,
+			kAsUser:       "pikachu",
+			kAsGroups:     []string{"operators", "snackeaters", "partyanimals"},
+			kCaFile:       "/tmp/ca.crt",
+			solverTimeout: time.Minute,
 		},
 		{
-			debug:      true,
-			noColors:   true,
-			noEmojis:   true,
-			name:       "with flags and envvars set",
-			args:       "--debug --no-colors --no-emojis --namespace=myns --kube-as-user=poro --kube-as-group=admins --kube-as-group=teatime --kube-as-group=snackeaters --kube-ca-file=/my/ca.crt",
-			envvars:    map[string]string{"HYPPER_DEBUG": "true", "HYPPER_NOCOLORS": "true", "HYPPER_NOEMOJIS": "false", "HYPPER_NAMESPACE": "myns", "HYPPER_KUBEASUSER": "pikachu", "HYPPER_KUBEASGROUPS": ",,,operators,snackeaters,partyanimals", "HYPPER_MAX_HISTORY": "5", "HYPPER_KUBECAFILE": "/tmp/ca.crt"},
-			ns:         "myns",
-			maxhistory: 5,
-			kAsUser:    "poro",
-			kAsGroups:  []string{"admins", "teatime", "snackeaters"},
-			kCaFile:    "/my/ca.crt",
+			debug:         true,
+			noColors:      true,
+			noEmojis:      true,
+			name:          "with flags and envvars set",
+			args:          "--debug --no-colors --no-emojis --namespace=myns --kube-as-user=poro --kube-as-group=admins --kube-as-group=teatime --kube-as-group=snackeaters --kube-ca-file=/my/ca.crt --solver-timeout=10s",
+			envvars:       map[string]string{"HYPPER_DEBUG": "true", "HYPPER_NOCOLORS": "true", "HYPPER_NOEMOJIS": "false", "HYPPER_NAMESPACE": "myns", "HYPPER_KUBEASUSER": "pikachu", "HYPPER_KUBEASGROUPS": ",,,operators,snackeaters,partyanimals", "HYPPER_MAX_HISTORY": "5", "HYPPER_KUBECAFILE": "/tmp/ca.crt", "HYPPER_SOLVER_TIMEOUT": "1m"},
+			ns:            "myns",
+			maxhistory:    5,
+			kAsUser:       "poro",
+			kAsGroups:     []string{"admins", "teatime", "snackeaters"},
+			kCaFile:       "/my/ca.crt",
+			solverTimeout: 10 * time.Second,
 		},
 	}
 
@@ -112,6 +117,9 @@ func TestEnvSettings(t *testing.T) {
 			if settings.Debug != tt.debug {
 				t.Errorf("on test %q expected debug %t, got %t", tt.name, tt.debug, settings.Debug)
 			}
+			if settings.SolverTimeout != tt.solverTimeout {
+				t.Errorf("on test %q expected solver timeout %s, got %s", tt.name, tt.solverTimeout, settings.SolverTimeout)
+			}
 		})
 	}
 }
@@ -0,0 +1,134 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*Package cluster provides the clusters that hypper commands run on at once,
+and runs operations on them in parallel.
+
+Clusters are targeted by their kubeconfig contexts, passed as a list, or read
+from an inventory file like:
+
+	clusters:
+	  - name: eu-1
+	    kubeContext: prod-eu-1
+	  - name: us-1
+	    kubeContext: prod-us-1
+	    kubeconfig: /home/me/.kube/us.yaml
+
+The name of a cluster is its kube context if not set.
+*/
+package cluster
+
+import (
+	"io/ioutil"
+	"sync"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Cluster is a cluster targeted by a kubeconfig context.
+type Cluster struct {
+	// Name identifies the cluster in the results.
+	Name string `json:"name,omitempty"`
+	// KubeContext is the name of the kubeconfig context of the cluster.
+	KubeContext string `json:"kubeContext"`
+	// KubeConfig is the path to the kubeconfig file with the context. The
+	// kubeconfig in use is taken if empty.
+	KubeConfig string `json:"kubeconfig,omitempty"`
+}
+
+// Inventory lists clusters.
+type Inventory struct {
+	Clusters []*Cluster `json:"clusters"`
+}
+
+// LoadInventory reads the inventory in the file at path.
+func LoadInventory(path string) (*Inventory, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "couldn't load cluster inventory (%s)", path)
+	}
+	inv := &Inventory{}
+	if err := yaml.UnmarshalStrict(b, inv); err != nil {
+		return nil, errors.Wrapf(err, "cluster inventory (%s) is malformed", path)
+	}
+	for _, c := range inv.Clusters {
+		if c.KubeContext == "" {
+			return nil, errors.Errorf("cluster inventory (%s) has a cluster without kubeContext", path)
+		}
+	}
+	if err := validate(inv.Clusters); err != nil {
+		return nil, errors.Wrapf(err, "cluster inventory (%s) is invalid", path)
+	}
+	return inv, nil
+}
+
+// FromKubeContexts returns the clusters of the kubeconfig contexts, named
+// after them.
+func FromKubeContexts(contexts []string) ([]*Cluster, error) {
+	clusters := make([]*Cluster, 0, len(contexts))
+	for _, ctx := range contexts {
+		if ctx == "" {
+			return nil, errors.New("empty kube context")
+		}
+		clusters = append(clusters, &Cluster{KubeContext: ctx})
+	}
+	if err := validate(clusters); err != nil {
+		return nil, err
+	}
+	return clusters, nil
+}
+
+// validate names the clusters without name after their kube context, and
+// checks that names are unique.
+func validate(clusters []*Cluster) error {
+	names := map[string]bool{}
+	for _, c := range clusters {
+		if c.Name == "" {
+			c.Name = c.KubeContext
+		}
+		if names[c.Name] {
+			return errors.Errorf("cluster %q is listed more than once", c.Name)
+		}
+		names[c.Name] = true
+	}
+	return nil
+}
+
+// Run calls fn for each of the clusters, with its index, running at most
+// maxParallel of them at once. It returns the errors of fn in the order of
+// the clusters, nil for those that succeeded.
+func Run(clusters []*Cluster, maxParallel int, fn func(idx int, c *Cluster) error) []error {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+	errs := make([]error, len(clusters))
+	sem := make(chan struct{}, maxParallel)
+	var wg sync.WaitGroup
+	for idx, c := range clusters {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(idx int, c *Cluster) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			errs[idx] = fn(idx, c)
+		}(idx, c)
+	}
+	wg.Wait()
+	return errs
+}
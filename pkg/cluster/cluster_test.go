@@ -0,0 +1,136 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cluster
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadInventory(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		path      string
+		want      []*Cluster
+		wantError string
+	}{
+		{
+			name: "valid inventory",
+			path: "testdata/inventory.yaml",
+			want: []*Cluster{
+				{Name: "eu-1", KubeContext: "prod-eu-1"},
+				{Name: "prod-us-1", KubeContext: "prod-us-1", KubeConfig: "/tmp/us.yaml"},
+			},
+		},
+		{
+			name:      "missing inventory",
+			path:      "testdata/non-existent.yaml",
+			wantError: "couldn't load cluster inventory (testdata/non-existent.yaml)",
+		},
+		{
+			name:      "malformed inventory",
+			path:      "testdata/malformed.yaml",
+			wantError: "cluster inventory (testdata/malformed.yaml) is malformed",
+		},
+		{
+			name:      "cluster without kube context",
+			path:      "testdata/no-context.yaml",
+			wantError: "cluster inventory (testdata/no-context.yaml) has a cluster without kubeContext",
+		},
+		{
+			name:      "duplicated cluster",
+			path:      "testdata/duplicated.yaml",
+			wantError: "cluster \"prod-eu-1\" is listed more than once",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+			inv, err := LoadInventory(tcase.path)
+			if tcase.wantError != "" {
+				is.Error(err)
+				is.Contains(err.Error(), tcase.wantError)
+				return
+			}
+			is.NoError(err)
+			is.Equal(tcase.want, inv.Clusters)
+		})
+	}
+}
+
+func TestFromKubeContexts(t *testing.T) {
+	is := assert.New(t)
+
+	clusters, err := FromKubeContexts([]string{"eu-1", "us-1"})
+	is.NoError(err)
+	is.Equal([]*Cluster{{Name: "eu-1", KubeContext: "eu-1"}, {Name: "us-1", KubeContext: "us-1"}}, clusters)
+
+	_, err = FromKubeContexts([]string{"eu-1", "eu-1"})
+	is.EqualError(err, "cluster \"eu-1\" is listed more than once")
+
+	_, err = FromKubeContexts([]string{""})
+	is.Error(err)
+}
+
+func TestRun(t *testing.T) {
+	is := assert.New(t)
+
+	clusters := []*Cluster{}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("cluster-%d", i)
+		clusters = append(clusters, &Cluster{Name: name, KubeContext: name})
+	}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	release := make(chan struct{})
+	go func() {
+		for range clusters {
+			release <- struct{}{}
+		}
+	}()
+	errs := Run(clusters, 3, func(idx int, c *Cluster) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		<-release
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if idx%2 == 1 {
+			return fmt.Errorf("failed on %s", c.Name)
+		}
+		return nil
+	})
+
+	is.LessOrEqual(maxRunning, 3)
+	is.Equal(len(clusters), len(errs))
+	for idx, err := range errs {
+		if idx%2 == 1 {
+			is.EqualError(err, fmt.Sprintf("failed on cluster-%d", idx))
+		} else {
+			is.NoError(err)
+		}
+	}
+}
@@ -31,6 +31,7 @@ const strict = false
 const badChartDir = "rules/testdata/badchart"
 const badChartDirWithBrokenHypperDeps = "rules/testdata/badchartbrokenhypperdeps"
 const goodChartDir = "rules/testdata/goodchart"
+const crdChartDir = "rules/testdata/crdchart"
 
 func TestBadChart(t *testing.T) {
 	m := All(badChartDir, values, namespace, strict).Messages
@@ -111,3 +112,23 @@ func TestGoodChart(t *testing.T) {
 		}
 	}
 }
+
+func TestCRDChartNotDeclared(t *testing.T) {
+	m := All(crdChartDir, values, namespace, strict).Messages
+	if len(m) != 1 {
+		t.Errorf("Number of errors %v", len(m))
+		t.Errorf("All didn't fail with expected errors, got %#v", m)
+	}
+	// There should be 1 WARNING, check for it
+	var w1 bool
+	for _, msg := range m {
+		if msg.Severity == support.WarningSev {
+			if strings.Contains(msg.Err.Error(), "Chart only contains CRDs, setting hypper.cattle.io/crd-only: \"true\" in annotations is recommended") {
+				w1 = true
+			}
+		}
+	}
+	if !w1 {
+		t.Errorf("Didn't find all the expected errors, got %#v", m)
+	}
+}
@@ -28,7 +28,10 @@ import (
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
 	helmChart "helm.sh/helm/v3/pkg/chart"
+	"helm.sh/helm/v3/pkg/chart/loader"
 	"helm.sh/helm/v3/pkg/chartutil"
+
+	"github.com/rancher-sandbox/hypper/pkg/chart"
 	"helm.sh/helm/v3/pkg/lint/support"
 )
 
@@ -49,6 +52,11 @@ func Annotations(linter *support.Linter) {
 	if _, ok := chartFile.Annotations["hypper.cattle.io/optional-dependencies"]; ok {
 		linter.RunLinterRule(support.ErrorSev, chartFileName, validateChartHypperOptionalSharedDepsCorrect(chartFile))
 	}
+	// Charts only containing CRDs are never removed by hypper, so they should
+	// declare it for the charts in repositories to be known as such
+	if c, err := loader.Load(linter.ChartDir); err == nil {
+		linter.RunLinterRule(support.WarningSev, chartFileName, validateChartHypperCRDOnly(c))
+	}
 }
 
 // validateChartHypperRelease checks that hypper release-name annotation is set
@@ -83,6 +91,22 @@ func validateChartHypperOptionalSharedDeps(chart *helmChart.Metadata) error {
 	return nil
 }
 
+// validateChartHypperCRDOnly checks that the crd-only hypper annotation is
+// correct, and set if the chart only contains CRDs
+func validateChartHypperCRDOnly(c *helmChart.Chart) error {
+	val, ok := c.Metadata.Annotations["hypper.cattle.io/crd-only"]
+	if !ok {
+		if chart.ContainsOnlyCRDs(c) {
+			return errors.New("Chart only contains CRDs, setting hypper.cattle.io/crd-only: \"true\" in annotations is recommended")
+		}
+		return nil
+	}
+	if val != "true" && val != "false" {
+		return errors.Errorf("hypper.cattle.io/crd-only must be \"true\" or \"false\", got %q", val)
+	}
+	return nil
+}
+
 // validateChartHypperSharedDepsCorrect checks that shared deps are in the correct format
 func validateChartHypperSharedDepsCorrect(chart *helmChart.Metadata) error {
 	depYaml := chart.Annotations["hypper.cattle.io/shared-dependencies"]
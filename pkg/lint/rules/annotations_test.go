@@ -125,3 +125,37 @@ func TestValidateChartHypperOptionalSharedDepsCorrect(t *testing.T) {
 	}
 
 }
+
+func TestValidateChartHypperCRDOnly(t *testing.T) {
+	crd := &chart.File{
+		Name: "crds/foos.yaml",
+		Data: []byte("apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\n"),
+	}
+
+	chartGood := &chart.Chart{
+		Metadata: &chart.Metadata{Annotations: map[string]string{"hypper.cattle.io/crd-only": "true"}},
+		Files:    []*chart.File{crd},
+	}
+	err := validateChartHypperCRDOnly(chartGood)
+	if err != nil {
+		t.Errorf("validateChartHypperCRDOnly to not return a linter error, got %v", err)
+	}
+
+	chartNotDeclared := &chart.Chart{
+		Metadata: &chart.Metadata{Annotations: map[string]string{}},
+		Files:    []*chart.File{crd},
+	}
+	err = validateChartHypperCRDOnly(chartNotDeclared)
+	if err == nil {
+		t.Errorf("validateChartHypperCRDOnly to return a linter warning, got no warning")
+	}
+
+	chartBadValue := &chart.Chart{
+		Metadata: &chart.Metadata{Annotations: map[string]string{"hypper.cattle.io/crd-only": "yes"}},
+		Files:    []*chart.File{crd},
+	}
+	err = validateChartHypperCRDOnly(chartBadValue)
+	if err == nil {
+		t.Errorf("validateChartHypperCRDOnly to return a linter error, got no error")
+	}
+}
@@ -0,0 +1,285 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*Package logjson provides a log.Logger that writes JSON lines, and the
+structured events of hypper operations.
+
+Every log message is written as a JSON object in its own line:
+
+	{"level":"info","msg":"Update Complete.","time":"2021-09-01T10:00:00Z"}
+
+Events are written the same way, with the name of the event instead of a
+message, and the fields describing it:
+
+	{"chart":"foo","event":"install-started","level":"info","namespace":"bar",...}
+
+Events are only written by loggers that implement EventLogger, such as Logger.
+Other loggers ignore them, as their messages already describe the operation.
+*/
+package logjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/log-go"
+)
+
+// The events of hypper operations.
+const (
+	// SolveStarted is emitted before solving.
+	SolveStarted = "solve-started"
+	// SolveFinished is emitted after solving, with the result "sat", "unsat",
+	// or "unknown" if the solver timed out, and the inconsistencies if not sat.
+	SolveFinished = "solve-finished"
+	// InstallStarted is emitted before installing a package.
+	InstallStarted = "install-started"
+	// InstallFinished is emitted after installing a package.
+	InstallFinished = "install-finished"
+	// InstallFailed is emitted when installing a package fails.
+	InstallFailed = "install-failed"
+	// InstallSkipped is emitted for the dependencies that aren't installed,
+	// because of '--no-shared-deps'.
+	InstallSkipped = "install-skipped"
+	// RepoAdded is emitted when a repository is added.
+	RepoAdded = "repo-added"
+	// RepoRemoved is emitted when a repository is removed.
+	RepoRemoved = "repo-removed"
+	// RepoUpdated is emitted when the index of a repository is updated.
+	RepoUpdated = "repo-updated"
+	// RepoUpdateFailed is emitted when the index of a repository can't be
+	// updated.
+	RepoUpdateFailed = "repo-update-failed"
+	// RepoChecked is emitted after checking a repository.
+	RepoChecked = "repo-checked"
+)
+
+// errorEvents are the events written at the error level.
+var errorEvents = map[string]bool{
+	InstallFailed:    true,
+	RepoUpdateFailed: true,
+}
+
+// EventLogger is a logger that writes structured events.
+type EventLogger interface {
+	Event(name string, fields log.Fields)
+}
+
+// Event writes the event name with fields to logger, if it is an EventLogger.
+// Otherwise, it does nothing.
+func Event(logger log.Logger, name string, fields log.Fields) {
+	if l, ok := logger.(EventLogger); ok {
+		l.Event(name, fields)
+	}
+}
+
+// Logger is a log.Logger that writes every message as a JSON line to Out.
+type Logger struct {
+	// Out is where the JSON lines are written.
+	Out io.Writer
+	// Level sets the current logging level.
+	Level int
+	// Fields are written in every line, e.g: the cluster of the operation.
+	Fields log.Fields
+
+	mu *sync.Mutex
+}
+
+// New creates a Logger that writes to out at the info level.
+func New(out io.Writer) *Logger {
+	return &Logger{
+		Out:   out,
+		Level: log.InfoLevel,
+		mu:    &sync.Mutex{},
+	}
+}
+
+// Event writes the event name with fields, at the info level, or at the
+// error level for the events of failures.
+func (l Logger) Event(name string, fields log.Fields) {
+	level := log.InfoLevel
+	if errorEvents[name] {
+		level = log.ErrorLevel
+	}
+	if l.Level <= level {
+		l.write(levelNames[level], "event", name, fields)
+	}
+}
+
+// Trace logs a message at the Trace level
+func (l Logger) Trace(msg ...interface{}) { l.log(log.TraceLevel, fmt.Sprint(msg...), nil) }
+
+// Tracef formats a message according to a format specifier and logs the
+// message at the Trace level
+func (l Logger) Tracef(template string, args ...interface{}) {
+	l.log(log.TraceLevel, fmt.Sprintf(template, args...), nil)
+}
+
+// Tracew logs a message at the Trace level along with some additional
+// context (key-value pairs)
+func (l Logger) Tracew(msg string, fields log.Fields) { l.log(log.TraceLevel, msg, fields) }
+
+// Debug logs a message at the Debug level
+func (l Logger) Debug(msg ...interface{}) { l.log(log.DebugLevel, fmt.Sprint(msg...), nil) }
+
+// Debugf formats a message according to a format specifier and logs the
+// message at the Debug level
+func (l Logger) Debugf(template string, args ...interface{}) {
+	l.log(log.DebugLevel, fmt.Sprintf(template, args...), nil)
+}
+
+// Debugw logs a message at the Debug level along with some additional
+// context (key-value pairs)
+func (l Logger) Debugw(msg string, fields log.Fields) { l.log(log.DebugLevel, msg, fields) }
+
+// Info logs a message at the Info level
+func (l Logger) Info(msg ...interface{}) { l.log(log.InfoLevel, fmt.Sprint(msg...), nil) }
+
+// Infof formats a message according to a format specifier and logs the
+// message at the Info level
+func (l Logger) Infof(template string, args ...interface{}) {
+	l.log(log.InfoLevel, fmt.Sprintf(template, args...), nil)
+}
+
+// Infow logs a message at the Info level along with some additional
+// context (key-value pairs)
+func (l Logger) Infow(msg string, fields log.Fields) { l.log(log.InfoLevel, msg, fields) }
+
+// Warn logs a message at the Warn level
+func (l Logger) Warn(msg ...interface{}) { l.log(log.WarnLevel, fmt.Sprint(msg...), nil) }
+
+// Warnf formats a message according to a format specifier and logs the
+// message at the Warning level
+func (l Logger) Warnf(template string, args ...interface{}) {
+	l.log(log.WarnLevel, fmt.Sprintf(template, args...), nil)
+}
+
+// Warnw logs a message at the Warning level along with some additional
+// context (key-value pairs)
+func (l Logger) Warnw(msg string, fields log.Fields) { l.log(log.WarnLevel, msg, fields) }
+
+// Error logs a message at the Error level
+func (l Logger) Error(msg ...interface{}) { l.log(log.ErrorLevel, fmt.Sprint(msg...), nil) }
+
+// Errorf formats a message according to a format specifier and logs the
+// message at the Error level
+func (l Logger) Errorf(template string, args ...interface{}) {
+	l.log(log.ErrorLevel, fmt.Sprintf(template, args...), nil)
+}
+
+// Errorw logs a message at the Error level along with some additional
+// context (key-value pairs)
+func (l Logger) Errorw(msg string, fields log.Fields) { l.log(log.ErrorLevel, msg, fields) }
+
+// Panic logs a message at the Panic level and panics
+func (l Logger) Panic(msg ...interface{}) {
+	s := fmt.Sprint(msg...)
+	l.log(log.PanicLevel, s, nil)
+	panic(s)
+}
+
+// Panicf formats a message according to a format specifier and logs the
+// message at the Panic level and then panics
+func (l Logger) Panicf(template string, args ...interface{}) {
+	s := fmt.Sprintf(template, args...)
+	l.log(log.PanicLevel, s, nil)
+	panic(s)
+}
+
+// Panicw logs a message at the Panic level along with some additional
+// context (key-value pairs) and then panics
+func (l Logger) Panicw(msg string, fields log.Fields) {
+	l.log(log.PanicLevel, msg, fields)
+	panic(msg)
+}
+
+// Fatal logs a message at the Fatal level and exits the application
+func (l Logger) Fatal(msg ...interface{}) {
+	l.log(log.FatalLevel, fmt.Sprint(msg...), nil)
+	os.Exit(1)
+}
+
+// Fatalf formats a message according to a format specifier and logs the
+// message at the Fatal level and exits the application
+func (l Logger) Fatalf(template string, args ...interface{}) {
+	l.log(log.FatalLevel, fmt.Sprintf(template, args...), nil)
+	os.Exit(1)
+}
+
+// Fatalw logs a message at the Fatal level along with some additional
+// context (key-value pairs) and exits the application
+func (l Logger) Fatalw(msg string, fields log.Fields) {
+	l.log(log.FatalLevel, msg, fields)
+	os.Exit(1)
+}
+
+var levelNames = map[int]string{
+	log.TraceLevel: "trace",
+	log.DebugLevel: "debug",
+	log.InfoLevel:  "info",
+	log.WarnLevel:  "warning",
+	log.ErrorLevel: "error",
+	log.PanicLevel: "panic",
+	log.FatalLevel: "fatal",
+}
+
+func (l Logger) log(level int, msg string, fields log.Fields) {
+	if l.Level > level {
+		return
+	}
+	msg = strings.TrimSpace(msg)
+	if msg == "" && len(fields) == 0 {
+		return
+	}
+	l.write(levelNames[level], "msg", msg, fields)
+}
+
+// write writes a JSON line with fields, and the level, time, and key set to
+// value.
+func (l Logger) write(level, key, value string, fields log.Fields) {
+	entry := make(map[string]interface{}, len(l.Fields)+len(fields)+3)
+	for k, v := range l.Fields {
+		entry[k] = v
+	}
+	for k, v := range fields {
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		entry[k] = v
+	}
+	entry[key] = value
+	entry["level"] = level
+	entry["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	b, err := json.Marshal(entry)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			key:     value,
+			"level": level,
+			"error": err.Error(),
+		})
+	}
+	if l.mu != nil {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+	}
+	fmt.Fprintln(l.Out, string(b))
+}
@@ -0,0 +1,117 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package logjson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/log-go"
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/stretchr/testify/assert"
+)
+
+// decode returns the JSON lines in out, without their time.
+func decode(t *testing.T, out string) []map[string]interface{} {
+	t.Helper()
+	entries := []map[string]interface{}{}
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("line %q is not JSON: %s", line, err)
+		}
+		if _, ok := entry["time"]; !ok {
+			t.Errorf("line %q has no time", line)
+		}
+		delete(entry, "time")
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestLogger(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out)
+
+	l.Debug("not logged")
+	l.Infof("Installing chart %q…\n", "foo")
+	l.Warnw("deprecated", log.Fields{"chart": "foo"})
+	l.Error(errors.New("failed"))
+	l.Info("")
+
+	assert.Equal(t, []map[string]interface{}{
+		{"level": "info", "msg": "Installing chart \"foo\"…"},
+		{"level": "warning", "msg": "deprecated", "chart": "foo"},
+		{"level": "error", "msg": "failed"},
+	}, decode(t, out.String()))
+
+	out.Reset()
+	l.Level = log.DebugLevel
+	l.Debug("logged")
+	assert.Equal(t, []map[string]interface{}{
+		{"level": "debug", "msg": "logged"},
+	}, decode(t, out.String()))
+}
+
+func TestEvent(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out)
+
+	Event(l, InstallStarted, log.Fields{"release": "foo", "dryRun": false})
+	Event(l, InstallFailed, log.Fields{"release": "foo", "error": errors.New("boom")})
+
+	assert.Equal(t, []map[string]interface{}{
+		{"level": "info", "event": "install-started", "release": "foo", "dryRun": false},
+		{"level": "error", "event": "install-failed", "release": "foo", "error": "boom"},
+	}, decode(t, out.String()))
+
+	out.Reset()
+	l.Level = log.WarnLevel
+	Event(l, InstallStarted, log.Fields{"release": "foo"})
+	assert.Empty(t, out.String())
+}
+
+func TestLoggerFields(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out)
+	l.Fields = log.Fields{"cluster": "eu-1"}
+
+	l.Info("Done!")
+	Event(l, InstallStarted, log.Fields{"release": "foo"})
+
+	assert.Equal(t, []map[string]interface{}{
+		{"level": "info", "msg": "Done!", "cluster": "eu-1"},
+		{"level": "info", "event": "install-started", "release": "foo", "cluster": "eu-1"},
+	}, decode(t, out.String()))
+}
+
+func TestEventIgnoredByOtherLoggers(t *testing.T) {
+	var out bytes.Buffer
+	l := logcli.NewStandard()
+	l.InfoOut = &out
+	l.ErrorOut = &out
+
+	Event(l, InstallStarted, log.Fields{"release": "foo"})
+	Event(nil, InstallStarted, log.Fields{"release": "foo"})
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,143 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*Package plugin runs the hooks that plugins register for hypper events.
+
+Plugins use the plugin.yaml format of Helm plugins. Besides the install,
+update and delete hooks of Helm, they can register hooks for the events of
+hypper operations:
+
+	hooks:
+	  pre-solve: "$HYPPER_PLUGIN_DIR/check-request.sh"
+	  post-solve: "$HYPPER_PLUGIN_DIR/check-solution.sh"
+	  pre-install-package: "$HYPPER_PLUGIN_DIR/check-package.sh"
+	  post-install-package: "$HYPPER_PLUGIN_DIR/notify.sh"
+
+Hooks are run with `sh -c`, with the environment of plugins, and get the JSON
+of the event on stdin. A hook that exits non-zero aborts the operation.
+*/
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+
+	"github.com/Masterminds/log-go"
+	logio "github.com/Masterminds/log-go/io"
+	"github.com/pkg/errors"
+
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+	"helm.sh/helm/v3/pkg/plugin"
+)
+
+const (
+	// PreSolve is the event before solving. Hooks get the requested package,
+	// if any.
+	PreSolve = "pre-solve"
+	// PostSolve is the event after solving. Hooks get the PkgResultSet of the
+	// solver, either satisfiable or not.
+	PostSolve = "post-solve"
+	// PreInstallPackage is the event before installing each package. Hooks get
+	// the package.
+	PreInstallPackage = "pre-install-package"
+	// PostInstallPackage is the event after installing each package. Hooks get
+	// the package.
+	PostInstallPackage = "post-install-package"
+)
+
+// Env returns the environment variables for running the plugin called name,
+// installed in dir: the hypper and helm env vars, and the ones describing the
+// plugin.
+//
+// Plugins written for Helm read HELM_PLUGIN_NAME and HELM_PLUGIN_DIR, while
+// HYPPER_PLUGIN_NAME and HYPPER_PLUGIN_DIR are set for hypper plugins.
+func Env(settings *cli.EnvSettings, name, dir string) map[string]string {
+	env := settings.EnvVars()
+	env["HELM_PLUGIN_NAME"] = name
+	env["HELM_PLUGIN_DIR"] = dir
+	env["HYPPER_PLUGIN_NAME"] = name
+	env["HYPPER_PLUGIN_DIR"] = dir
+	return env
+}
+
+// RunHooks runs the hooks for event of the plugins in the plugins directory,
+// in the order of the plugin names. Hooks get input encoded as JSON on stdin,
+// and env in addition to the environment of plugins.
+//
+// It stops at the first hook that fails, and returns its error. Nothing is run
+// if $HYPPER_NO_PLUGINS is set to 1.
+func RunHooks(event string, input interface{}, env map[string]string,
+	settings *cli.EnvSettings, logger log.Logger) error {
+
+	if os.Getenv("HYPPER_NO_PLUGINS") == "1" {
+		return nil
+	}
+	plugins, err := plugin.FindPlugins(settings.PluginsDirectory)
+	if err != nil {
+		return errors.Wrap(err, "failed to load plugins")
+	}
+	sort.SliceStable(plugins, func(i, j int) bool {
+		return plugins[i].Metadata.Name < plugins[j].Metadata.Name
+	})
+
+	var stdin []byte
+	for _, p := range plugins {
+		hook := p.Metadata.Hooks[event]
+		if hook == "" {
+			continue
+		}
+		if stdin == nil {
+			if stdin, err = json.Marshal(input); err != nil {
+				return err
+			}
+		}
+
+		logger.Debugf("running %s hook of plugin %q: %s", event, p.Metadata.Name, hook)
+		if err := runHook(p, event, hook, stdin, env, settings, logger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runHook(p *plugin.Plugin, event, hook string, stdin []byte, env map[string]string,
+	settings *cli.EnvSettings, logger log.Logger) error {
+
+	prog := exec.Command("sh", "-c", hook)
+	prog.Env = os.Environ()
+	for k, v := range Env(settings, p.Metadata.Name, p.Dir) {
+		prog.Env = append(prog.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	prog.Env = append(prog.Env, fmt.Sprintf("HYPPER_HOOK_EVENT=%s", event))
+	for k, v := range env {
+		prog.Env = append(prog.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+	prog.Stdin = bytes.NewReader(stdin)
+	prog.Stdout = logio.NewWriter(logger, log.InfoLevel)
+	prog.Stderr = logio.NewWriter(logger, log.ErrorLevel)
+
+	if err := prog.Run(); err != nil {
+		if _, ok := err.(*exec.ExitError); ok {
+			return errors.Errorf("plugin %q %s hook exited with error: %s", p.Metadata.Name, event, err)
+		}
+		return err
+	}
+	return nil
+}
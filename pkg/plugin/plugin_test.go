@@ -0,0 +1,94 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package plugin
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	logcli "github.com/Masterminds/log-go/impl/cli"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/rancher-sandbox/hypper/pkg/cli"
+)
+
+func TestRunHooks(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		event     string
+		noPlugins bool
+		want      string
+		wantError string
+	}{
+		{
+			name:  "hook gets the input and env",
+			event: PostSolve,
+			want:  "post-solve echo bar {\"Status\":\"SAT\"}\n",
+		},
+		{
+			name:      "failing hook",
+			event:     PreSolve,
+			wantError: "plugin \"fail\" pre-solve hook exited with error: exit status 3",
+		},
+		{
+			name:  "no hooks for the event",
+			event: PostInstallPackage,
+		},
+		{
+			name:      "plugins disabled",
+			event:     PreSolve,
+			noPlugins: true,
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+			if tcase.noPlugins {
+				os.Setenv("HYPPER_NO_PLUGINS", "1")
+				defer os.Unsetenv("HYPPER_NO_PLUGINS")
+			}
+			settings := cli.New()
+			settings.PluginsDirectory = "testdata/plugins"
+
+			var out bytes.Buffer
+			logger := logcli.NewStandard()
+			logger.InfoOut = &out
+
+			input := struct{ Status string }{"SAT"}
+			err := RunHooks(tcase.event, input, map[string]string{"FOO": "bar"}, settings, logger)
+			if tcase.wantError != "" {
+				is.EqualError(err, tcase.wantError)
+			} else {
+				is.NoError(err)
+			}
+			is.Equal(tcase.want, out.String())
+		})
+	}
+}
+
+func TestEnv(t *testing.T) {
+	is := assert.New(t)
+	settings := cli.New()
+	settings.PluginsDirectory = "testdata/plugins"
+
+	env := Env(settings, "echo", "testdata/plugins/echo")
+	is.Equal("echo", env["HELM_PLUGIN_NAME"])
+	is.Equal("echo", env["HYPPER_PLUGIN_NAME"])
+	is.Equal("testdata/plugins/echo", env["HELM_PLUGIN_DIR"])
+	is.Equal("testdata/plugins/echo", env["HYPPER_PLUGIN_DIR"])
+	is.Equal("testdata/plugins", env["HYPPER_PLUGINS"])
+}
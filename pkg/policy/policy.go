@@ -0,0 +1,147 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*Package policy implements the allow and deny rules that charts must comply
+with to be considered by the solver.
+
+The policy is read from a YAML file like:
+
+	allowedRepositories:
+	  - https://charts.example.com/stable
+	deniedCharts:
+	  - name: foo
+	    version: "<1.2.0"
+	  - name: bar
+	requiredAnnotations:
+	  - hypper.cattle.io/namespace
+
+An empty or missing policy allows everything.
+*/
+package policy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+// Policy describes which charts are allowed.
+type Policy struct {
+	// AllowedRepositories are the URLs of the repositories that charts can
+	// come from. If empty, all repositories are allowed. Local `file://`
+	// charts are always allowed.
+	AllowedRepositories []string `json:"allowedRepositories,omitempty"`
+	// DeniedCharts are the charts, or ranges of versions of charts, that
+	// are denied.
+	DeniedCharts []*DeniedChart `json:"deniedCharts,omitempty"`
+	// RequiredAnnotations are the annotations that all charts must have.
+	RequiredAnnotations []string `json:"requiredAnnotations,omitempty"`
+}
+
+// DeniedChart describes a denied chart.
+type DeniedChart struct {
+	// Name is the name of the chart.
+	Name string `json:"name"`
+	// Version is the semver range of denied versions. If empty, all versions
+	// are denied.
+	Version string `json:"version,omitempty"`
+
+	constraint *semver.Constraints
+}
+
+// Load reads the policy from the file at path. A missing file is an empty
+// policy.
+func Load(path string) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &Policy{}, nil
+		}
+		return nil, errors.Wrapf(err, "couldn't load policy file (%s)", path)
+	}
+	p := &Policy{}
+	if err := yaml.UnmarshalStrict(b, p); err != nil {
+		return nil, errors.Wrapf(err, "policy file (%s) is malformed", path)
+	}
+	for _, dc := range p.DeniedCharts {
+		if dc.Name == "" {
+			return nil, errors.Errorf("policy file (%s) has a denied chart without name", path)
+		}
+		if dc.Version == "" {
+			continue
+		}
+		if dc.constraint, err = semver.NewConstraint(dc.Version); err != nil {
+			return nil, errors.Wrapf(err, "policy file (%s) has an invalid version range for denied chart %q", path, dc.Name)
+		}
+	}
+	return p, nil
+}
+
+// Check returns why the chart version from repoURL, with the passed
+// annotations, is denied by the policy. It returns an empty string if it is
+// allowed.
+func (p *Policy) Check(repoURL, chartName, version string, annotations map[string]string) string {
+	if p == nil {
+		return ""
+	}
+	if reason := p.checkRepository(repoURL); reason != "" {
+		return deniedMsg(chartName, version, reason)
+	}
+	for _, dc := range p.DeniedCharts {
+		if dc.Name != chartName {
+			continue
+		}
+		if dc.constraint == nil {
+			return deniedMsg(chartName, version, "chart is denied")
+		}
+		v, err := semver.NewVersion(version)
+		if err != nil || dc.constraint.Check(v) {
+			return deniedMsg(chartName, version, fmt.Sprintf("versions %q are denied", dc.Version))
+		}
+	}
+	for _, annot := range p.RequiredAnnotations {
+		if _, ok := annotations[annot]; !ok {
+			return deniedMsg(chartName, version, fmt.Sprintf("missing required annotation %q", annot))
+		}
+	}
+	return ""
+}
+
+func (p *Policy) checkRepository(repoURL string) string {
+	if len(p.AllowedRepositories) == 0 || repoURL == "" {
+		return ""
+	}
+	if u, err := url.Parse(repoURL); err == nil && (u.Scheme == "" || u.Scheme == "file") {
+		// local chart
+		return ""
+	}
+	for _, allowed := range p.AllowedRepositories {
+		if strings.TrimSuffix(allowed, "/") == strings.TrimSuffix(repoURL, "/") {
+			return ""
+		}
+	}
+	return fmt.Sprintf("repository %q is not allowed", repoURL)
+}
+
+func deniedMsg(chartName, version, reason string) string {
+	return fmt.Sprintf("Chart %q version %q is denied by policy: %s", chartName, version, reason)
+}
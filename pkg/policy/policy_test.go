@@ -0,0 +1,137 @@
+/*
+Copyright SUSE LLC.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	for _, tcase := range []struct {
+		name      string
+		path      string
+		wantError string
+	}{
+		{
+			name: "valid policy",
+			path: "testdata/policy.yaml",
+		},
+		{
+			name: "missing policy",
+			path: "testdata/non-existent.yaml",
+		},
+		{
+			name:      "malformed policy",
+			path:      "testdata/malformed.yaml",
+			wantError: "policy file (testdata/malformed.yaml) is malformed",
+		},
+		{
+			name:      "invalid version range",
+			path:      "testdata/invalid-range.yaml",
+			wantError: "policy file (testdata/invalid-range.yaml) has an invalid version range for denied chart \"foo\"",
+		},
+		{
+			name:      "denied chart without name",
+			path:      "testdata/no-name.yaml",
+			wantError: "policy file (testdata/no-name.yaml) has a denied chart without name",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			is := assert.New(t)
+			p, err := Load(tcase.path)
+			if tcase.wantError != "" {
+				is.Error(err)
+				is.Contains(err.Error(), tcase.wantError)
+				return
+			}
+			is.NoError(err)
+			is.NotNil(p)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	p, err := Load("testdata/policy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	annot := map[string]string{"hypper.cattle.io/namespace": "ns"}
+
+	for _, tcase := range []struct {
+		name        string
+		repo        string
+		chart       string
+		version     string
+		annotations map[string]string
+		want        string
+	}{
+		{
+			name:        "allowed",
+			repo:        "https://charts.example.com/stable",
+			chart:       "foo",
+			version:     "1.2.0",
+			annotations: annot,
+		},
+		{
+			name:        "local charts are allowed from any path",
+			repo:        "file://../foo",
+			chart:       "foo",
+			version:     "1.2.0",
+			annotations: annot,
+		},
+		{
+			name:        "repository not allowed",
+			repo:        "https://charts.example.com/incubator",
+			chart:       "foo",
+			version:     "1.2.0",
+			annotations: annot,
+			want:        "Chart \"foo\" version \"1.2.0\" is denied by policy: repository \"https://charts.example.com/incubator\" is not allowed",
+		},
+		{
+			name:        "version range denied",
+			repo:        "https://charts.example.com/stable",
+			chart:       "foo",
+			version:     "1.1.9",
+			annotations: annot,
+			want:        "Chart \"foo\" version \"1.1.9\" is denied by policy: versions \"<1.2.0\" are denied",
+		},
+		{
+			name:        "all versions denied",
+			repo:        "https://charts.example.com/stable",
+			chart:       "bar",
+			version:     "3.0.0",
+			annotations: annot,
+			want:        "Chart \"bar\" version \"3.0.0\" is denied by policy: chart is denied",
+		},
+		{
+			name:    "missing required annotation",
+			repo:    "https://charts.example.com/stable",
+			chart:   "foo",
+			version: "1.2.0",
+			want:    "Chart \"foo\" version \"1.2.0\" is denied by policy: missing required annotation \"hypper.cattle.io/namespace\"",
+		},
+	} {
+		t.Run(tcase.name, func(t *testing.T) {
+			assert.Equal(t, tcase.want, p.Check(tcase.repo, tcase.chart, tcase.version, tcase.annotations))
+		})
+	}
+
+	// an empty policy allows everything:
+	assert.Equal(t, "", (&Policy{}).Check("https://foo", "bar", "1.0.0", nil))
+}